@@ -1,21 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
-	"os/signal"
 	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	swagger "github.com/arsmn/fiber-swagger/v2"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cache"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/etag"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/pprof"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
@@ -23,20 +23,110 @@ import (
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 	_ "github.com/sizzlorox/go-service-boilerplate/internal/docs"
+	"github.com/valyala/fasthttp/reuseport"
 
+	"github.com/sizzlorox/go-service-boilerplate/internal/auth"
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
 	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
-	"github.com/sizzlorox/go-service-boilerplate/internal/v1/router"
+	"github.com/sizzlorox/go-service-boilerplate/internal/gql"
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/idempotency"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/lifecycle"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resource"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resources"
+	"github.com/sizzlorox/go-service-boilerplate/internal/router"
+	"github.com/sizzlorox/go-service-boilerplate/internal/rpc"
+	"github.com/sizzlorox/go-service-boilerplate/internal/scheduler"
+	"github.com/sizzlorox/go-service-boilerplate/internal/telemetry"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
 )
 
 type Config struct {
 	SERVICE_ENV  string
 	SERVICE_NAME string
 	SERVICE_PORT int
+	DB_DRIVER    string
 	DB_URI       string
 	DB_PWD       string
-	LOGGING      bool
+	// gRPC API port, zero leaves it disabled
+	GRPC_PORT int
+	// Mongo connection, unset options keep the ones in DB_URI
+	DB_MIN_POOL_SIZE            uint64
+	DB_MAX_POOL_SIZE            uint64
+	DB_SERVER_SELECTION_TIMEOUT time.Duration
+	DB_READ_CONCERN             string
+	DB_WRITE_CONCERN            string
+	DB_READ_PREFERENCE          string
+	DB_TLS                      bool
+	DB_TLS_CA_FILE              string
+	DB_TLS_CERT_KEY_FILE        string
+	DB_CONNECT_RETRIES          int
+	// Retries of transient datastore failures, and the circuit breaker failing fast after them
+	DB_RETRIES           int
+	DB_RETRY_BACKOFF     time.Duration
+	DB_BREAKER_THRESHOLD int
+	DB_BREAKER_TIMEOUT   time.Duration
+
+	LOGGING bool
+	PREFORK bool
+	// Datastore cache, TTLs override the TTL per collection, e.g. audit=0,models=30s
 	CACHE        bool
-	PREFORK      bool
+	CACHE_DRIVER string
+	CACHE_URI    string
+	CACHE_SIZE   int
+	CACHE_TTL    time.Duration
+	CACHE_TTLS   map[string]time.Duration
+	// Responses replayed to retries sending the same Idempotency-Key, kept in the cache when enabled
+	IDEMPOTENCY_TTL time.Duration
+	// Requests are validated against the OpenAPI spec, and responses too outside production
+	OPENAPI_VALIDATION bool
+	// Background jobs, workers retry failed jobs after the backoff which doubles on each attempt
+	JOBS_WORKERS       int
+	JOBS_POLL_INTERVAL time.Duration
+	JOBS_LEASE         time.Duration
+	JOBS_MAX_ATTEMPTS  int
+	JOBS_BACKOFF       time.Duration
+	// Model imports larger than the sync rows run as background jobs
+	IMPORT_BATCH_SIZE int
+	IMPORT_SYNC_ROWS  int
+	// GraphQL operations beyond these limits are rejected, list fields count once per item
+	GRAPHQL_MAX_COMPLEXITY int
+	GRAPHQL_MAX_DEPTH      int
+	// Scheduled tasks, a run holds a lease lock so it happens in a single process
+	SCHEDULER_POLL_INTERVAL time.Duration
+	SCHEDULER_LEASE         time.Duration
+	// Shutdown, readiness fails for the drain delay before in-flight requests get the grace period
+	SHUTDOWN_DRAIN_DELAY  time.Duration
+	SHUTDOWN_GRACE_PERIOD time.Duration
+	SHUTDOWN_TIMEOUT      time.Duration
+	// Deprecation and sunset dates announced on v1 responses, RFC 3339
+	API_V1_DEPRECATED_AT time.Time
+	API_V1_SUNSET        time.Time
+	// Admin API, only mounted when both are set
+	ADMIN_USER string
+	ADMIN_PWD  string
+	// Logging
+	LOG_LEVEL       string
+	LOG_FORMAT      string
+	LOG_SAMPLE_RATE float64
+	// Tracing
+	TRACING_EXPORTER string
+	TRACING_ENDPOINT string
+	// Tenants, TENANCY_MODE is filter or database and empty serves a single tenant. Sources are
+	// any of header, subdomain and claim, claims are read from HS256 tokens signed with the secret.
+	// TENANCY_TENANTS lists the accepted tenants, it is required in database mode
+	TENANCY_MODE       string
+	TENANCY_SOURCES    []string
+	TENANCY_HEADER     string
+	TENANCY_DOMAIN     string
+	TENANCY_CLAIM      string
+	TENANCY_JWT_SECRET string
+	TENANCY_TENANTS    []string
 }
 
 var config Config
@@ -46,7 +136,8 @@ var config Config
 // @description This is a go service boilerplate
 // @termsOfService http://swagger.io/terms/
 // @host localhost:8080
-// @BasePath /
+// @BasePath /api
+// @securityDefinitions.basic BasicAuth
 func main() {
 	ENV := os.Getenv("SERVICE_ENV")
 
@@ -81,63 +172,529 @@ func main() {
 	if err != nil {
 		log.Panic(err)
 	}
+	cacheSize := 0
+	if v := os.Getenv("CACHE_SIZE"); len(v) != 0 {
+		cacheSize, err = strconv.Atoi(v)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	cacheTTL := 1 * time.Minute
+	if v := os.Getenv("CACHE_TTL"); len(v) != 0 {
+		cacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	cacheTTLs, err := parseTTLs(os.Getenv("CACHE_TTLS"))
+	if err != nil {
+		log.Panic(err)
+	}
+	var v1DeprecatedAt time.Time
+	if v := os.Getenv("API_V1_DEPRECATED_AT"); len(v) != 0 {
+		v1DeprecatedAt, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	var v1Sunset time.Time
+	if v := os.Getenv("API_V1_SUNSET"); len(v) != 0 {
+		v1Sunset, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	logSampleRate := 1.0
+	if v := os.Getenv("LOG_SAMPLE_RATE"); len(v) != 0 {
+		logSampleRate, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	dbTLS := false
+	if v := os.Getenv("DB_TLS"); len(v) != 0 {
+		dbTLS, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+	openAPIValidation := false
+	if v := os.Getenv("OPENAPI_VALIDATION"); len(v) != 0 {
+		openAPIValidation, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
 
 	config = Config{
 		SERVICE_ENV:  os.Getenv("SERVICE_ENV"),
 		SERVICE_NAME: os.Getenv("SERVICE_NAME"),
 		SERVICE_PORT: port,
+		GRPC_PORT:    envInt("GRPC_PORT", 0),
+		DB_DRIVER:    os.Getenv("DB_DRIVER"),
 		DB_URI:       os.Getenv("DB_URI"),
 		DB_PWD:       os.Getenv("DB_PWD"),
-		LOGGING:      logEnabled,
+
+		DB_MIN_POOL_SIZE:            uint64(envInt("DB_MIN_POOL_SIZE", 0)),
+		DB_MAX_POOL_SIZE:            uint64(envInt("DB_MAX_POOL_SIZE", 0)),
+		DB_SERVER_SELECTION_TIMEOUT: envDuration("DB_SERVER_SELECTION_TIMEOUT", 0),
+		DB_READ_CONCERN:             os.Getenv("DB_READ_CONCERN"),
+		DB_WRITE_CONCERN:            os.Getenv("DB_WRITE_CONCERN"),
+		DB_READ_PREFERENCE:          os.Getenv("DB_READ_PREFERENCE"),
+		DB_TLS:                      dbTLS,
+		DB_TLS_CA_FILE:              os.Getenv("DB_TLS_CA_FILE"),
+		DB_TLS_CERT_KEY_FILE:        os.Getenv("DB_TLS_CERT_KEY_FILE"),
+		DB_CONNECT_RETRIES:          envInt("DB_CONNECT_RETRIES", 5),
+
+		DB_RETRIES:           envInt("DB_RETRIES", 2),
+		DB_RETRY_BACKOFF:     envDuration("DB_RETRY_BACKOFF", 100*time.Millisecond),
+		DB_BREAKER_THRESHOLD: envInt("DB_BREAKER_THRESHOLD", 5),
+		DB_BREAKER_TIMEOUT:   envDuration("DB_BREAKER_TIMEOUT", 30*time.Second),
+
+		LOGGING: logEnabled,
+		PREFORK: preforkEnabled,
+
 		CACHE:        cachEnabled,
-		PREFORK:      preforkEnabled,
+		CACHE_DRIVER: os.Getenv("CACHE_DRIVER"),
+		CACHE_URI:    os.Getenv("CACHE_URI"),
+		CACHE_SIZE:   cacheSize,
+		CACHE_TTL:    cacheTTL,
+		CACHE_TTLS:   cacheTTLs,
+
+		IDEMPOTENCY_TTL: envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		OPENAPI_VALIDATION: openAPIValidation,
+
+		JOBS_WORKERS:       envInt("JOBS_WORKERS", 4),
+		JOBS_POLL_INTERVAL: envDuration("JOBS_POLL_INTERVAL", time.Second),
+		JOBS_LEASE:         envDuration("JOBS_LEASE", 30*time.Second),
+		JOBS_MAX_ATTEMPTS:  envInt("JOBS_MAX_ATTEMPTS", 5),
+		JOBS_BACKOFF:       envDuration("JOBS_BACKOFF", 10*time.Second),
+
+		IMPORT_BATCH_SIZE: envInt("IMPORT_BATCH_SIZE", 500),
+		IMPORT_SYNC_ROWS:  envInt("IMPORT_SYNC_ROWS", 1000),
+
+		GRAPHQL_MAX_COMPLEXITY: envInt("GRAPHQL_MAX_COMPLEXITY", 1000),
+		GRAPHQL_MAX_DEPTH:      envInt("GRAPHQL_MAX_DEPTH", 10),
+
+		SCHEDULER_POLL_INTERVAL: envDuration("SCHEDULER_POLL_INTERVAL", 5*time.Second),
+		SCHEDULER_LEASE:         envDuration("SCHEDULER_LEASE", time.Minute),
+
+		SHUTDOWN_DRAIN_DELAY:  envDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		SHUTDOWN_GRACE_PERIOD: envDuration("SHUTDOWN_GRACE_PERIOD", 30*time.Second),
+		SHUTDOWN_TIMEOUT:      envDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+
+		API_V1_DEPRECATED_AT: v1DeprecatedAt,
+		API_V1_SUNSET:        v1Sunset,
+
+		ADMIN_USER: os.Getenv("ADMIN_USER"),
+		ADMIN_PWD:  os.Getenv("ADMIN_PWD"),
+
+		LOG_LEVEL:       os.Getenv("LOG_LEVEL"),
+		LOG_FORMAT:      os.Getenv("LOG_FORMAT"),
+		LOG_SAMPLE_RATE: logSampleRate,
+
+		TRACING_EXPORTER: os.Getenv("TRACING_EXPORTER"),
+		TRACING_ENDPOINT: os.Getenv("TRACING_ENDPOINT"),
+
+		TENANCY_MODE:       os.Getenv("TENANCY_MODE"),
+		TENANCY_SOURCES:    envList("TENANCY_SOURCES"),
+		TENANCY_HEADER:     os.Getenv("TENANCY_HEADER"),
+		TENANCY_DOMAIN:     os.Getenv("TENANCY_DOMAIN"),
+		TENANCY_CLAIM:      os.Getenv("TENANCY_CLAIM"),
+		TENANCY_JWT_SECRET: os.Getenv("TENANCY_JWT_SECRET"),
+		TENANCY_TENANTS:    envList("TENANCY_TENANTS"),
 	}
 
+	// Initialize Logging
+	logging.Setup(&logging.Config{
+		Level:       config.LOG_LEVEL,
+		Format:      config.LOG_FORMAT,
+		Environment: config.SERVICE_ENV,
+		ServiceName: config.SERVICE_NAME,
+	})
+
 	if fiber.IsChild() {
 		log.Infof("[%d] Child", os.Getppid())
 	} else {
 		log.Infof("[%d] Master", os.Getppid())
 	}
 
+	// The prefork master only supervises children, which serve and drain on their own
+	if config.PREFORK && !fiber.IsChild() {
+		m := lifecycle.NewManager(&lifecycle.Config{})
+		children := lifecycle.Prefork(m, runtime.GOMAXPROCS(0))
+		children.Timeout = config.SHUTDOWN_DRAIN_DELAY + config.SHUTDOWN_GRACE_PERIOD + 3*config.SHUTDOWN_TIMEOUT
+		m.Append(children)
+		run(m)
+		return
+	}
+
+	// Components are stopped in the reverse order they are appended
+	m := lifecycle.NewManager(&lifecycle.Config{
+		DrainDelay: config.SHUTDOWN_DRAIN_DELAY,
+		Timeout:    config.SHUTDOWN_TIMEOUT,
+	})
+
+	// Initialize Telemetry
+	t := telemetry.NewTelemetry(&telemetry.Config{
+		ServiceName: config.SERVICE_NAME,
+		Environment: config.SERVICE_ENV,
+		Exporter:    config.TRACING_EXPORTER,
+		Endpoint:    config.TRACING_ENDPOINT,
+	})
+	m.Append(lifecycle.Hook{Name: "telemetry", Stop: t.Shutdown})
+
 	// Initialize Datastore
 	dsConfig := datastore.Config{
+		Driver:       config.DB_DRIVER,
 		Uri:          config.DB_URI,
 		DatabaseName: config.SERVICE_NAME,
+		Mongo: datastore.MongoOptions{
+			MinPoolSize:            config.DB_MIN_POOL_SIZE,
+			MaxPoolSize:            config.DB_MAX_POOL_SIZE,
+			ServerSelectionTimeout: config.DB_SERVER_SELECTION_TIMEOUT,
+			ReadConcern:            config.DB_READ_CONCERN,
+			WriteConcern:           config.DB_WRITE_CONCERN,
+			ReadPreference:         config.DB_READ_PREFERENCE,
+			TLS:                    config.DB_TLS,
+			TLSCAFile:              config.DB_TLS_CA_FILE,
+			TLSCertificateKeyFile:  config.DB_TLS_CERT_KEY_FILE,
+			ConnectRetries:         config.DB_CONNECT_RETRIES,
+		},
+	}
+	// Every retry is traced as its own span
+	open := func(dsConfig *datastore.Config) datastore.Repository {
+		return datastore.NewResilientRepository(datastore.NewTracedRepository(datastore.New(dsConfig)), &datastore.ResilienceConfig{
+			Retries:          config.DB_RETRIES,
+			Backoff:          config.DB_RETRY_BACKOFF,
+			BreakerThreshold: config.DB_BREAKER_THRESHOLD,
+			BreakerTimeout:   config.DB_BREAKER_TIMEOUT,
+		})
+	}
+	resilient := open(&dsConfig)
+	ds := resilient
+	var keys cache.Cache = cache.NewLRU(10000)
+	var dsCache cache.Cache
+	m.Append(lifecycle.Hook{
+		Name: "datastore",
+		Stop: func(ctx context.Context) error {
+			return resilient.Close()
+		},
+	})
+	if config.CACHE {
+		c := cache.New(&cache.Config{
+			Driver: config.CACHE_DRIVER,
+			Uri:    config.CACHE_URI,
+			Size:   config.CACHE_SIZE,
+		})
+		m.Append(lifecycle.Hook{
+			Name: "cache",
+			Stop: func(ctx context.Context) error {
+				return c.Close()
+			},
+		})
+		keys = c
+		dsCache = c
+	}
+	// Cache hits skip the datastore spans
+	cached := func(r datastore.Repository, namespace string) datastore.Repository {
+		if dsCache == nil {
+			return r
+		}
+		return datastore.NewCachedRepository(r, dsCache, &datastore.CacheConfig{
+			Namespace: namespace,
+			TTL:       config.CACHE_TTL,
+			TTLs:      config.CACHE_TTLS,
+		})
 	}
-	ds := datastore.NewDatastore(&dsConfig)
+
+	// Initialize Tenancy, requests then need a tenant and only ever see its data. Tenant scoping
+	// wraps the cache so cache keys include the tenant
+	var resolver tenancy.Resolver
+	switch config.TENANCY_MODE {
+	case "":
+		ds = cached(ds, config.SERVICE_NAME)
+	case datastore.TenancyFilter:
+		ds = datastore.NewTenantRepository(cached(ds, config.SERVICE_NAME), &datastore.TenancyConfig{})
+	case datastore.TenancyDatabase:
+		if _, err := dsConfig.ForTenant("tenant"); err != nil {
+			log.Fatal(err)
+		}
+		// Every tenant opens a client of its own, callers must not be able to open more
+		if len(config.TENANCY_TENANTS) == 0 {
+			log.Fatal("TENANCY_TENANTS must list the tenants in database mode")
+		}
+		tenants := datastore.NewTenantRouter(func(tenant string) datastore.Repository {
+			tenantConfig, _ := dsConfig.ForTenant(tenant)
+			return cached(open(tenantConfig), config.SERVICE_NAME+":"+tenant)
+		})
+		m.Append(lifecycle.Hook{
+			Name: "tenants",
+			Stop: func(ctx context.Context) error {
+				return tenants.Close()
+			},
+		})
+		ds = tenants
+	default:
+		log.Fatalf("Unknown tenancy mode %q", config.TENANCY_MODE)
+	}
+	if len(config.TENANCY_MODE) != 0 {
+		resolver = tenancy.NewResolver(&tenancy.Config{
+			Sources: config.TENANCY_SOURCES,
+			Header:  config.TENANCY_HEADER,
+			Domain:  config.TENANCY_DOMAIN,
+			Claim:   config.TENANCY_CLAIM,
+			Secret:  []byte(config.TENANCY_JWT_SECRET),
+			Tenants: config.TENANCY_TENANTS,
+		})
+	}
+
+	// Initialize Jobs, which bypass the cache so claims always see the latest writes. They are
+	// shared by every tenant, handlers run as the tenant that enqueued the job and the admin API
+	// only shows a tenant its own jobs
+	jobsConfig := jobs.Config{
+		Workers:      config.JOBS_WORKERS,
+		PollInterval: config.JOBS_POLL_INTERVAL,
+		Lease:        config.JOBS_LEASE,
+		MaxAttempts:  config.JOBS_MAX_ATTEMPTS,
+		Backoff:      config.JOBS_BACKOFF,
+	}
+	q := jobs.NewQueue(resilient, &jobsConfig)
+	pool := jobs.NewPool(resilient, &jobsConfig)
+	// CHANGE: Register job handlers here, e.g. jobs.Type[T]{Name: "email.send"}.Handle(pool, ...)
+	m.Append(lifecycle.Hook{
+		Name:  "jobs",
+		Start: pool.Start,
+		// Running jobs get the grace period, then they are cancelled and released for another worker
+		Stop: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, config.SHUTDOWN_GRACE_PERIOD)
+			defer cancel()
+			return pool.Stop(ctx)
+		},
+		Timeout: config.SHUTDOWN_GRACE_PERIOD + config.SHUTDOWN_TIMEOUT,
+	})
+
+	// Initialize Scheduler, which bypasses the cache for the same reason. Tasks run without a
+	// tenant, they must set one before using the tenant scoped datastore
+	s := scheduler.NewScheduler(resilient, &scheduler.Config{
+		PollInterval: config.SCHEDULER_POLL_INTERVAL,
+		Lease:        config.SCHEDULER_LEASE,
+	})
+	// CHANGE: Register tasks here, e.g. s.Register(scheduler.Task{Name: "models.purge", Schedule: "@daily", Run: ...})
+	m.Append(lifecycle.Hook{
+		Name:  "scheduler",
+		Start: s.Start,
+		// Running tasks get the grace period, then they are cancelled
+		Stop: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, config.SHUTDOWN_GRACE_PERIOD)
+			defer cancel()
+			return s.Stop(ctx)
+		},
+		Timeout: config.SHUTDOWN_GRACE_PERIOD + config.SHUTDOWN_TIMEOUT,
+	})
+
 	// CHANGE: Update indexes here ????
 	ds.EnsureIndexes("models", []string{"email"})
+	resource.EnsureIndexes(ds, resources.All)
 
 	// Initialize Fiber App
 	app := initializeApp()
+	checkers := map[string]health.Checker{
+		"lifecycle": m,
+		"datastore": resilient.(health.Checker),
+		"scheduler": s,
+	}
+	app.Get("/health", health.Handler(checkers))
+
+	// The spec is generated from the routes once they are all registered
+	routerConfig := router.Config{
+		V1DeprecatedAt: config.API_V1_DEPRECATED_AT,
+		V1Sunset:       config.API_V1_SUNSET,
+		Models: services.Config{
+			ImportBatchSize: config.IMPORT_BATCH_SIZE,
+			ImportSyncRows:  config.IMPORT_SYNC_ROWS,
+		},
+		GraphQL: gql.Config{
+			MaxComplexity: config.GRAPHQL_MAX_COMPLEXITY,
+			MaxDepth:      config.GRAPHQL_MAX_DEPTH,
+		},
+	}
+	mountAdmin := len(config.ADMIN_USER) != 0 && len(config.ADMIN_PWD) != 0
+	users := map[string]string{}
+	if mountAdmin {
+		users[config.ADMIN_USER] = config.ADMIN_PWD
+	}
+	operations := router.Operations(&routerConfig)
+	if mountAdmin {
+		operations.Merge(router.AdminOperations())
+	}
+	spec := openapi.NewSpec(app, &openapi.Config{
+		Title:      config.SERVICE_NAME,
+		Version:    "1.0",
+		Base:       "/api",
+		Operations: operations,
+	})
+	app.Get("/openapi.json", openapi.Handler(spec))
 
 	// Load Routes
 	api := app.Group("/api")
-	router.LoadRoutes(api, ds)
+	if config.OPENAPI_VALIDATION {
+		api.Use(openapi.Middleware(spec, openapi.MiddlewareConfig{Responses: config.SERVICE_ENV != "production"}))
+	}
+	// Credentials are optional outside the admin API, they name the actor of the audit log
+	api.Use(auth.Middleware(&auth.Config{Users: users, Bearer: resolver != nil}))
+	if resolver != nil {
+		api.Use(tenancy.Middleware(resolver))
+	}
+	api.Use(idempotency.Middleware(keys, idempotency.Config{
+		Namespace: config.SERVICE_NAME,
+		TTL:       config.IDEMPOTENCY_TTL,
+	}))
+	ms := router.LoadRoutes(api, ds, q, pool, &routerConfig)
+	if mountAdmin {
+		admin := api.Group("/v1/admin", auth.Middleware(&auth.Config{
+			Users:    users,
+			Required: true,
+			Message:  "Admin credentials required",
+		}))
+		router.LoadAdminRoutes(admin, ds, q, s)
+	}
+	if undocumented := spec.Undocumented(); len(undocumented) != 0 {
+		log.Warnf("Routes missing from the OpenAPI spec: %s", strings.Join(undocumented, ", "))
+	}
 
 	// Load Middlewares
 	loadMiddlewares(app)
 
-	// Start Server
-	go func() {
-		err := app.Listen(fmt.Sprintf(":%d", config.SERVICE_PORT))
-		if err != nil {
-			log.Panic(err)
-		}
-	}()
+	// In-flight requests get the grace period to finish once readiness has failed for the drain delay
+	m.Append(lifecycle.Hook{
+		Name: "http",
+		Start: func(ctx context.Context) error {
+			go func() {
+				err := app.Listen(fmt.Sprintf(":%d", config.SERVICE_PORT))
+				if err != nil {
+					m.Fail("http", err)
+				}
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return app.Shutdown()
+		},
+		Timeout: config.SHUTDOWN_GRACE_PERIOD,
+	})
+
+	// The gRPC API serves the same models Service, in-flight calls get the grace period too
+	if config.GRPC_PORT != 0 {
+		g := rpc.NewServer(ms, &rpc.Config{
+			Users:      users,
+			Checkers:   checkers,
+			AccessLog:  config.LOGGING,
+			SampleRate: config.LOG_SAMPLE_RATE,
+			Tenancy:    resolver,
+		})
+		m.Append(lifecycle.Hook{
+			Name: "grpc",
+			Start: func(ctx context.Context) error {
+				lis, err := listen(fmt.Sprintf(":%d", config.GRPC_PORT))
+				if err != nil {
+					return err
+				}
+				go func() {
+					err := g.Serve(lis)
+					if err != nil {
+						m.Fail("grpc", err)
+					}
+				}()
+				return nil
+			},
+			Stop:    g.Stop,
+			Timeout: config.SHUTDOWN_GRACE_PERIOD,
+		})
+	}
 
-	// Graceful Shutdown
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	run(m)
+}
 
-	// Block main thread until interrupt is received
-	_ = <-sig
+// listen Opens a TCP listener, prefork children share the port like fiber's own listeners
+func listen(addr string) (net.Listener, error) {
+	if config.PREFORK {
+		return reuseport.Listen("tcp4", addr)
+	}
+	return net.Listen("tcp", addr)
+}
 
-	log.Info("Gracefully shutting down...")
-	_ = app.Shutdown()
+// run Starts every component and blocks until a signal or a failed component stops them
+func run(m lifecycle.Manager) {
+	err := m.Start(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	log.Info("Cleaning up modules...")
-	ds.Close()
+	err = m.Wait(os.Interrupt, syscall.SIGTERM)
+	if err != nil {
+		log.Errorf("Shut down with errors: %v", err)
+		os.Exit(1)
+	}
+	log.Info("Shut down")
+}
+
+// envInt Reads an optional integer variable
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Panicf("%s: %v", key, err)
+	}
+	return i
+}
+
+// envDuration Reads an optional duration variable such as 30s
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Panicf("%s: %v", key, err)
+	}
+	return d
+}
+
+// envList Reads an optional comma separated variable
+func envList(key string) []string {
+	list := []string{}
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); len(v) != 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// parseTTLs Reads comma separated collection=duration pairs
+func parseTTLs(v string) (map[string]time.Duration, error) {
+	ttls := map[string]time.Duration{}
+	for _, pair := range strings.Split(v, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("CACHE_TTLS entry %q is not collection=duration", pair)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		ttls[strings.TrimSpace(parts[0])] = ttl
+	}
+	return ttls, nil
 }
 
 func initializeApp() *fiber.App {
@@ -145,22 +702,19 @@ func initializeApp() *fiber.App {
 	app := fiber.New(fiber.Config{
 		Prefork:      config.PREFORK,
 		ServerHeader: config.SERVICE_NAME,
-		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
-
-			err = ctx.Status(code).JSON(err)
-			if err != nil {
-				return ctx.Status(fiber.StatusInternalServerError).SendString("Internal Server Error")
-			}
-
-			return nil
-		},
+		ErrorHandler: problem.ErrorHandler,
 	})
 
-	// Exposes swagger docs in /swagger/index.html
+	// Tracing and request logging must wrap every route registered after them
+	app.Use(telemetry.Middleware())
+	app.Use(requestid.New())
+	app.Use(logging.Middleware(logging.MiddlewareConfig{
+		AccessLog:  config.LOGGING,
+		SampleRate: config.LOG_SAMPLE_RATE,
+	}))
+
+	// Exposes swagger docs in /swagger/index.html, merged with the declarative resources
+	app.Get("/swagger/doc.json", resource.SwaggerHandler(resources.All))
 	app.Get("/swagger/*", swagger.Handler)
 
 	return app
@@ -170,31 +724,9 @@ func loadMiddlewares(app *fiber.App) {
 	app.Use(cors.New())
 	app.Use(recover.New())
 	app.Use(helmet.New())
-	app.Use(etag.New())
-	app.Use(requestid.New())
 	if config.SERVICE_ENV == "productionb" {
 		app.Use(pprof.New())
 	}
-	if config.CACHE {
-		app.Use(cache.New(cache.Config{
-			Next: func(c *fiber.Ctx) bool {
-				return c.Query("refresh") == "true"
-			},
-			Expiration:   1 * time.Minute,
-			CacheControl: true,
-		}))
-
-	}
-	if config.LOGGING {
-		app.Use(logger.New(logger.Config{
-			Next:         nil,
-			Format:       "[${time}] ${status} - ${latency} ${method} ${path}\n",
-			TimeFormat:   "15:04:05",
-			TimeZone:     "Local",
-			TimeInterval: 500 * time.Millisecond,
-			Output:       log.StandardLogger().Out,
-		}))
-	}
 	app.Use(compress.New(compress.Config{
 		Next: func(c *fiber.Ctx) bool {
 			re := regexp.MustCompile(`swagger`)
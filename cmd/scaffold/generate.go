@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// files maps each template to where it is written inside internal/<package>
+var files = map[string]string{
+	"models.go.tmpl":           "models/models.go",
+	"services.go.tmpl":         "services/services.go",
+	"controllers.go.tmpl":      "controllers/controllers.go",
+	"controllers_test.go.tmpl": "controllers/controllers_test.go",
+	"router.go.tmpl":           "router/router.go",
+}
+
+const (
+	routerFile    = "internal/router/router.go"
+	importsMarker = "// scaffold:imports"
+	routesMarker  = "// scaffold:routes"
+)
+
+// data Is what the templates are rendered with
+type data struct {
+	Module     string
+	Name       string
+	Type       string
+	Plural     string
+	PluralType string
+	// Label and PluralLabel are human readable, Route is the URL segment
+	Label       string
+	PluralLabel string
+	Route       string
+	Collection  string
+	Package     string
+	Fields      []field
+	Required    []field
+	IndexKeys   []string
+	HasTime     bool
+}
+
+type field struct {
+	Name     string
+	GoName   string
+	GoType   string
+	JSON     string
+	BSON     string
+	Validate string
+	Sample   string
+}
+
+/*
+* PRIVATE
+ */
+
+// rule returns the param of a validate rule, ok is false when the rule is absent
+func rule(validate string, name string) (string, bool) {
+	for _, r := range strings.Split(validate, ",") {
+		parts := strings.SplitN(r, "=", 2)
+		if parts[0] != name {
+			continue
+		}
+		if len(parts) == 1 {
+			return "", true
+		}
+		return parts[1], true
+	}
+	return "", false
+}
+
+// sample returns a Go literal that satisfies the common validate rules of f
+func sample(f Field) string {
+	v := f.Validate
+	if opts, ok := rule(v, "oneof"); ok {
+		first := strings.Fields(opts)[0]
+		if f.Type == "string" {
+			return strconv.Quote(first)
+		}
+		return first
+	}
+	min := "1"
+	for _, r := range []string{"min", "gte", "len"} {
+		if p, ok := rule(v, r); ok {
+			min = p
+		}
+	}
+
+	switch f.Type {
+	case "string":
+		switch {
+		case strings.Contains(v, "email"):
+			return `"test@test.com"`
+		case strings.Contains(v, "url"):
+			return `"https://example.com"`
+		}
+		n, err := strconv.Atoi(min)
+		if err != nil || n < 4 {
+			return `"test"`
+		}
+		return strconv.Quote(strings.Repeat("a", n))
+	case "bool":
+		return "true"
+	case "time":
+		return "time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)"
+	}
+	if _, err := strconv.ParseFloat(min, 64); err != nil || min == "0" {
+		min = "1"
+	}
+	return min
+}
+
+func newData(module string, s *Spec) data {
+	d := data{
+		Module:      module,
+		Name:        s.Name,
+		Type:        pascal(s.Name),
+		Plural:      camel(s.Plural),
+		PluralType:  pascal(s.Plural),
+		Package:     strings.ToLower(pascal(s.Plural)),
+		Label:       strings.ToLower(strings.Join(words(s.Name), " ")),
+		PluralLabel: strings.ToLower(strings.Join(words(s.Plural), " ")),
+		Route:       strings.ToLower(strings.Join(words(s.Plural), "-")),
+		Collection:  snake(s.Plural),
+	}
+	bsonKeys := map[string]string{}
+	for _, f := range s.Fields {
+		gf := field{
+			Name:     f.Name,
+			GoName:   pascal(f.Name),
+			GoType:   goTypes[f.Type],
+			JSON:     camel(f.Name),
+			BSON:     snake(f.Name),
+			Validate: f.Validate,
+			Sample:   sample(f),
+		}
+		bsonKeys[f.Name] = gf.BSON
+		d.Fields = append(d.Fields, gf)
+		if _, ok := rule(f.Validate, "required"); ok {
+			d.Required = append(d.Required, gf)
+		}
+		if f.Type == "time" {
+			d.HasTime = true
+		}
+	}
+	for _, idx := range s.Indexes {
+		d.IndexKeys = append(d.IndexKeys, bsonKeys[idx])
+	}
+	return d
+}
+
+func render(name string, d data) ([]byte, error) {
+	t, err := template.ParseFS(templates, "templates/"+name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return src, nil
+}
+
+// register mounts the generated router in internal/router
+func register(root string, d data) error {
+	path := filepath.Join(root, routerFile)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	src := string(b)
+
+	alias := d.Package + "router"
+	imp := fmt.Sprintf("%s \"%s/internal/%s/router\"", alias, d.Module, d.Package)
+	if strings.Contains(src, imp) {
+		return nil
+	}
+	if !strings.Contains(src, importsMarker) || !strings.Contains(src, routesMarker) {
+		return fmt.Errorf("%s is missing the %q and %q markers", routerFile, importsMarker, routesMarker)
+	}
+	src = strings.Replace(src, importsMarker, imp+"\n"+importsMarker, 1)
+	src = strings.Replace(src, routesMarker, alias+".LoadRoutes(v2, ds, u, a)\n"+routesMarker, 1)
+
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+/*
+* PUBLIC
+ */
+
+// Generate Writes the resource described by s into root, refusing to overwrite unless force is set
+func Generate(root string, s *Spec, force bool) ([]string, error) {
+	module, err := modulePath(root)
+	if err != nil {
+		return nil, err
+	}
+	d := newData(module, s)
+	dir := filepath.Join(root, "internal", d.Package)
+
+	rendered := map[string][]byte{}
+	for tmpl, out := range files {
+		path := filepath.Join(dir, out)
+		if _, err := os.Stat(path); err == nil && !force {
+			return nil, fmt.Errorf("%s already exists, use -force to overwrite", path)
+		}
+		src, err := render(tmpl, d)
+		if err != nil {
+			return nil, err
+		}
+		rendered[path] = src
+	}
+
+	var written []string
+	for path, src := range rendered {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return written, err
+		}
+		if err := ioutil.WriteFile(path, src, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, register(root, d)
+}
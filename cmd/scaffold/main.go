@@ -0,0 +1,115 @@
+// Command scaffold generates new resources and renames the module of a freshly cloned service.
+//
+//	go run ./cmd/scaffold resource -name widget -field label:string:required -field size:int:gte=0 -index label
+//	go run ./cmd/scaffold resource -spec widget.yaml
+//	go run ./cmd/scaffold rename -module github.com/acme/orders
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fieldFlags Collects repeated -field flags
+type fieldFlags []Field
+
+func (f *fieldFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *fieldFlags) Set(v string) error {
+	field, err := ParseField(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, field)
+	return nil
+}
+
+// listFlags Collects repeated string flags
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlags) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: scaffold <resource|rename> [flags]")
+	os.Exit(2)
+}
+
+func resource(args []string) {
+	fs := flag.NewFlagSet("resource", flag.ExitOnError)
+	root := fs.String("dir", ".", "Root of the service")
+	specPath := fs.String("spec", "", "YAML spec, flags are ignored when set")
+	name := fs.String("name", "", "Singular resource name")
+	plural := fs.String("plural", "", "Plural resource name, defaults to name + s")
+	force := fs.Bool("force", false, "Overwrite existing files")
+	var fields fieldFlags
+	var indexes listFlags
+	fs.Var(&fields, "field", "Field as name:type[:validate], repeatable")
+	fs.Var(&indexes, "index", "Field with a unique index, repeatable")
+	fs.Parse(args)
+
+	spec := &Spec{Name: *name, Plural: *plural, Fields: fields, Indexes: indexes}
+	if len(*specPath) != 0 {
+		var err error
+		spec, err = LoadSpec(*specPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	written, err := Generate(*root, spec, *force)
+	for _, path := range written {
+		fmt.Println("created", path)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("registered in", routerFile, "- run make swag to update the docs")
+}
+
+func rename(args []string) {
+	fs := flag.NewFlagSet("rename", flag.ExitOnError)
+	root := fs.String("dir", ".", "Root of the service")
+	module := fs.String("module", "", "New module path")
+	fs.Parse(args)
+
+	if len(*module) == 0 {
+		log.Fatal("-module is required")
+	}
+	changed, err := Rename(*root, *module)
+	for _, path := range changed {
+		fmt.Println("updated", path)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "resource":
+		resource(os.Args[2:])
+	case "rename":
+		rename(os.Args[2:])
+	default:
+		usage()
+	}
+}
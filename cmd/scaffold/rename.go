@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// renamed lists the files that may reference the module path
+var renamed = map[string]bool{
+	".go":   true,
+	".mod":  true,
+	".tmpl": true,
+	".md":   true,
+	".yml":  true,
+	".yaml": true,
+}
+
+var moduleDirective = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+/*
+* PRIVATE
+ */
+
+func modulePath(root string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	m := moduleDirective.FindSubmatch(b)
+	if m == nil {
+		return "", fmt.Errorf("no module directive in %s", filepath.Join(root, "go.mod"))
+	}
+	return string(m[1]), nil
+}
+
+/*
+* PUBLIC
+ */
+
+// Rename Rewrites every reference to the current module path, returning the changed files
+func Rename(root string, module string) ([]string, error) {
+	old, err := modulePath(root)
+	if err != nil {
+		return nil, err
+	}
+	if old == module {
+		return nil, nil
+	}
+
+	var changed []string
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" || info.Name() == "vendor" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !renamed[filepath.Ext(path)] {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out := bytes.ReplaceAll(b, []byte(old), []byte(module))
+		if bytes.Equal(b, out) {
+			return nil
+		}
+		changed = append(changed, path)
+		return ioutil.WriteFile(path, out, info.Mode())
+	})
+	return changed, err
+}
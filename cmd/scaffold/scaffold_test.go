@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRouter = `package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	// scaffold:imports
+)
+
+func LoadRoutes(v2 fiber.Router) {
+	// scaffold:routes
+}
+`
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		expected    Field
+		expectedErr bool
+	}{
+		{"Name and type", "label:string", Field{Name: "label", Type: "string"}, false},
+		{"Validate keeps commas and colons", "email:string:required,email", Field{Name: "email", Type: "string", Validate: "required,email"}, false},
+		{"Missing type", "label", Field{}, true},
+	}
+
+	for _, test := range tests {
+		f, err := ParseField(test.input)
+		assert.Equalf(t, test.expectedErr, err != nil, test.description)
+		assert.Equalf(t, test.expected, f, test.description)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	tests := []struct {
+		description string
+		spec        Spec
+		expectedErr bool
+	}{
+		{"Valid", Spec{Name: "widget", Fields: []Field{{Name: "label", Type: "string"}}, Indexes: []string{"label"}}, false},
+		{"Unknown type", Spec{Name: "widget", Fields: []Field{{Name: "label", Type: "text"}}}, true},
+		{"No fields", Spec{Name: "widget"}, true},
+		{"Generated field", Spec{Name: "widget", Fields: []Field{{Name: "created_at", Type: "time"}}}, true},
+		{"Index is not a field", Spec{Name: "widget", Fields: []Field{{Name: "label", Type: "string"}}, Indexes: []string{"size"}}, true},
+	}
+
+	for _, test := range tests {
+		err := test.spec.Validate()
+		assert.Equalf(t, test.expectedErr, err != nil, test.description)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	root, err := ioutil.TempDir("", "scaffold")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "internal", "router"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/svc\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, routerFile), []byte(testRouter), 0644))
+
+	spec := &Spec{
+		Name:    "line_item",
+		Fields:  []Field{{Name: "label", Type: "string", Validate: "required"}, {Name: "due_at", Type: "time"}},
+		Indexes: []string{"label"},
+	}
+	require.Nil(t, spec.Validate())
+
+	written, err := Generate(root, spec, false)
+	require.Nil(t, err)
+	assert.Len(t, written, len(files))
+
+	router, _ := ioutil.ReadFile(filepath.Join(root, routerFile))
+	assert.Contains(t, string(router), `lineitemsrouter "example.com/svc/internal/lineitems/router"`)
+	assert.Contains(t, string(router), "lineitemsrouter.LoadRoutes(v2, ds, u, a)")
+
+	// Generating twice neither overwrites nor registers twice
+	_, err = Generate(root, spec, false)
+	assert.NotNil(t, err)
+	_, err = Generate(root, spec, true)
+	assert.Nil(t, err)
+	again, _ := ioutil.ReadFile(filepath.Join(root, routerFile))
+	assert.Equal(t, string(router), string(again))
+
+	changed, err := Rename(root, "example.com/orders")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, changed)
+	module, _ := modulePath(root)
+	assert.Equal(t, "example.com/orders", module)
+}
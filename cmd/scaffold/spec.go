@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec Describes a resource to scaffold
+type Spec struct {
+	// Name is the singular resource name, e.g. widget
+	Name string `yaml:"name"`
+	// Plural is used for routes, packages and the collection, defaults to Name + "s"
+	Plural  string   `yaml:"plural"`
+	Fields  []Field  `yaml:"fields"`
+	Indexes []string `yaml:"indexes"`
+}
+
+// Field Is a single model field
+type Field struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Validate string `yaml:"validate"`
+}
+
+var goTypes = map[string]string{
+	"string":  "string",
+	"int":     "int",
+	"int64":   "int64",
+	"float":   "float64",
+	"float64": "float64",
+	"bool":    "bool",
+	"time":    "time.Time",
+}
+
+var identifier = regexp.MustCompile(`^[a-z][a-zA-Z0-9_]*$`)
+
+/*
+* PRIVATE
+ */
+
+func words(s string) []string {
+	var out []string
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' || r == ' ' }) {
+		// Split camelCase words
+		start := 0
+		for i, r := range w {
+			if i > 0 && unicode.IsUpper(r) {
+				out = append(out, w[start:i])
+				start = i
+			}
+		}
+		out = append(out, w[start:])
+	}
+	return out
+}
+
+func pascal(s string) string {
+	var b strings.Builder
+	for _, w := range words(s) {
+		if strings.EqualFold(w, "id") {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + strings.ToLower(w[1:]))
+	}
+	return b.String()
+}
+
+func camel(s string) string {
+	p := pascal(s)
+	if strings.HasPrefix(p, "ID") {
+		return "id" + p[2:]
+	}
+	return strings.ToLower(p[:1]) + p[1:]
+}
+
+func snake(s string) string {
+	ws := words(s)
+	for i := range ws {
+		ws[i] = strings.ToLower(ws[i])
+	}
+	return strings.Join(ws, "_")
+}
+
+/*
+* PUBLIC
+ */
+
+// LoadSpec Reads a YAML spec file
+func LoadSpec(path string) (*Spec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Spec
+	err = yaml.Unmarshal(b, &s)
+	return &s, err
+}
+
+// ParseField Parses name:type[:validate]
+func ParseField(v string) (Field, error) {
+	parts := strings.SplitN(v, ":", 3)
+	if len(parts) < 2 {
+		return Field{}, fmt.Errorf("field %q must be name:type[:validate]", v)
+	}
+	f := Field{Name: parts[0], Type: parts[1]}
+	if len(parts) == 3 {
+		f.Validate = parts[2]
+	}
+	return f, nil
+}
+
+// Validate Fills defaults and checks the spec
+func (s *Spec) Validate() error {
+	if !identifier.MatchString(s.Name) {
+		return fmt.Errorf("name %q must be a lower case identifier", s.Name)
+	}
+	if len(s.Plural) == 0 {
+		s.Plural = s.Name + "s"
+	}
+	if !identifier.MatchString(s.Plural) {
+		return fmt.Errorf("plural %q must be a lower case identifier", s.Plural)
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("at least one field is required")
+	}
+	seen := map[string]bool{}
+	for _, f := range s.Fields {
+		if !identifier.MatchString(f.Name) {
+			return fmt.Errorf("field %q must be a lower case identifier", f.Name)
+		}
+		if _, ok := goTypes[f.Type]; !ok {
+			return fmt.Errorf("field %s has unknown type %q", f.Name, f.Type)
+		}
+		switch pascal(f.Name) {
+		case "ID", "CreatedAt", "UpdatedAt":
+			return fmt.Errorf("field %s is generated for every resource", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	for _, idx := range s.Indexes {
+		if !seen[idx] {
+			return fmt.Errorf("index %q is not a field", idx)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind Is the category of a domain error, transports map kinds to their own status codes
+type Kind string
+
+const (
+	KindInvalidArgument Kind = "invalid_argument"
+	KindValidation      Kind = "validation"
+	KindUnauthorized    Kind = "unauthorized"
+	KindForbidden       Kind = "forbidden"
+	KindNotFound        Kind = "not_found"
+	KindConflict        Kind = "conflict"
+	KindUnavailable     Kind = "unavailable"
+	KindInternal        Kind = "internal"
+)
+
+// Stable machine readable codes, clients may branch on these so never rename them
+const (
+	CodeInvalidArgument       = "INVALID_ARGUMENT"
+	CodeInvalidID             = "INVALID_ID"
+	CodeInvalidPagination     = "INVALID_PAGINATION"
+	CodeInvalidBody           = "INVALID_BODY"
+	CodeValidationFailed      = "VALIDATION_FAILED"
+	CodeNoFieldsToUpdate      = "NO_FIELDS_TO_UPDATE"
+	CodeInvalidQuery          = "INVALID_QUERY"
+	CodeQueryTooComplex       = "QUERY_TOO_COMPLEX"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	CodeTenantRequired        = "TENANT_REQUIRED"
+	CodeInvalidTenant         = "INVALID_TENANT"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeForbidden             = "FORBIDDEN"
+	CodeModelNotFound         = "MODEL_NOT_FOUND"
+	CodeModelAlreadyExists    = "MODEL_ALREADY_EXISTS"
+	CodeResourceNotFound      = "RESOURCE_NOT_FOUND"
+	CodeResourceAlreadyExists = "RESOURCE_ALREADY_EXISTS"
+	CodeJobNotFound           = "JOB_NOT_FOUND"
+	CodeJobStateConflict      = "JOB_STATE_CONFLICT"
+	CodeTaskNotFound          = "TASK_NOT_FOUND"
+	CodeImportNotFound        = "IMPORT_NOT_FOUND"
+	CodeTenantNotFound        = "TENANT_NOT_FOUND"
+	CodeIdempotencyKeyInUse   = "IDEMPOTENCY_KEY_IN_USE"
+	CodeUnavailable           = "SERVICE_UNAVAILABLE"
+	CodeInternal              = "INTERNAL_ERROR"
+)
+
+// FieldError Is a validation failure of a single field
+type FieldError struct {
+	Field   string `json:"field" example:"email"`
+	Rule    string `json:"rule" example:"required"`
+	Param   string `json:"param,omitempty" example:""`
+	Message string `json:"message,omitempty" example:"email is required"`
+}
+
+// Error Is a typed domain error
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+/*
+* CONSTRUCTORS
+ */
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func InvalidArgument(code string, message string) *Error {
+	return New(KindInvalidArgument, code, message)
+}
+
+func Validation(message string, fields []FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidationFailed, Message: message, Fields: fields}
+}
+
+func Unauthorized(message string) *Error {
+	return New(KindUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(KindForbidden, CodeForbidden, message)
+}
+
+func NotFound(code string, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Conflict(code string, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Unavailable(err error) *Error {
+	return &Error{Kind: KindUnavailable, Code: CodeUnavailable, Message: "Service Unavailable", Err: err}
+}
+
+// Internal wraps an unexpected error, its message is never shown to clients
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: CodeInternal, Message: "Internal Server Error", Err: err}
+}
+
+/*
+* PUBLIC
+ */
+
+// As Returns the domain error in err's chain, if any
+func As(err error) (*Error, bool) {
+	var e *Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+// KindOf Returns the kind of a domain error, unknown errors are internal
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
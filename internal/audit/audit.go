@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// Collection is the append-only collection audit entries are written to
+const Collection = "audit"
+
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+type Auditor interface {
+	Record(ctx context.Context, op string, coll string, targetID string, before interface{}, after interface{}) error
+	History(ctx context.Context, targetID string, page datastore.Pagination) ([]Entry, error)
+	Query(ctx context.Context, filter Filter, page datastore.Pagination) ([]Entry, error)
+}
+
+// Entry Is a single audit record, entries are never updated or deleted
+type Entry struct {
+	ID         string    `json:"id" xml:"id" bson:"_id" example:"5ff3fc0e00acd4328da25d92"`
+	Actor      string    `json:"actor" xml:"actor" bson:"actor" example:"bob"`
+	Timestamp  time.Time `json:"timestamp" xml:"timestamp" bson:"timestamp"`
+	RequestID  string    `json:"requestId,omitempty" xml:"requestId,omitempty" bson:"request_id,omitempty" example:"3c1a9b3e-9f0e-4a64-a3f1-0a3c2b5c1d8e"`
+	Operation  string    `json:"operation" xml:"operation" bson:"operation" example:"update"`
+	Collection string    `json:"collection" xml:"collection" bson:"collection" example:"models"`
+	TargetID   string    `json:"targetId" xml:"targetId" bson:"target_id" example:"5ff3fc0e00acd4328da25d92"`
+	Changes    []Change  `json:"changes,omitempty" xml:"changes,omitempty" bson:"changes,omitempty"`
+}
+
+// Change Is the before/after value of a single field
+type Change struct {
+	Field  string      `json:"field" xml:"field" bson:"field" example:"name"`
+	Before interface{} `json:"before,omitempty" xml:"before,omitempty" bson:"before,omitempty"`
+	After  interface{} `json:"after,omitempty" xml:"after,omitempty" bson:"after,omitempty"`
+}
+
+// Filter Is the admin query filter, empty fields are ignored
+type Filter struct {
+	Actor      string
+	Operation  string
+	Collection string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+}
+
+type auditor struct {
+	r datastore.Repository
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func NewAuditor(r datastore.Repository) Auditor {
+	return &auditor{r: r}
+}
+
+/*
+* PRIVATE
+ */
+
+func (a *auditor) find(ctx context.Context, match datastore.M, page datastore.Pagination) ([]Entry, error) {
+	query := datastore.Query{Where: match, From: Collection}
+	page.Sort = []string{"-timestamp"}
+
+	res := []Entry{}
+	err := a.r.FindInto(ctx, query, &page, &res)
+	return res, err
+}
+
+// toMap flattens a value to its JSON representation so diffs use API field names
+func toMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil || reflect.ValueOf(v).IsZero() {
+		return m
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+/*
+* PUBLIC
+ */
+
+// Diff Returns the fields that differ between before and after, sorted by field name
+func Diff(before interface{}, after interface{}) []Change {
+	b := toMap(before)
+	a := toMap(after)
+
+	fields := map[string]bool{}
+	for k := range b {
+		fields[k] = true
+	}
+	for k := range a {
+		fields[k] = true
+	}
+
+	changes := []Change{}
+	for k := range fields {
+		if reflect.DeepEqual(b[k], a[k]) {
+			continue
+		}
+		changes = append(changes, Change{Field: k, Before: b[k], After: a[k]})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// Record Will append an audit entry for a mutating operation
+func (a *auditor) Record(ctx context.Context, op string, coll string, targetID string, before interface{}, after interface{}) error {
+	e := Entry{
+		ID:         datastore.NewID(),
+		Actor:      utils.Actor(ctx),
+		Timestamp:  time.Now().UTC(),
+		RequestID:  utils.RequestID(ctx),
+		Operation:  op,
+		Collection: coll,
+		TargetID:   targetID,
+		Changes:    Diff(before, after),
+	}
+
+	_, err := a.r.Insert(ctx, datastore.Query{From: Collection}, e)
+	return err
+}
+
+// History Returns the audit trail of a single entity, newest first
+func (a *auditor) History(ctx context.Context, targetID string, page datastore.Pagination) ([]Entry, error) {
+	return a.find(ctx, datastore.M{"target_id": targetID}, page)
+}
+
+// Query Returns audit entries matching the filter, newest first
+func (a *auditor) Query(ctx context.Context, filter Filter, page datastore.Pagination) ([]Entry, error) {
+	match := datastore.M{}
+	if len(filter.Actor) != 0 {
+		match["actor"] = filter.Actor
+	}
+	if len(filter.Operation) != 0 {
+		match["operation"] = filter.Operation
+	}
+	if len(filter.Collection) != 0 {
+		match["collection"] = filter.Collection
+	}
+	if len(filter.TargetID) != 0 {
+		match["target_id"] = filter.TargetID
+	}
+	ts := datastore.M{}
+	if !filter.From.IsZero() {
+		ts["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		ts["$lte"] = filter.To
+	}
+	if len(ts) != 0 {
+		match["timestamp"] = ts
+	}
+
+	return a.find(ctx, match, page)
+}
@@ -0,0 +1,138 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/auth"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/router"
+)
+
+// newApp Mounts the models API behind the request ID, logging and auth middlewares like cmd/api does
+func newApp(r datastore.Repository) *fiber.App {
+	jobsConfig := &jobs.Config{Workers: 1, PollInterval: time.Second, Lease: time.Second, MaxAttempts: 1}
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(requestid.New())
+	app.Use(logging.Middleware(logging.MiddlewareConfig{}))
+	api := app.Group("/api")
+	api.Use(auth.Middleware(&auth.Config{Users: map[string]string{"admin": "secret"}}))
+	router.LoadRoutes(api, r, jobs.NewQueue(r, jobsConfig), jobs.NewPool(r, jobsConfig), &router.Config{})
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, method string, path string, rid string, credentials string, body string) (int, string) {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderXRequestID, rid)
+	if len(credentials) != 0 {
+		req.Header.Set(fiber.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func byOperation(entries []audit.Entry) map[string]audit.Entry {
+	res := map[string]audit.Entry{}
+	for _, e := range entries {
+		res[e.Operation] = e
+	}
+	return res
+}
+
+func change(entry audit.Entry, field string) *audit.Change {
+	for i := range entry.Changes {
+		if entry.Changes[i].Field == field {
+			return &entry.Changes[i]
+		}
+	}
+	return nil
+}
+
+/*
+	TESTS
+*/
+
+func TestHTTPMutations(t *testing.T) {
+	r := datastore.NewMemoryDatastore()
+	app := newApp(r)
+
+	status, body := send(t, app, fiber.MethodPost, "/api/v2/models", "rid-create", "admin:secret", `{"name":"Bob","email":"bob@bob.com"}`)
+	require.Equal(t, fiber.StatusCreated, status, body)
+	var created struct {
+		Data struct {
+			InsertedID string `json:"insertedId"`
+		} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(body), &created))
+	id := created.Data.InsertedID
+
+	status, body = send(t, app, fiber.MethodPatch, "/api/v2/models/"+id, "rid-update", "admin:secret", `{"name":"Robert"}`)
+	require.Equal(t, fiber.StatusOK, status, body)
+	status, body = send(t, app, fiber.MethodDelete, "/api/v2/models/"+id, "rid-delete", "admin:secret", "")
+	require.Equal(t, fiber.StatusNoContent, status, body)
+
+	entries, err := audit.NewAuditor(r).History(context.Background(), id, datastore.Pagination{Page: 1, Limit: 10})
+	require.Nil(t, err)
+	require.Len(t, entries, 3)
+	ops := byOperation(entries)
+
+	tests := []struct {
+		operation string
+		requestID string
+		field     string
+		before    interface{}
+		after     interface{}
+	}{
+		{operation: audit.OperationCreate, requestID: "rid-create", field: "name", after: "Bob"},
+		{operation: audit.OperationUpdate, requestID: "rid-update", field: "name", before: "Bob", after: "Robert"},
+		{operation: audit.OperationDelete, requestID: "rid-delete", field: "name", before: "Robert"},
+	}
+	for _, test := range tests {
+		entry, ok := ops[test.operation]
+		require.True(t, ok, test.operation)
+		assert.Equal(t, "admin", entry.Actor, test.operation)
+		assert.Equal(t, test.requestID, entry.RequestID, test.operation)
+		assert.Equal(t, "models", entry.Collection, test.operation)
+		assert.Equal(t, id, entry.TargetID, test.operation)
+		c := change(entry, test.field)
+		require.NotNil(t, c, "%s changes %s", test.operation, test.field)
+		assert.Equal(t, test.before, c.Before, test.operation)
+		assert.Equal(t, test.after, c.After, test.operation)
+	}
+	assert.Nil(t, change(ops[audit.OperationUpdate], "email"), "unchanged fields are left out")
+}
+
+func TestHTTPActor(t *testing.T) {
+	r := datastore.NewMemoryDatastore()
+	app := newApp(r)
+
+	// Requests without credentials are anonymous, wrong credentials are rejected
+	status, body := send(t, app, fiber.MethodPost, "/api/v2/models", "rid-1", "", `{"name":"Ann","email":"ann@ann.com"}`)
+	require.Equal(t, fiber.StatusCreated, status, body)
+	status, _ = send(t, app, fiber.MethodPost, "/api/v2/models", "rid-2", "admin:guess", `{"name":"Eve","email":"eve@eve.com"}`)
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+
+	entries, err := audit.NewAuditor(r).Query(context.Background(), audit.Filter{}, datastore.Pagination{Page: 1, Limit: 10})
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "anonymous", entries[0].Actor)
+	assert.Equal(t, "rid-1", entries[0].RequestID)
+}
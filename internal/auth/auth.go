@@ -0,0 +1,77 @@
+// Package auth verifies the basic credentials of HTTP requests and attaches the user as the actor,
+// like the auth interceptor of the gRPC API does for calls.
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+)
+
+// Config Is the auth middleware config
+type Config struct {
+	// Users are the accepted basic credentials, without users every request stays anonymous
+	Users map[string]string
+	// Required rejects requests without credentials rather than leaving them anonymous
+	Required bool
+	// Bearer leaves bearer tokens to another middleware, such as tenant claims
+	Bearer bool
+	// Message is the detail of the 401 answered to requests without valid credentials
+	Message string
+}
+
+/*
+* PUBLIC
+ */
+
+// Middleware Will verify the basic credentials of the Authorization header and attach the user to
+// the request context. Requests without credentials stay anonymous unless they are required, wrong
+// credentials are always rejected
+func Middleware(config *Config) fiber.Handler {
+	c := *config
+	if len(c.Message) == 0 {
+		c.Message = "Invalid credentials"
+	}
+	unauthorized := func(ctx *fiber.Ctx, message string) error {
+		ctx.Set(fiber.HeaderWWWAuthenticate, "basic realm=Restricted")
+		return apperrors.Unauthorized(message)
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		authorization := ctx.Get(fiber.HeaderAuthorization)
+		if len(authorization) == 0 {
+			if c.Required {
+				return unauthorized(ctx, c.Message)
+			}
+			return ctx.Next()
+		}
+		if len(c.Users) == 0 && !c.Required {
+			return ctx.Next()
+		}
+
+		scheme, credentials, _ := strings.Cut(authorization, " ")
+		if strings.EqualFold(scheme, "bearer") && c.Bearer && !c.Required {
+			return ctx.Next()
+		}
+		if !strings.EqualFold(scheme, "basic") {
+			return unauthorized(ctx, "Basic credentials required")
+		}
+		raw, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return unauthorized(ctx, "Malformed credentials")
+		}
+		user, pwd, _ := strings.Cut(string(raw), ":")
+		expected, ok := c.Users[user]
+		if !ok || subtle.ConstantTimeCompare([]byte(pwd), []byte(expected)) != 1 {
+			return unauthorized(ctx, c.Message)
+		}
+
+		logging.SetUser(ctx, user)
+		return ctx.Next()
+	}
+}
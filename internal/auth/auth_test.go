@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/auth"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+func basic(credentials string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+/*
+	TESTS
+*/
+
+func TestMiddleware(t *testing.T) {
+	users := map[string]string{"admin": "secret"}
+	tests := []struct {
+		description   string
+		config        auth.Config
+		authorization string
+		status        int
+		actor         string
+	}{
+		{description: "Anonymous", config: auth.Config{Users: users}, status: fiber.StatusOK, actor: utils.AnonymousActor},
+		{description: "Credentials", config: auth.Config{Users: users}, authorization: basic("admin:secret"), status: fiber.StatusOK, actor: "admin"},
+		{description: "Wrong password", config: auth.Config{Users: users}, authorization: basic("admin:guess"), status: fiber.StatusUnauthorized},
+		{description: "Unknown user", config: auth.Config{Users: users}, authorization: basic("bob:secret"), status: fiber.StatusUnauthorized},
+		{description: "Malformed", config: auth.Config{Users: users}, authorization: "Basic !!", status: fiber.StatusUnauthorized},
+		{description: "Other scheme", config: auth.Config{Users: users}, authorization: "Bearer token", status: fiber.StatusUnauthorized},
+		{description: "Bearer left to another middleware", config: auth.Config{Users: users, Bearer: true}, authorization: "Bearer token", status: fiber.StatusOK, actor: utils.AnonymousActor},
+		{description: "No users", config: auth.Config{}, authorization: basic("admin:secret"), status: fiber.StatusOK, actor: utils.AnonymousActor},
+		{description: "Required", config: auth.Config{Users: users, Required: true}, status: fiber.StatusUnauthorized},
+		{description: "Required bearer", config: auth.Config{Users: users, Required: true, Bearer: true}, authorization: "Bearer token", status: fiber.StatusUnauthorized},
+		{description: "Required credentials", config: auth.Config{Users: users, Required: true}, authorization: basic("admin:secret"), status: fiber.StatusOK, actor: "admin"},
+	}
+	for _, test := range tests {
+		app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+		app.Use(auth.Middleware(&test.config))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendString(utils.Actor(utils.Context(ctx)))
+		})
+
+		req, _ := http.NewRequest(fiber.MethodGet, "/", nil)
+		if len(test.authorization) != 0 {
+			req.Header.Set(fiber.HeaderAuthorization, test.authorization)
+		}
+		res, err := app.Test(req, -1)
+		require.Nil(t, err)
+		body, _ := io.ReadAll(res.Body)
+		assert.Equal(t, test.status, res.StatusCode, test.description)
+		if test.status == fiber.StatusOK {
+			assert.Equal(t, test.actor, string(body), test.description)
+		} else {
+			assert.Equal(t, "basic realm=Restricted", res.Header.Get(fiber.HeaderWWWAuthenticate), test.description)
+		}
+	}
+}
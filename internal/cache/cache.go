@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Cache Stores encoded values until they expire, implementations are safe for concurrent use
+type Cache interface {
+	// Get reports whether key was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value for ttl, zero keeps it until it is evicted
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+// Drivers selectable with Config.Driver
+const (
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+)
+
+// Config Is the Cache config
+type Config struct {
+	// Driver defaults to memory
+	Driver string
+	// Uri is the redis URL, e.g. redis://localhost:6379/0
+	Uri string
+	// Size is the number of entries the memory cache keeps, defaults to 10000
+	Size int
+}
+
+// New Will initialize the cache selected by config.Driver
+func New(config *Config) Cache {
+	switch config.Driver {
+	case "", DriverMemory:
+		size := config.Size
+		if size <= 0 {
+			size = 10000
+		}
+		return NewLRU(size)
+	case DriverRedis:
+		return NewRedis(config)
+	}
+	log.Fatalf("Unknown cache driver %q", config.Driver)
+	return nil
+}
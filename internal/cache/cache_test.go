@@ -0,0 +1,77 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+)
+
+/*
+	TESTS
+*/
+
+func TestCache(t *testing.T) {
+	m := miniredis.RunT(t)
+
+	tests := []struct {
+		description string
+		cache       cache.Cache
+		// elapse lets d pass for the cache
+		elapse func(d time.Duration)
+	}{
+		{"Memory", cache.New(&cache.Config{Driver: cache.DriverMemory}), time.Sleep},
+		{"Redis", cache.New(&cache.Config{Driver: cache.DriverRedis, Uri: "redis://" + m.Addr()}), m.FastForward},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			c := test.cache
+			defer c.Close()
+			ctx := context.Background()
+
+			_, ok, err := c.Get(ctx, "missing")
+			require.Nil(t, err)
+			assert.False(t, ok)
+
+			require.Nil(t, c.Set(ctx, "key", []byte("value"), 0))
+			v, ok, err := c.Get(ctx, "key")
+			require.Nil(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []byte("value"), v)
+
+			require.Nil(t, c.Delete(ctx, "key"))
+			_, ok, _ = c.Get(ctx, "key")
+			assert.False(t, ok, "Deleted")
+
+			require.Nil(t, c.Set(ctx, "short", []byte("value"), 20*time.Millisecond))
+			test.elapse(30 * time.Millisecond)
+			_, ok, _ = c.Get(ctx, "short")
+			assert.False(t, ok, "Expired")
+		})
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := cache.NewLRU(3)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		require.Nil(t, c.Set(ctx, fmt.Sprint(i), []byte{byte(i)}, 0))
+	}
+
+	// Reading 0 makes 1 the least recently used
+	_, ok, _ := c.Get(ctx, "0")
+	assert.True(t, ok)
+	require.Nil(t, c.Set(ctx, "3", []byte{3}, 0))
+
+	for key, expected := range map[string]bool{"0": true, "1": false, "2": true, "3": true} {
+		_, ok, _ := c.Get(ctx, key)
+		assert.Equalf(t, expected, ok, "key %s", key)
+	}
+}
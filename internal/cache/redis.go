@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+type redisCache struct {
+	client *redis.Client
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewRedis Will connect to the redis compatible server at config.Uri
+func NewRedis(config *Config) Cache {
+	opts, err := redis.ParseURL(config.Uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	log.Infof("Connecting to %s", opts.Addr)
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Fatal(err)
+	}
+	return &redisCache{client: client}
+}
+
+/*
+* PUBLIC
+ */
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *redisCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,91 @@
+package dataloader
+
+import (
+	"context"
+	"sync"
+)
+
+// Fetch Loads the values of keys in one call, keys without a value are left out of the map
+type Fetch[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader Batches and caches lookups by key, it is meant to live for a single request. Load
+// returns a thunk instead of the value, so resolvers can load every key they need before the
+// first thunk is called and fetches them all at once
+type Loader[K comparable, V any] interface {
+	// Load Adds key to the pending batch, the thunk returns false when key has no value
+	Load(ctx context.Context, key K) func() (V, bool, error)
+	// Clear Drops the cached value of key, e.g. once it was updated
+	Clear(key K)
+}
+
+type loader[K comparable, V any] struct {
+	fetch Fetch[K, V]
+
+	mu      sync.Mutex
+	pending *batch[K, V]
+	cache   map[K]*batch[K, V]
+}
+
+// batch Is a set of keys fetched together
+type batch[K comparable, V any] struct {
+	keys   []K
+	once   sync.Once
+	values map[K]V
+	err    error
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewLoader Will create a Loader calling fetch once per batch
+func NewLoader[K comparable, V any](fetch Fetch[K, V]) Loader[K, V] {
+	return &loader[K, V]{fetch: fetch, cache: map[K]*batch[K, V]{}}
+}
+
+/*
+* PRIVATE
+ */
+
+// dispatch fetches b, the Loader starts a new batch for the keys loaded from then on
+func (l *loader[K, V]) dispatch(ctx context.Context, b *batch[K, V]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.pending == b {
+			l.pending = nil
+		}
+		l.mu.Unlock()
+
+		b.values, b.err = l.fetch(ctx, b.keys)
+	})
+}
+
+/*
+* PUBLIC
+ */
+
+func (l *loader[K, V]) Load(ctx context.Context, key K) func() (V, bool, error) {
+	l.mu.Lock()
+	b, ok := l.cache[key]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &batch[K, V]{}
+		}
+		b = l.pending
+		b.keys = append(b.keys, key)
+		l.cache[key] = b
+	}
+	l.mu.Unlock()
+
+	return func() (V, bool, error) {
+		l.dispatch(ctx, b)
+		v, ok := b.values[key]
+		return v, ok, b.err
+	}
+}
+
+func (l *loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, key)
+}
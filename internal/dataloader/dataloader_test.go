@@ -0,0 +1,83 @@
+package dataloader_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/dataloader"
+)
+
+/*
+	TESTS
+*/
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+	batches := [][]string{}
+	l := dataloader.NewLoader(func(ctx context.Context, keys []string) (map[string]string, error) {
+		batches = append(batches, keys)
+		values := map[string]string{}
+		for _, k := range keys {
+			if k != "missing" {
+				values[k] = strings.ToUpper(k)
+			}
+		}
+		return values, nil
+	})
+
+	// Keys loaded before the first thunk runs are fetched together
+	a := l.Load(ctx, "a")
+	b := l.Load(ctx, "b")
+	missing := l.Load(ctx, "missing")
+	again := l.Load(ctx, "a")
+
+	tests := []struct {
+		description string
+		thunk       func() (string, bool, error)
+		value       string
+		found       bool
+	}{
+		{description: "First key", thunk: a, value: "A", found: true},
+		{description: "Second key", thunk: b, value: "B", found: true},
+		{description: "Missing key", thunk: missing},
+		{description: "Same key", thunk: again, value: "A", found: true},
+		{description: "Cached key", thunk: l.Load(ctx, "b"), value: "B", found: true},
+	}
+	for _, test := range tests {
+		v, found, err := test.thunk()
+		require.Nil(t, err, test.description)
+		assert.Equal(t, test.value, v, test.description)
+		assert.Equal(t, test.found, found, test.description)
+	}
+	assert.Equal(t, [][]string{{"a", "b", "missing"}}, batches)
+
+	// Keys loaded after a batch was fetched start a new one
+	l.Clear("a")
+	c := l.Load(ctx, "c")
+	a = l.Load(ctx, "a")
+	v, _, _ := c()
+	assert.Equal(t, "C", v)
+	v, _, _ = a()
+	assert.Equal(t, "A", v)
+	assert.Equal(t, []string{"c", "a"}, batches[1])
+}
+
+func TestLoaderError(t *testing.T) {
+	ctx := context.Background()
+	l := dataloader.NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		return nil, errors.New("datastore unreachable")
+	})
+
+	one := l.Load(ctx, 1)
+	two := l.Load(ctx, 2)
+	_, _, err := one()
+	assert.EqualError(t, err, "datastore unreachable")
+	_, found, err := two()
+	assert.False(t, found)
+	assert.EqualError(t, err, "datastore unreachable", "Every key of the batch fails")
+}
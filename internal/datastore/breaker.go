@@ -0,0 +1,111 @@
+package datastore
+
+import (
+	"sync"
+	"time"
+)
+
+// States of a circuit breaker
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerStats Is a snapshot of a circuit breaker
+type BreakerStats struct {
+	State string
+	// Failures are the consecutive failures counted while closed
+	Failures int
+	OpenedAt time.Time
+}
+
+// breaker Opens after threshold consecutive failures and fails fast until timeout has passed,
+// then lets a single probe through whose outcome closes or reopens it
+type breaker struct {
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// newBreaker Will create a closed breaker, a threshold below one never opens it
+func newBreaker(threshold int, timeout time.Duration) *breaker {
+	return &breaker{threshold: threshold, timeout: timeout, now: time.Now, state: BreakerClosed}
+}
+
+/*
+* PUBLIC
+ */
+
+// allow Reports whether an operation may run, every allowed operation must be recorded or released
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.timeout {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record Counts the outcome of an allowed operation
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.state = BreakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	case BreakerClosed:
+		b.failures++
+		if b.threshold > 0 && b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+		}
+	}
+}
+
+// release Gives back an allowed operation that has no outcome, such as one the caller gave up on.
+// A half open breaker lets the next operation probe instead
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{State: b.state, Failures: b.failures, OpenedAt: b.openedAt}
+}
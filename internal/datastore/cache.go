@@ -0,0 +1,350 @@
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+// CacheConfig Is the config of a cached Repository
+type CacheConfig struct {
+	// Namespace prefixes every key, so several services can share a cache
+	Namespace string
+	// TTL applies to collections missing from TTLs, zero or less leaves them uncached
+	TTL  time.Duration
+	TTLs map[string]time.Duration
+}
+
+// CacheStats Counts the lookups of a cached Repository since it was created
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Shared misses waited on an identical lookup instead of querying the datastore
+	Shared        uint64                 `json:"shared"`
+	Invalidations uint64                 `json:"invalidations"`
+	Errors        uint64                 `json:"errors"`
+	Collections   []CollectionCacheStats `json:"collections"`
+}
+
+// CollectionCacheStats Counts the lookups of one collection
+type CollectionCacheStats struct {
+	Name   string `json:"name"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CacheStatsReporter Is implemented by cached Repositories
+type CacheStatsReporter interface {
+	CacheStats() CacheStats
+}
+
+type cacheCounters struct {
+	hits, misses, shared, invalidations, errors uint64
+
+	mu          sync.Mutex
+	collections map[string]*CollectionCacheStats
+}
+
+type cachedRepository struct {
+	r      Repository
+	c      cache.Cache
+	config CacheConfig
+	group  *singleflight.Group
+	stats  *cacheCounters
+	// written is set on the Repository handed to Transaction, whose reads bypass the cache
+	written *sync.Map
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewCachedRepository Will wrap a Repository so reads are served from c until a write to their
+// collection, identical concurrent misses share a single datastore query
+func NewCachedRepository(r Repository, c cache.Cache, config *CacheConfig) Repository {
+	return &cachedRepository{
+		r:      r,
+		c:      c,
+		config: *config,
+		group:  &singleflight.Group{},
+		stats:  &cacheCounters{collections: map[string]*CollectionCacheStats{}},
+	}
+}
+
+/*
+* PRIVATE
+ */
+
+func (cr *cachedRepository) ttl(coll string) time.Duration {
+	if ttl, ok := cr.config.TTLs[coll]; ok {
+		return ttl
+	}
+	return cr.config.TTL
+}
+
+func (cr *cachedRepository) count(coll string, hit bool) {
+	if hit {
+		atomic.AddUint64(&cr.stats.hits, 1)
+	} else {
+		atomic.AddUint64(&cr.stats.misses, 1)
+	}
+
+	cr.stats.mu.Lock()
+	defer cr.stats.mu.Unlock()
+	s, ok := cr.stats.collections[coll]
+	if !ok {
+		s = &CollectionCacheStats{Name: coll}
+		cr.stats.collections[coll] = s
+	}
+	if hit {
+		s.Hits++
+	} else {
+		s.Misses++
+	}
+}
+
+func (cr *cachedRepository) fail(ctx context.Context, err error) {
+	atomic.AddUint64(&cr.stats.errors, 1)
+	logging.FromContext(ctx).WithField("component", "cache").Warn(err)
+}
+
+func (cr *cachedRepository) versionKey(coll string) string {
+	return cr.config.Namespace + ":" + coll + ":version"
+}
+
+// version Names the current generation of a collection. Writes replace it with a new unique
+// value, so entries of older generations are never read again and simply expire
+func (cr *cachedRepository) version(ctx context.Context, coll string) (string, error) {
+	v, ok, err := cr.c.Get(ctx, cr.versionKey(coll))
+	if err != nil || ok {
+		return string(v), err
+	}
+	id := NewID()
+	return id, cr.c.Set(ctx, cr.versionKey(coll), []byte(id), 0)
+}
+
+func (cr *cachedRepository) invalidate(ctx context.Context, coll string) {
+	atomic.AddUint64(&cr.stats.invalidations, 1)
+	if err := cr.c.Set(ctx, cr.versionKey(coll), []byte(NewID()), 0); err != nil {
+		cr.fail(ctx, err)
+	}
+}
+
+// wrote Invalidates after a successful write, inside a transaction it is invalidated again on commit
+func (cr *cachedRepository) wrote(ctx context.Context, coll string, err error) {
+	if err != nil {
+		return
+	}
+	if cr.written != nil {
+		cr.written.Store(coll, true)
+	}
+	cr.invalidate(ctx, coll)
+}
+
+// key Hashes the lookup, lookups of a single ID are keyed by it
+func (cr *cachedRepository) key(ctx context.Context, op string, query Query, page *Pagination, out interface{}) (string, error) {
+	version, err := cr.version(ctx, query.From)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(struct {
+		Op     string
+		Select M
+		Where  M
+		Page   *Pagination
+		Type   string
+	}{op, query.Select, query.Where, page, reflect.TypeOf(out).String()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+
+	prefix := cr.config.Namespace + ":" + query.From + ":" + version
+	if id, ok := query.Where["_id"].(ID); ok && len(query.Where) == 1 {
+		return prefix + ":id:" + string(id) + ":" + hash, nil
+	}
+	return prefix + ":query:" + hash, nil
+}
+
+// read Serves out, a pointer to a slice, from the cache or fills it with fetch and caches it
+func (cr *cachedRepository) read(ctx context.Context, op string, query Query, page *Pagination, out interface{}, fetch func(ctx context.Context, out interface{}) error) error {
+	ttl := cr.ttl(query.From)
+	if cr.written != nil || ttl <= 0 {
+		return fetch(ctx, out)
+	}
+
+	key, err := cr.key(ctx, op, query, page, out)
+	if err != nil {
+		cr.fail(ctx, err)
+		return fetch(ctx, out)
+	}
+	b, ok, err := cr.c.Get(ctx, key)
+	if err != nil {
+		cr.fail(ctx, err)
+	}
+	if ok {
+		if err := bson.Raw(b).Lookup("v").Unmarshal(out); err == nil {
+			cr.count(query.From, true)
+			return nil
+		}
+	}
+
+	cr.count(query.From, false)
+	leader := false
+	v, err, _ := cr.group.Do(key, func() (interface{}, error) {
+		leader = true
+		res := reflect.New(reflect.TypeOf(out).Elem())
+		if err := fetch(ctx, res.Interface()); err != nil {
+			return nil, err
+		}
+		b, err := bson.Marshal(bson.M{"v": res.Interface()})
+		if err != nil {
+			return nil, err
+		}
+		if err := cr.c.Set(ctx, key, b, ttl); err != nil {
+			cr.fail(ctx, err)
+		}
+		return b, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !leader {
+		atomic.AddUint64(&cr.stats.shared, 1)
+	}
+	return bson.Raw(v.([]byte)).Lookup("v").Unmarshal(out)
+}
+
+/*
+* PUBLIC
+ */
+
+// CacheStats Returns the counters, collections are sorted by name
+func (cr *cachedRepository) CacheStats() CacheStats {
+	stats := CacheStats{
+		Hits:          atomic.LoadUint64(&cr.stats.hits),
+		Misses:        atomic.LoadUint64(&cr.stats.misses),
+		Shared:        atomic.LoadUint64(&cr.stats.shared),
+		Invalidations: atomic.LoadUint64(&cr.stats.invalidations),
+		Errors:        atomic.LoadUint64(&cr.stats.errors),
+		Collections:   []CollectionCacheStats{},
+	}
+
+	cr.stats.mu.Lock()
+	defer cr.stats.mu.Unlock()
+	for _, s := range cr.stats.collections {
+		stats.Collections = append(stats.Collections, *s)
+	}
+	sort.Slice(stats.Collections, func(i, j int) bool {
+		return stats.Collections[i].Name < stats.Collections[j].Name
+	})
+	return stats
+}
+
+func (cr *cachedRepository) Close() error {
+	return cr.r.Close()
+}
+
+func (cr *cachedRepository) EnsureIndexes(coll string, indexQuery []string) {
+	cr.r.EnsureIndexes(coll, indexQuery)
+}
+
+// Transaction Bypasses the cache for reads of the transaction, which may not be committed
+func (cr *cachedRepository) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if cr.written != nil {
+		return fn(ctx, cr)
+	}
+	written := &sync.Map{}
+	err := Transaction(ctx, cr.r, func(ctx context.Context, tx Repository) error {
+		return fn(ctx, &cachedRepository{r: tx, c: cr.c, config: cr.config, group: cr.group, stats: cr.stats, written: written})
+	})
+	// Reads between a write and the commit may have cached the old documents again
+	written.Range(func(coll, _ interface{}) bool {
+		cr.invalidate(ctx, coll.(string))
+		return true
+	})
+	return err
+}
+
+func (cr *cachedRepository) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	var res []models.Model
+	err := cr.read(ctx, "find", query, nil, &res, func(ctx context.Context, out interface{}) error {
+		m, err := cr.r.Find(ctx, query)
+		if err == nil && m != nil {
+			*out.(*[]models.Model) = *m
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (cr *cachedRepository) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	res, err := cr.r.Insert(ctx, query, d)
+	cr.wrote(ctx, query.From, err)
+	return res, err
+}
+
+func (cr *cachedRepository) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	res, err := cr.r.Update(ctx, query, d)
+	cr.wrote(ctx, query.From, err)
+	return res, err
+}
+
+func (cr *cachedRepository) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	err := FindOneAndUpdate(ctx, cr.r, query, sort, d, out)
+	cr.wrote(ctx, query.From, err)
+	return err
+}
+
+// Stream Bypasses the cache, streams are read once and may be too large to hold
+func (cr *cachedRepository) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	return Stream(ctx, cr.r, query, sort, fn)
+}
+
+func (cr *cachedRepository) Delete(ctx context.Context, query Query) (interface{}, error) {
+	res, err := cr.r.Delete(ctx, query)
+	cr.wrote(ctx, query.From, err)
+	return res, err
+}
+
+func (cr *cachedRepository) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	var res []models.Model
+	err := cr.read(ctx, "paginate", query, &page, &res, func(ctx context.Context, out interface{}) error {
+		m, err := cr.r.Paginate(ctx, query, page)
+		if err == nil && m != nil {
+			*out.(*[]models.Model) = *m
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (cr *cachedRepository) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	if reflect.TypeOf(out).Kind() != reflect.Ptr {
+		return fmt.Errorf("out must be a pointer to a slice, got %T", out)
+	}
+	return cr.read(ctx, "findInto", query, page, out, func(ctx context.Context, out interface{}) error {
+		return cr.r.FindInto(ctx, query, page, out)
+	})
+}
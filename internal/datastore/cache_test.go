@@ -0,0 +1,103 @@
+package datastore_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore/datastoretest"
+)
+
+// countingRepository Counts the lookups reaching the datastore, which are slow enough to overlap
+type countingRepository struct {
+	datastore.Repository
+	lookups int32
+}
+
+func (r *countingRepository) FindInto(ctx context.Context, query datastore.Query, page *datastore.Pagination, out interface{}) error {
+	atomic.AddInt32(&r.lookups, 1)
+	time.Sleep(20 * time.Millisecond)
+	return r.Repository.FindInto(ctx, query, page, out)
+}
+
+/*
+	TESTS
+*/
+
+func TestCachedRepository(t *testing.T) {
+	m := miniredis.RunT(t)
+	config := &datastore.CacheConfig{Namespace: "test", TTL: time.Minute}
+
+	t.Run("Memory", func(t *testing.T) {
+		datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+			return datastore.NewCachedRepository(datastore.NewMemoryDatastore(), cache.NewLRU(100), config)
+		})
+	})
+	t.Run("Redis", func(t *testing.T) {
+		c := cache.New(&cache.Config{Driver: cache.DriverRedis, Uri: "redis://" + m.Addr()})
+		defer c.Close()
+		datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+			return datastore.NewCachedRepository(datastore.NewMemoryDatastore(), c, config)
+		})
+	})
+}
+
+func TestCacheStats(t *testing.T) {
+	base := &countingRepository{Repository: datastore.NewMemoryDatastore()}
+	r := datastore.NewCachedRepository(base, cache.NewLRU(100), &datastore.CacheConfig{
+		TTL:  time.Minute,
+		TTLs: map[string]time.Duration{"audit": 0},
+	})
+	ctx := context.Background()
+	people := datastore.Query{From: "people"}
+	find := func(query datastore.Query) []datastoretest.Person {
+		res := []datastoretest.Person{}
+		require.Nil(t, r.FindInto(ctx, query, nil, &res))
+		return res
+	}
+
+	res, err := r.Insert(ctx, people, datastoretest.Person{Name: "ann"})
+	require.Nil(t, err)
+	id := res.(*datastore.InsertResult).InsertedID
+
+	// Concurrent misses share one lookup
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Len(t, find(people), 1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), base.lookups)
+
+	assert.Len(t, find(people), 1)
+	assert.Equal(t, int32(1), base.lookups, "Served from the cache")
+	assert.Equal(t, "ann", find(datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: "people"})[0].Name)
+	assert.Equal(t, int32(2), base.lookups, "Lookups by ID are cached apart")
+
+	_, err = r.Update(ctx, datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: "people"}, datastore.M{"$set": datastore.M{"name": "bob"}})
+	require.Nil(t, err)
+	assert.Equal(t, "bob", find(people)[0].Name, "Writes invalidate the collection")
+	assert.Equal(t, int32(3), base.lookups)
+
+	find(datastore.Query{From: "audit"})
+	find(datastore.Query{From: "audit"})
+	assert.Equal(t, int32(5), base.lookups, "Collections with a zero TTL are not cached")
+
+	stats := r.(datastore.CacheStatsReporter).CacheStats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(12), stats.Misses)
+	assert.Equal(t, uint64(9), stats.Shared)
+	assert.Equal(t, uint64(2), stats.Invalidations)
+	assert.Equal(t, []datastore.CollectionCacheStats{{Name: "people", Hits: 1, Misses: 12}}, stats.Collections)
+}
@@ -2,177 +2,255 @@ package datastore
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
-	"go.mongodb.org/mongo-driver/x/bsonx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
 )
 
 type Repository interface {
-	Close()
+	Close() error
+	// EnsureIndexes Creates a unique index per entry of indexQuery, an entry listing several
+	// comma separated fields is a compound index, e.g. tenantId,email
 	EnsureIndexes(coll string, indexQuery []string)
-	Find(query Query) (*[]models.Model, error)
-	Insert(query Query, d interface{}) (interface{}, error)
-	Update(query Query, d interface{}) (interface{}, error)
-	Delete(query Query) (interface{}, error)
-	Paginate(query Query, page Pagination) (*[]models.Model, error)
-	Aggregate(query Query, pipeline []bson.M) (*mongo.Cursor, error)
+	Find(ctx context.Context, query Query) (*[]models.Model, error)
+	Insert(ctx context.Context, query Query, d interface{}) (interface{}, error)
+	// Update Applies d to the first match, d is either a document of update operators such as
+	// $set or a replacement document, which keeps the _id of the match. ErrNotFound when nothing
+	// matches
+	Update(ctx context.Context, query Query, d interface{}) (interface{}, error)
+	Delete(ctx context.Context, query Query) (interface{}, error)
+	Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error)
+	FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error
 }
 
+// Transactor Is implemented by backends that can run several operations atomically
+type Transactor interface {
+	// Transaction Runs fn against a Repository bound to one transaction, which commits when
+	// fn returns nil and rolls back otherwise. Nested calls join the outer transaction
+	Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error
+}
+
+// FindOneAndUpdater Is implemented by backends that can claim a document atomically
+type FindOneAndUpdater interface {
+	// FindOneAndUpdate Applies the update d to the first match in sort order and decodes the
+	// document as it is after the update into out. Concurrent calls never both update a document
+	// that no longer matches once the other one updated it. ErrNotFound when nothing matches
+	FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error
+}
+
+// Streamer Is implemented by backends that can iterate over matches without holding them all
+type Streamer interface {
+	// Stream Calls fn with every match in sort order, decode decodes the match into out. Stream
+	// stops at the first error fn returns and returns it
+	Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error
+}
+
+// Drivers selectable with Config.Driver
+const (
+	DriverMongo    = "mongo"
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 // Config Is the Datastore config
 type Config struct {
+	// Driver defaults to mongo
+	Driver string
+	// Uri is the mongo server, the postgres connection string or the sqlite database file
 	Uri          string
 	DatabaseName string
+	Mongo        MongoOptions
+}
+
+// MongoOptions Are only read by the mongo driver, zero values keep the ones in Uri or the driver defaults
+type MongoOptions struct {
+	MinPoolSize            uint64
+	MaxPoolSize            uint64
+	ServerSelectionTimeout time.Duration
+	// ReadConcern is a level such as local or majority
+	ReadConcern string
+	// WriteConcern is majority, a number of nodes or a tag set
+	WriteConcern string
+	// ReadPreference is a mode such as primary or secondaryPreferred
+	ReadPreference string
+	TLS            bool
+	TLSCAFile      string
+	// TLSCertificateKeyFile holds the client certificate and its key in PEM
+	TLSCertificateKeyFile string
+	// ConnectRetries is how many times startup pings are retried before the service starts
+	// without mongo and lets the driver reconnect in the background
+	ConnectRetries int
 }
 
+// M Is a document, filter or projection. Every backend understands the same subset of
+// mongo query syntax: field equality, dotted paths, $eq $ne $gt $gte $lt $lte $in $nin
+// $exists $regex $not $and $or $nor, and the $set $unset $inc update operators
+type M map[string]interface{}
+
+// ID Is a document ID in a filter, backends convert it to their native ID type
+type ID string
+
 // Query Is the query builder object
 type Query struct {
-	Select bson.M
-	Where  bson.M
+	Select M
+	Where  M
 	From   string
 }
 
 type Pagination struct {
 	Page  int
 	Limit int
-	Sort  bson.M
+	// Sort lists fields in priority order, a leading - sorts descending
+	Sort []string
 }
 
-type datastore struct {
-	c  *mongo.Client
-	db *mongo.Database
+// offset Is the number of matches skipped, pages before the first read as the first
+func (p Pagination) offset() int {
+	if p.Page < 1 || p.Limit < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
 }
 
-// NewDatastore Will initialize a new datastore which contains the client connection
-func NewDatastore(config *Config) Repository {
-	client, err := mongo.NewClient(options.Client().ApplyURI(fmt.Sprintf("%s/%s", config.Uri, config.DatabaseName)))
-	if err != nil {
-		log.Fatal(err)
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	log.Infof("Connecting to %s", config.Uri)
-	err = client.Connect(ctx)
-	db := client.Database(config.DatabaseName)
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = client.Ping(context.Background(), readpref.Primary())
-	if err != nil {
-		log.Fatal(err)
-	}
+// InsertResult Is returned by Insert on backends other than mongo
+type InsertResult struct {
+	InsertedID string
+}
 
-	return &datastore{c: client, db: db}
+// DuplicateKeyError Is returned when a write violates a unique index
+type DuplicateKeyError struct {
+	Collection string
+	Field      string
 }
 
-// Close Will close the datastores connection
-func (ds *datastore) Close() {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err := ds.c.Disconnect(ctx)
-	if err != nil {
-		log.Fatal(err)
-	}
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key error collection: %s index: %s", e.Collection, e.Field)
 }
 
-// EnsureIndexes Makes sure datastore indexes are created
-func (ds *datastore) EnsureIndexes(coll string, indexQuery []string) {
-	opts := options.CreateIndexes().SetMaxTime(5 * time.Second)
-	index := []mongo.IndexModel{}
-	for _, val := range indexQuery {
-		tmp := mongo.IndexModel{
-			Options: options.Index().SetUnique(true),
-		}
-		tmp.Keys = bsonx.Doc{{Key: val, Value: bsonx.Int32(1)}}
-		index = append(index, tmp)
-	}
+// DuplicateKey Marks the error for utils.ErrorWrapper
+func (e *DuplicateKeyError) DuplicateKey() bool {
+	return true
+}
 
-	_, err := ds.db.Collection(coll).Indexes().CreateMany(context.Background(), index, opts)
-	if err != nil {
-		log.Fatal(err)
-	}
+type notFoundError struct{}
+
+func (notFoundError) Error() string {
+	return "no documents in result"
 }
 
-// Find Will find an entry within the datastore
-func (ds *datastore) Find(query Query) (*[]models.Model, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// NotFound Marks the error for utils.ErrorWrapper
+func (notFoundError) NotFound() bool {
+	return true
+}
 
-	o := options.Find().SetProjection(query.Select)
-	cursor, err := ds.db.Collection(query.From).Find(ctx, query.Where, o)
-	if err != nil {
-		return nil, err
-	}
+// ErrNotFound Is returned when Update or Delete match nothing
+var ErrNotFound error = notFoundError{}
 
-	var res []models.Model
-	for cursor.Next(context.Background()) {
-		var m models.Model
-		_ = cursor.Decode(&m)
-		res = append(res, m)
-	}
+// ErrNoTransactions Is returned by Transaction when the backend cannot run transactions
+var ErrNoTransactions = errors.New("datastore does not support transactions")
 
-	return &res, err
-}
+// ErrNoFindOneAndUpdate Is returned by FindOneAndUpdate when the backend cannot find and update atomically
+var ErrNoFindOneAndUpdate = errors.New("datastore does not support find one and update")
 
-// Insert Will insert an entry into datastore
-func (ds *datastore) Insert(query Query, d interface{}) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// ErrNoStream Is returned by Stream when the backend cannot iterate over matches
+var ErrNoStream = errors.New("datastore does not support streaming")
 
-	res, err := ds.db.Collection(query.From).InsertOne(ctx, d)
-	return res, err
+// New Will initialize the datastore selected by config.Driver
+func New(config *Config) Repository {
+	switch config.Driver {
+	case "", DriverMongo:
+		return NewDatastore(config)
+	case DriverMemory:
+		log.Warn("Using the memory datastore, data is lost on shutdown")
+		return NewMemoryDatastore()
+	case DriverPostgres:
+		return NewPostgresDatastore(config)
+	case DriverSQLite:
+		return NewSQLiteDatastore(config)
+	}
+	log.Fatalf("Unknown datastore driver %q", config.Driver)
+	return nil
 }
 
-// Update will update an entry from the datastore
-func (ds *datastore) Update(query Query, d interface{}) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// ForTenant Returns a copy of the config opening the database of a tenant. Mongo databases are
+// named after the database and the tenant, postgres and sqlite Uris name it with a {tenant}
+// placeholder and every memory datastore is a database of its own
+func (c *Config) ForTenant(tenant string) (*Config, error) {
+	t := *c
+	switch c.Driver {
+	case "", DriverMongo:
+		t.DatabaseName = c.DatabaseName + "_" + tenant
+	case DriverPostgres, DriverSQLite:
+		if !strings.Contains(c.Uri, "{tenant}") {
+			return nil, fmt.Errorf("the %s Uri needs a {tenant} placeholder to open a database per tenant", c.Driver)
+		}
+		t.Uri = strings.ReplaceAll(c.Uri, "{tenant}", tenant)
+	}
+	return &t, nil
+}
 
-	res := ds.db.Collection(query.From).FindOneAndUpdate(ctx, query.Where, d)
-	return res, res.Err()
+// Transaction Runs fn in a transaction when r is a Transactor
+func Transaction(ctx context.Context, r Repository, fn func(ctx context.Context, tx Repository) error) error {
+	t, ok := r.(Transactor)
+	if !ok {
+		return ErrNoTransactions
+	}
+	return t.Transaction(ctx, fn)
 }
 
-// Delete will delete an entry from the datastore
-func (ds *datastore) Delete(query Query) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// FindOneAndUpdate Runs the update when r is a FindOneAndUpdater
+func FindOneAndUpdate(ctx context.Context, r Repository, query Query, sort []string, d interface{}, out interface{}) error {
+	f, ok := r.(FindOneAndUpdater)
+	if !ok {
+		return ErrNoFindOneAndUpdate
+	}
+	return f.FindOneAndUpdate(ctx, query, sort, d, out)
+}
 
-	res := ds.db.Collection(query.From).FindOneAndDelete(ctx, query.Where)
-	return res, res.Err()
+// Stream Iterates over the matches when r is a Streamer
+func Stream(ctx context.Context, r Repository, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	st, ok := r.(Streamer)
+	if !ok {
+		return ErrNoStream
+	}
+	return st.Stream(ctx, query, sort, fn)
 }
 
-// Paginate provides pagination to the find operation
-func (ds *datastore) Paginate(query Query, page Pagination) (*[]models.Model, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// NewID Returns a new document ID, IDs are 24 character hex strings on every backend
+func NewID() string {
+	return primitive.NewObjectID().Hex()
+}
 
-	o := options.Find().SetSort(page.Sort).SetLimit(int64(page.Limit)).SetSkip(int64((page.Page - 1) * page.Limit))
-	cursor, err := ds.db.Collection(query.From).Find(ctx, query.Where, o)
-	if err != nil {
-		return nil, err
+// ValidID Reports whether id could have been returned by NewID
+func ValidID(id string) bool {
+	if len(id) != 24 {
+		return false
 	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
 
-	var res []models.Model
-	for cursor.Next(context.Background()) {
-		var m models.Model
-		_ = cursor.Decode(&m)
+// indexFields splits a compound index entry into its fields
+func indexFields(index string) []string {
+	fields := strings.Split(index, ",")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
 	}
-
-	return &res, err
+	return fields
 }
 
-// Aggregate uses mongodbs Aggregate operation
-func (ds *datastore) Aggregate(query Query, pipeline []bson.M) (*mongo.Cursor, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	return ds.db.Collection(query.From).Aggregate(ctx, pipeline)
+// parseSort splits a Sort entry into its field and direction
+func parseSort(s string) (string, bool) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], true
+	}
+	return strings.TrimPrefix(s, "+"), false
 }
@@ -0,0 +1,523 @@
+// Package datastoretest holds the conformance suite every datastore.Repository must pass.
+// Transactions are checked on backends implementing datastore.Transactor, claims on backends
+// implementing datastore.FindOneAndUpdater and streams on backends implementing datastore.Streamer.
+package datastoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// Person Is the document the suite stores
+type Person struct {
+	ID    string    `bson:"_id,omitempty"`
+	Name  string    `bson:"name,omitempty"`
+	Email string    `bson:"email,omitempty"`
+	Age   int       `bson:"age,omitempty"`
+	Tags  []string  `bson:"tags,omitempty"`
+	Seen  time.Time `bson:"seen,omitempty"`
+}
+
+var seen = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+/*
+* PRIVATE
+ */
+
+// seed stores three people in a collection unique to the test, so backends can share a database
+func seed(t *testing.T, r datastore.Repository) string {
+	coll := fmt.Sprintf("people_%d", time.Now().UnixNano())
+	people := []Person{
+		{Name: "ann", Email: "ann@test.com", Age: 31, Tags: []string{"admin"}, Seen: seen},
+		{Name: "bob", Email: "bob@test.com", Age: 25, Seen: seen.Add(time.Hour)},
+		{Name: "cid", Email: "cid@test.com", Age: 40, Tags: []string{"ops", "admin"}},
+	}
+	for _, p := range people {
+		_, err := r.Insert(context.Background(), datastore.Query{From: coll}, p)
+		require.Nil(t, err)
+	}
+	return coll
+}
+
+func names(people []Person) []string {
+	res := []string{}
+	for _, p := range people {
+		res = append(res, p.Name)
+	}
+	return res
+}
+
+func kind(u utils.Utils, err error) apperrors.Kind {
+	return apperrors.KindOf(u.ErrorWrapper(err))
+}
+
+func find(t *testing.T, r datastore.Repository, query datastore.Query, page *datastore.Pagination) []Person {
+	res := []Person{}
+	err := r.FindInto(context.Background(), query, page, &res)
+	require.Nil(t, err)
+	return res
+}
+
+/*
+* PUBLIC
+ */
+
+// Run Executes the suite, newRepository is called once per test
+func Run(t *testing.T, newRepository func(t *testing.T) datastore.Repository) {
+	t.Run("Where", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+
+		tests := []struct {
+			description string
+			where       datastore.M
+			expected    []string
+		}{
+			{"Everything", nil, []string{"ann", "bob", "cid"}},
+			{"Equality", datastore.M{"name": "bob"}, []string{"bob"}},
+			{"Comparison", datastore.M{"age": datastore.M{"$gte": 30}}, []string{"ann", "cid"}},
+			{"Range", datastore.M{"age": datastore.M{"$gt": 24, "$lt": 40}}, []string{"ann", "bob"}},
+			{"Not equal", datastore.M{"name": datastore.M{"$ne": "ann"}}, []string{"bob", "cid"}},
+			{"In", datastore.M{"name": datastore.M{"$in": []string{"ann", "cid"}}}, []string{"ann", "cid"}},
+			{"Not in", datastore.M{"name": datastore.M{"$nin": []string{"ann", "cid"}}}, []string{"bob"}},
+			{"Array contains", datastore.M{"tags": "admin"}, []string{"ann", "cid"}},
+			{"Exists", datastore.M{"tags": datastore.M{"$exists": false}}, []string{"bob"}},
+			{"Regex", datastore.M{"email": datastore.M{"$regex": "^(ann|bob)@"}}, []string{"ann", "bob"}},
+			{"Time", datastore.M{"seen": datastore.M{"$gt": seen}}, []string{"bob"}},
+			{"Not", datastore.M{"age": datastore.M{"$not": datastore.M{"$gt": 30}}}, []string{"bob"}},
+			{"Or", datastore.M{"$or": []datastore.M{{"name": "ann"}, {"age": 40}}}, []string{"ann", "cid"}},
+			{"And", datastore.M{"$and": []datastore.M{{"tags": "admin"}, {"age": datastore.M{"$lt": 35}}}}, []string{"ann"}},
+		}
+
+		for _, test := range tests {
+			res := find(t, r, datastore.Query{Where: test.where, From: coll}, nil)
+			assert.Equalf(t, test.expected, names(res), test.description)
+		}
+	})
+
+	t.Run("ID", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+
+		res, err := r.Insert(context.Background(), datastore.Query{From: coll}, Person{Name: "dan"})
+		require.Nil(t, err)
+		id := fmt.Sprint(res)
+		all := find(t, r, datastore.Query{Where: datastore.M{"name": "dan"}, From: coll}, nil)
+		require.Len(t, all, 1)
+		assert.True(t, datastore.ValidID(all[0].ID), "IDs are 24 character hex strings")
+		assert.Contains(t, id, all[0].ID, "Insert returns the new ID")
+
+		byID := find(t, r, datastore.Query{Where: datastore.M{"_id": datastore.ID(all[0].ID)}, From: coll}, nil)
+		assert.Equal(t, []string{"dan"}, names(byID))
+	})
+
+	t.Run("Explicit IDs", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+
+		// IDs given by the caller are found, updated and deleted by ID like generated ones
+		id := datastore.NewID()
+		_, err := r.Insert(ctx, datastore.Query{From: coll}, Person{ID: id, Name: "dan"})
+		require.Nil(t, err)
+		byID := datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: coll}
+
+		res := find(t, r, byID, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, id, res[0].ID)
+
+		_, err = r.Update(ctx, byID, datastore.M{"$set": datastore.M{"age": 40}})
+		require.Nil(t, err)
+		res = find(t, r, byID, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, 40, res[0].Age)
+
+		_, err = r.Delete(ctx, byID)
+		require.Nil(t, err)
+		assert.Empty(t, find(t, r, byID, nil))
+		_, err = r.Delete(ctx, byID)
+		assert.ErrorIs(t, err, datastore.ErrNotFound)
+	})
+
+	t.Run("Paginate and select", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+
+		res := find(t, r, datastore.Query{From: coll}, &datastore.Pagination{Page: 1, Limit: 2, Sort: []string{"-age"}})
+		assert.Equal(t, []string{"cid", "ann"}, names(res))
+
+		res = find(t, r, datastore.Query{From: coll}, &datastore.Pagination{Page: 2, Limit: 2, Sort: []string{"-age"}})
+		assert.Equal(t, []string{"bob"}, names(res))
+
+		// Missing fields sort lowest
+		res = find(t, r, datastore.Query{From: coll}, &datastore.Pagination{Page: 1, Limit: 3, Sort: []string{"seen", "name"}})
+		assert.Equal(t, []string{"cid", "ann", "bob"}, names(res))
+
+		res = find(t, r, datastore.Query{Select: datastore.M{"name": 1}, Where: datastore.M{"name": "ann"}, From: coll}, nil)
+		require.Len(t, res, 1)
+		assert.NotEmpty(t, res[0].ID)
+		assert.Empty(t, res[0].Email)
+
+		models, err := r.Paginate(context.Background(), datastore.Query{From: coll}, datastore.Pagination{Page: 1, Limit: 2, Sort: []string{"name"}})
+		require.Nil(t, err)
+		assert.Len(t, *models, 2)
+	})
+
+	t.Run("Update and delete", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+
+		_, err := r.Update(ctx, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}, datastore.M{
+			"$set":   datastore.M{"email": "bobby@test.com"},
+			"$inc":   datastore.M{"age": 1},
+			"$unset": datastore.M{"seen": ""},
+		})
+		require.Nil(t, err)
+		res := find(t, r, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, "bobby@test.com", res[0].Email)
+		assert.Equal(t, 26, res[0].Age)
+		assert.True(t, res[0].Seen.IsZero())
+
+		_, err = r.Delete(ctx, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll})
+		require.Nil(t, err)
+		assert.Empty(t, find(t, r, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}, nil))
+
+		_, err = r.Update(ctx, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}, datastore.M{"$set": datastore.M{"age": 1}})
+		assert.ErrorIs(t, err, datastore.ErrNotFound)
+		_, err = r.Delete(ctx, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll})
+		assert.ErrorIs(t, err, datastore.ErrNotFound)
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+		ann := find(t, r, datastore.Query{Where: datastore.M{"name": "ann"}, From: coll}, nil)
+		require.Len(t, ann, 1)
+		byID := datastore.Query{Where: datastore.M{"_id": datastore.ID(ann[0].ID)}, From: coll}
+
+		// Replacement documents drop the fields they leave out and keep the _id
+		_, err := r.Update(ctx, byID, datastore.M{"_id": datastore.NewID(), "name": "ann", "age": 32})
+		require.Nil(t, err)
+		res := find(t, r, byID, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, Person{ID: ann[0].ID, Name: "ann", Age: 32}, res[0])
+		assert.Len(t, find(t, r, datastore.Query{From: coll}, nil), 3)
+
+		_, err = r.Update(ctx, datastore.Query{Where: datastore.M{"name": "dan"}, From: coll}, datastore.M{"name": "dan"})
+		assert.ErrorIs(t, err, datastore.ErrNotFound)
+	})
+
+	t.Run("Find one and update", func(t *testing.T) {
+		r := newRepository(t)
+		if _, ok := r.(datastore.FindOneAndUpdater); !ok {
+			t.Skip("The repository does not support find one and update")
+		}
+		coll := seed(t, r)
+		ctx := context.Background()
+		admins := datastore.Query{Where: datastore.M{"tags": "admin"}, From: coll}
+
+		var p Person
+		err := datastore.FindOneAndUpdate(ctx, r, admins, []string{"-age"}, datastore.M{"$inc": datastore.M{"age": 1}}, &p)
+		require.Nil(t, err)
+		assert.Equal(t, "cid", p.Name, "Takes the first match in sort order")
+		assert.Equal(t, 41, p.Age, "Returns the document after the update")
+
+		err = datastore.FindOneAndUpdate(ctx, r, datastore.Query{Where: datastore.M{"name": "dan"}, From: coll}, nil, datastore.M{"$set": datastore.M{"age": 1}}, &p)
+		assert.True(t, errors.Is(err, datastore.ErrNotFound), "%v", err)
+
+		// Concurrent claims never take the same document
+		unclaimed := datastore.Query{Where: datastore.M{"email": datastore.M{"$exists": true}, "tags": datastore.M{"$ne": "claimed"}}, From: coll}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		claimed := []string{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var p Person
+				err := datastore.FindOneAndUpdate(ctx, r, unclaimed, []string{"name"}, datastore.M{"$set": datastore.M{"tags": []string{"claimed"}}}, &p)
+				if errors.Is(err, datastore.ErrNotFound) {
+					return
+				}
+				assert.Nil(t, err)
+				mu.Lock()
+				defer mu.Unlock()
+				claimed = append(claimed, p.Name)
+			}()
+		}
+		wg.Wait()
+		assert.ElementsMatch(t, []string{"ann", "bob", "cid"}, claimed)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		r := newRepository(t)
+		if _, ok := r.(datastore.Streamer); !ok {
+			t.Skip("The repository does not support streams")
+		}
+		coll := seed(t, r)
+		ctx := context.Background()
+
+		streamed := []Person{}
+		query := datastore.Query{Select: datastore.M{"name": 1}, Where: datastore.M{"age": datastore.M{"$gt": 30}}, From: coll}
+		err := datastore.Stream(ctx, r, query, []string{"-age"}, func(decode func(out interface{}) error) error {
+			var p Person
+			if err := decode(&p); err != nil {
+				return err
+			}
+			streamed = append(streamed, p)
+			return nil
+		})
+		require.Nil(t, err)
+		assert.Equal(t, []string{"cid", "ann"}, names(streamed), "Streams the matches in sort order")
+		assert.Zero(t, streamed[0].Age, "Streams the selected fields")
+
+		stop := errors.New("stop")
+		calls := 0
+		err = datastore.Stream(ctx, r, datastore.Query{From: coll}, nil, func(decode func(out interface{}) error) error {
+			calls++
+			return stop
+		})
+		assert.True(t, errors.Is(err, stop), "%v", err)
+		assert.Equal(t, 1, calls, "Stops at the first error")
+	})
+
+	t.Run("Unique indexes", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+		u := utils.NewUtils()
+		r.EnsureIndexes(coll, []string{"email"})
+
+		_, err := r.Insert(ctx, datastore.Query{From: coll}, Person{Name: "dup", Email: "ann@test.com"})
+		assert.Equal(t, apperrors.KindConflict, kind(u, err))
+
+		_, err = r.Update(ctx, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}, datastore.M{"$set": datastore.M{"email": "cid@test.com"}})
+		assert.Equal(t, apperrors.KindConflict, kind(u, err))
+
+		// Missing fields index as null, as they do in mongo
+		_, err = r.Insert(ctx, datastore.Query{From: coll}, Person{Name: "eve"})
+		assert.Nil(t, err)
+		_, err = r.Insert(ctx, datastore.Query{From: coll}, Person{Name: "fay"})
+		assert.Equal(t, apperrors.KindConflict, kind(u, err))
+
+		// Failed writes leave the data untouched
+		res := find(t, r, datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, "bob@test.com", res[0].Email)
+	})
+
+	t.Run("Compound unique indexes", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+		u := utils.NewUtils()
+		r.EnsureIndexes(coll, []string{"name,email"})
+
+		// Only documents matching on every field of the index collide
+		_, err := r.Insert(ctx, datastore.Query{From: coll}, Person{Name: "ann", Email: "ann@test.com"})
+		assert.Equal(t, apperrors.KindConflict, kind(u, err))
+		_, err = r.Insert(ctx, datastore.Query{From: coll}, Person{Name: "ann", Email: "ann@other.com"})
+		assert.Nil(t, err)
+		_, err = r.Insert(ctx, datastore.Query{From: coll}, Person{Name: "dan", Email: "ann@test.com"})
+		assert.Nil(t, err)
+	})
+
+	t.Run("Insert and find", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+		u := utils.NewUtils()
+
+		models, err := r.Find(ctx, datastore.Query{Where: datastore.M{"name": "ann"}, From: coll})
+		require.Nil(t, err)
+		assert.Len(t, *models, 1)
+
+		// IDs given by the caller are kept and stay unique
+		p := Person{ID: datastore.NewID(), Name: "dan"}
+		_, err = r.Insert(ctx, datastore.Query{From: coll}, p)
+		require.Nil(t, err)
+		_, err = r.Insert(ctx, datastore.Query{From: coll}, p)
+		assert.Equal(t, apperrors.KindConflict, kind(u, err))
+
+		res := find(t, r, datastore.Query{Where: datastore.M{"name": "dan"}, From: coll}, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, p.ID, res[0].ID)
+		assert.Equal(t, []string{"ann", "bob", "cid", "dan"}, names(find(t, r, datastore.Query{From: coll}, nil)), "Natural order is insertion order")
+	})
+
+	t.Run("Pagination bounds", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		byName := []string{"name"}
+
+		tests := []struct {
+			description string
+			page        datastore.Pagination
+			expected    []string
+		}{
+			{"First page", datastore.Pagination{Page: 1, Limit: 2, Sort: byName}, []string{"ann", "bob"}},
+			{"Last page is short", datastore.Pagination{Page: 2, Limit: 2, Sort: byName}, []string{"cid"}},
+			{"Past the end", datastore.Pagination{Page: 3, Limit: 2, Sort: byName}, []string{}},
+			{"Page zero reads as the first", datastore.Pagination{Page: 0, Limit: 2, Sort: byName}, []string{"ann", "bob"}},
+			{"No limit", datastore.Pagination{Page: 1, Sort: byName}, []string{"ann", "bob", "cid"}},
+			{"Limit above the count", datastore.Pagination{Page: 1, Limit: 10, Sort: []string{"-name"}}, []string{"cid", "bob", "ann"}},
+			{"Ties use the next field", datastore.Pagination{Page: 1, Limit: 3, Sort: []string{"-missing", "age"}}, []string{"bob", "ann", "cid"}},
+		}
+
+		for _, test := range tests {
+			page := test.page
+			res := find(t, r, datastore.Query{From: coll}, &page)
+			assert.Equalf(t, test.expected, names(res), test.description)
+		}
+	})
+
+	t.Run("Projections", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		where := datastore.M{"name": "ann"}
+
+		res := find(t, r, datastore.Query{Select: datastore.M{"email": 0, "tags": 0}, Where: where, From: coll}, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, "ann", res[0].Name)
+		assert.Equal(t, 31, res[0].Age)
+		assert.Empty(t, res[0].Email)
+		assert.Empty(t, res[0].Tags)
+
+		res = find(t, r, datastore.Query{Select: datastore.M{"_id": 0, "name": 1}, Where: where, From: coll}, nil)
+		require.Len(t, res, 1)
+		assert.Equal(t, Person{Name: "ann"}, res[0])
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+		missing := datastore.Query{Where: datastore.M{"_id": datastore.ID(datastore.NewID())}, From: coll}
+
+		res := []Person{}
+		require.Nil(t, r.FindInto(ctx, missing, nil, &res))
+		assert.NotNil(t, res)
+		assert.Empty(t, res)
+
+		empty := find(t, r, datastore.Query{From: fmt.Sprintf("%s_empty", coll)}, nil)
+		assert.Empty(t, empty, "Unknown collections are empty")
+
+		_, err := r.Update(ctx, missing, datastore.M{"$set": datastore.M{"age": 1}})
+		assert.ErrorIs(t, err, datastore.ErrNotFound)
+		_, err = r.Delete(ctx, missing)
+		assert.ErrorIs(t, err, datastore.ErrNotFound)
+		assert.Len(t, find(t, r, datastore.Query{From: coll}, nil), 3)
+	})
+
+	t.Run("Transactions", func(t *testing.T) {
+		r := newRepository(t)
+		if _, ok := r.(datastore.Transactor); !ok {
+			t.Skip("The repository does not support transactions")
+		}
+		coll := seed(t, r)
+		ctx := context.Background()
+		failed := errors.New("failed")
+		ann := datastore.Query{Where: datastore.M{"name": "ann"}, From: coll}
+		dan := datastore.Query{Where: datastore.M{"name": "dan"}, From: coll}
+
+		err := datastore.Transaction(ctx, r, func(ctx context.Context, tx datastore.Repository) error {
+			_, err := tx.Insert(ctx, datastore.Query{From: coll}, Person{Name: "dan"})
+			require.Nil(t, err)
+			_, err = tx.Update(ctx, ann, datastore.M{"$set": datastore.M{"age": 1}})
+			require.Nil(t, err)
+			assert.Len(t, find(t, tx, dan, nil), 1, "Reads in a transaction see its writes")
+			return failed
+		})
+		assert.Equal(t, failed, err)
+		assert.Empty(t, find(t, r, dan, nil), "Rolls back when fn fails")
+		assert.Equal(t, 31, find(t, r, ann, nil)[0].Age)
+
+		err = datastore.Transaction(ctx, r, func(ctx context.Context, tx datastore.Repository) error {
+			_, err := tx.Insert(ctx, datastore.Query{From: coll}, Person{Name: "dan"})
+			if err != nil {
+				return err
+			}
+			// Nested calls join the outer transaction
+			return datastore.Transaction(ctx, tx, func(ctx context.Context, tx datastore.Repository) error {
+				_, err := tx.Delete(ctx, ann)
+				return err
+			})
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bob", "cid", "dan"}, names(find(t, r, datastore.Query{From: coll}, nil)), "Commits when fn succeeds")
+	})
+
+	t.Run("Concurrent writes", func(t *testing.T) {
+		r := newRepository(t)
+		coll := seed(t, r)
+		ctx := context.Background()
+		u := utils.NewUtils()
+		r.EnsureIndexes(coll, []string{"email"})
+		bob := datastore.Query{Where: datastore.M{"name": "bob"}, From: coll}
+
+		var wg sync.WaitGroup
+		var created int32
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := r.Update(ctx, bob, datastore.M{"$inc": datastore.M{"age": 1}})
+				assert.Nil(t, err)
+			}()
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := r.Insert(ctx, datastore.Query{From: coll}, Person{Name: fmt.Sprintf("new%d", i), Email: "new@test.com"})
+				if err == nil {
+					atomic.AddInt32(&created, 1)
+					return
+				}
+				assert.Equal(t, apperrors.KindConflict, kind(u, err))
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 45, find(t, r, bob, nil)[0].Age, "No increment is lost")
+		assert.Equal(t, int32(1), created, "Exactly one write wins a unique key")
+
+		if _, ok := r.(datastore.Transactor); !ok {
+			return
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := datastore.Transaction(ctx, r, func(ctx context.Context, tx datastore.Repository) error {
+					_, err := tx.Insert(ctx, datastore.Query{From: coll}, Person{Name: fmt.Sprintf("tx%d", i), Email: fmt.Sprintf("tx%d@test.com", i)})
+					if err != nil {
+						return err
+					}
+					_, err = tx.Update(ctx, bob, datastore.M{"$inc": datastore.M{"age": 1}})
+					return err
+				})
+				assert.Nil(t, err)
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 55, find(t, r, bob, nil)[0].Age)
+		assert.Len(t, find(t, r, datastore.Query{Where: datastore.M{"name": datastore.M{"$regex": "^tx"}}, From: coll}, nil), 10)
+	})
+}
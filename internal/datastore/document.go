@@ -0,0 +1,288 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+// Helpers shared by the backends that evaluate queries themselves, documents are handled as
+// normalized bson so every backend agrees on field names and value types
+
+// normalize round trips v through bson so stored documents and query values share the same types
+func normalize(v interface{}) (interface{}, error) {
+	b, err := bson.Marshal(bson.M{"v": v})
+	if err != nil {
+		return nil, err
+	}
+	var out bson.M
+	if err := bson.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out["v"], nil
+}
+
+func toDocument(d interface{}) (bson.M, error) {
+	b, err := bson.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	err = bson.Unmarshal(b, &doc)
+	return doc, err
+}
+
+func asDocument(v interface{}) (bson.M, bool) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, true
+	case M:
+		return bson.M(d), true
+	case primitive.D:
+		return d.Map(), true
+	case map[string]interface{}:
+		return bson.M(d), true
+	}
+	return nil, false
+}
+
+// lookup resolves a dotted path
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		d, ok := asDocument(cur)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = d[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func assign(doc bson.M, path string, v interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := asDocument(doc[key])
+		if !ok {
+			next = bson.M{}
+		}
+		doc[key] = next
+		doc = next
+	}
+	doc[keys[len(keys)-1]] = v
+}
+
+func unassign(doc bson.M, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := asDocument(doc[key])
+		if !ok {
+			return
+		}
+		doc = next
+	}
+	delete(doc, keys[len(keys)-1])
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// compare orders two bson values of the same kind, ok is false when they cannot be ordered
+func compare(a interface{}, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case primitive.DateTime:
+		y, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		n, _ := compare(int64(x), int64(y))
+		return n, true
+	case primitive.ObjectID:
+		y, ok := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:]), ok
+	case bool:
+		y, ok := b.(bool)
+		if !ok || x == y {
+			return 0, ok
+		}
+		if !x {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func equal(a interface{}, b interface{}) bool {
+	if n, ok := compare(a, b); ok {
+		return n == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// project applies an inclusion or exclusion projection, _id is kept unless excluded
+func project(doc bson.M, sel bson.M) bson.M {
+	if len(sel) == 0 {
+		return doc
+	}
+	include := false
+	for k, v := range sel {
+		if n, ok := number(v); (ok && n != 0 || v == true) && k != "_id" {
+			include = true
+		}
+	}
+
+	out := bson.M{}
+	if !include {
+		for k, v := range doc {
+			out[k] = v
+		}
+	} else if id, ok := doc["_id"]; ok {
+		out["_id"] = id
+	}
+	for k, v := range sel {
+		n, _ := number(v)
+		keep := n != 0 || v == true
+		if keep && include {
+			if fv, ok := lookup(doc, k); ok {
+				assign(out, k, fv)
+			}
+		}
+		if !keep {
+			unassign(out, k)
+		}
+	}
+	return out
+}
+
+func applyUpdate(doc bson.M, update bson.M) (bson.M, error) {
+	if _, ok := isOperatorDocument(update); !ok {
+		// Replacement documents keep the _id
+		out := bson.M{"_id": doc["_id"]}
+		for k, v := range update {
+			if k != "_id" {
+				out[k] = v
+			}
+		}
+		return out, nil
+	}
+
+	out, err := toDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	for op, arg := range update {
+		fields, ok := asDocument(arg)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a document", op)
+		}
+		for path, v := range fields {
+			switch op {
+			case "$set":
+				assign(out, path, v)
+			case "$unset":
+				unassign(out, path)
+			case "$inc":
+				cur, _ := lookup(out, path)
+				x, _ := number(cur)
+				y, ok := number(v)
+				if !ok {
+					return nil, fmt.Errorf("$inc needs a number")
+				}
+				if _, isFloat := cur.(float64); isFloat || reflect.TypeOf(v).Kind() == reflect.Float64 {
+					assign(out, path, x+y)
+				} else {
+					assign(out, path, int64(x+y))
+				}
+			default:
+				return nil, fmt.Errorf("unsupported update operator %s", op)
+			}
+		}
+	}
+	return out, nil
+}
+
+func decodeInto(docs []bson.M, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("out must be a pointer to a slice, got %T", out)
+	}
+	slice := reflect.MakeSlice(v.Elem().Type(), 0, len(docs))
+	for _, doc := range docs {
+		b, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(b, elem.Interface()); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem.Elem())
+	}
+	v.Elem().Set(slice)
+	return nil
+}
+
+// decodeOne decodes a single document into out, which must be a pointer
+func decodeOne(doc bson.M, out interface{}) error {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(b, out)
+}
+
+func decodeModels(ctx context.Context, coll string, docs []bson.M) *[]models.Model {
+	var res []models.Model
+	for _, doc := range docs {
+		var m models.Model
+		b, err := bson.Marshal(doc)
+		if err == nil {
+			err = bson.Unmarshal(b, &m)
+		}
+		if err != nil {
+			logging.FromContext(ctx).WithField("collection", coll).Warn(err)
+			continue
+		}
+		res = append(res, m)
+	}
+	return &res
+}
@@ -0,0 +1,558 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+// rwLocker Lets the Repository of a transaction skip the lock its transaction already holds
+type rwLocker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+type nopLocker struct{}
+
+func (nopLocker) Lock()    {}
+func (nopLocker) Unlock()  {}
+func (nopLocker) RLock()   {}
+func (nopLocker) RUnlock() {}
+
+type memoryDatastore struct {
+	mu rwLocker
+	// tx is set on the Repository handed to Transaction
+	tx bool
+	// Documents are stored as normalized bson, in insertion order
+	collections map[string][]bson.M
+	// Unique indexes per collection
+	indexes map[string][]string
+}
+
+// NewMemoryDatastore Will initialize an in-memory datastore, data is lost on Close
+func NewMemoryDatastore() Repository {
+	return &memoryDatastore{
+		mu:          &sync.RWMutex{},
+		collections: map[string][]bson.M{},
+		indexes:     map[string][]string{},
+	}
+}
+
+/*
+* PRIVATE
+ */
+
+// equalOrContains follows mongo where a scalar matches any element of an array field
+func equalOrContains(field interface{}, v interface{}) bool {
+	if equal(field, v) {
+		return true
+	}
+	if arr, ok := field.(primitive.A); ok {
+		for _, e := range arr {
+			if equal(e, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchOperator(field interface{}, exists bool, op string, arg interface{}) (bool, error) {
+	switch op {
+	case "$eq":
+		return exists && equalOrContains(field, arg), nil
+	case "$ne":
+		return !exists || !equalOrContains(field, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exists {
+			return false, nil
+		}
+		n, ok := compare(field, arg)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case "$gt":
+			return n > 0, nil
+		case "$gte":
+			return n >= 0, nil
+		case "$lt":
+			return n < 0, nil
+		}
+		return n <= 0, nil
+	case "$in", "$nin":
+		arr, ok := arg.(primitive.A)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array", op)
+		}
+		found := false
+		for _, v := range arr {
+			if exists && equalOrContains(field, v) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$exists":
+		want, _ := arg.(bool)
+		return exists == want, nil
+	case "$regex":
+		s, ok := field.(string)
+		if !ok {
+			return false, nil
+		}
+		var pattern string
+		switch r := arg.(type) {
+		case string:
+			pattern = r
+		case primitive.Regex:
+			pattern = r.Pattern
+			if len(r.Options) != 0 {
+				pattern = "(?" + r.Options + ")" + pattern
+			}
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(s), nil
+	case "$not":
+		cond, ok := asDocument(arg)
+		if !ok {
+			return false, fmt.Errorf("$not needs a document")
+		}
+		m, err := matchCondition(field, exists, cond)
+		return !m, err
+	}
+	return false, fmt.Errorf("unsupported query operator %s", op)
+}
+
+func isOperatorDocument(v interface{}) (bson.M, bool) {
+	d, ok := asDocument(v)
+	if !ok || len(d) == 0 {
+		return nil, false
+	}
+	for k := range d {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return d, true
+}
+
+func matchCondition(field interface{}, exists bool, cond bson.M) (bool, error) {
+	for op, arg := range cond {
+		if op == "$options" {
+			continue
+		}
+		if op == "$regex" {
+			if opts, ok := cond["$options"].(string); ok {
+				arg = primitive.Regex{Pattern: fmt.Sprint(arg), Options: opts}
+			}
+		}
+		m, err := matchOperator(field, exists, op, arg)
+		if err != nil || !m {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchAll(doc bson.M, clauses interface{}, any bool) (bool, error) {
+	arr, ok := clauses.(primitive.A)
+	if !ok {
+		return false, fmt.Errorf("logical operators need an array")
+	}
+	for _, c := range arr {
+		where, ok := asDocument(c)
+		if !ok {
+			return false, fmt.Errorf("logical operators need documents")
+		}
+		m, err := match(doc, where)
+		if err != nil {
+			return false, err
+		}
+		if m == any {
+			return any, nil
+		}
+	}
+	return !any, nil
+}
+
+// match reports whether doc satisfies a normalized where clause
+func match(doc bson.M, where bson.M) (bool, error) {
+	for key, cond := range where {
+		var m bool
+		var err error
+		switch key {
+		case "$and":
+			m, err = matchAll(doc, cond, false)
+		case "$or":
+			m, err = matchAll(doc, cond, true)
+		case "$nor":
+			m, err = matchAll(doc, cond, true)
+			m = !m
+		default:
+			field, exists := lookup(doc, key)
+			if ops, ok := isOperatorDocument(cond); ok {
+				m, err = matchCondition(field, exists, ops)
+			} else if re, ok := cond.(primitive.Regex); ok {
+				m, err = matchOperator(field, exists, "$regex", re)
+			} else {
+				m = exists && equalOrContains(field, cond)
+			}
+		}
+		if err != nil || !m {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// lessDocument orders by the Sort fields, missing fields sort lowest as they do in mongo
+func lessDocument(a bson.M, b bson.M, by []string) bool {
+	for _, s := range by {
+		field, desc := parseSort(s)
+		x, xok := lookup(a, field)
+		y, yok := lookup(b, field)
+		var n int
+		switch {
+		case !xok && !yok:
+			continue
+		case !xok:
+			n = -1
+		case !yok:
+			n = 1
+		default:
+			n, _ = compare(x, y)
+		}
+		if n == 0 {
+			continue
+		}
+		if desc {
+			return n > 0
+		}
+		return n < 0
+	}
+	return false
+}
+
+func sortDocuments(docs []bson.M, by []string) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return lessDocument(docs[i], docs[j], by)
+	})
+}
+
+// find returns copies of the matching documents, the caller must hold the lock
+func (ds *memoryDatastore) find(query Query, page *Pagination) ([]bson.M, []int, error) {
+	where, err := normalize(query.Where)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, _ := asDocument(where)
+
+	var res []bson.M
+	var positions []int
+	for i, doc := range ds.collections[query.From] {
+		m, err := match(doc, w)
+		if err != nil {
+			return nil, nil, err
+		}
+		if m {
+			res = append(res, doc)
+			positions = append(positions, i)
+		}
+	}
+
+	if page != nil {
+		if len(page.Sort) != 0 {
+			sortDocuments(res, page.Sort)
+		}
+		skip := page.offset()
+		if skip > len(res) {
+			skip = len(res)
+		}
+		res = res[skip:]
+		if page.Limit > 0 && page.Limit < len(res) {
+			res = res[:page.Limit]
+		}
+	}
+
+	out := make([]bson.M, 0, len(res))
+	for _, doc := range res {
+		out = append(out, project(doc, bson.M(query.Select)))
+	}
+	return out, positions, nil
+}
+
+// checkUnique validates doc against the unique indexes, skip is the position of doc itself or -1
+func (ds *memoryDatastore) checkUnique(coll string, doc bson.M, skip int) error {
+	for _, index := range ds.indexes[coll] {
+		fields := indexFields(index)
+		for i, other := range ds.collections[coll] {
+			if i == skip {
+				continue
+			}
+			same := true
+			for _, field := range fields {
+				// Missing fields index as null, as they do in mongo
+				v, _ := lookup(doc, field)
+				ov, _ := lookup(other, field)
+				same = same && equal(v, ov)
+			}
+			if same {
+				return &DuplicateKeyError{Collection: coll, Field: index}
+			}
+		}
+	}
+	return nil
+}
+
+// update replaces the first match in sort order, the caller must hold the lock
+func (ds *memoryDatastore) update(query Query, by []string, d interface{}) (bson.M, bson.M, error) {
+	update, err := normalize(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, ok := asDocument(update)
+	if !ok {
+		return nil, nil, fmt.Errorf("update must be a document, got %T", d)
+	}
+
+	_, positions, err := ds.find(Query{Where: query.Where, From: query.From}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(positions) == 0 {
+		return nil, nil, ErrNotFound
+	}
+
+	// The first match in sort order, ties keep insertion order
+	docs := ds.collections[query.From]
+	i := positions[0]
+	for _, p := range positions[1:] {
+		if lessDocument(docs[p], docs[i], by) {
+			i = p
+		}
+	}
+	before := docs[i]
+	after, err := applyUpdate(before, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ds.checkUnique(query.From, after, i); err != nil {
+		return nil, nil, err
+	}
+	ds.collections[query.From][i] = after
+	return before, after, nil
+}
+
+/*
+* PUBLIC
+ */
+
+// Close Will drop every collection, it does nothing on the Repository of a transaction
+func (ds *memoryDatastore) Close() error {
+	if ds.tx {
+		return nil
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.collections = map[string][]bson.M{}
+	ds.indexes = map[string][]string{}
+	return nil
+}
+
+// Transaction Runs fn against a copy of the data that replaces it when fn succeeds, holding
+// the lock throughout so transactions are serializable
+func (ds *memoryDatastore) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if ds.tx {
+		return fn(ctx, ds)
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	tx := &memoryDatastore{
+		mu:          nopLocker{},
+		tx:          true,
+		collections: make(map[string][]bson.M, len(ds.collections)),
+		indexes:     make(map[string][]string, len(ds.indexes)),
+	}
+	// Writes replace documents and slices, so copying the slices isolates the transaction
+	for coll, docs := range ds.collections {
+		tx.collections[coll] = append([]bson.M(nil), docs...)
+	}
+	for coll, fields := range ds.indexes {
+		tx.indexes[coll] = append([]string(nil), fields...)
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	ds.collections = tx.collections
+	ds.indexes = tx.indexes
+	return nil
+}
+
+// EnsureIndexes Makes sure the unique indexes exist, existing duplicates are fatal as they are with mongo
+func (ds *memoryDatastore) EnsureIndexes(coll string, indexQuery []string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	for _, field := range indexQuery {
+		exists := false
+		for _, f := range ds.indexes[coll] {
+			exists = exists || f == field
+		}
+		if exists {
+			continue
+		}
+		ds.indexes[coll] = append(ds.indexes[coll], field)
+	}
+	for i, doc := range ds.collections[coll] {
+		if err := ds.checkUnique(coll, doc, i); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Find Will find an entry within the datastore
+func (ds *memoryDatastore) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	docs, _, err := ds.find(query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeModels(ctx, query.From, docs), nil
+}
+
+// Insert Will insert an entry into datastore
+func (ds *memoryDatastore) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	switch id := doc["_id"].(type) {
+	case string:
+	case primitive.ObjectID:
+		doc["_id"] = id.Hex()
+	default:
+		doc["_id"] = NewID()
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// _id is always unique
+	for _, other := range ds.collections[query.From] {
+		if equal(other["_id"], doc["_id"]) {
+			return nil, &DuplicateKeyError{Collection: query.From, Field: "_id"}
+		}
+	}
+	if err := ds.checkUnique(query.From, doc, -1); err != nil {
+		return nil, err
+	}
+	ds.collections[query.From] = append(ds.collections[query.From], doc)
+	return &InsertResult{InsertedID: doc["_id"].(string)}, nil
+}
+
+// Update will update the first matching entry, returning it as it was before the update
+func (ds *memoryDatastore) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	before, _, err := ds.update(query, nil, d)
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// FindOneAndUpdate Holds the lock while it finds and updates, so claims never race
+func (ds *memoryDatastore) FindOneAndUpdate(ctx context.Context, query Query, by []string, d interface{}, out interface{}) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	_, after, err := ds.update(query, by, d)
+	if err != nil {
+		return err
+	}
+	return decodeOne(after, out)
+}
+
+// Stream Iterates over a snapshot of the matches, so fn may write to the datastore
+func (ds *memoryDatastore) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	ds.mu.RLock()
+	docs, _, err := ds.find(query, &Pagination{Sort: sort})
+	ds.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(func(out interface{}) error { return decodeOne(doc, out) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete will delete the first matching entry, returning it
+func (ds *memoryDatastore) Delete(ctx context.Context, query Query) (interface{}, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	_, positions, err := ds.find(Query{Where: query.Where, From: query.From}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	i := positions[0]
+	docs := ds.collections[query.From]
+	before := docs[i]
+	ds.collections[query.From] = append(docs[:i:i], docs[i+1:]...)
+	return before, nil
+}
+
+// Paginate provides pagination to the find operation
+func (ds *memoryDatastore) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	docs, _, err := ds.find(query, &page)
+	if err != nil {
+		return nil, err
+	}
+	return decodeModels(ctx, query.From, docs), nil
+}
+
+// FindInto Will decode every matching entry into out, which must be a pointer to a slice.
+// A nil page returns every match
+func (ds *memoryDatastore) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	docs, _, err := ds.find(query, page)
+	if err != nil {
+		return err
+	}
+	return decodeInto(docs, out)
+}
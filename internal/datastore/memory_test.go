@@ -0,0 +1,20 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore/datastoretest"
+)
+
+func TestMemoryDatastore(t *testing.T) {
+	datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+		return datastore.NewMemoryDatastore()
+	})
+}
+
+func TestTracedRepository(t *testing.T) {
+	datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+		return datastore.NewTracedRepository(datastore.NewMemoryDatastore())
+	})
+}
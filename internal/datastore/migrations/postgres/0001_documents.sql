@@ -0,0 +1,14 @@
+-- Every collection lives in one table, documents are normalized bson encoded as JSON
+CREATE TABLE IF NOT EXISTS documents (
+	collection text NOT NULL,
+	id text NOT NULL,
+	seq bigserial NOT NULL,
+	doc jsonb NOT NULL,
+	PRIMARY KEY (collection, id)
+);
+
+-- Natural order within a collection
+CREATE INDEX IF NOT EXISTS documents_collection_seq_idx ON documents (collection, seq);
+
+-- Containment lookups on whole documents
+CREATE INDEX IF NOT EXISTS documents_doc_idx ON documents USING gin (doc jsonb_path_ops);
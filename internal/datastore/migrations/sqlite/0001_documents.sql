@@ -0,0 +1,11 @@
+-- Every collection lives in one table, documents are normalized bson encoded as JSON
+CREATE TABLE IF NOT EXISTS documents (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	collection TEXT NOT NULL,
+	id TEXT NOT NULL,
+	doc TEXT NOT NULL CHECK (json_valid(doc)),
+	UNIQUE (collection, id)
+);
+
+-- Natural order within a collection
+CREATE INDEX IF NOT EXISTS documents_collection_seq_idx ON documents (collection, seq);
@@ -0,0 +1,472 @@
+package datastore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+type datastore struct {
+	c  *mongo.Client
+	db *mongo.Database
+	// session is set on the Repository handed to Transaction
+	session mongo.Session
+	// closed stops background index creation
+	closed chan struct{}
+}
+
+// toBSON converts filters and documents to bson, IDs become ObjectIDs when they are valid hex
+func toBSON(v interface{}) interface{} {
+	switch x := v.(type) {
+	case M:
+		out := bson.M{}
+		for k, e := range x {
+			out[k] = toBSON(e)
+		}
+		return out
+	case []M:
+		out := bson.A{}
+		for _, e := range x {
+			out = append(out, toBSON(e))
+		}
+		return out
+	case []interface{}:
+		out := bson.A{}
+		for _, e := range x {
+			out = append(out, toBSON(e))
+		}
+		return out
+	case []ID:
+		out := bson.A{}
+		for _, e := range x {
+			out = append(out, toBSON(e))
+		}
+		return out
+	case ID:
+		if oid, err := primitive.ObjectIDFromHex(string(x)); err == nil {
+			return oid
+		}
+		return string(x)
+	}
+	return v
+}
+
+func filter(where M) interface{} {
+	if where == nil {
+		return bson.M{}
+	}
+	return toBSON(where)
+}
+
+func projection(sel M) interface{} {
+	if sel == nil {
+		return nil
+	}
+	return toBSON(sel)
+}
+
+func sortDocument(sort []string) bson.D {
+	d := bson.D{}
+	for _, s := range sort {
+		field, desc := parseSort(s)
+		dir := 1
+		if desc {
+			dir = -1
+		}
+		d = append(d, bson.E{Key: field, Value: dir})
+	}
+	return d
+}
+
+// paginate Applies sort, skip and limit, a limit below one returns every match as it does elsewhere
+func paginate(o *options.FindOptions, page Pagination) *options.FindOptions {
+	o.SetSort(sortDocument(page.Sort)).SetSkip(int64(page.offset()))
+	if page.Limit > 0 {
+		o.SetLimit(int64(page.Limit))
+	}
+	return o
+}
+
+// writeConcern Reads majority, a number of nodes or a tag set
+func writeConcern(w string) *writeconcern.WriteConcern {
+	if w == "majority" {
+		return writeconcern.New(writeconcern.WMajority())
+	}
+	if n, err := strconv.Atoi(w); err == nil {
+		return writeconcern.New(writeconcern.W(n))
+	}
+	return writeconcern.New(writeconcern.WTagSet(w))
+}
+
+func tlsConfig(o MongoOptions) (*tls.Config, error) {
+	c := &tls.Config{}
+	if len(o.TLSCAFile) != 0 {
+		pem, err := ioutil.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.TLSCAFile)
+		}
+	}
+	if len(o.TLSCertificateKeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(o.TLSCertificateKeyFile, o.TLSCertificateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// clientOptions Applies config.Mongo over the options in the URI
+func clientOptions(config *Config) (*options.ClientOptions, error) {
+	o := config.Mongo
+	opts := options.Client().
+		ApplyURI(fmt.Sprintf("%s/%s", config.Uri, config.DatabaseName)).
+		SetMonitor(newCommandMonitor())
+
+	if o.MinPoolSize > 0 {
+		opts.SetMinPoolSize(o.MinPoolSize)
+	}
+	if o.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(o.MaxPoolSize)
+	}
+	if o.ServerSelectionTimeout > 0 {
+		opts.SetServerSelectionTimeout(o.ServerSelectionTimeout)
+	}
+	if len(o.ReadConcern) != 0 {
+		opts.SetReadConcern(readconcern.New(readconcern.Level(o.ReadConcern)))
+	}
+	if len(o.WriteConcern) != 0 {
+		opts.SetWriteConcern(writeConcern(o.WriteConcern))
+	}
+	if len(o.ReadPreference) != 0 {
+		mode, err := readpref.ModeFromString(o.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+	if o.TLS || len(o.TLSCAFile) != 0 || len(o.TLSCertificateKeyFile) != 0 {
+		c, err := tlsConfig(o)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(c)
+	}
+	return opts, nil
+}
+
+// NewDatastore Will initialize a new datastore which contains the client connection. An
+// unreachable server is not fatal, the driver keeps reconnecting in the background
+func NewDatastore(config *Config) Repository {
+	opts, err := clientOptions(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := mongo.NewClient(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("Connecting to %s", config.Uri)
+	// Connect only starts monitoring, it fails on invalid options rather than unreachable servers
+	err = client.Connect(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ds := &datastore{c: client, db: client.Database(config.DatabaseName), closed: make(chan struct{})}
+	ds.waitForServer(config.Mongo.ConnectRetries)
+	return ds
+}
+
+// waitForServer Pings with exponential backoff, it reports whether the server answered
+func (ds *datastore) waitForServer(retries int) bool {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := ds.c.Ping(context.Background(), nil)
+		if err == nil {
+			return true
+		}
+		if attempt >= retries {
+			log.Warnf("Mongo is unreachable, starting without it: %v", err)
+			return false
+		}
+		log.Warnf("Mongo is unreachable, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// createIndexes Retries in the background while mongo is unreachable, until the datastore is closed
+func (ds *datastore) createIndexes(coll string, index []mongo.IndexModel) {
+	opts := options.CreateIndexes().SetMaxTime(5 * time.Second)
+	backoff := time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := ds.db.Collection(coll).Indexes().CreateMany(ctx, index, opts)
+		cancel()
+		if err == nil {
+			return
+		}
+		if classify(context.Background(), err) == failureNone {
+			log.Errorf("Could not create the indexes of %s: %v", coll, err)
+			return
+		}
+
+		log.Warnf("Mongo is unreachable, creating the indexes of %s in %s", coll, backoff)
+		select {
+		case <-ds.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// bind Puts operations of a transaction Repository in its session, whatever context they get
+func (ds *datastore) bind(ctx context.Context) context.Context {
+	if ds.session == nil {
+		return ctx
+	}
+	return mongo.NewSessionContext(ctx, ds.session)
+}
+
+// Close Will close the datastores connection, it does nothing on the Repository of a transaction
+func (ds *datastore) Close() error {
+	if ds.session != nil {
+		return nil
+	}
+	close(ds.closed)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return ds.c.Disconnect(ctx)
+}
+
+// Transaction Runs fn in a multi-document transaction, which needs a replica set or sharded
+// cluster. Transient errors such as write conflicts retry fn, so it must not have side effects
+// outside the transaction
+func (ds *datastore) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if ds.session != nil {
+		return fn(ds.bind(ctx), ds)
+	}
+	session, err := ds.c.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	tx := &datastore{c: ds.c, db: ds.db, session: session}
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc, tx)
+	})
+	return err
+}
+
+// EnsureIndexes Makes sure datastore indexes are created, once mongo is reachable when it is not.
+// Any other failure is fatal
+func (ds *datastore) EnsureIndexes(coll string, indexQuery []string) {
+	opts := options.CreateIndexes().SetMaxTime(5 * time.Second)
+	index := []mongo.IndexModel{}
+	for _, val := range indexQuery {
+		tmp := mongo.IndexModel{
+			Options: options.Index().SetUnique(true),
+		}
+		keys := bsonx.Doc{}
+		for _, field := range indexFields(val) {
+			keys = append(keys, bsonx.Elem{Key: field, Value: bsonx.Int32(1)})
+		}
+		tmp.Keys = keys
+		index = append(index, tmp)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := ds.db.Collection(coll).Indexes().CreateMany(ctx, index, opts)
+	if err == nil {
+		return
+	}
+	if classify(context.Background(), err) == failureNone {
+		log.Fatal(err)
+	}
+	go ds.createIndexes(coll, index)
+}
+
+// Find Will find an entry within the datastore
+func (ds *datastore) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	o := options.Find().SetProjection(projection(query.Select))
+	cursor, err := ds.db.Collection(query.From).Find(ctx, filter(query.Where), o)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []models.Model
+	for cursor.Next(ctx) {
+		var m models.Model
+		if err := cursor.Decode(&m); err != nil {
+			logging.FromContext(ctx).WithField("collection", query.From).Warn(err)
+			continue
+		}
+		res = append(res, m)
+	}
+
+	return &res, err
+}
+
+// Insert Will insert an entry into datastore, a hex _id given by the caller is stored as an ObjectID
+// so it matches the filters built from ID
+func (ds *datastore) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := doc["_id"].(string); ok {
+		doc["_id"] = toBSON(ID(id))
+	}
+
+	res, err := ds.db.Collection(query.From).InsertOne(ctx, doc)
+	return res, err
+}
+
+// Update will update an entry from the datastore, it returns ErrNotFound when nothing matched
+func (ds *datastore) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	update := toBSON(d)
+	var res *mongo.SingleResult
+	if _, ok := isOperatorDocument(update); ok {
+		res = ds.db.Collection(query.From).FindOneAndUpdate(ctx, filter(query.Where), update)
+	} else {
+		// Replacement documents keep the _id
+		doc, err := toDocument(update)
+		if err != nil {
+			return nil, err
+		}
+		delete(doc, "_id")
+		res = ds.db.Collection(query.From).FindOneAndReplace(ctx, filter(query.Where), doc)
+	}
+	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	return res, res.Err()
+}
+
+// FindOneAndUpdate Returns the document as it is after the update, the server updates it atomically
+func (ds *datastore) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	o := options.FindOneAndUpdate().SetSort(sortDocument(sort)).SetReturnDocument(options.After)
+	err := ds.db.Collection(query.From).FindOneAndUpdate(ctx, filter(query.Where), toBSON(d), o).Decode(out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Stream Iterates over a cursor, it has no timeout of its own since the caller paces it
+func (ds *datastore) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	ctx = ds.bind(ctx)
+	o := options.Find().SetProjection(projection(query.Select)).SetSort(sortDocument(sort))
+	cursor, err := ds.db.Collection(query.From).Find(ctx, filter(query.Where), o)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		if err := fn(cursor.Decode); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Delete will delete an entry from the datastore, it returns ErrNotFound when nothing matched
+func (ds *datastore) Delete(ctx context.Context, query Query) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	res := ds.db.Collection(query.From).FindOneAndDelete(ctx, filter(query.Where))
+	if errors.Is(res.Err(), mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	return res, res.Err()
+}
+
+// Paginate provides pagination to the find operation
+func (ds *datastore) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	o := paginate(options.Find().SetProjection(projection(query.Select)), page)
+	cursor, err := ds.db.Collection(query.From).Find(ctx, filter(query.Where), o)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []models.Model
+	for cursor.Next(ctx) {
+		var m models.Model
+		if err := cursor.Decode(&m); err != nil {
+			logging.FromContext(ctx).WithField("collection", query.From).Warn(err)
+			continue
+		}
+		res = append(res, m)
+	}
+
+	return &res, err
+}
+
+// FindInto Will decode every matching entry into out, which must be a pointer to a slice.
+// A nil page returns every match
+func (ds *datastore) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ds.bind(ctx), 15*time.Second)
+	defer cancel()
+
+	o := options.Find().SetProjection(projection(query.Select))
+	if page != nil {
+		paginate(o, *page)
+	}
+	cursor, err := ds.db.Collection(query.From).Find(ctx, filter(query.Where), o)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
@@ -0,0 +1,117 @@
+package datastore_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore/datastoretest"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// initiate Turns the server on port into a single node replica set, which transactions need
+func initiate(t *testing.T, port int, host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(fmt.Sprintf("mongodb://127.0.0.1:%d/?connect=direct", port)))
+	require.Nil(t, err)
+	defer client.Disconnect(ctx)
+	admin := client.Database("admin")
+
+	// The server takes a moment to accept connections
+	config := bson.M{"_id": "rs0", "members": bson.A{bson.M{"_id": 0, "host": host}}}
+	for {
+		err := admin.RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: config}}).Err()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	for {
+		var res struct {
+			IsMaster bool `bson:"ismaster"`
+		}
+		err := admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&res)
+		if err == nil && res.IsMaster {
+			return
+		}
+		if ctx.Err() != nil {
+			t.Fatal("The replica set did not elect a primary")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// startMongo Starts a throwaway server from a mongod binary or the mongo docker image
+func startMongo(t *testing.T) string {
+	port := freePort(t)
+	if bin, err := exec.LookPath("mongod"); err == nil {
+		cmd := exec.Command(bin, "--dbpath", t.TempDir(), "--port", strconv.Itoa(port), "--bind_ip", "127.0.0.1", "--replSet", "rs0", "--quiet")
+		require.Nil(t, cmd.Start())
+		t.Cleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+		initiate(t, port, fmt.Sprintf("127.0.0.1:%d", port))
+	} else if bin, err := exec.LookPath("docker"); err == nil {
+		// The server listens on the published port so the member host is the same inside and
+		// outside the container, clients connect to the members the replica set reports
+		out, err := exec.Command(bin, "run", "-d", "--rm", "-p", fmt.Sprintf("127.0.0.1:%d:%d", port, port), "mongo:4.4", "--replSet", "rs0", "--port", strconv.Itoa(port), "--bind_ip_all").Output()
+		if err != nil {
+			t.Skipf("Cannot start the mongo container: %v", err)
+		}
+		id := strings.TrimSpace(string(out))
+		t.Cleanup(func() {
+			_ = exec.Command(bin, "rm", "-f", id).Run()
+		})
+		initiate(t, port, fmt.Sprintf("127.0.0.1:%d", port))
+	} else {
+		t.Skip("Set TEST_MONGO_URI, or put mongod or docker on the PATH")
+	}
+	return fmt.Sprintf("mongodb://127.0.0.1:%d", port)
+}
+
+// TestMongoDatastore Runs against TEST_MONGO_URI, e.g. mongodb://localhost:27017, which must be
+// a replica set for the transaction tests. Without it a throwaway server is started
+func TestMongoDatastore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the mongo suite in short mode")
+	}
+	uri := os.Getenv("TEST_MONGO_URI")
+	if len(uri) == 0 {
+		uri = startMongo(t)
+	}
+
+	r := datastore.NewDatastore(&datastore.Config{
+		Driver:       datastore.DriverMongo,
+		Uri:          uri,
+		DatabaseName: fmt.Sprintf("test_%d", time.Now().UnixNano()),
+	})
+	defer r.Close()
+
+	datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+		return r
+	})
+}
@@ -0,0 +1,633 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// migrationLock Is the advisory lock held while migrating, so prefork children migrate once
+const migrationLock = 7_035_001
+
+var indexName = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// postgresDatastore Stores every collection in a single JSONB documents table
+type postgresDatastore struct {
+	pool *pgxpool.Pool
+	// tx is set on the Repository handed to Transaction
+	tx pgx.Tx
+}
+
+// NewPostgresDatastore Will connect to postgres and apply any pending migrations
+func NewPostgresDatastore(config *Config) Repository {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, config.Uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Connecting to %s", pool.Config().ConnConfig.Host)
+	if err := pool.Ping(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	ds := &postgresDatastore{pool: pool}
+	if err := ds.Migrate(ctx); err != nil {
+		log.Fatal(err)
+	}
+	return ds
+}
+
+/*
+* PRIVATE
+ */
+
+// encodeJSON converts a normalized bson value to JSON, keeping dates, ObjectIDs and binary
+// data as tagged objects so they can be decoded again and dates still order correctly
+func encodeJSON(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, string, bool, int32, int64, float64:
+		return x, nil
+	case primitive.DateTime:
+		return map[string]interface{}{"$date": int64(x)}, nil
+	case primitive.ObjectID:
+		return map[string]interface{}{"$oid": x.Hex()}, nil
+	case primitive.Binary:
+		return map[string]interface{}{"$binary": base64.StdEncoding.EncodeToString(x.Data)}, nil
+	case primitive.Null, primitive.Undefined:
+		return nil, nil
+	case primitive.A:
+		out := make([]interface{}, 0, len(x))
+		for _, e := range x {
+			ev, err := encodeJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ev)
+		}
+		return out, nil
+	}
+	if d, ok := asDocument(v); ok {
+		out := make(map[string]interface{}, len(d))
+		for k, e := range d {
+			ev, err := encodeJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = ev
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot store %T in postgres", v)
+}
+
+func decodeJSON(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+			return n, nil
+		}
+		return x.Float64()
+	case []interface{}:
+		out := make(primitive.A, 0, len(x))
+		for _, e := range x {
+			ev, err := decodeJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ev)
+		}
+		return out, nil
+	case map[string]interface{}:
+		if len(x) == 1 {
+			if n, ok := x["$date"].(json.Number); ok {
+				ms, err := n.Int64()
+				return primitive.DateTime(ms), err
+			}
+			if s, ok := x["$oid"].(string); ok {
+				return primitive.ObjectIDFromHex(s)
+			}
+			if s, ok := x["$binary"].(string); ok {
+				b, err := base64.StdEncoding.DecodeString(s)
+				return primitive.Binary{Data: b}, err
+			}
+		}
+		out := make(bson.M, len(x))
+		for k, e := range x {
+			ev, err := decodeJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = ev
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func marshalDocument(doc bson.M) ([]byte, error) {
+	v, err := encodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func unmarshalDocument(b []byte) (bson.M, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	d, err := decodeJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	doc, _ := d.(bson.M)
+	return doc, nil
+}
+
+// sqlBuilder Is the postgres sqlDialect, fields are paths into the doc column
+type sqlBuilder struct {
+	args []interface{}
+}
+
+func (b *sqlBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *sqlBuilder) value(v interface{}) (string, error) {
+	ev, err := encodeJSON(v)
+	if err != nil {
+		return "", err
+	}
+	j, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	return b.arg(string(j)) + "::jsonb", nil
+}
+
+func (b *sqlBuilder) path(field string) string {
+	return "(doc #> " + b.arg(strings.Split(field, ".")) + "::text[])"
+}
+
+// eq follows mongo where a scalar also matches any element of an array field
+func (b *sqlBuilder) eq(field string, v interface{}) (string, error) {
+	p := b.path(field)
+	if v == nil {
+		return fmt.Sprintf("(%s IS NULL OR %s = 'null'::jsonb)", p, p), nil
+	}
+	val, err := b.value(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("coalesce(%s @> %s, false)", p, val), nil
+}
+
+// order only compares values of the same JSON type
+func (b *sqlBuilder) order(field string, sym string, v interface{}) (string, error) {
+	p := b.path(field)
+	val, err := b.value(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("coalesce(jsonb_typeof(%s) = jsonb_typeof(%s) AND %s %s %s, false)", p, val, p, sym, val), nil
+}
+
+func (b *sqlBuilder) exists(field string) string {
+	return "(" + b.path(field) + " IS NOT NULL)"
+}
+
+func (b *sqlBuilder) regex(field string, pattern string, insensitive bool) string {
+	sym := "~"
+	if insensitive {
+		sym = "~*"
+	}
+	return fmt.Sprintf("coalesce((doc #>> %s::text[]) %s %s, false)", b.arg(strings.Split(field, ".")), sym, b.arg(pattern))
+}
+
+// selectSQL builds the query returning id and doc of every match in insertion order
+func selectSQL(query Query, page *Pagination) (string, []interface{}, error) {
+	where, err := normalize(query.Where)
+	if err != nil {
+		return "", nil, err
+	}
+	w, _ := asDocument(where)
+
+	b := &sqlBuilder{}
+	sql := "SELECT id, doc FROM documents WHERE collection = " + b.arg(query.From)
+	cond, err := sqlWhere(b, w)
+	if err != nil {
+		return "", nil, err
+	}
+	sql += " AND " + cond + " ORDER BY "
+
+	if page != nil {
+		for _, s := range page.Sort {
+			field, desc := parseSort(s)
+			// Missing fields sort lowest, as they do in mongo
+			if desc {
+				sql += b.path(field) + " DESC NULLS LAST, "
+			} else {
+				sql += b.path(field) + " ASC NULLS FIRST, "
+			}
+		}
+	}
+	sql += "seq"
+
+	if page != nil {
+		if page.Limit > 0 {
+			sql += " LIMIT " + b.arg(page.Limit)
+		}
+		sql += " OFFSET " + b.arg(page.offset())
+	}
+	return sql, b.args, nil
+}
+
+// pgConn Is satisfied by both the pool and a transaction, where Begin starts a savepoint
+type pgConn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+func (ds *postgresDatastore) conn() pgConn {
+	if ds.tx != nil {
+		return ds.tx
+	}
+	return ds.pool
+}
+
+// atomic runs fn in a new transaction, or in a savepoint of the current one so a failed
+// statement does not abort the whole transaction as it would not on the other backends
+func (ds *postgresDatastore) atomic(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := ds.conn().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// scan calls fn with the id and projected document of every match as rows are read
+func (ds *postgresDatastore) scan(ctx context.Context, q pgConn, query Query, page *Pagination, suffix string, fn func(id string, doc bson.M) error) error {
+	sql, args, err := selectSQL(query, page)
+	if err != nil {
+		return err
+	}
+	rows, err := q.Query(ctx, sql+suffix, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var raw []byte
+		if err := rows.Scan(&id, &raw); err != nil {
+			return err
+		}
+		doc, err := unmarshalDocument(raw)
+		if err != nil {
+			return err
+		}
+		if err := fn(id, project(doc, bson.M(query.Select))); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (ds *postgresDatastore) find(ctx context.Context, q pgConn, query Query, page *Pagination, suffix string) ([]string, []bson.M, error) {
+	var ids []string
+	var docs []bson.M
+	err := ds.scan(ctx, q, query, page, suffix, func(id string, doc bson.M) error {
+		ids = append(ids, id)
+		docs = append(docs, doc)
+		return nil
+	})
+	return ids, docs, err
+}
+
+// wrap converts unique violations to DuplicateKeyError
+func wrapPostgres(coll string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return &DuplicateKeyError{Collection: coll, Field: pgErr.ConstraintName}
+	}
+	return err
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// update replaces the first match in sort order, lock is the locking clause of the select
+func (ds *postgresDatastore) update(ctx context.Context, query Query, sort []string, d interface{}, lock string) (bson.M, bson.M, error) {
+	update, err := normalize(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, ok := asDocument(update)
+	if !ok {
+		return nil, nil, fmt.Errorf("update must be a document, got %T", d)
+	}
+
+	var before, after bson.M
+	err = ds.atomic(ctx, func(tx pgx.Tx) error {
+		ids, docs, err := ds.find(ctx, tx, Query{Where: query.Where, From: query.From}, &Pagination{Page: 1, Limit: 1, Sort: sort}, lock)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+
+		after, err = applyUpdate(docs[0], u)
+		if err != nil {
+			return err
+		}
+		raw, err := marshalDocument(after)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE documents SET doc = $3 WHERE collection = $1 AND id = $2", query.From, ids[0], string(raw))
+		if err != nil {
+			return wrapPostgres(query.From, err)
+		}
+		before = docs[0]
+		return nil
+	})
+	return before, after, err
+}
+
+/*
+* PUBLIC
+ */
+
+// Migrate Applies the embedded migrations that have not run yet
+func (ds *postgresDatastore) Migrate(ctx context.Context) error {
+	files, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version text PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		version := strings.TrimSuffix(f[strings.LastIndex(f, "/")+1:], ".sql")
+		var applied bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		sql, err := postgresMigrations.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			return err
+		}
+		log.Infof("Applied migration %s", version)
+	}
+	return tx.Commit(ctx)
+}
+
+// Close Will close the connection pool, it does nothing on the Repository of a transaction
+func (ds *postgresDatastore) Close() error {
+	if ds.tx != nil {
+		return nil
+	}
+	ds.pool.Close()
+	return nil
+}
+
+// Transaction Runs fn in a read committed transaction, Update and Delete lock the rows they change
+func (ds *postgresDatastore) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if ds.tx != nil {
+		return fn(ctx, ds)
+	}
+	tx, err := ds.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(ctx, &postgresDatastore{pool: ds.pool, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// EnsureIndexes Makes sure a unique expression index exists for every field of the collection,
+// missing fields index as null as they do in mongo
+func (ds *postgresDatastore) EnsureIndexes(coll string, indexQuery []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, field := range indexQuery {
+		name := indexName.ReplaceAllString(strings.ToLower("documents_"+coll+"_"+field), "_")
+		if len(name) > 59 {
+			name = name[:59]
+		}
+		name += "_key"
+
+		exprs := []string{}
+		for _, f := range indexFields(field) {
+			path := make([]string, 0)
+			for _, key := range strings.Split(f, ".") {
+				path = append(path, `"`+strings.ReplaceAll(key, `"`, `\"`)+`"`)
+			}
+			exprs = append(exprs, fmt.Sprintf(`(coalesce(doc #> %s::text[], 'null'))`, quoteLiteral("{"+strings.Join(path, ",")+"}")))
+		}
+		sql := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s ON documents (%s) WHERE collection = %s`,
+			pgx.Identifier{name}.Sanitize(), strings.Join(exprs, ", "), quoteLiteral(coll))
+		if _, err := ds.pool.Exec(ctx, sql); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Find Will find an entry within the datastore
+func (ds *postgresDatastore) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, docs, err := ds.find(ctx, ds.conn(), query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return decodeModels(ctx, query.From, docs), nil
+}
+
+// Insert Will insert an entry into datastore
+func (ds *postgresDatastore) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	switch id := doc["_id"].(type) {
+	case string:
+	case primitive.ObjectID:
+		doc["_id"] = id.Hex()
+	default:
+		doc["_id"] = NewID()
+	}
+	raw, err := marshalDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	insert := "INSERT INTO documents (collection, id, doc) VALUES ($1, $2, $3)"
+	if ds.tx != nil {
+		err = ds.atomic(ctx, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, insert, query.From, doc["_id"], string(raw))
+			return err
+		})
+	} else {
+		_, err = ds.pool.Exec(ctx, insert, query.From, doc["_id"], string(raw))
+	}
+	if err != nil {
+		return nil, wrapPostgres(query.From, err)
+	}
+	return &InsertResult{InsertedID: doc["_id"].(string)}, nil
+}
+
+// Update will update the first matching entry, returning it as it was before the update
+func (ds *postgresDatastore) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	before, _, err := ds.update(ctx, query, nil, d, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// FindOneAndUpdate Skips rows locked by other writers, so concurrent claims take different documents
+// instead of waiting on the same one
+func (ds *postgresDatastore) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, after, err := ds.update(ctx, query, sort, d, " FOR UPDATE SKIP LOCKED")
+	if err != nil {
+		return err
+	}
+	return decodeOne(after, out)
+}
+
+// Stream Iterates over the rows as they are read
+func (ds *postgresDatastore) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	return ds.scan(ctx, ds.conn(), query, &Pagination{Sort: sort}, "", func(id string, doc bson.M) error {
+		return fn(func(out interface{}) error { return decodeOne(doc, out) })
+	})
+}
+
+// Delete will delete the first matching entry, returning it
+func (ds *postgresDatastore) Delete(ctx context.Context, query Query) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	tx, err := ds.conn().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ids, docs, err := ds.find(ctx, tx, Query{Where: query.Where, From: query.From}, &Pagination{Page: 1, Limit: 1}, " FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM documents WHERE collection = $1 AND id = $2", query.From, ids[0])
+	if err != nil {
+		return nil, err
+	}
+	return docs[0], tx.Commit(ctx)
+}
+
+// Paginate provides pagination to the find operation
+func (ds *postgresDatastore) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, docs, err := ds.find(ctx, ds.conn(), query, &page, "")
+	if err != nil {
+		return nil, err
+	}
+	return decodeModels(ctx, query.From, docs), nil
+}
+
+// FindInto Will decode every matching entry into out, which must be a pointer to a slice.
+// A nil page returns every match
+func (ds *postgresDatastore) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, docs, err := ds.find(ctx, ds.conn(), query, page, "")
+	if err != nil {
+		return err
+	}
+	return decodeInto(docs, out)
+}
@@ -0,0 +1,256 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+// ErrCircuitOpen Is wrapped in the Unavailable error returned while the circuit breaker is open
+var ErrCircuitOpen = errors.New("datastore circuit breaker is open")
+
+// ResilienceConfig Is the config of a resilient Repository
+type ResilienceConfig struct {
+	// Retries is how many times an operation that failed transiently is retried, writes are only
+	// retried when they provably did not run
+	Retries int
+	// Backoff is the delay before the first retry, it doubles on each retry
+	Backoff time.Duration
+	// BreakerThreshold consecutive transient failures open the circuit, zero never opens it
+	BreakerThreshold int
+	// BreakerTimeout is how long the circuit stays open before a probe is let through
+	BreakerTimeout time.Duration
+}
+
+// failure Classifies an error by what it says about the datastore
+type failure int
+
+const (
+	// failureNone is a successful or ordinary result, e.g. a duplicate key
+	failureNone failure = iota
+	// failureUnsent never reached the datastore, writes may be retried
+	failureUnsent
+	// failureUnknown may have been applied, only reads may be retried
+	failureUnknown
+)
+
+type resilientRepository struct {
+	r       Repository
+	config  ResilienceConfig
+	breaker *breaker
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewResilientRepository Will wrap a Repository so transient failures are retried, and fail fast
+// with an Unavailable error once they keep happening
+func NewResilientRepository(r Repository, config *ResilienceConfig) Repository {
+	return &resilientRepository{
+		r:       r,
+		config:  *config,
+		breaker: newBreaker(config.BreakerThreshold, config.BreakerTimeout),
+	}
+}
+
+/*
+* PRIVATE
+ */
+
+// classify Tells unreachable datastores apart from failed operations, errors caused by the
+// caller giving up are ordinary results
+func classify(ctx context.Context, err error) failure {
+	if err == nil || ctx.Err() != nil {
+		return failureNone
+	}
+	if errors.Is(err, mongo.ErrClientDisconnected) {
+		return failureUnsent
+	}
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		if ce.HasErrorLabel(driver.RetryableWriteError) {
+			return failureUnsent
+		}
+		if ce.HasErrorLabel(driver.NetworkError) {
+			return failureUnknown
+		}
+	}
+	// The driver only formats server selection errors, no server was picked to send to
+	if strings.HasPrefix(err.Error(), "server selection error") {
+		return failureUnsent
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return failureUnsent
+	}
+	if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return failureUnknown
+	}
+	return failureNone
+}
+
+// do Runs op through the breaker and retries it, a transient failure that outlasts the
+// retries is returned as an Unavailable error
+func (rr *resilientRepository) do(ctx context.Context, write bool, op func() error) error {
+	if !rr.breaker.allow() {
+		return apperrors.Unavailable(ErrCircuitOpen)
+	}
+
+	backoff := rr.config.Backoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		// The datastore may never have answered a caller that gave up, neither outcome is known
+		if ctx.Err() != nil {
+			rr.breaker.release()
+			return err
+		}
+		f := classify(ctx, err)
+		if f == failureNone {
+			rr.breaker.record(true)
+			return err
+		}
+		if attempt >= rr.config.Retries || (write && f != failureUnsent) {
+			rr.breaker.record(false)
+			return apperrors.Unavailable(err)
+		}
+
+		logging.FromContext(ctx).WithField("component", "datastore").WithField("attempt", attempt+1).Warn(err)
+		select {
+		case <-ctx.Done():
+			rr.breaker.record(false)
+			return apperrors.Unavailable(err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+// Health Reports the state of the circuit breaker, half open counts as degraded
+func (rr *resilientRepository) Health(ctx context.Context) health.Check {
+	s := rr.breaker.stats()
+	check := health.Check{
+		Status:  health.StatusUp,
+		Details: map[string]interface{}{"breaker": s.State, "failures": s.Failures},
+	}
+	switch s.State {
+	case BreakerOpen:
+		check.Status = health.StatusDown
+	case BreakerHalfOpen:
+		check.Status = health.StatusDegraded
+	}
+	if !s.OpenedAt.IsZero() {
+		check.Details["openedAt"] = s.OpenedAt
+	}
+	return check
+}
+
+func (rr *resilientRepository) Close() error {
+	return rr.r.Close()
+}
+
+func (rr *resilientRepository) EnsureIndexes(coll string, indexQuery []string) {
+	rr.r.EnsureIndexes(coll, indexQuery)
+}
+
+// Transaction Goes through the breaker as a whole, the backend retries transient transaction errors
+func (rr *resilientRepository) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if !rr.breaker.allow() {
+		return apperrors.Unavailable(ErrCircuitOpen)
+	}
+	err := Transaction(ctx, rr.r, fn)
+	if ctx.Err() != nil {
+		rr.breaker.release()
+		return err
+	}
+	if classify(ctx, err) != failureNone {
+		rr.breaker.record(false)
+		return apperrors.Unavailable(err)
+	}
+	rr.breaker.record(true)
+	return err
+}
+
+// Stream Goes through the breaker as a whole, it is not retried since fn may have seen matches
+func (rr *resilientRepository) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	if !rr.breaker.allow() {
+		return apperrors.Unavailable(ErrCircuitOpen)
+	}
+	err := Stream(ctx, rr.r, query, sort, fn)
+	if ctx.Err() != nil {
+		rr.breaker.release()
+		return err
+	}
+	if classify(ctx, err) != failureNone {
+		rr.breaker.record(false)
+		return apperrors.Unavailable(err)
+	}
+	rr.breaker.record(true)
+	return err
+}
+
+func (rr *resilientRepository) Find(ctx context.Context, query Query) (res *[]models.Model, err error) {
+	err = rr.do(ctx, false, func() error {
+		res, err = rr.r.Find(ctx, query)
+		return err
+	})
+	return res, err
+}
+
+func (rr *resilientRepository) Insert(ctx context.Context, query Query, d interface{}) (res interface{}, err error) {
+	err = rr.do(ctx, true, func() error {
+		res, err = rr.r.Insert(ctx, query, d)
+		return err
+	})
+	return res, err
+}
+
+func (rr *resilientRepository) Update(ctx context.Context, query Query, d interface{}) (res interface{}, err error) {
+	err = rr.do(ctx, true, func() error {
+		res, err = rr.r.Update(ctx, query, d)
+		return err
+	})
+	return res, err
+}
+
+func (rr *resilientRepository) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	return rr.do(ctx, true, func() error {
+		return FindOneAndUpdate(ctx, rr.r, query, sort, d, out)
+	})
+}
+
+func (rr *resilientRepository) Delete(ctx context.Context, query Query) (res interface{}, err error) {
+	err = rr.do(ctx, true, func() error {
+		res, err = rr.r.Delete(ctx, query)
+		return err
+	})
+	return res, err
+}
+
+func (rr *resilientRepository) Paginate(ctx context.Context, query Query, page Pagination) (res *[]models.Model, err error) {
+	err = rr.do(ctx, false, func() error {
+		res, err = rr.r.Paginate(ctx, query, page)
+		return err
+	})
+	return res, err
+}
+
+func (rr *resilientRepository) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	return rr.do(ctx, false, func() error {
+		return rr.r.FindInto(ctx, query, page, out)
+	})
+}
@@ -0,0 +1,167 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore/datastoretest"
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+)
+
+var (
+	errNetwork   = mongo.CommandError{Message: "connection reset", Labels: []string{"NetworkError"}}
+	errSelection = errors.New("server selection error: server selection timeout, current topology: { }")
+)
+
+// flakyRepository Fails the next calls with err, then reaches the datastore
+type flakyRepository struct {
+	datastore.Repository
+	err      error
+	failures int
+	calls    int
+}
+
+func (r *flakyRepository) fail() error {
+	r.calls++
+	if r.failures > 0 {
+		r.failures--
+		return r.err
+	}
+	return nil
+}
+
+func (r *flakyRepository) FindInto(ctx context.Context, query datastore.Query, page *datastore.Pagination, out interface{}) error {
+	if err := r.fail(); err != nil {
+		return err
+	}
+	return r.Repository.FindInto(ctx, query, page, out)
+}
+
+func (r *flakyRepository) Insert(ctx context.Context, query datastore.Query, d interface{}) (interface{}, error) {
+	if err := r.fail(); err != nil {
+		return nil, err
+	}
+	return r.Repository.Insert(ctx, query, d)
+}
+
+/*
+	TESTS
+*/
+
+func TestResilientRepository(t *testing.T) {
+	datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+		return datastore.NewResilientRepository(datastore.NewMemoryDatastore(), &datastore.ResilienceConfig{
+			Retries:          2,
+			Backoff:          time.Millisecond,
+			BreakerThreshold: 5,
+			BreakerTimeout:   time.Second,
+		})
+	})
+}
+
+func TestResilientRetries(t *testing.T) {
+	people := datastore.Query{From: "people"}
+	tests := []struct {
+		description string
+		err         error
+		failures    int
+		write       bool
+		calls       int
+		unavailable bool
+	}{
+		{description: "Read retried", err: errNetwork, failures: 2, calls: 3},
+		{description: "Read retries exhausted", err: errNetwork, failures: 3, calls: 3, unavailable: true},
+		{description: "Unsent write retried", err: errSelection, failures: 1, write: true, calls: 2},
+		{description: "Ambiguous write not retried", err: errNetwork, failures: 1, write: true, calls: 1, unavailable: true},
+		{description: "Ordinary error not retried", err: datastore.ErrNotFound, failures: 1, calls: 1},
+	}
+
+	for _, test := range tests {
+		base := &flakyRepository{Repository: datastore.NewMemoryDatastore(), err: test.err, failures: test.failures}
+		r := datastore.NewResilientRepository(base, &datastore.ResilienceConfig{Retries: 2, Backoff: time.Millisecond})
+
+		var err error
+		if test.write {
+			_, err = r.Insert(context.Background(), people, datastoretest.Person{Name: "ann"})
+		} else {
+			err = r.FindInto(context.Background(), people, nil, &[]datastoretest.Person{})
+		}
+
+		assert.Equal(t, test.calls, base.calls, test.description)
+		assert.Equal(t, test.unavailable, apperrors.KindOf(err) == apperrors.KindUnavailable, test.description)
+		if test.failures < test.calls && !test.unavailable {
+			assert.Nil(t, err, test.description)
+		}
+	}
+}
+
+func TestResilientBreaker(t *testing.T) {
+	base := &flakyRepository{Repository: datastore.NewMemoryDatastore(), err: errNetwork, failures: 2}
+	r := datastore.NewResilientRepository(base, &datastore.ResilienceConfig{
+		BreakerThreshold: 2,
+		BreakerTimeout:   20 * time.Millisecond,
+	})
+	checker, ok := r.(health.Checker)
+	require.True(t, ok)
+
+	ctx := context.Background()
+	find := func() error {
+		return r.FindInto(ctx, datastore.Query{From: "people"}, nil, &[]datastoretest.Person{})
+	}
+
+	assert.NotNil(t, find())
+	assert.Equal(t, health.StatusUp, checker.Health(ctx).Status, "Closed below the threshold")
+	assert.NotNil(t, find())
+	assert.Equal(t, health.StatusDown, checker.Health(ctx).Status, "Open at the threshold")
+
+	// Open circuits fail fast without reaching the datastore
+	err := find()
+	assert.True(t, errors.Is(err, datastore.ErrCircuitOpen))
+	assert.Equal(t, apperrors.KindUnavailable, apperrors.KindOf(err))
+	assert.Equal(t, 2, base.calls)
+
+	// A successful probe closes it again
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(t, find())
+	assert.Equal(t, 3, base.calls)
+	check := checker.Health(ctx)
+	assert.Equal(t, health.StatusUp, check.Status)
+	assert.Equal(t, datastore.BreakerClosed, check.Details["breaker"])
+}
+
+func TestResilientCancelledProbe(t *testing.T) {
+	base := &flakyRepository{Repository: datastore.NewMemoryDatastore(), err: errNetwork, failures: 1}
+	r := datastore.NewResilientRepository(base, &datastore.ResilienceConfig{
+		BreakerThreshold: 1,
+		BreakerTimeout:   20 * time.Millisecond,
+	})
+	checker := r.(health.Checker)
+	find := func(ctx context.Context) error {
+		return r.FindInto(ctx, datastore.Query{From: "people"}, nil, &[]datastoretest.Person{})
+	}
+
+	ctx := context.Background()
+	assert.NotNil(t, find(ctx))
+	require.Equal(t, datastore.BreakerOpen, checker.Health(ctx).Details["breaker"])
+	time.Sleep(30 * time.Millisecond)
+
+	// A probe whose caller gave up tells nothing about the datastore
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_ = find(cancelled)
+	assert.Equal(t, 2, base.calls)
+	assert.Equal(t, datastore.BreakerHalfOpen, checker.Health(ctx).Details["breaker"], "not closed by the cancelled probe")
+
+	// The next operation probes instead
+	assert.Nil(t, find(ctx))
+	assert.Equal(t, 3, base.calls)
+	assert.Equal(t, datastore.BreakerClosed, checker.Health(ctx).Details["breaker"])
+}
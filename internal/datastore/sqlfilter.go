@@ -0,0 +1,157 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqlDialect Compiles the conditions on a single field for one SQL database, sqlWhere handles
+// the operators and the logical combinations so every SQL backend reads filters the same way
+type sqlDialect interface {
+	// eq follows mongo where a scalar also matches any element of an array field
+	eq(field string, v interface{}) (string, error)
+	// order compares with < <= > or >=, only values of the same type are ordered as in mongo
+	order(field string, sym string, v interface{}) (string, error)
+	exists(field string) string
+	regex(field string, pattern string, insensitive bool) string
+}
+
+/*
+* PRIVATE
+ */
+
+func sqlOperator(d sqlDialect, field string, op string, arg interface{}, cond bson.M) (string, error) {
+	switch op {
+	case "$eq":
+		return d.eq(field, arg)
+	case "$ne":
+		c, err := d.eq(field, arg)
+		return "NOT " + c, err
+	case "$gt", "$gte", "$lt", "$lte":
+		sym := map[string]string{"$gt": ">", "$gte": ">=", "$lt": "<", "$lte": "<="}[op]
+		return d.order(field, sym, arg)
+	case "$in", "$nin":
+		arr, ok := arg.(primitive.A)
+		if !ok {
+			return "", fmt.Errorf("%s needs an array", op)
+		}
+		clauses := []string{"false"}
+		for _, v := range arr {
+			c, err := d.eq(field, v)
+			if err != nil {
+				return "", err
+			}
+			clauses = append(clauses, c)
+		}
+		in := "(" + strings.Join(clauses, " OR ") + ")"
+		if op == "$nin" {
+			return "NOT " + in, nil
+		}
+		return in, nil
+	case "$exists":
+		if want, _ := arg.(bool); want {
+			return d.exists(field), nil
+		}
+		return "NOT " + d.exists(field), nil
+	case "$regex":
+		pattern, options := fmt.Sprint(arg), ""
+		if re, ok := arg.(primitive.Regex); ok {
+			pattern, options = re.Pattern, re.Options
+		}
+		if opts, ok := cond["$options"].(string); ok {
+			options = opts
+		}
+		return d.regex(field, pattern, strings.Contains(options, "i")), nil
+	case "$not":
+		inner, ok := asDocument(arg)
+		if !ok {
+			return "", fmt.Errorf("$not needs a document")
+		}
+		c, err := sqlCondition(d, field, inner)
+		return "NOT " + c, err
+	}
+	return "", fmt.Errorf("unsupported query operator %s", op)
+}
+
+func sqlCondition(d sqlDialect, field string, cond bson.M) (string, error) {
+	clauses := []string{"true"}
+	for _, op := range sortedKeys(cond) {
+		if op == "$options" {
+			continue
+		}
+		c, err := sqlOperator(d, field, op, cond[op], cond)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, c)
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", nil
+}
+
+func sqlLogical(d sqlDialect, clauses interface{}, join string) (string, error) {
+	arr, ok := clauses.(primitive.A)
+	if !ok {
+		return "", fmt.Errorf("logical operators need an array")
+	}
+	parts := []string{}
+	for _, c := range arr {
+		where, ok := asDocument(c)
+		if !ok {
+			return "", fmt.Errorf("logical operators need documents")
+		}
+		sql, err := sqlWhere(d, where)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, sql)
+	}
+	if len(parts) == 0 {
+		return "true", nil
+	}
+	return "(" + strings.Join(parts, join) + ")", nil
+}
+
+// sqlWhere compiles a normalized filter to a boolean SQL expression
+func sqlWhere(d sqlDialect, where bson.M) (string, error) {
+	clauses := []string{"true"}
+	for _, key := range sortedKeys(where) {
+		cond := where[key]
+		var c string
+		var err error
+		switch key {
+		case "$and":
+			c, err = sqlLogical(d, cond, " AND ")
+		case "$or":
+			c, err = sqlLogical(d, cond, " OR ")
+		case "$nor":
+			c, err = sqlLogical(d, cond, " OR ")
+			c = "NOT " + c
+		default:
+			if ops, ok := isOperatorDocument(cond); ok {
+				c, err = sqlCondition(d, key, ops)
+			} else if re, ok := cond.(primitive.Regex); ok {
+				c, err = sqlOperator(d, key, "$regex", re, nil)
+			} else {
+				c, err = d.eq(key, cond)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, c)
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", nil
+}
+
+func sortedKeys(m bson.M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,581 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+var uniqueIndex = regexp.MustCompile(`index '([^']+)'`)
+
+// regexps caches the patterns compiled by the regexp SQL function
+var regexps sync.Map
+
+func init() {
+	// sqlite ships without a regexp implementation, X REGEXP Y calls regexp(Y, X)
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		pattern, _ := args[0].(string)
+		s, ok := args[1].(string)
+		if !ok {
+			return int64(0), nil
+		}
+		re, ok := regexps.Load(pattern)
+		if !ok {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			re, _ = regexps.LoadOrStore(pattern, compiled)
+		}
+		if re.(*regexp.Regexp).MatchString(s) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	})
+}
+
+// sqliteDatastore Stores every collection in a single table of a sqlite database file
+type sqliteDatastore struct {
+	db *sql.DB
+	// tx is set on the Repository handed to Transaction
+	tx *sql.Tx
+}
+
+// NewSQLiteDatastore Will open the database file named by config.Uri and apply any pending migrations
+func NewSQLiteDatastore(config *Config) Repository {
+	if len(config.Uri) == 0 {
+		log.Fatal("The sqlite datastore needs the database file as its Uri")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := sql.Open("sqlite", sqliteDSN(config.Uri))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Opening %s", config.Uri)
+	if err := db.PingContext(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	ds := &sqliteDatastore{db: db}
+	if err := ds.Migrate(ctx); err != nil {
+		log.Fatal(err)
+	}
+	return ds
+}
+
+/*
+* PRIVATE
+ */
+
+// sqliteDSN Waits on locks instead of failing and takes the write lock when a transaction
+// begins, so concurrent writers queue up rather than deadlock
+func sqliteDSN(uri string) string {
+	if !strings.HasPrefix(uri, "file:") {
+		uri = "file:" + uri
+	}
+	sep := "?"
+	if strings.Contains(uri, "?") {
+		sep = "&"
+	}
+	return uri + sep + "_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// jsonPath converts a dotted field to a sqlite JSON path
+func jsonPath(field string) string {
+	path := "$"
+	for _, key := range strings.Split(field, ".") {
+		path += `."` + key + `"`
+	}
+	return path
+}
+
+// sqliteBuilder Is the sqlite sqlDialect, fields are JSON paths into the doc column
+type sqliteBuilder struct {
+	args []interface{}
+}
+
+func (b *sqliteBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "?" + strconv.Itoa(len(b.args))
+}
+
+// value compiles the comparison of a JSON value, given by its json_type and its extracted
+// SQL value, with a normalized bson value
+func (b *sqliteBuilder) value(typ string, val string, sym string, v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		if sym != "=" {
+			return "false", nil
+		}
+		return "(" + typ + " = 'null')", nil
+	case bool:
+		if sym == "=" {
+			return fmt.Sprintf("(%s = '%t')", typ, x), nil
+		}
+		return fmt.Sprintf("(%s IN ('true', 'false') AND %s %s %s)", typ, val, sym, b.arg(x)), nil
+	case int32, int64, float64:
+		return fmt.Sprintf("(%s IN ('integer', 'real') AND %s %s %s)", typ, val, sym, b.arg(x)), nil
+	case string:
+		return fmt.Sprintf("(%s = 'text' AND %s %s %s)", typ, val, sym, b.arg(x)), nil
+	case primitive.DateTime:
+		return fmt.Sprintf(`(%s = 'object' AND json_extract(%s, '$."$date"') %s %s)`, typ, val, sym, b.arg(int64(x))), nil
+	case primitive.ObjectID:
+		return fmt.Sprintf(`(%s = 'object' AND json_extract(%s, '$."$oid"') %s %s)`, typ, val, sym, b.arg(x.Hex())), nil
+	}
+	if sym != "=" {
+		return "", fmt.Errorf("cannot order by %T", v)
+	}
+	ev, err := encodeJSON(v)
+	if err != nil {
+		return "", err
+	}
+	j, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s IN ('object', 'array') AND json(%s) = json(%s))", typ, val, b.arg(string(j))), nil
+}
+
+func (b *sqliteBuilder) eq(field string, v interface{}) (string, error) {
+	p := b.arg(jsonPath(field))
+	typ, val := "json_type(doc, "+p+")", "json_extract(doc, "+p+")"
+	top, err := b.value(typ, val, "=", v)
+	if err != nil {
+		return "", err
+	}
+	elem, err := b.value("e.type", "e.value", "=", v)
+	if err != nil {
+		return "", err
+	}
+	// Missing fields equal null, as they do in mongo
+	if v == nil {
+		top = "(" + typ + " IS NULL OR " + top + ")"
+	}
+	// Never null, so $ne and $nin match missing fields as they do in mongo
+	return fmt.Sprintf("coalesce(%s OR (%s = 'array' AND EXISTS (SELECT 1 FROM json_each(doc, %s) AS e WHERE %s)), false)", top, typ, p, elem), nil
+}
+
+func (b *sqliteBuilder) order(field string, sym string, v interface{}) (string, error) {
+	p := b.arg(jsonPath(field))
+	return b.value("json_type(doc, "+p+")", "json_extract(doc, "+p+")", sym, v)
+}
+
+func (b *sqliteBuilder) exists(field string) string {
+	return "(json_type(doc, " + b.arg(jsonPath(field)) + ") IS NOT NULL)"
+}
+
+func (b *sqliteBuilder) regex(field string, pattern string, insensitive bool) string {
+	if insensitive {
+		pattern = "(?i)" + pattern
+	}
+	p := b.arg(jsonPath(field))
+	return fmt.Sprintf("coalesce(json_type(doc, %s) = 'text' AND regexp(%s, json_extract(doc, %s)), false)", p, b.arg(pattern), p)
+}
+
+// sqliteSelect builds the query returning id and doc of every match in insertion order
+func sqliteSelect(query Query, page *Pagination) (string, []interface{}, error) {
+	where, err := normalize(query.Where)
+	if err != nil {
+		return "", nil, err
+	}
+	w, _ := asDocument(where)
+
+	b := &sqliteBuilder{}
+	sql := "SELECT id, doc FROM documents WHERE collection = " + b.arg(query.From)
+	cond, err := sqlWhere(b, w)
+	if err != nil {
+		return "", nil, err
+	}
+	sql += " AND " + cond + " ORDER BY "
+
+	if page != nil {
+		for _, s := range page.Sort {
+			field, desc := parseSort(s)
+			// Dates and ObjectIDs are stored tagged, they sort by their value
+			p := jsonPath(field)
+			key := fmt.Sprintf("coalesce(json_extract(doc, %s), json_extract(doc, %s), json_extract(doc, %s))",
+				b.arg(p+`."$date"`), b.arg(p+`."$oid"`), b.arg(p))
+			// Missing fields sort lowest, as they do in mongo
+			if desc {
+				sql += key + " DESC NULLS LAST, "
+			} else {
+				sql += key + " ASC NULLS FIRST, "
+			}
+		}
+	}
+	sql += "seq"
+
+	if page != nil {
+		limit := page.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		sql += " LIMIT " + b.arg(limit) + " OFFSET " + b.arg(page.offset())
+	}
+	return sql, b.args, nil
+}
+
+// sqlConn Is satisfied by both *sql.DB and *sql.Tx
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (ds *sqliteDatastore) conn() sqlConn {
+	if ds.tx != nil {
+		return ds.tx
+	}
+	return ds.db
+}
+
+// atomic runs fn in the current transaction, or in a new one
+func (ds *sqliteDatastore) atomic(ctx context.Context, fn func(q sqlConn) error) error {
+	if ds.tx != nil {
+		return fn(ds.tx)
+	}
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scan calls fn with the id and projected document of every match as rows are read
+func (ds *sqliteDatastore) scan(ctx context.Context, q sqlConn, query Query, page *Pagination, fn func(id string, doc bson.M) error) error {
+	sql, args, err := sqliteSelect(query, page)
+	if err != nil {
+		return err
+	}
+	rows, err := q.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return err
+		}
+		doc, err := unmarshalDocument([]byte(raw))
+		if err != nil {
+			return err
+		}
+		if err := fn(id, project(doc, bson.M(query.Select))); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (ds *sqliteDatastore) find(ctx context.Context, q sqlConn, query Query, page *Pagination) ([]string, []bson.M, error) {
+	var ids []string
+	var docs []bson.M
+	err := ds.scan(ctx, q, query, page, func(id string, doc bson.M) error {
+		ids = append(ids, id)
+		docs = append(docs, doc)
+		return nil
+	})
+	return ids, docs, err
+}
+
+// wrapSQLite converts unique violations to DuplicateKeyError
+func wrapSQLite(coll string, err error) error {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	switch e.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		field := "_id"
+		if m := uniqueIndex.FindStringSubmatch(e.Error()); m != nil {
+			field = m[1]
+		}
+		return &DuplicateKeyError{Collection: coll, Field: field}
+	}
+	return err
+}
+
+// update replaces the first match in sort order
+func (ds *sqliteDatastore) update(ctx context.Context, query Query, sort []string, d interface{}) (bson.M, bson.M, error) {
+	update, err := normalize(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, ok := asDocument(update)
+	if !ok {
+		return nil, nil, fmt.Errorf("update must be a document, got %T", d)
+	}
+
+	var before, after bson.M
+	err = ds.atomic(ctx, func(q sqlConn) error {
+		ids, docs, err := ds.find(ctx, q, Query{Where: query.Where, From: query.From}, &Pagination{Page: 1, Limit: 1, Sort: sort})
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+
+		after, err = applyUpdate(docs[0], u)
+		if err != nil {
+			return err
+		}
+		raw, err := marshalDocument(after)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, "UPDATE documents SET doc = ? WHERE collection = ? AND id = ?", string(raw), query.From, ids[0])
+		if err != nil {
+			return wrapSQLite(query.From, err)
+		}
+		before = docs[0]
+		return nil
+	})
+	return before, after, err
+}
+
+/*
+* PUBLIC
+ */
+
+// Migrate Applies the embedded migrations that have not run yet
+func (ds *sqliteDatastore) Migrate(ctx context.Context) error {
+	files, err := fs.Glob(sqliteMigrations, "migrations/sqlite/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	// Transactions take the write lock as they begin, so only one process migrates at a time
+	return ds.atomic(ctx, func(q sqlConn) error {
+		_, err := q.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			version := strings.TrimSuffix(f[strings.LastIndex(f, "/")+1:], ".sql")
+			rows, err := q.QueryContext(ctx, "SELECT 1 FROM schema_migrations WHERE version = ?", version)
+			if err != nil {
+				return err
+			}
+			applied := rows.Next()
+			rows.Close()
+			if applied {
+				continue
+			}
+
+			sql, err := sqliteMigrations.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if _, err := q.ExecContext(ctx, string(sql)); err != nil {
+				return fmt.Errorf("migration %s: %w", version, err)
+			}
+			if _, err := q.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+				return err
+			}
+			log.Infof("Applied migration %s", version)
+		}
+		return nil
+	})
+}
+
+// Close Will close the database, it does nothing on the Repository of a transaction
+func (ds *sqliteDatastore) Close() error {
+	if ds.tx != nil {
+		return nil
+	}
+	return ds.db.Close()
+}
+
+// Transaction Runs fn in a transaction, which holds the database write lock until it ends
+func (ds *sqliteDatastore) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if ds.tx != nil {
+		return fn(ctx, ds)
+	}
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, &sqliteDatastore{db: ds.db, tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EnsureIndexes Makes sure a unique expression index exists for every field of the collection,
+// missing fields index as null as they do in mongo
+func (ds *sqliteDatastore) EnsureIndexes(coll string, indexQuery []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, field := range indexQuery {
+		name := indexName.ReplaceAllString(strings.ToLower("documents_"+coll+"_"+field), "_") + "_key"
+		exprs := []string{}
+		for _, f := range indexFields(field) {
+			exprs = append(exprs, fmt.Sprintf(`coalesce(doc -> %s, 'null')`, quoteLiteral(jsonPath(f))))
+		}
+		sql := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS "%s" ON documents (%s) WHERE collection = %s`,
+			name, strings.Join(exprs, ", "), quoteLiteral(coll))
+		if _, err := ds.conn().ExecContext(ctx, sql); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Find Will find an entry within the datastore
+func (ds *sqliteDatastore) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, docs, err := ds.find(ctx, ds.conn(), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeModels(ctx, query.From, docs), nil
+}
+
+// Insert Will insert an entry into datastore
+func (ds *sqliteDatastore) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	switch id := doc["_id"].(type) {
+	case string:
+	case primitive.ObjectID:
+		doc["_id"] = id.Hex()
+	default:
+		doc["_id"] = NewID()
+	}
+	raw, err := marshalDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ds.conn().ExecContext(ctx, "INSERT INTO documents (collection, id, doc) VALUES (?, ?, ?)", query.From, doc["_id"], string(raw))
+	if err != nil {
+		return nil, wrapSQLite(query.From, err)
+	}
+	return &InsertResult{InsertedID: doc["_id"].(string)}, nil
+}
+
+// Update will update the first matching entry, returning it as it was before the update
+func (ds *sqliteDatastore) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	before, _, err := ds.update(ctx, query, nil, d)
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// FindOneAndUpdate Finds and updates in one transaction, which holds the write lock from its start
+func (ds *sqliteDatastore) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, after, err := ds.update(ctx, query, sort, d)
+	if err != nil {
+		return err
+	}
+	return decodeOne(after, out)
+}
+
+// Stream Iterates over the rows as they are read
+func (ds *sqliteDatastore) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	return ds.scan(ctx, ds.conn(), query, &Pagination{Sort: sort}, func(id string, doc bson.M) error {
+		return fn(func(out interface{}) error { return decodeOne(doc, out) })
+	})
+}
+
+// Delete will delete the first matching entry, returning it
+func (ds *sqliteDatastore) Delete(ctx context.Context, query Query) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	var before bson.M
+	err := ds.atomic(ctx, func(q sqlConn) error {
+		ids, docs, err := ds.find(ctx, q, Query{Where: query.Where, From: query.From}, &Pagination{Page: 1, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+
+		_, err = q.ExecContext(ctx, "DELETE FROM documents WHERE collection = ? AND id = ?", query.From, ids[0])
+		before = docs[0]
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// Paginate provides pagination to the find operation
+func (ds *sqliteDatastore) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, docs, err := ds.find(ctx, ds.conn(), query, &page)
+	if err != nil {
+		return nil, err
+	}
+	return decodeModels(ctx, query.From, docs), nil
+}
+
+// FindInto Will decode every matching entry into out, which must be a pointer to a slice.
+// A nil page returns every match
+func (ds *sqliteDatastore) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	_, docs, err := ds.find(ctx, ds.conn(), query, page)
+	if err != nil {
+		return err
+	}
+	return decodeInto(docs, out)
+}
@@ -0,0 +1,22 @@
+package datastore_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore/datastoretest"
+)
+
+func TestSQLiteDatastore(t *testing.T) {
+	datastoretest.Run(t, func(t *testing.T) datastore.Repository {
+		r := datastore.NewSQLiteDatastore(&datastore.Config{
+			Driver: datastore.DriverSQLite,
+			Uri:    filepath.Join(t.TempDir(), "test.db"),
+		})
+		t.Cleanup(func() {
+			_ = r.Close()
+		})
+		return r
+	})
+}
@@ -0,0 +1,414 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+// Tenancy modes selectable per deployment
+const (
+	// TenancyFilter keeps every tenant in the same database, documents carry their tenant
+	TenancyFilter = "filter"
+	// TenancyDatabase gives every tenant a database of its own
+	TenancyDatabase = "database"
+)
+
+// DefaultTenantField Is the field documents carry their tenant in
+const DefaultTenantField = "tenantId"
+
+// TenancyConfig Is the config of a tenant filtered Repository
+type TenancyConfig struct {
+	// Field defaults to tenantId
+	Field string
+}
+
+// ErrNoTenant Is returned by tenant scoped Repositories when the context carries no tenant, so an
+// unscoped call fails rather than reading every tenant
+var ErrNoTenant = errors.New("datastore: the context carries no tenant")
+
+// ErrRouterClosed Is returned by the tenant router once it is closed
+var ErrRouterClosed = errors.New("datastore: the tenant router is closed")
+
+type tenantRepository struct {
+	r     Repository
+	field string
+}
+
+// tenantStatsRepository Is a tenantRepository over a cached Repository, it keeps reporting stats
+type tenantStatsRepository struct {
+	*tenantRepository
+	CacheStatsReporter
+}
+
+type tenantRouter struct {
+	open func(tenant string) Repository
+
+	mu      sync.Mutex
+	tenants map[string]*tenantEntry
+	indexes map[string][]string
+	closed  bool
+}
+
+// tenantEntry Is the Repository of a tenant, ready is closed once it is opened
+type tenantEntry struct {
+	ready chan struct{}
+	r     Repository
+	err   error
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewTenantRepository Will wrap a Repository so every query only matches the documents of the
+// tenant of its context and every insert is stamped with it. Unique indexes are made unique per
+// tenant. Wrap the cache rather than be wrapped by it, so cache keys include the tenant
+func NewTenantRepository(r Repository, config *TenancyConfig) Repository {
+	field := config.Field
+	if len(field) == 0 {
+		field = DefaultTenantField
+	}
+	t := &tenantRepository{r: r, field: field}
+	if reporter, ok := r.(CacheStatsReporter); ok {
+		return &tenantStatsRepository{tenantRepository: t, CacheStatsReporter: reporter}
+	}
+	return t
+}
+
+// NewTenantRouter Will route every operation to the Repository of the tenant of its context,
+// open is called on the first operation of each tenant and must build a Repository over that
+// tenant's database. Indexes are ensured on every tenant Repository. Every tenant gets a client of
+// its own, so the tenants must be restricted upstream, e.g. by tenancy.Config.Tenants
+func NewTenantRouter(open func(tenant string) Repository) Repository {
+	return &tenantRouter{open: open, tenants: map[string]*tenantEntry{}, indexes: map[string][]string{}}
+}
+
+/*
+* PRIVATE
+ */
+
+func (t *tenantRepository) tenant(ctx context.Context) (string, error) {
+	tenant := tenancy.FromContext(ctx)
+	if len(tenant) == 0 {
+		return "", ErrNoTenant
+	}
+	return tenant, nil
+}
+
+// scope returns a copy of query only matching the tenant, a tenant set by the caller is replaced
+func (t *tenantRepository) scope(ctx context.Context, query Query) (Query, error) {
+	tenant, err := t.tenant(ctx)
+	if err != nil {
+		return query, err
+	}
+	where := M{}
+	for k, v := range query.Where {
+		where[k] = v
+	}
+	where[t.field] = tenant
+	query.Where = where
+	return query, nil
+}
+
+// stamp returns d as a document carrying the tenant
+func (t *tenantRepository) stamp(ctx context.Context, d interface{}) (bson.M, error) {
+	tenant, err := t.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := toDocument(d)
+	if err != nil {
+		return nil, err
+	}
+	doc[t.field] = tenant
+	return doc, nil
+}
+
+// guard returns an update that cannot move a document to another tenant, a $set of the tenant
+// field is replaced by the tenant and other operators on it are refused
+func (t *tenantRepository) guard(ctx context.Context, d interface{}) (interface{}, error) {
+	tenant, err := t.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := normalize(d)
+	if err != nil {
+		return nil, err
+	}
+	update, ok := asDocument(normalized)
+	if !ok {
+		return nil, fmt.Errorf("update must be a document, got %T", d)
+	}
+	if _, ok := isOperatorDocument(update); !ok {
+		// Replacement documents keep their tenant
+		update[t.field] = tenant
+		return update, nil
+	}
+
+	for op, arg := range update {
+		fields, ok := asDocument(arg)
+		if !ok {
+			continue
+		}
+		if _, ok := fields[t.field]; !ok {
+			continue
+		}
+		if op != "$set" {
+			return nil, fmt.Errorf("%s cannot change the tenant field %s", op, t.field)
+		}
+		fields[t.field] = tenant
+	}
+	return update, nil
+}
+
+// repository returns the Repository of the tenant of ctx, opening it on first use. It is opened
+// outside the lock so a slow tenant never holds up the others, concurrent callers of the same
+// tenant wait for the first one
+func (t *tenantRouter) repository(ctx context.Context) (Repository, error) {
+	tenant := tenancy.FromContext(ctx)
+	if len(tenant) == 0 {
+		return nil, ErrNoTenant
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrRouterClosed
+	}
+	e, ok := t.tenants[tenant]
+	if !ok {
+		e = &tenantEntry{ready: make(chan struct{})}
+		t.tenants[tenant] = e
+	}
+	t.mu.Unlock()
+
+	if ok {
+		select {
+		case <-e.ready:
+			return e.r, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r := t.open(tenant)
+	// Indexes are ensured under the lock so none registered while opening are missed
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		e.err = ErrRouterClosed
+		close(e.ready)
+		return nil, errors.Join(e.err, r.Close())
+	}
+	for coll, indexes := range t.indexes {
+		r.EnsureIndexes(coll, indexes)
+	}
+	e.r = r
+	close(e.ready)
+	return r, nil
+}
+
+/*
+* PUBLIC
+ */
+
+func (t *tenantRepository) Close() error {
+	return t.r.Close()
+}
+
+// EnsureIndexes Prefixes every index with the tenant field, values are unique per tenant
+func (t *tenantRepository) EnsureIndexes(coll string, indexQuery []string) {
+	scoped := make([]string, 0, len(indexQuery))
+	for _, index := range indexQuery {
+		scoped = append(scoped, t.field+","+index)
+	}
+	t.r.EnsureIndexes(coll, scoped)
+}
+
+func (t *tenantRepository) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return t.r.Find(ctx, query)
+}
+
+func (t *tenantRepository) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	doc, err := t.stamp(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return t.r.Insert(ctx, query, doc)
+}
+
+func (t *tenantRepository) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	update, err := t.guard(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	return t.r.Update(ctx, query, update)
+}
+
+func (t *tenantRepository) Delete(ctx context.Context, query Query) (interface{}, error) {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return t.r.Delete(ctx, query)
+}
+
+func (t *tenantRepository) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return t.r.Paginate(ctx, query, page)
+}
+
+func (t *tenantRepository) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return err
+	}
+	return t.r.FindInto(ctx, query, page, out)
+}
+
+func (t *tenantRepository) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return err
+	}
+	update, err := t.guard(ctx, d)
+	if err != nil {
+		return err
+	}
+	return FindOneAndUpdate(ctx, t.r, query, sort, update, out)
+}
+
+func (t *tenantRepository) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	query, err := t.scope(ctx, query)
+	if err != nil {
+		return err
+	}
+	return Stream(ctx, t.r, query, sort, fn)
+}
+
+// Transaction Scopes the Repository of the transaction to the tenant too
+func (t *tenantRepository) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	if _, err := t.tenant(ctx); err != nil {
+		return err
+	}
+	return Transaction(ctx, t.r, func(ctx context.Context, tx Repository) error {
+		return fn(ctx, &tenantRepository{r: tx, field: t.field})
+	})
+}
+
+// Close Closes the Repository of every tenant opened so far
+func (t *tenantRouter) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	var errs []error
+	for _, e := range t.tenants {
+		// Tenants still opening are closed by their opener
+		if e.r != nil {
+			errs = append(errs, e.r.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EnsureIndexes Creates the indexes on the tenants opened so far and remembers them for the others
+func (t *tenantRouter) EnsureIndexes(coll string, indexQuery []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.indexes[coll] = append(t.indexes[coll], indexQuery...)
+	for _, e := range t.tenants {
+		if e.r != nil {
+			e.r.EnsureIndexes(coll, indexQuery)
+		}
+	}
+}
+
+func (t *tenantRouter) Find(ctx context.Context, query Query) (*[]models.Model, error) {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Find(ctx, query)
+}
+
+func (t *tenantRouter) Insert(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Insert(ctx, query, d)
+}
+
+func (t *tenantRouter) Update(ctx context.Context, query Query, d interface{}) (interface{}, error) {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Update(ctx, query, d)
+}
+
+func (t *tenantRouter) Delete(ctx context.Context, query Query) (interface{}, error) {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Delete(ctx, query)
+}
+
+func (t *tenantRouter) Paginate(ctx context.Context, query Query, page Pagination) (*[]models.Model, error) {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.Paginate(ctx, query, page)
+}
+
+func (t *tenantRouter) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) error {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return err
+	}
+	return r.FindInto(ctx, query, page, out)
+}
+
+func (t *tenantRouter) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) error {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return err
+	}
+	return FindOneAndUpdate(ctx, r, query, sort, d, out)
+}
+
+func (t *tenantRouter) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) error {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return err
+	}
+	return Stream(ctx, r, query, sort, fn)
+}
+
+func (t *tenantRouter) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) error {
+	r, err := t.repository(ctx)
+	if err != nil {
+		return err
+	}
+	return Transaction(ctx, r, fn)
+}
@@ -0,0 +1,203 @@
+package datastore_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore/datastoretest"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// isolation Stores a person of acme and checks globex can neither read nor write it
+func isolation(t *testing.T, r datastore.Repository) {
+	acme := tenancy.WithTenant(context.Background(), "acme")
+	globex := tenancy.WithTenant(context.Background(), "globex")
+	people := datastore.Query{From: "people"}
+	u := utils.NewUtils()
+	r.EnsureIndexes("people", []string{"email"})
+
+	res, err := r.Insert(acme, people, datastoretest.Person{Name: "ann", Email: "ann@test.com"})
+	require.Nil(t, err)
+	id := res.(*datastore.InsertResult).InsertedID
+	byID := datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: "people"}
+
+	list := func(ctx context.Context, query datastore.Query) []datastoretest.Person {
+		out := []datastoretest.Person{}
+		require.Nil(t, r.FindInto(ctx, query, nil, &out))
+		return out
+	}
+	require.Len(t, list(acme, byID), 1)
+
+	// Reads
+	assert.Empty(t, list(globex, byID))
+	assert.Empty(t, list(globex, people))
+	assert.Empty(t, list(globex, datastore.Query{Where: datastore.M{"tenantId": "acme"}, From: "people"}), "a tenant in the filter is replaced")
+	assert.Empty(t, list(globex, datastore.Query{Where: datastore.M{"$or": []datastore.M{{"tenantId": "acme"}}}, From: "people"}))
+	found, err := r.Find(globex, byID)
+	require.Nil(t, err)
+	assert.Empty(t, *found)
+	page, err := r.Paginate(globex, people, datastore.Pagination{Page: 1, Limit: 10})
+	require.Nil(t, err)
+	assert.Empty(t, *page)
+	streamed := 0
+	err = datastore.Stream(globex, r, people, nil, func(decode func(out interface{}) error) error {
+		streamed++
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Zero(t, streamed)
+
+	// Writes
+	_, err = r.Update(globex, byID, datastore.M{"$set": datastore.M{"name": "eve"}})
+	assert.ErrorIs(t, err, datastore.ErrNotFound, "update")
+	var claimed datastoretest.Person
+	err = datastore.FindOneAndUpdate(globex, r, byID, nil, datastore.M{"$set": datastore.M{"name": "eve"}}, &claimed)
+	assert.ErrorIs(t, err, datastore.ErrNotFound, "find one and update")
+	_, err = r.Delete(globex, byID)
+	assert.ErrorIs(t, err, datastore.ErrNotFound, "delete")
+	err = datastore.Transaction(globex, r, func(ctx context.Context, tx datastore.Repository) error {
+		out := []datastoretest.Person{}
+		require.Nil(t, tx.FindInto(ctx, byID, nil, &out))
+		assert.Empty(t, out, "transactions are scoped too")
+		return nil
+	})
+	require.Nil(t, err)
+
+	// A document cannot be moved to another tenant
+	_, err = r.Update(acme, byID, datastore.M{"$set": datastore.M{"tenantId": "globex"}})
+	require.Nil(t, err)
+	assert.Empty(t, list(globex, byID))
+
+	// Unique values are unique per tenant
+	_, err = r.Insert(globex, people, datastoretest.Person{Name: "ann", Email: "ann@test.com"})
+	assert.Nil(t, err)
+	_, err = r.Insert(acme, people, datastoretest.Person{Name: "dup", Email: "ann@test.com"})
+	assert.Equal(t, apperrors.KindConflict, apperrors.KindOf(u.ErrorWrapper(err)))
+	assert.Equal(t, []string{"ann"}, names(list(acme, people)))
+	assert.Equal(t, []string{"ann"}, names(list(globex, people)))
+
+	// Calls without a tenant fail rather than reading every tenant
+	_, err = r.Find(context.Background(), people)
+	assert.ErrorIs(t, err, datastore.ErrNoTenant)
+	_, err = r.Insert(context.Background(), people, datastoretest.Person{Name: "cid"})
+	assert.ErrorIs(t, err, datastore.ErrNoTenant)
+	_, err = r.Delete(context.Background(), people)
+	assert.ErrorIs(t, err, datastore.ErrNoTenant)
+}
+
+func names(people []datastoretest.Person) []string {
+	res := []string{}
+	for _, p := range people {
+		res = append(res, p.Name)
+	}
+	return res
+}
+
+/*
+	TESTS
+*/
+
+func TestTenantRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		isolation(t, datastore.NewTenantRepository(datastore.NewMemoryDatastore(), &datastore.TenancyConfig{}))
+	})
+	t.Run("Cached", func(t *testing.T) {
+		cached := datastore.NewCachedRepository(datastore.NewMemoryDatastore(), cache.NewLRU(100), &datastore.CacheConfig{TTL: time.Minute})
+		r := datastore.NewTenantRepository(cached, &datastore.TenancyConfig{})
+		isolation(t, r)
+		_, ok := r.(datastore.CacheStatsReporter)
+		assert.True(t, ok, "cache stats are still reported")
+	})
+
+	// Documents are stamped with their tenant
+	base := datastore.NewMemoryDatastore()
+	r := datastore.NewTenantRepository(base, &datastore.TenancyConfig{Field: "org"})
+	_, err := r.Insert(tenancy.WithTenant(context.Background(), "acme"), datastore.Query{From: "people"}, datastoretest.Person{Name: "ann"})
+	require.Nil(t, err)
+	stored := []datastore.M{}
+	require.Nil(t, base.FindInto(context.Background(), datastore.Query{From: "people"}, nil, &stored))
+	require.Len(t, stored, 1)
+	assert.Equal(t, "acme", stored[0]["org"])
+}
+
+func TestTenantRouter(t *testing.T) {
+	opened := map[string]datastore.Repository{}
+	r := datastore.NewTenantRouter(func(tenant string) datastore.Repository {
+		opened[tenant] = datastore.NewMemoryDatastore()
+		return opened[tenant]
+	})
+	isolation(t, r)
+
+	// Every tenant got its own database, with the indexes ensured before it was opened
+	assert.Len(t, opened, 2)
+	_, err := opened["globex"].Insert(context.Background(), datastore.Query{From: "people"}, datastoretest.Person{Name: "dup", Email: "ann@test.com"})
+	assert.NotNil(t, err)
+	assert.Nil(t, r.Close())
+}
+
+func TestTenantRouterOpen(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var opens sync.Map
+	r := datastore.NewTenantRouter(func(tenant string) datastore.Repository {
+		n, _ := opens.LoadOrStore(tenant, new(int32))
+		atomic.AddInt32(n.(*int32), 1)
+		if tenant == "slow" {
+			close(started)
+			<-release
+		}
+		return datastore.NewMemoryDatastore()
+	})
+	people := datastore.Query{From: "people"}
+	slow := tenancy.WithTenant(context.Background(), "slow")
+
+	// Callers of the tenant being opened wait for it, without opening it again
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := []datastoretest.Person{}
+			assert.Nil(t, r.FindInto(slow, people, nil, &out))
+		}()
+	}
+
+	<-started
+
+	// Other tenants are served meanwhile
+	done := make(chan error)
+	go func() {
+		out := []datastoretest.Person{}
+		done <- r.FindInto(tenancy.WithTenant(context.Background(), "acme"), people, nil, &out)
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("a slow tenant blocked another one")
+	}
+
+	// A caller giving up stops waiting
+	ctx, cancel := context.WithTimeout(slow, 10*time.Millisecond)
+	defer cancel()
+	out := []datastoretest.Person{}
+	assert.ErrorIs(t, r.FindInto(ctx, people, nil, &out), context.DeadlineExceeded)
+
+	close(release)
+	wg.Wait()
+	n, _ := opens.Load("slow")
+	assert.Equal(t, int32(1), atomic.LoadInt32(n.(*int32)))
+
+	assert.Nil(t, r.Close())
+	assert.ErrorIs(t, r.FindInto(slow, people, nil, &out), datastore.ErrRouterClosed)
+}
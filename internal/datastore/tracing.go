@@ -0,0 +1,167 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+const tracerName = "github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+
+type tracedRepository struct {
+	r      Repository
+	tracer trace.Tracer
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewTracedRepository Will wrap a Repository so every operation is recorded as a child span
+func NewTracedRepository(r Repository) Repository {
+	return &tracedRepository{r: r, tracer: otel.Tracer(tracerName)}
+}
+
+/*
+* PRIVATE
+ */
+
+func (t *tracedRepository) start(ctx context.Context, op string, query Query) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "datastore."+op,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			semconv.DBOperationName(op),
+			semconv.DBCollectionName(query.From),
+		),
+	)
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// newCommandMonitor Will create a span for every command the mongo driver sends
+func newCommandMonitor() *event.CommandMonitor {
+	tracer := otel.Tracer(tracerName)
+	spans := sync.Map{}
+
+	finish := func(requestID int64, err string) {
+		v, ok := spans.LoadAndDelete(requestID)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		if len(err) != 0 {
+			span.SetStatus(codes.Error, err)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			// Skip driver housekeeping that does not belong to a request
+			if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+				return
+			}
+			_, span := tracer.Start(ctx, "mongo."+e.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+					attribute.String("db.mongodb.connection_id", e.ConnectionID),
+				),
+			)
+			spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, e.Failure)
+		},
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+func (t *tracedRepository) Close() error {
+	return t.r.Close()
+}
+
+func (t *tracedRepository) EnsureIndexes(coll string, indexQuery []string) {
+	t.r.EnsureIndexes(coll, indexQuery)
+}
+
+func (t *tracedRepository) Find(ctx context.Context, query Query) (res *[]models.Model, err error) {
+	ctx, span := t.start(ctx, "find", query)
+	defer func() { end(span, err) }()
+	return t.r.Find(ctx, query)
+}
+
+func (t *tracedRepository) Insert(ctx context.Context, query Query, d interface{}) (res interface{}, err error) {
+	ctx, span := t.start(ctx, "insert", query)
+	defer func() { end(span, err) }()
+	return t.r.Insert(ctx, query, d)
+}
+
+func (t *tracedRepository) Update(ctx context.Context, query Query, d interface{}) (res interface{}, err error) {
+	ctx, span := t.start(ctx, "update", query)
+	defer func() { end(span, err) }()
+	return t.r.Update(ctx, query, d)
+}
+
+func (t *tracedRepository) Delete(ctx context.Context, query Query) (res interface{}, err error) {
+	ctx, span := t.start(ctx, "delete", query)
+	defer func() { end(span, err) }()
+	return t.r.Delete(ctx, query)
+}
+
+func (t *tracedRepository) Paginate(ctx context.Context, query Query, page Pagination) (res *[]models.Model, err error) {
+	ctx, span := t.start(ctx, "paginate", query)
+	span.SetAttributes(attribute.Int("db.page", page.Page), attribute.Int("db.limit", page.Limit))
+	defer func() { end(span, err) }()
+	return t.r.Paginate(ctx, query, page)
+}
+
+func (t *tracedRepository) FindInto(ctx context.Context, query Query, page *Pagination, out interface{}) (err error) {
+	ctx, span := t.start(ctx, "findInto", query)
+	defer func() { end(span, err) }()
+	return t.r.FindInto(ctx, query, page, out)
+}
+
+func (t *tracedRepository) FindOneAndUpdate(ctx context.Context, query Query, sort []string, d interface{}, out interface{}) (err error) {
+	ctx, span := t.start(ctx, "findOneAndUpdate", query)
+	defer func() { end(span, err) }()
+	return FindOneAndUpdate(ctx, t.r, query, sort, d, out)
+}
+
+// Stream Traces the iteration as a whole, including the time fn takes
+func (t *tracedRepository) Stream(ctx context.Context, query Query, sort []string, fn func(decode func(out interface{}) error) error) (err error) {
+	ctx, span := t.start(ctx, "stream", query)
+	defer func() { end(span, err) }()
+	return Stream(ctx, t.r, query, sort, fn)
+}
+
+// Transaction Traces the transaction as a whole, operations inside it are children of its span
+func (t *tracedRepository) Transaction(ctx context.Context, fn func(ctx context.Context, tx Repository) error) (err error) {
+	ctx, span := t.start(ctx, "transaction", Query{})
+	defer func() { end(span, err) }()
+	return Transaction(ctx, t.r, func(ctx context.Context, tx Repository) error {
+		return fn(ctx, &tracedRepository{r: tx, tracer: t.tracer})
+	})
+}
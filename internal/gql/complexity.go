@@ -0,0 +1,144 @@
+package gql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// cost Is the complexity of an operation
+type cost struct {
+	// Complexity counts every field that may be resolved, fields under a list count once per item
+	Complexity int
+	// Depth is the deepest nesting of fields
+	Depth int
+}
+
+// analyzer walks the selected operation of a validated document
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+/*
+* PRIVATE
+ */
+
+// size is how many items a list field may return, its limit argument or DefaultLimit
+func (a *analyzer) size(field *ast.Field, def *graphql.FieldDefinition) int {
+	limit := DefaultLimit
+	for _, arg := range def.Args {
+		if arg.Name() == "limit" {
+			if v, ok := arg.DefaultValue.(int); ok {
+				limit = v
+			}
+		}
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			limit, _ = strconv.Atoi(v.Value)
+		case *ast.Variable:
+			switch n := a.variables[v.Name.Value].(type) {
+			case float64:
+				limit = int(n)
+			case int:
+				limit = n
+			}
+		}
+	}
+	return max(limit, 1)
+}
+
+// selectionSet returns the cost of the fields selected on parent
+func (a *analyzer) selectionSet(set *ast.SelectionSet, parent graphql.Type) cost {
+	c := cost{}
+	if set == nil {
+		return c
+	}
+	for _, selection := range set.Selections {
+		var sub cost
+		switch s := selection.(type) {
+		case *ast.Field:
+			sub = a.field(s, parent)
+		case *ast.InlineFragment:
+			sub = a.selectionSet(s.SelectionSet, parent)
+		case *ast.FragmentSpread:
+			if f, ok := a.fragments[s.Name.Value]; ok {
+				sub = a.selectionSet(f.SelectionSet, parent)
+			}
+		}
+		c.Complexity += sub.Complexity
+		c.Depth = max(c.Depth, sub.Depth)
+	}
+	return c
+}
+
+// field returns the cost of a field and its selections, introspection is free
+func (a *analyzer) field(field *ast.Field, parent graphql.Type) cost {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return cost{}
+	}
+	object, ok := parent.(*graphql.Object)
+	if !ok {
+		return cost{Complexity: 1, Depth: 1}
+	}
+	def, ok := object.Fields()[field.Name.Value]
+	if !ok {
+		return cost{Complexity: 1, Depth: 1}
+	}
+
+	t := def.Type
+	items := 1
+	for {
+		if n, ok := t.(*graphql.NonNull); ok {
+			t = n.OfType
+			continue
+		}
+		if l, ok := t.(*graphql.List); ok {
+			items *= a.size(field, def)
+			t = l.OfType
+			continue
+		}
+		break
+	}
+
+	sub := a.selectionSet(field.SelectionSet, t)
+	return cost{Complexity: 1 + items*sub.Complexity, Depth: 1 + sub.Depth}
+}
+
+// operation returns the operation named operationName, or the first one
+func operation(doc *ast.Document, operationName string) *ast.OperationDefinition {
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		d, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if op == nil || (d.Name != nil && d.Name.Value == operationName) {
+			op = d
+		}
+	}
+	return op
+}
+
+// analyze returns the cost of an operation of a validated document
+func analyze(schema graphql.Schema, doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) cost {
+	a := &analyzer{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, def := range doc.Definitions {
+		if d, ok := def.(*ast.FragmentDefinition); ok {
+			a.fragments[d.Name.Value] = d
+		}
+	}
+
+	var root graphql.Type = schema.QueryType()
+	if op.Operation == ast.OperationTypeMutation {
+		root = schema.MutationType()
+	}
+	return a.selectionSet(op.SelectionSet, root)
+}
@@ -0,0 +1,252 @@
+package gql_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/gql"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+)
+
+// countingService Records the batches of GetByIds
+type countingService struct {
+	services.Service
+	batches [][]string
+}
+
+func (c *countingService) GetByIds(ctx context.Context, ids []string) (services.ServiceResponse, error) {
+	c.batches = append(c.batches, ids)
+	return c.Service.GetByIds(ctx, ids)
+}
+
+type response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []gql.Error            `json:"errors"`
+}
+
+func newApp(t *testing.T, config *gql.Config) (*fiber.App, *countingService) {
+	r := datastore.NewMemoryDatastore()
+	r.EnsureIndexes("models", []string{"email"})
+	s := &countingService{Service: services.NewService(r, utils.NewUtils(), audit.NewAuditor(r), jobs.NewQueue(r, &jobs.Config{}), &services.Config{})}
+
+	app := fiber.New()
+	app.Get("/graphql", gql.Handler(s, config))
+	app.Post("/graphql", gql.Handler(s, config))
+	return app, s
+}
+
+func create(t *testing.T, s services.Service, name string, email string) string {
+	res, err := s.Create(context.Background(), &models.Model{Name: name, Email: email})
+	require.Nil(t, err)
+	return res.Data.(models.CreateResponse).InsertedID
+}
+
+func post(t *testing.T, app *fiber.App, query string, variables map[string]interface{}) (int, response) {
+	body, _ := json.Marshal(gql.Request{Query: query, Variables: variables})
+	req, _ := http.NewRequest(fiber.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return send(t, app, req)
+}
+
+func get(t *testing.T, app *fiber.App, query string) (int, response) {
+	req, _ := http.NewRequest(fiber.MethodGet, "/graphql?"+url.Values{"query": {query}}.Encode(), nil)
+	return send(t, app, req)
+}
+
+func send(t *testing.T, app *fiber.App, req *http.Request) (int, response) {
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	var out response
+	require.Nil(t, json.NewDecoder(res.Body).Decode(&out))
+	return res.StatusCode, out
+}
+
+// code Returns the stable code of the first error
+func code(res response) string {
+	if len(res.Errors) == 0 {
+		return ""
+	}
+	c, _ := res.Errors[0].Extensions["code"].(string)
+	return c
+}
+
+/*
+	TESTS
+*/
+
+func TestQueries(t *testing.T) {
+	app, s := newApp(t, &gql.Config{})
+	ann := create(t, s, "Ann", "ann@ann.com")
+	bob := create(t, s, "Bob", "bob@bob.com")
+
+	// Model lookups of one level are fetched in a single batch
+	status, res := post(t, app, `query($ann: ID!, $bob: ID!, $missing: ID!) {
+		ann: model(id: $ann) { id name email }
+		bob: model(id: $bob) { name updatedAt }
+		missing: model(id: $missing) { id }
+		again: model(id: $ann) { name }
+	}`, map[string]interface{}{"ann": ann, "bob": bob, "missing": string(datastore.NewID())})
+	require.Equal(t, fiber.StatusOK, status, res.Errors)
+	require.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{"id": ann, "name": "Ann", "email": "ann@ann.com"}, res.Data["ann"])
+	assert.Equal(t, map[string]interface{}{"name": "Bob", "updatedAt": nil}, res.Data["bob"], "Zero times are null")
+	assert.Nil(t, res.Data["missing"])
+	assert.Equal(t, "Ann", res.Data["again"].(map[string]interface{})["name"])
+	require.Len(t, s.batches, 1)
+	assert.Len(t, s.batches[0], 3, "Keys are fetched once")
+
+	tests := []struct {
+		description string
+		query       string
+		names       []string
+		code        string
+	}{
+		{description: "List", query: `{ models { name } }`, names: []string{"Ann", "Bob"}},
+		{description: "Page", query: `{ models(page: 2, limit: 1) { name } }`, names: []string{"Bob"}},
+		{description: "Filter", query: `{ models(filter: {email: "bob@bob.com"}) { name } }`, names: []string{"Bob"}},
+		{description: "Created since", query: `{ models(filter: {since: "2000-01-01T00:00:00Z"}) { name } }`, names: []string{"Ann", "Bob"}},
+		{description: "Invalid page", query: `{ models(page: 0) { name } }`, code: apperrors.CodeInvalidPagination},
+		{description: "Invalid ID", query: `{ model(id: "1") { name } }`, code: apperrors.CodeInvalidID},
+	}
+	for _, test := range tests {
+		status, res := post(t, app, test.query, nil)
+		assert.Equal(t, fiber.StatusOK, status, test.description)
+		assert.Equal(t, test.code, code(res), test.description)
+		if len(test.code) != 0 {
+			continue
+		}
+		names := []string{}
+		for _, m := range res.Data["models"].([]interface{}) {
+			names = append(names, m.(map[string]interface{})["name"].(string))
+		}
+		assert.Equal(t, test.names, names, test.description)
+	}
+}
+
+func TestMutations(t *testing.T) {
+	app, s := newApp(t, &gql.Config{})
+	bob := create(t, s, "Bob", "bob@bob.com")
+
+	tests := []struct {
+		description string
+		query       string
+		variables   map[string]interface{}
+		expected    interface{}
+		code        string
+	}{
+		{
+			description: "Update",
+			query:       `mutation($id: ID!) { updateModel(id: $id, input: {name: "Robert"}) { name email } }`,
+			variables:   map[string]interface{}{"id": bob},
+			expected:    map[string]interface{}{"name": "Robert", "email": "bob@bob.com"},
+		},
+		{
+			description: "No fields to update",
+			query:       `mutation($id: ID!) { updateModel(id: $id, input: {}) { name } }`,
+			variables:   map[string]interface{}{"id": bob},
+			code:        apperrors.CodeNoFieldsToUpdate,
+		},
+		{
+			description: "Invalid model",
+			query:       `mutation { createModel(input: {name: "Cid", email: "cid"}) { id } }`,
+			code:        apperrors.CodeValidationFailed,
+		},
+		{
+			description: "Duplicate email",
+			query:       `mutation { createModel(input: {name: "Bobby", email: "bob@bob.com"}) { id } }`,
+			code:        apperrors.CodeModelAlreadyExists,
+		},
+		{
+			description: "Delete",
+			query:       `mutation($id: ID!) { deleteModel(id: $id) }`,
+			variables:   map[string]interface{}{"id": bob},
+			expected:    bob,
+		},
+		{
+			description: "Delete twice",
+			query:       `mutation($id: ID!) { deleteModel(id: $id) }`,
+			variables:   map[string]interface{}{"id": bob},
+			code:        apperrors.CodeModelNotFound,
+		},
+	}
+	for _, test := range tests {
+		status, res := post(t, app, test.query, test.variables)
+		assert.Equal(t, fiber.StatusOK, status, test.description)
+		assert.Equal(t, test.code, code(res), "%s: %v", test.description, res.Errors)
+		if len(test.code) != 0 {
+			continue
+		}
+		for _, v := range res.Data {
+			assert.Equal(t, test.expected, v, test.description)
+		}
+	}
+
+	_, res := post(t, app, `mutation { createModel(input: {name: "Cid", email: "cid@cid.com"}) { id name createdAt } }`, nil)
+	require.Empty(t, res.Errors)
+	created := res.Data["createModel"].(map[string]interface{})
+	assert.True(t, datastore.ValidID(created["id"].(string)))
+	assert.NotNil(t, created["createdAt"])
+
+	_, res = post(t, app, `mutation { createModel(input: {name: "Cid", email: "cid"}) { id } }`, nil)
+	require.Len(t, res.Errors, 1)
+	assert.Equal(t, "Model failed validation", res.Errors[0].Message)
+	assert.NotEmpty(t, res.Errors[0].Extensions["fields"], "Failed fields are reported")
+}
+
+func TestLimits(t *testing.T) {
+	app, _ := newApp(t, &gql.Config{MaxComplexity: 100, MaxDepth: 2})
+
+	tests := []struct {
+		description string
+		query       string
+		variables   map[string]interface{}
+		status      int
+		code        string
+	}{
+		{description: "Within limits", query: `{ models(limit: 30) { id name email } }`, status: fiber.StatusOK},
+		{description: "Default limit", query: `{ models { id name email } }`, status: fiber.StatusOK},
+		{description: "Large page", query: `{ models(limit: 50) { id name email } }`, status: fiber.StatusBadRequest, code: apperrors.CodeQueryTooComplex},
+		{
+			description: "Large page variable",
+			query:       `query($limit: Int) { models(limit: $limit) { id } }`,
+			variables:   map[string]interface{}{"limit": 500},
+			status:      fiber.StatusBadRequest,
+			code:        apperrors.CodeQueryTooComplex,
+		},
+		{
+			description: "Fragments count",
+			query:       `{ a: models(limit: 20) { ...all } b: models(limit: 20) { ...all } } fragment all on Model { id name email }`,
+			status:      fiber.StatusBadRequest,
+			code:        apperrors.CodeQueryTooComplex,
+		},
+		{description: "Introspection is free", query: `{ __schema { types { name fields { name type { name ofType { name } } } } } }`, status: fiber.StatusOK},
+		{description: "Syntax error", query: `{ models {`, status: fiber.StatusBadRequest, code: apperrors.CodeInvalidQuery},
+		{description: "Unknown field", query: `{ models { password } }`, status: fiber.StatusBadRequest, code: apperrors.CodeInvalidQuery},
+		{description: "No query", query: ``, status: fiber.StatusBadRequest, code: apperrors.CodeInvalidQuery},
+	}
+	for _, test := range tests {
+		status, res := post(t, app, test.query, test.variables)
+		assert.Equal(t, test.status, status, "%s: %v", test.description, res.Errors)
+		assert.Equal(t, test.code, code(res), test.description)
+	}
+
+	// Queries may be sent with GET, mutations may not
+	status, res := get(t, app, `{ models { id } }`)
+	assert.Equal(t, fiber.StatusOK, status, res.Errors)
+	status, _ = get(t, app, `mutation { deleteModel(id: "5ff3fc0e00acd4328da25d92") }`)
+	assert.Equal(t, fiber.StatusMethodNotAllowed, status)
+}
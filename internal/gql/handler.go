@@ -0,0 +1,207 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
+)
+
+// Config Is the GraphQL endpoint config
+type Config struct {
+	// MaxComplexity bounds the fields an operation may resolve, counting the fields under a list
+	// once per item. Zero is unbounded
+	MaxComplexity int
+	// MaxDepth bounds the nesting of fields, zero is unbounded
+	MaxDepth int
+}
+
+// Request Is a GraphQL request, GET requests send its fields as query parameters
+type Request struct {
+	Query         string                 `json:"query" example:"{ models(limit: 10) { id name } }"`
+	OperationName string                 `json:"operationName,omitempty" example:""`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Location Is where an error is in the query
+type Location struct {
+	Line   int `json:"line" example:"1"`
+	Column int `json:"column" example:"3"`
+}
+
+// Error Is a GraphQL error, domain errors carry their stable code and failed fields as extensions
+type Error struct {
+	Message    string                 `json:"message" example:"Model Not Found"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Response Is a GraphQL response, Data is left out when the request could not be executed
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+/*
+* PRIVATE
+ */
+
+// original returns the error a resolver returned, graphql wraps it once or twice
+func original(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			if e.OriginalError() == nil {
+				return err
+			}
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			if e.OriginalError == nil {
+				return err
+			}
+			err = e.OriginalError
+		default:
+			return err
+		}
+	}
+}
+
+// toError maps a graphql error, domain errors are rendered like problems and internal details
+// are never exposed. Field messages follow acceptLanguage
+func toError(ctx context.Context, f gqlerrors.FormattedError, code string, acceptLanguage string) Error {
+	e := Error{Message: f.Message, Path: f.Path}
+	for _, l := range f.Locations {
+		e.Locations = append(e.Locations, Location{Line: l.Line, Column: l.Column})
+	}
+	if len(code) != 0 {
+		e.Extensions = map[string]interface{}{"code": code}
+	}
+
+	domain, ok := apperrors.As(original(f))
+	if !ok {
+		return e
+	}
+	e.Message = domain.Message
+	e.Extensions = map[string]interface{}{"code": domain.Code}
+	if len(domain.Fields) != 0 {
+		e.Extensions["fields"], _ = validation.Localize(domain.Fields, acceptLanguage)
+	}
+	if domain.Kind == apperrors.KindInternal {
+		logging.FromContext(ctx).Error(domain)
+	}
+	return e
+}
+
+// fail answers a request that could not be executed
+func fail(ctx *fiber.Ctx, status int, code string, errs ...gqlerrors.FormattedError) error {
+	res := Response{}
+	for _, err := range errs {
+		res.Errors = append(res.Errors, toError(utils.Context(ctx), err, code, ctx.Get(fiber.HeaderAcceptLanguage)))
+	}
+	return ctx.Status(status).JSON(res)
+}
+
+// parseRequest reads a request from the query parameters of a GET or from a JSON body
+func parseRequest(ctx *fiber.Ctx) (Request, error) {
+	var req Request
+	if ctx.Method() != fiber.MethodGet {
+		err := json.Unmarshal(ctx.Body(), &req)
+		return req, err
+	}
+
+	req.Query = ctx.Query("query")
+	req.OperationName = ctx.Query("operationName")
+	if v := ctx.Query("variables"); len(v) != 0 {
+		err := json.Unmarshal([]byte(v), &req.Variables)
+		return req, err
+	}
+	return req, nil
+}
+
+/*
+* PUBLIC
+ */
+
+// Handler godoc
+// @Summary Runs a GraphQL query or mutation over the models, GET only runs queries
+// @Description Operations beyond the complexity or depth limits are rejected before they run
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param request body gql.Request true "GraphQL request"
+// @Success 200 {object} gql.Response
+// @Failure 400 {object} gql.Response
+// @Router /graphql [post]
+func Handler(s services.Service, config *Config) fiber.Handler {
+	schema, err := newSchema(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		req, err := parseRequest(ctx)
+		if err != nil {
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeInvalidBody, gqlerrors.NewFormattedError("Request must be a JSON object with a query"))
+		}
+		if len(req.Query) == 0 {
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeInvalidQuery, gqlerrors.NewFormattedError("A query is required"))
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query)})})
+		if err != nil {
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeInvalidQuery, gqlerrors.FormatError(err))
+		}
+		report := graphql.ValidateDocument(&schema, doc, nil)
+		if !report.IsValid {
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeInvalidQuery, report.Errors...)
+		}
+
+		op := operation(doc, req.OperationName)
+		if op == nil {
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeInvalidQuery, gqlerrors.NewFormattedError("The query has no operation"))
+		}
+		if op.Operation == ast.OperationTypeMutation && ctx.Method() == fiber.MethodGet {
+			ctx.Set(fiber.HeaderAllow, fiber.MethodPost)
+			return fail(ctx, fiber.StatusMethodNotAllowed, apperrors.CodeInvalidQuery, gqlerrors.NewFormattedError("Mutations must be sent with POST"))
+		}
+
+		c := analyze(schema, doc, op, req.Variables)
+		if config.MaxComplexity > 0 && c.Complexity > config.MaxComplexity {
+			msg := fmt.Sprintf("Query complexity %d exceeds the limit of %d", c.Complexity, config.MaxComplexity)
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeQueryTooComplex, gqlerrors.NewFormattedError(msg))
+		}
+		if config.MaxDepth > 0 && c.Depth > config.MaxDepth {
+			msg := fmt.Sprintf("Query depth %d exceeds the limit of %d", c.Depth, config.MaxDepth)
+			return fail(ctx, fiber.StatusBadRequest, apperrors.CodeQueryTooComplex, gqlerrors.NewFormattedError(msg))
+		}
+
+		rctx := utils.Context(ctx)
+		result := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       withLoaders(rctx, s),
+		})
+
+		res := Response{Data: result.Data}
+		for _, err := range result.Errors {
+			res.Errors = append(res.Errors, toError(rctx, err, "", ctx.Get(fiber.HeaderAcceptLanguage)))
+		}
+		return ctx.Status(fiber.StatusOK).JSON(res)
+	}
+}
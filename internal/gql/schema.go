@@ -0,0 +1,303 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/dataloader"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+)
+
+// DefaultLimit is the page size of list fields without a limit argument, the Service default
+const DefaultLimit = 30
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type loadersKey struct{}
+
+// loaders Are the per request Loaders of a query
+type loaders struct {
+	models dataloader.Loader[string, models.Model]
+}
+
+/*
+* PRIVATE
+ */
+
+// fieldName is the JSON name of a struct field, or its name in lower camel case without a tag
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if len(name) == 0 {
+		name = strings.ToLower(f.Name[:1]) + f.Name[1:]
+	}
+	return name
+}
+
+// scalarOf maps a Go type to the scalar it is exposed as, nil for unsupported types
+func scalarOf(t reflect.Type) *graphql.Scalar {
+	if t == timeType {
+		return graphql.DateTime
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return graphql.String
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return graphql.Int
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	case reflect.Bool:
+		return graphql.Boolean
+	}
+	return nil
+}
+
+// resolveField reads the value of field index from a struct source, zero times are null
+func resolveField(index int) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		v := reflect.Indirect(reflect.ValueOf(p.Source))
+		if v.Kind() != reflect.Struct {
+			return nil, nil
+		}
+		f := v.Field(index).Interface()
+		if t, ok := f.(time.Time); ok && t.IsZero() {
+			return nil, nil
+		}
+		return f, nil
+	}
+}
+
+// objectOf generates an object type from the exported scalar fields of a struct. The id field is
+// an ID and fields validated as required are non null
+func objectOf(name string, t reflect.Type) *graphql.Object {
+	fields := graphql.Fields{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		scalar := scalarOf(f.Type)
+		if !f.IsExported() || f.Tag.Get("json") == "-" || scalar == nil {
+			continue
+		}
+
+		var output graphql.Output = scalar
+		switch {
+		case fieldName(f) == "id":
+			output = graphql.NewNonNull(graphql.ID)
+		case strings.Contains(f.Tag.Get("validate"), "required"):
+			output = graphql.NewNonNull(scalar)
+		}
+		fields[fieldName(f)] = &graphql.Field{Type: output, Resolve: resolveField(i)}
+	}
+	return graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: fields})
+}
+
+// inputOf generates an input type from the exported scalar fields of a struct but omit, every
+// field is optional
+func inputOf(name string, t reflect.Type, omit ...string) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		scalar := scalarOf(f.Type)
+		if !f.IsExported() || f.Tag.Get("json") == "-" || scalar == nil {
+			continue
+		}
+		skip := false
+		for _, o := range omit {
+			skip = skip || o == fieldName(f)
+		}
+		if !skip {
+			fields[fieldName(f)] = &graphql.InputObjectFieldConfig{Type: scalar}
+		}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: fields})
+}
+
+// decode converts an input argument to its Go type, out has the fields of the generated input
+func decode(arg interface{}, out interface{}) error {
+	if arg == nil {
+		return nil
+	}
+	b, err := json.Marshal(arg)
+	if err != nil {
+		return apperrors.Internal(err)
+	}
+	err = json.Unmarshal(b, out)
+	if err != nil {
+		return apperrors.InvalidArgument(apperrors.CodeInvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// domainError makes every resolver error a domain error, so unexpected ones are not exposed
+func domainError(err error) error {
+	if _, ok := apperrors.As(err); ok {
+		return err
+	}
+	return apperrors.Internal(err)
+}
+
+// loadersFrom returns the Loaders of the query, see withLoaders
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// withLoaders returns a copy of the context carrying new Loaders fetching from s
+func withLoaders(ctx context.Context, s services.Service) context.Context {
+	l := &loaders{
+		models: dataloader.NewLoader(func(ctx context.Context, ids []string) (map[string]models.Model, error) {
+			res, err := s.GetByIds(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			found := map[string]models.Model{}
+			for _, m := range res.Data.([]models.Model) {
+				found[m.ID] = m
+			}
+			return found, nil
+		}),
+	}
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+// loadModel resolves a model by ID through the Loader of the query, missing models are null
+func loadModel(ctx context.Context, id string) (interface{}, error) {
+	if !datastore.ValidID(id) {
+		return nil, apperrors.InvalidArgument(apperrors.CodeInvalidID, "ID must be a 24 character hex string")
+	}
+	thunk := loadersFrom(ctx).models.Load(ctx, id)
+	return func() (interface{}, error) {
+		m, ok, err := thunk()
+		if err != nil {
+			return nil, domainError(err)
+		}
+		if !ok {
+			return nil, nil
+		}
+		return m, nil
+	}, nil
+}
+
+// newSchema generates the schema of the models Service from models.Model
+func newSchema(s services.Service) (graphql.Schema, error) {
+	model := objectOf("Model", reflect.TypeOf(models.Model{}))
+	// The server sets the ID and timestamps
+	input := inputOf("ModelInput", reflect.TypeOf(models.Model{}), "id", "createdAt", "updatedAt")
+	filter := inputOf("ModelFilter", reflect.TypeOf(services.Filter{}))
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"model": &graphql.Field{
+				Type:        model,
+				Description: "A model by ID, null when it does not exist",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadModel(p.Context, p.Args["id"].(string))
+				},
+			},
+			"models": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(model))),
+				Description: "A page of the models matching filter, oldest first",
+				Args: graphql.FieldConfigArgument{
+					"page":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: DefaultLimit},
+					"filter": &graphql.ArgumentConfig{Type: filter},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var f services.Filter
+					if err := decode(p.Args["filter"], &f); err != nil {
+						return nil, err
+					}
+					page := strconv.Itoa(p.Args["page"].(int))
+					limit := strconv.Itoa(p.Args["limit"].(int))
+					res, err := s.Find(p.Context, f, page, limit)
+					if err != nil {
+						return nil, domainError(err)
+					}
+					return *res.Data.(*[]models.Model), nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createModel": &graphql.Field{
+				Type: graphql.NewNonNull(model),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var m models.Model
+					if err := decode(p.Args["input"], &m); err != nil {
+						return nil, err
+					}
+					if err := m.Validate(); err != nil {
+						return nil, err
+					}
+					res, err := s.Create(p.Context, &m)
+					if err != nil {
+						return nil, domainError(err)
+					}
+					m.ID = res.Data.(models.CreateResponse).InsertedID
+					return m, nil
+				},
+			},
+			"updateModel": &graphql.Field{
+				Type:        model,
+				Description: "Sets the fields of input on a model and returns it",
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := p.Args["id"].(string)
+					var m models.Model
+					if err := decode(p.Args["input"], &m); err != nil {
+						return nil, err
+					}
+					if m.IsNil() {
+						return nil, apperrors.InvalidArgument(apperrors.CodeNoFieldsToUpdate, "You require at least one field to update")
+					}
+					if err := m.ValidatePartial(); err != nil {
+						return nil, err
+					}
+					_, err := s.Update(p.Context, id, &m)
+					if err != nil {
+						return nil, domainError(err)
+					}
+					loadersFrom(p.Context).models.Clear(id)
+					return loadModel(p.Context, id)
+				},
+			},
+			"deleteModel": &graphql.Field{
+				Type:        graphql.ID,
+				Description: "Deletes a model and returns its ID",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := p.Args["id"].(string)
+					_, err := s.Delete(p.Context, id)
+					if err != nil {
+						return nil, domainError(err)
+					}
+					loadersFrom(p.Context).models.Clear(id)
+					return id, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
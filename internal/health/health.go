@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// Statuses a Check reports, degraded dependencies still serve requests
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Check Is the health of one dependency
+type Check struct {
+	Status string `json:"status" example:"up"`
+	// Details are dependency specific, e.g. the state of a circuit breaker
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report Is the health of the service, it is down when any dependency is
+type Report struct {
+	Status string           `json:"status" example:"up"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Checker Is implemented by dependencies that report their own health
+type Checker interface {
+	Health(ctx context.Context) Check
+}
+
+/*
+* PUBLIC
+ */
+
+// Run Collects the checks of every checker
+func Run(ctx context.Context, checkers map[string]Checker) Report {
+	report := Report{Status: StatusUp, Checks: map[string]Check{}}
+	for name, c := range checkers {
+		check := c.Health(ctx)
+		report.Checks[name] = check
+		switch {
+		case check.Status == StatusDown:
+			report.Status = StatusDown
+		case check.Status == StatusDegraded && report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// Handler Serves the Report, with 503 while the service is down so probes take it out of rotation
+func Handler(checkers map[string]Checker) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		report := Run(utils.Context(ctx), checkers)
+		status := fiber.StatusOK
+		if report.Status == StatusDown {
+			status = fiber.StatusServiceUnavailable
+		}
+		return ctx.Status(status).JSON(report)
+	}
+}
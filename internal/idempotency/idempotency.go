@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+const (
+	// Header carries the client chosen key of a request, retries of the request reuse it
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// Config Is the idempotency middleware config
+type Config struct {
+	// Namespace prefixes every key so services can share a cache
+	Namespace string
+	// TTL is how long responses are replayed, defaults to 24h
+	TTL time.Duration
+	// Lock is how long a key stays in use by a request that never finished, defaults to 1m
+	Lock time.Duration
+}
+
+// record Is the outcome of the first request with a key
+type record struct {
+	// Fingerprint is the hash of the body, a key may not be reused for another body
+	Fingerprint string `json:"fingerprint"`
+	// Pending records are held by a request still running
+	Pending     bool   `json:"pending,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+/*
+* PRIVATE
+ */
+
+func hash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// safe methods never change state so their keys are ignored
+func safe(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
+
+func store(ctx *fiber.Ctx, c cache.Cache, key string, r record, ttl time.Duration) {
+	b, err := json.Marshal(r)
+	if err == nil {
+		err = c.Set(utils.Context(ctx), key, b, ttl)
+	}
+	if err != nil {
+		logging.FromContext(utils.Context(ctx)).Warn(err)
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+// Middleware Will replay the response of the first request sent with an Idempotency-Key to the
+// retries reusing it, so retried writes happen once. Keys are scoped to the method, URL and
+// credentials of the request. Errors are not replayed so a failed request may be retried, and a
+// key reused while its first request runs is a conflict. Two first requests racing on a cache
+// without the key may both run
+func Middleware(c cache.Cache, config Config) fiber.Handler {
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.Lock <= 0 {
+		config.Lock = time.Minute
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		id := ctx.Get(Header)
+		if len(id) == 0 || safe(ctx.Method()) {
+			return ctx.Next()
+		}
+		if len(id) > 255 {
+			return apperrors.InvalidArgument(apperrors.CodeInvalidArgument, "Idempotency-Key must be at most 255 characters")
+		}
+
+		rctx := utils.Context(ctx)
+		key := config.Namespace + ":idempotency:" + hash([]byte(tenancy.FromContext(rctx)), []byte(ctx.Method()), []byte(ctx.OriginalURL()), []byte(ctx.Get(fiber.HeaderAuthorization)), []byte(id))
+		fingerprint := hash(ctx.Body())
+
+		b, found, err := c.Get(rctx, key)
+		if err != nil {
+			// Without the cache requests still run, they just are not deduplicated
+			logging.FromContext(rctx).Warn(err)
+			return ctx.Next()
+		}
+		if found {
+			var r record
+			if err := json.Unmarshal(b, &r); err != nil {
+				return apperrors.Internal(err)
+			}
+			switch {
+			case r.Fingerprint != fingerprint:
+				return apperrors.InvalidArgument(apperrors.CodeIdempotencyKeyReused, "Idempotency-Key was already used for another request")
+			case r.Pending:
+				return apperrors.Conflict(apperrors.CodeIdempotencyKeyInUse, "A request with this Idempotency-Key is still running")
+			}
+			ctx.Set(ReplayedHeader, "true")
+			if len(r.Location) != 0 {
+				ctx.Location(r.Location)
+			}
+			ctx.Set(fiber.HeaderContentType, r.ContentType)
+			return ctx.Status(r.Status).Send(r.Body)
+		}
+
+		store(ctx, c, key, record{Fingerprint: fingerprint, Pending: true}, config.Lock)
+		err = ctx.Next()
+		status := ctx.Response().StatusCode()
+		if err != nil || status >= fiber.StatusInternalServerError {
+			if err := c.Delete(rctx, key); err != nil {
+				logging.FromContext(rctx).Warn(err)
+			}
+			return err
+		}
+
+		store(ctx, c, key, record{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: string(ctx.Response().Header.ContentType()),
+			Location:    string(ctx.Response().Header.Peek(fiber.HeaderLocation)),
+			Body:        append([]byte(nil), ctx.Response().Body()...),
+		}, config.TTL)
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package idempotency_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+	"github.com/sizzlorox/go-service-boilerplate/internal/idempotency"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+)
+
+func send(t *testing.T, app *fiber.App, method string, key string, body string) (*http.Response, string) {
+	req, _ := http.NewRequest(method, "/things", strings.NewReader(body))
+	if len(key) != 0 {
+		req.Header.Set(idempotency.Header, key)
+	}
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	b, _ := io.ReadAll(res.Body)
+	return res, string(b)
+}
+
+/*
+	TESTS
+*/
+
+func TestMiddleware(t *testing.T) {
+	calls := 0
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(idempotency.Middleware(cache.NewLRU(100), idempotency.Config{}))
+	handler := func(ctx *fiber.Ctx) error {
+		calls++
+		if string(ctx.Body()) == "fail" {
+			return apperrors.Unavailable(nil)
+		}
+		ctx.Location("/things/1")
+		return ctx.Status(fiber.StatusCreated).SendString(string(ctx.Body()) + " created")
+	}
+	app.Post("/things", handler)
+	app.Get("/things", handler)
+
+	tests := []struct {
+		description string
+		method      string
+		key         string
+		body        string
+		status      int
+		calls       int
+		replayed    bool
+		code        string
+	}{
+		{description: "First request", method: fiber.MethodPost, key: "a", body: "one", status: fiber.StatusCreated, calls: 1},
+		{description: "Retry", method: fiber.MethodPost, key: "a", body: "one", status: fiber.StatusCreated, replayed: true},
+		{description: "Another body", method: fiber.MethodPost, key: "a", body: "two", status: fiber.StatusBadRequest, code: apperrors.CodeIdempotencyKeyReused},
+		{description: "Another key", method: fiber.MethodPost, key: "b", body: "two", status: fiber.StatusCreated, calls: 1},
+		{description: "No key", method: fiber.MethodPost, body: "one", status: fiber.StatusCreated, calls: 1},
+		{description: "Reads are not replayed", method: fiber.MethodGet, key: "a", body: "one", status: fiber.StatusCreated, calls: 1},
+		{description: "Failure", method: fiber.MethodPost, key: "c", body: "fail", status: fiber.StatusServiceUnavailable, calls: 1},
+		{description: "Failures are not replayed", method: fiber.MethodPost, key: "c", body: "fail", status: fiber.StatusServiceUnavailable, calls: 1},
+	}
+	for _, test := range tests {
+		calls = 0
+		res, body := send(t, app, test.method, test.key, test.body)
+		assert.Equal(t, test.status, res.StatusCode, test.description)
+		assert.Equal(t, test.calls, calls, test.description)
+		assert.Equal(t, test.replayed, res.Header.Get(idempotency.ReplayedHeader) == "true", test.description)
+		if len(test.code) != 0 {
+			assert.Contains(t, body, test.code, test.description)
+			continue
+		}
+		if test.status == fiber.StatusCreated {
+			assert.Equal(t, test.body+" created", body, test.description)
+			assert.Equal(t, "/things/1", res.Header.Get(fiber.HeaderLocation), test.description)
+		}
+	}
+}
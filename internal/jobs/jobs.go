@@ -0,0 +1,334 @@
+// Package jobs runs background work outside of requests. Services enqueue jobs on a Queue and a
+// Pool of workers claims them from the datastore with a lease, so any number of processes can
+// share a queue. Failed jobs are retried with exponential backoff until they run out of attempts
+// and are kept as dead jobs, which admins may retry.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+)
+
+// Collection is where jobs are stored
+const Collection = "jobs"
+
+// Statuses of a Job
+const (
+	// StatusPending jobs run once RunAt has passed
+	StatusPending = "pending"
+	// StatusRunning jobs are leased by a worker, they are claimed again once the lease expires
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	// StatusDead jobs failed on every attempt or with a permanent error
+	StatusDead      = "dead"
+	StatusCancelled = "cancelled"
+)
+
+// Job Is a unit of background work, its payload round trips through JSON
+type Job struct {
+	ID          string                 `json:"id" xml:"id" bson:"_id,omitempty" example:"5ff3fc0e00acd4328da25d92"`
+	Type        string                 `json:"type" xml:"type" bson:"type" example:"email.send"`
+	Payload     map[string]interface{} `json:"payload,omitempty" xml:"-" bson:"payload,omitempty"`
+	Status      string                 `json:"status" xml:"status" bson:"status" example:"pending"`
+	Attempts    int                    `json:"attempts" xml:"attempts" bson:"attempts" example:"1"`
+	MaxAttempts int                    `json:"maxAttempts" xml:"maxAttempts" bson:"max_attempts" example:"5"`
+	RunAt       time.Time              `json:"runAt" xml:"runAt" bson:"run_at"`
+	// Tenant is the tenant of the request that enqueued the job, handlers run as that tenant
+	Tenant string `json:"tenant,omitempty" xml:"tenant,omitempty" bson:"tenant,omitempty" example:"acme"`
+	// Lease is unique to each claim, so a worker that lost its lease cannot complete the job
+	Lease       string    `json:"-" xml:"-" bson:"lease,omitempty"`
+	LeasedUntil time.Time `json:"leasedUntil,omitempty" xml:"leasedUntil,omitempty" bson:"leased_until,omitempty"`
+	Worker      string    `json:"worker,omitempty" xml:"worker,omitempty" bson:"worker,omitempty" example:"api-1234-0"`
+	LastError   string    `json:"lastError,omitempty" xml:"lastError,omitempty" bson:"last_error,omitempty" example:"smtp: connection refused"`
+	CreatedAt   time.Time `json:"createdAt" xml:"createdAt" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" xml:"updatedAt" bson:"updated_at"`
+	FinishedAt  time.Time `json:"finishedAt,omitempty" xml:"finishedAt,omitempty" bson:"finished_at,omitempty"`
+}
+
+// Options Are the per job options of Enqueue
+type Options struct {
+	// RunAt schedules the job, zero runs it as soon as a worker is free
+	RunAt time.Time
+	// Delay schedules the job relative to now when RunAt is zero
+	Delay time.Duration
+	// MaxAttempts defaults to Config.MaxAttempts
+	MaxAttempts int
+}
+
+// Filter Is the admin query filter, empty fields are ignored
+type Filter struct {
+	Status string
+	Type   string
+}
+
+// Config Is shared by the Queue and the Pool
+type Config struct {
+	// Workers is how many jobs a Pool runs at once, zero only enqueues
+	Workers int
+	// PollInterval is how long idle workers wait before looking for due jobs again
+	PollInterval time.Duration
+	// Lease is how long a claimed job is reserved, workers extend it while the job runs
+	Lease time.Duration
+	// MaxAttempts is the default of jobs enqueued without one
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles on each retry up to an hour
+	Backoff time.Duration
+}
+
+// Queue Stores jobs for every tenant, Get, List, Retry and Cancel only reach the jobs of the tenant
+// of the context when it carries one
+type Queue interface {
+	// Enqueue Stores a job of type typ, payload must encode to a JSON object
+	Enqueue(ctx context.Context, typ string, payload interface{}, opts *Options) (*Job, error)
+	Get(ctx context.Context, id string) (*Job, error)
+	// List Returns the jobs matching filter, the next to run first
+	List(ctx context.Context, filter Filter, page datastore.Pagination) ([]Job, error)
+	// Retry Runs a dead or cancelled job again with a fresh set of attempts
+	Retry(ctx context.Context, id string) (*Job, error)
+	// Cancel Stops a pending or running job, a running job's context is cancelled once its
+	// worker next extends the lease
+	Cancel(ctx context.Context, id string) (*Job, error)
+}
+
+// Type Is a job type whose payload is a T
+type Type[T any] struct {
+	Name string
+}
+
+// permanentError Is returned by handlers to skip the remaining attempts
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+type queue struct {
+	r      datastore.Repository
+	config Config
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewQueue Will create a Queue storing jobs in r, which must implement datastore.FindOneAndUpdater
+func NewQueue(r datastore.Repository, config *Config) Queue {
+	return &queue{r: r, config: *config}
+}
+
+/*
+* PRIVATE
+ */
+
+func (q *queue) parseID(id string) (datastore.ID, error) {
+	if !datastore.ValidID(id) {
+		return "", apperrors.InvalidArgument(apperrors.CodeInvalidID, "ID must be a 24 character hex string")
+	}
+	return datastore.ID(id), nil
+}
+
+// scope Restricts where to the jobs of the tenant of ctx, jobs are stored unscoped so workers can
+// claim them for every tenant, but a tenant only ever sees and changes its own
+func scope(ctx context.Context, where datastore.M) datastore.M {
+	if tenant := tenancy.FromContext(ctx); len(tenant) != 0 {
+		where["tenant"] = tenant
+	}
+	return where
+}
+
+func notFound() error {
+	return apperrors.NotFound(apperrors.CodeJobNotFound, "Job not found")
+}
+
+// transition Moves the job from one of the statuses in from, a job in any other status is a conflict
+func (q *queue) transition(ctx context.Context, id string, from []string, update datastore.M, verb string) (*Job, error) {
+	oid, err := q.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := datastore.Query{Where: scope(ctx, datastore.M{"_id": oid, "status": datastore.M{"$in": from}}), From: Collection}
+	var job Job
+	err = datastore.FindOneAndUpdate(ctx, q.r, query, nil, update, &job)
+	if errors.Is(err, datastore.ErrNotFound) {
+		current, err := q.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, apperrors.Conflict(apperrors.CodeJobStateConflict, fmt.Sprintf("A %s job cannot be %s", current.Status, verb))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// encodePayload Flattens payload to its JSON object
+func encodePayload(payload interface{}) (map[string]interface{}, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("job payloads must encode to a JSON object: %w", err)
+	}
+	return m, nil
+}
+
+// insertedID Reads the ID of a backend specific insert result, its JSON form always carries it
+func insertedID(res interface{}) (string, error) {
+	var payload struct {
+		InsertedID string
+	}
+	b, err := json.Marshal(res)
+	if err == nil {
+		err = json.Unmarshal(b, &payload)
+	}
+	return payload.InsertedID, err
+}
+
+/*
+* PUBLIC
+ */
+
+// Permanent Wraps a handler error so the job is not retried
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// IsPermanent Reports whether err was wrapped by Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Decode Will decode the payload into out
+func (j *Job) Decode(out interface{}) error {
+	b, err := json.Marshal(j.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// Enqueue Will enqueue a job of type t
+func (t Type[T]) Enqueue(ctx context.Context, q Queue, payload T, opts *Options) (*Job, error) {
+	return q.Enqueue(ctx, t.Name, payload, opts)
+}
+
+// Handle Will run fn for the jobs of type t, a payload that does not decode is a permanent failure
+func (t Type[T]) Handle(p Pool, fn func(ctx context.Context, job *Job, payload T) error) {
+	p.Register(t.Name, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := job.Decode(&payload); err != nil {
+			return Permanent(err)
+		}
+		return fn(ctx, job, payload)
+	})
+}
+
+func (q *queue) Enqueue(ctx context.Context, typ string, payload interface{}, opts *Options) (*Job, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p, err := encodePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := Job{
+		Type:        typ,
+		Payload:     p,
+		Status:      StatusPending,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt.UTC(),
+		Tenant:      tenancy.FromContext(ctx),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = q.config.MaxAttempts
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = 1
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = now.Add(opts.Delay)
+	}
+
+	res, err := q.r.Insert(ctx, datastore.Query{From: Collection}, job)
+	if err != nil {
+		return nil, err
+	}
+	job.ID, err = insertedID(res)
+	if err != nil {
+		return nil, apperrors.Internal(err)
+	}
+	return &job, nil
+}
+
+func (q *queue) Get(ctx context.Context, id string) (*Job, error) {
+	oid, err := q.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Job{}
+	err = q.r.FindInto(ctx, datastore.Query{Where: scope(ctx, datastore.M{"_id": oid}), From: Collection}, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, notFound()
+	}
+	return &res[0], nil
+}
+
+func (q *queue) List(ctx context.Context, filter Filter, page datastore.Pagination) ([]Job, error) {
+	match := datastore.M{}
+	if len(filter.Status) != 0 {
+		match["status"] = filter.Status
+	}
+	if len(filter.Type) != 0 {
+		match["type"] = filter.Type
+	}
+	page.Sort = []string{"run_at"}
+
+	res := []Job{}
+	err := q.r.FindInto(ctx, datastore.Query{Where: scope(ctx, match), From: Collection}, &page, &res)
+	return res, err
+}
+
+func (q *queue) Retry(ctx context.Context, id string) (*Job, error) {
+	now := time.Now().UTC()
+	return q.transition(ctx, id, []string{StatusDead, StatusCancelled}, datastore.M{
+		"$set":   datastore.M{"status": StatusPending, "attempts": 0, "run_at": now, "updated_at": now},
+		"$unset": datastore.M{"finished_at": ""},
+	}, "retried")
+}
+
+func (q *queue) Cancel(ctx context.Context, id string) (*Job, error) {
+	now := time.Now().UTC()
+	return q.transition(ctx, id, []string{StatusPending, StatusRunning}, datastore.M{
+		"$set":   datastore.M{"status": StatusCancelled, "finished_at": now, "updated_at": now},
+		"$unset": datastore.M{"lease": "", "leased_until": ""},
+	}, "cancelled")
+}
@@ -0,0 +1,213 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+)
+
+type email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+var sendEmail = jobs.Type[email]{Name: "email.send"}
+
+func newConfig() *jobs.Config {
+	return &jobs.Config{
+		Workers:      2,
+		PollInterval: 5 * time.Millisecond,
+		Lease:        time.Second,
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+	}
+}
+
+// wait Returns the job once it reaches status
+func wait(t *testing.T, q jobs.Queue, id string, status string) *jobs.Job {
+	var job *jobs.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = q.Get(context.Background(), id)
+		require.Nil(t, err)
+		return job.Status == status
+	}, 2*time.Second, 5*time.Millisecond, "Job never became %s", status)
+	return job
+}
+
+/*
+	TESTS
+*/
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	q := jobs.NewQueue(datastore.NewMemoryDatastore(), newConfig())
+
+	job, err := sendEmail.Enqueue(ctx, q, email{To: "ann@test.com"}, &jobs.Options{Delay: time.Hour})
+	require.Nil(t, err)
+	assert.Equal(t, jobs.StatusPending, job.Status)
+	assert.Equal(t, 3, job.MaxAttempts, "Defaults to the configured attempts")
+	assert.True(t, job.RunAt.After(time.Now().Add(59*time.Minute)), "Delayed by an hour")
+	_, err = q.Enqueue(ctx, "export", nil, &jobs.Options{MaxAttempts: 1})
+	require.Nil(t, err)
+
+	got, err := q.Get(ctx, job.ID)
+	require.Nil(t, err)
+	assert.Equal(t, "ann@test.com", got.Payload["to"])
+	res, err := q.List(ctx, jobs.Filter{Type: "export"}, datastore.Pagination{Page: 1, Limit: 10})
+	require.Nil(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, 1, res[0].MaxAttempts)
+
+	tests := []struct {
+		description string
+		action      func(ctx context.Context, id string) (*jobs.Job, error)
+		id          string
+		status      string
+		kind        apperrors.Kind
+	}{
+		{description: "Cancel pending", action: q.Cancel, id: job.ID, status: jobs.StatusCancelled},
+		{description: "Cancel cancelled", action: q.Cancel, id: job.ID, kind: apperrors.KindConflict},
+		{description: "Retry cancelled", action: q.Retry, id: job.ID, status: jobs.StatusPending},
+		{description: "Retry pending", action: q.Retry, id: job.ID, kind: apperrors.KindConflict},
+		{description: "Unknown ID", action: q.Retry, id: datastore.NewID(), kind: apperrors.KindNotFound},
+		{description: "Invalid ID", action: q.Cancel, id: "nope", kind: apperrors.KindInvalidArgument},
+	}
+	for _, test := range tests {
+		res, err := test.action(ctx, test.id)
+		if len(test.kind) != 0 {
+			assert.Equal(t, test.kind, apperrors.KindOf(err), test.description)
+			continue
+		}
+		require.Nil(t, err, test.description)
+		assert.Equal(t, test.status, res.Status, test.description)
+	}
+}
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		description string
+		failures    int
+		err         error
+		status      string
+		attempts    int
+	}{
+		{description: "Succeeds", status: jobs.StatusSucceeded, attempts: 1},
+		{description: "Retried until it succeeds", failures: 2, err: errors.New("smtp down"), status: jobs.StatusSucceeded, attempts: 3},
+		{description: "Dead once out of attempts", failures: 3, err: errors.New("smtp down"), status: jobs.StatusDead, attempts: 3},
+		{description: "Permanent errors are not retried", failures: 1, err: jobs.Permanent(errors.New("no such user")), status: jobs.StatusDead, attempts: 1},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		r := datastore.NewMemoryDatastore()
+		q := jobs.NewQueue(r, newConfig())
+		p := jobs.NewPool(r, newConfig())
+
+		var calls int32
+		failures, failure := test.failures, test.err
+		sendEmail.Handle(p, func(ctx context.Context, job *jobs.Job, payload email) error {
+			assert.Equal(t, "ann@test.com", payload.To)
+			if int(atomic.AddInt32(&calls, 1)) <= failures {
+				return failure
+			}
+			return nil
+		})
+		require.Nil(t, p.Start(ctx))
+
+		job, err := sendEmail.Enqueue(ctx, q, email{To: "ann@test.com"}, nil)
+		require.Nil(t, err)
+		job = wait(t, q, job.ID, test.status)
+		require.Nil(t, p.Stop(ctx))
+
+		assert.Equal(t, test.attempts, job.Attempts, test.description)
+		assert.Equal(t, int32(test.attempts), atomic.LoadInt32(&calls), test.description)
+		if test.status == jobs.StatusDead {
+			assert.Equal(t, test.err.Error(), job.LastError, test.description)
+		}
+		assert.False(t, job.FinishedAt.IsZero(), test.description)
+	}
+}
+
+func TestPoolSchedule(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	q := jobs.NewQueue(r, newConfig())
+	p := jobs.NewPool(r, newConfig())
+	p.Register("export", func(ctx context.Context, job *jobs.Job) error {
+		return nil
+	})
+	require.Nil(t, p.Start(ctx))
+	defer p.Stop(ctx)
+
+	later, err := q.Enqueue(ctx, "export", nil, &jobs.Options{Delay: time.Hour})
+	require.Nil(t, err)
+	soon, err := q.Enqueue(ctx, "export", nil, &jobs.Options{Delay: 50 * time.Millisecond})
+	require.Nil(t, err)
+	// A worker died holding this one, its lease expired
+	_, err = r.Insert(ctx, datastore.Query{From: jobs.Collection}, jobs.Job{
+		Type:        "export",
+		Status:      jobs.StatusRunning,
+		Attempts:    1,
+		MaxAttempts: 3,
+		RunAt:       time.Now().Add(-time.Minute),
+		LeasedUntil: time.Now().Add(-time.Second),
+	})
+	require.Nil(t, err)
+
+	wait(t, q, soon.ID, jobs.StatusSucceeded)
+	res, err := q.List(ctx, jobs.Filter{Status: jobs.StatusSucceeded}, datastore.Pagination{})
+	require.Nil(t, err)
+	assert.Len(t, res, 2, "Expired leases are claimed again")
+	got, err := q.Get(ctx, later.ID)
+	require.Nil(t, err)
+	assert.Equal(t, jobs.StatusPending, got.Status, "Not run before it is due")
+}
+
+func TestPoolStop(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	q := jobs.NewQueue(r, newConfig())
+	p := jobs.NewPool(r, newConfig())
+	started := make(chan struct{})
+	p.Register("reindex", func(ctx context.Context, job *jobs.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Nil(t, p.Start(ctx))
+
+	job, err := q.Enqueue(ctx, "reindex", nil, nil)
+	require.Nil(t, err)
+	<-started
+
+	stopCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	err = p.Stop(stopCtx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+
+	// Interrupted jobs are released without using up an attempt
+	got, err := q.Get(ctx, job.ID)
+	require.Nil(t, err)
+	assert.Equal(t, jobs.StatusPending, got.Status)
+	assert.Equal(t, 0, got.Attempts)
+}
+
+func TestPoolLease(t *testing.T) {
+	for _, lease := range []time.Duration{0, time.Nanosecond, 999 * time.Millisecond} {
+		config := newConfig()
+		config.Lease = lease
+		p := jobs.NewPool(datastore.NewMemoryDatastore(), config)
+		sendEmail.Handle(p, func(ctx context.Context, job *jobs.Job, payload email) error { return nil })
+		assert.NotNil(t, p.Start(context.Background()), "Rejects a lease of %s", lease)
+	}
+}
@@ -0,0 +1,343 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+)
+
+const tracerName = "github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+
+// maxBackoff caps the delay between attempts
+const maxBackoff = time.Hour
+
+// minLease leaves room to extend a lease a few times before it expires
+const minLease = time.Second
+
+// Handler Runs a job, an error retries it unless it is Permanent. Handlers must return once
+// ctx is done, the job is then released for another worker
+type Handler func(ctx context.Context, job *Job) error
+
+// Pool Runs the jobs of the registered types
+type Pool interface {
+	// Register Will run h for the jobs of type typ, handlers must be registered before Start
+	Register(typ string, h Handler)
+	Start(ctx context.Context) error
+	// Stop Stops claiming jobs and waits for the running ones. Jobs still running once ctx is
+	// done are cancelled and released, Stop returns once their handlers have returned
+	Stop(ctx context.Context) error
+}
+
+type pool struct {
+	r      datastore.Repository
+	config Config
+	tracer trace.Tracer
+	// name prefixes the worker names recorded on claimed jobs
+	name     string
+	handlers map[string]Handler
+
+	stopping chan struct{}
+	// ctx is cancelled to abandon the running jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewPool Will create a Pool claiming jobs from r, which must implement datastore.FindOneAndUpdater
+func NewPool(r datastore.Repository, config *Config) Pool {
+	if _, ok := r.(datastore.FindOneAndUpdater); !ok {
+		log.Fatal("The jobs pool needs a datastore that can find and update atomically")
+	}
+	host, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pool{
+		r:        r,
+		config:   *config,
+		tracer:   otel.Tracer(tracerName),
+		name:     fmt.Sprintf("%s-%d", host, os.Getpid()),
+		handlers: map[string]Handler{},
+		stopping: make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+/*
+* PRIVATE
+ */
+
+func (p *pool) types() []string {
+	types := make([]string, 0, len(p.handlers))
+	for typ := range p.handlers {
+		types = append(types, typ)
+	}
+	return types
+}
+
+// backoff Is the delay after the given failed attempt
+func (p *pool) backoff(attempt int) time.Duration {
+	d := p.config.Backoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// claim Leases the next due job, or a running job whose worker let its lease expire
+func (p *pool) claim(ctx context.Context, worker string) (*Job, error) {
+	now := time.Now().UTC()
+	query := datastore.Query{
+		Where: datastore.M{
+			"type": datastore.M{"$in": p.types()},
+			"$or": []datastore.M{
+				{"status": StatusPending, "run_at": datastore.M{"$lte": now}},
+				{"status": StatusRunning, "leased_until": datastore.M{"$lt": now}},
+			},
+		},
+		From: Collection,
+	}
+	update := datastore.M{
+		"$set": datastore.M{
+			"status":       StatusRunning,
+			"lease":        datastore.NewID(),
+			"leased_until": now.Add(p.config.Lease),
+			"worker":       worker,
+			"updated_at":   now,
+		},
+		"$inc": datastore.M{"attempts": 1},
+	}
+
+	var job Job
+	err := datastore.FindOneAndUpdate(ctx, p.r, query, []string{"run_at"}, update, &job)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// leased Updates the job only while the worker still holds its lease, it reports whether it did
+func (p *pool) leased(job *Job, update datastore.M) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := datastore.Query{
+		Where: datastore.M{"_id": datastore.ID(job.ID), "lease": job.Lease, "status": StatusRunning},
+		From:  Collection,
+	}
+	_, err := p.r.Update(ctx, query, update)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// finish Records the outcome of the attempt
+func (p *pool) finish(logger *log.Entry, job *Job, status string, runAt time.Time, cause error) {
+	now := time.Now().UTC()
+	set := datastore.M{"status": status, "updated_at": now}
+	unset := datastore.M{"lease": "", "leased_until": ""}
+	if status == StatusPending {
+		set["run_at"] = runAt
+	} else {
+		set["finished_at"] = now
+	}
+	if cause != nil {
+		set["last_error"] = cause.Error()
+	} else {
+		unset["last_error"] = ""
+	}
+
+	ok, err := p.leased(job, datastore.M{"$set": set, "$unset": unset})
+	if err != nil {
+		logger.Errorf("Could not record the job as %s: %v", status, err)
+	} else if !ok {
+		logger.Warnf("Lost the lease before the job could be recorded as %s", status)
+	}
+}
+
+// heartbeat Extends the lease until done is closed, it cancels the job once the lease is lost
+func (p *pool) heartbeat(logger *log.Entry, job *Job, done <-chan struct{}, cancel context.CancelFunc) {
+	ticker := time.NewTicker(p.config.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ok, err := p.leased(job, datastore.M{"$set": datastore.M{"leased_until": time.Now().UTC().Add(p.config.Lease)}})
+		if err != nil {
+			logger.Warnf("Could not extend the lease: %v", err)
+			continue
+		}
+		if !ok {
+			logger.Warn("Lost the lease, the job was cancelled or claimed by another worker")
+			cancel()
+			return
+		}
+	}
+}
+
+// call Runs the handler, a panic fails the attempt
+func call(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, job)
+}
+
+func (p *pool) run(worker string, job *Job) {
+	logger := logging.FromContext(p.ctx).WithFields(log.Fields{
+		"component": "jobs",
+		"job":       job.ID,
+		"type":      job.Type,
+		"attempt":   job.Attempts,
+	})
+	// A worker died holding the lease on the last attempt
+	if job.Attempts > job.MaxAttempts {
+		p.finish(logger, job, StatusDead, time.Time{}, errors.New("lease expired on the last attempt"))
+		return
+	}
+
+	ctx, span := p.tracer.Start(logging.WithEntry(p.ctx, logger), "job "+job.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.String("job.type", job.Type),
+			attribute.Int("job.attempt", job.Attempts),
+		),
+	)
+	defer span.End()
+	if len(job.Tenant) != 0 {
+		ctx = tenancy.WithTenant(ctx, job.Tenant)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go p.heartbeat(logger, job, done, cancel)
+	err := call(ctx, p.handlers[job.Type], job)
+	close(done)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	switch {
+	case err == nil:
+		logger.Info("Job succeeded")
+		p.finish(logger, job, StatusSucceeded, time.Time{}, nil)
+	case p.ctx.Err() != nil:
+		// Shutting down, the attempt does not count
+		logger.Warn("Job interrupted by shutdown, releasing it")
+		ok, err := p.leased(job, datastore.M{
+			"$set":   datastore.M{"status": StatusPending, "run_at": time.Now().UTC(), "updated_at": time.Now().UTC()},
+			"$unset": datastore.M{"lease": "", "leased_until": ""},
+			"$inc":   datastore.M{"attempts": -1},
+		})
+		if err != nil || !ok {
+			logger.Warnf("Could not release the job, it runs again once its lease expires: %v", err)
+		}
+	case ctx.Err() != nil:
+		// The lease was lost, whoever took it records the outcome
+	case IsPermanent(err) || job.Attempts >= job.MaxAttempts:
+		logger.Errorf("Job failed for good: %v", err)
+		p.finish(logger, job, StatusDead, time.Time{}, err)
+	default:
+		backoff := p.backoff(job.Attempts)
+		logger.Warnf("Job failed, retrying in %s: %v", backoff, err)
+		p.finish(logger, job, StatusPending, time.Now().UTC().Add(backoff), err)
+	}
+}
+
+// work Claims and runs jobs one at a time until the pool stops
+func (p *pool) work(worker string) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stopping:
+			return
+		default:
+		}
+
+		job, err := p.claim(p.ctx, worker)
+		if err != nil {
+			log.WithField("component", "jobs").Warnf("Could not claim a job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-p.stopping:
+				return
+			case <-time.After(p.config.PollInterval):
+			}
+			continue
+		}
+		p.run(worker, job)
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+func (p *pool) Register(typ string, h Handler) {
+	p.handlers[typ] = h
+}
+
+func (p *pool) Start(ctx context.Context) error {
+	if p.config.Workers < 1 || len(p.handlers) == 0 {
+		log.Info("No job workers or handlers, jobs are only enqueued")
+		return nil
+	}
+	if p.config.Lease < minLease {
+		return fmt.Errorf("the job lease must be at least %s", minLease)
+	}
+	for i := 0; i < p.config.Workers; i++ {
+		p.wg.Add(1)
+		go p.work(fmt.Sprintf("%s-%d", p.name, i))
+	}
+	return nil
+}
+
+func (p *pool) Stop(ctx context.Context) error {
+	close(p.stopping)
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	p.cancel()
+	<-done
+	return fmt.Errorf("cancelled the running jobs: %w", ctx.Err())
+}
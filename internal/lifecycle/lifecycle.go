@@ -0,0 +1,227 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+)
+
+// States of a Manager, only a running Manager is ready
+const (
+	StateIdle     = "idle"
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateStopping = "stopping"
+	StateStopped  = "stopped"
+)
+
+// Hook Is a component the Manager starts in the order hooks were appended and stops in reverse,
+// so components should be appended after the ones they depend on
+type Hook struct {
+	Name string
+	// Start must return once the component runs, long running work belongs in a goroutine that
+	// reports failures with Manager.Fail. It may be nil
+	Start func(ctx context.Context) error
+	// Stop may be nil
+	Stop func(ctx context.Context) error
+	// Timeout bounds Start and Stop, zero uses Config.Timeout
+	Timeout time.Duration
+}
+
+// Config Is the Manager config
+type Config struct {
+	// DrainDelay is how long readiness fails before the first component stops, so load
+	// balancers stop routing new requests first
+	DrainDelay time.Duration
+	// Timeout bounds the hooks that do not set their own, zero waits forever
+	Timeout time.Duration
+}
+
+// Manager Starts and stops the components of the service
+type Manager interface {
+	Append(h Hook)
+	// Start Runs every start hook, a failure stops the components already started
+	Start(ctx context.Context) error
+	// Stop Fails readiness, waits for the drain delay and runs every stop hook. Every failure
+	// is returned joined, stopping goes on past them
+	Stop(ctx context.Context) error
+	// Fail Reports a component that stopped on its own, which shuts the service down
+	Fail(name string, err error)
+	// Wait Blocks until one of signals is received or a component fails, then stops
+	Wait(signals ...os.Signal) error
+	// Health Reports readiness, the service is down unless it is running
+	Health(ctx context.Context) health.Check
+}
+
+type manager struct {
+	config Config
+	failed chan error
+
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+	state   string
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewManager Will create a Manager without components
+func NewManager(config *Config) Manager {
+	return &manager{config: *config, failed: make(chan error, 1), state: StateIdle}
+}
+
+/*
+* PRIVATE
+ */
+
+func (m *manager) setState(state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = state
+}
+
+// run Calls fn with the timeout of h, fn keeps running in the background once it times out
+func (m *manager) run(ctx context.Context, h Hook, fn func(ctx context.Context) error) error {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = m.config.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up after %s: %w", timeout, ctx.Err())
+	}
+}
+
+// stop Runs the stop hooks of the started components in reverse order
+func (m *manager) stop(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := m.hooks[:m.started]
+	m.started = 0
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if h.Stop == nil {
+			continue
+		}
+		log.Infof("Stopping %s", h.Name)
+		if err := m.run(ctx, h, h.Stop); err != nil {
+			log.WithField("component", h.Name).Error(err)
+			errs = append(errs, fmt.Errorf("stop %s: %w", h.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+/*
+* PUBLIC
+ */
+
+func (m *manager) Append(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, h)
+}
+
+func (m *manager) Start(ctx context.Context) error {
+	m.setState(StateStarting)
+
+	m.mu.Lock()
+	hooks := append([]Hook{}, m.hooks...)
+	m.mu.Unlock()
+
+	for _, h := range hooks {
+		if h.Start != nil {
+			log.Infof("Starting %s", h.Name)
+			if err := m.run(ctx, h, h.Start); err != nil {
+				err = fmt.Errorf("start %s: %w", h.Name, err)
+				m.setState(StateStopping)
+				err = errors.Join(err, m.stop(ctx))
+				m.setState(StateStopped)
+				return err
+			}
+		}
+		m.mu.Lock()
+		m.started++
+		m.mu.Unlock()
+	}
+
+	m.setState(StateRunning)
+	return nil
+}
+
+func (m *manager) Stop(ctx context.Context) error {
+	m.setState(StateStopping)
+	defer m.setState(StateStopped)
+
+	if m.config.DrainDelay > 0 {
+		log.Infof("Draining for %s", m.config.DrainDelay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(m.config.DrainDelay):
+		}
+	}
+	return m.stop(ctx)
+}
+
+func (m *manager) Fail(name string, err error) {
+	if err == nil {
+		err = errors.New("stopped unexpectedly")
+	}
+	err = fmt.Errorf("%s: %w", name, err)
+	log.WithField("component", name).Error(err)
+
+	select {
+	case m.failed <- err:
+	default:
+	}
+}
+
+func (m *manager) Wait(signals ...os.Signal) error {
+	// Signals stay captured, a second one must not kill the service while it drains
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+
+	var failure error
+	select {
+	case s := <-sig:
+		log.Infof("Received %s, gracefully shutting down...", s)
+	case failure = <-m.failed:
+		log.Info("A component failed, shutting down...")
+	}
+	return errors.Join(failure, m.Stop(context.Background()))
+}
+
+func (m *manager) Health(ctx context.Context) health.Check {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	check := health.Check{Status: health.StatusDown, Details: map[string]interface{}{"state": m.state}}
+	if m.state == StateRunning {
+		check.Status = health.StatusUp
+	}
+	return check
+}
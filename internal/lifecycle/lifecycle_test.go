@@ -0,0 +1,155 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/lifecycle"
+)
+
+// recorder Appends hooks that record their calls in order
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) hook(name string, startErr error, stop func(ctx context.Context) error) lifecycle.Hook {
+	record := func(call string) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls = append(r.calls, call)
+	}
+	return lifecycle.Hook{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			record("start " + name)
+			return startErr
+		},
+		Stop: func(ctx context.Context) error {
+			record("stop " + name)
+			if stop != nil {
+				return stop(ctx)
+			}
+			return nil
+		},
+	}
+}
+
+/*
+	TESTS
+*/
+
+func TestManagerOrder(t *testing.T) {
+	r := &recorder{}
+	m := lifecycle.NewManager(&lifecycle.Config{})
+	m.Append(r.hook("datastore", nil, nil))
+	m.Append(r.hook("http", nil, nil))
+
+	ctx := context.Background()
+	assert.Equal(t, health.StatusDown, m.Health(ctx).Status, "Not ready before start")
+	require.Nil(t, m.Start(ctx))
+	assert.Equal(t, health.StatusUp, m.Health(ctx).Status, "Ready once started")
+	require.Nil(t, m.Stop(ctx))
+	assert.Equal(t, health.StatusDown, m.Health(ctx).Status, "Not ready once stopped")
+
+	assert.Equal(t, []string{"start datastore", "start http", "stop http", "stop datastore"}, r.calls)
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	r := &recorder{}
+	m := lifecycle.NewManager(&lifecycle.Config{})
+	m.Append(r.hook("datastore", nil, nil))
+	m.Append(r.hook("http", errors.New("address in use"), nil))
+	m.Append(r.hook("workers", nil, nil))
+
+	err := m.Start(context.Background())
+	assert.EqualError(t, err, "start http: address in use")
+	assert.Equal(t, []string{"start datastore", "start http", "stop datastore"}, r.calls, "Only started components are stopped")
+}
+
+func TestManagerStopErrors(t *testing.T) {
+	r := &recorder{}
+	m := lifecycle.NewManager(&lifecycle.Config{DrainDelay: 20 * time.Millisecond})
+	m.Append(r.hook("datastore", nil, func(ctx context.Context) error {
+		return errors.New("disconnect failed")
+	}))
+	slow := r.hook("http", nil, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	slow.Timeout = 10 * time.Millisecond
+	m.Append(slow)
+
+	ctx := context.Background()
+	require.Nil(t, m.Start(ctx))
+
+	done := make(chan error)
+	go func() {
+		done <- m.Stop(ctx)
+	}()
+	// Readiness fails while draining, before any component stops
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, health.StatusDown, m.Health(ctx).Status)
+	r.mu.Lock()
+	assert.Equal(t, []string{"start datastore", "start http"}, r.calls)
+	r.mu.Unlock()
+
+	// Every failure is reported and stopping goes on past them
+	err := <-done
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.Contains(t, err.Error(), "stop http: gave up after 10ms")
+	assert.Contains(t, err.Error(), "stop datastore: disconnect failed")
+	assert.Equal(t, []string{"start datastore", "start http", "stop http", "stop datastore"}, r.calls)
+}
+
+func TestManagerWait(t *testing.T) {
+	tests := []struct {
+		description string
+		trigger     func(m lifecycle.Manager)
+		expectedErr string
+	}{
+		{
+			description: "Signal",
+			trigger: func(m lifecycle.Manager) {
+				_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			},
+		},
+		{
+			description: "Failed component",
+			trigger: func(m lifecycle.Manager) {
+				m.Fail("http", errors.New("listener closed"))
+			},
+			expectedErr: "http: listener closed",
+		},
+	}
+
+	for _, test := range tests {
+		r := &recorder{}
+		m := lifecycle.NewManager(&lifecycle.Config{})
+		m.Append(r.hook("http", nil, nil))
+		require.Nil(t, m.Start(context.Background()), test.description)
+
+		trigger := test.trigger
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			trigger(m)
+		}()
+		err := m.Wait(syscall.SIGUSR1)
+
+		if len(test.expectedErr) == 0 {
+			assert.Nil(t, err, test.description)
+		} else {
+			assert.EqualError(t, err, test.expectedErr, test.description)
+		}
+		assert.Equal(t, []string{"start http", "stop http"}, r.calls, test.description)
+	}
+}
@@ -0,0 +1,86 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// preforkChildEnv Marks prefork children, it is the variable fiber.IsChild reads
+const preforkChildEnv = "FIBER_PREFORK_CHILD=1"
+
+/*
+* PUBLIC
+ */
+
+// Prefork Is a Hook that runs n copies of the process as fiber prefork children, for the master
+// process to append instead of listening itself. Unlike the fiber master, stopping forwards
+// SIGTERM to every child and waits for all of them to drain, and a child exiting on its own
+// is reported to m
+func Prefork(m Manager, n int) Hook {
+	var (
+		mu       sync.Mutex
+		children []*exec.Cmd
+		stopping bool
+		wg       sync.WaitGroup
+	)
+
+	return Hook{
+		Name: "prefork",
+		Start: func(ctx context.Context) error {
+			for i := 0; i < n; i++ {
+				/* #nosec G204 */
+				cmd := exec.Command(os.Args[0], os.Args[1:]...)
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				cmd.Env = append(os.Environ(), preforkChildEnv)
+				if err := cmd.Start(); err != nil {
+					return err
+				}
+
+				mu.Lock()
+				children = append(children, cmd)
+				mu.Unlock()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := cmd.Wait()
+					mu.Lock()
+					defer mu.Unlock()
+					if !stopping {
+						m.Fail("prefork", fmt.Errorf("child %d exited: %v", cmd.Process.Pid, err))
+					}
+				}()
+			}
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			mu.Lock()
+			stopping = true
+			for _, cmd := range children {
+				_ = cmd.Process.Signal(syscall.SIGTERM)
+			}
+			mu.Unlock()
+
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				mu.Lock()
+				defer mu.Unlock()
+				for _, cmd := range children {
+					_ = cmd.Process.Kill()
+				}
+				return fmt.Errorf("children did not drain in time: %w", ctx.Err())
+			}
+		},
+	}
+}
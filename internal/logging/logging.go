@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatPretty = "pretty"
+)
+
+// Config Is the Logging config
+type Config struct {
+	// Level is any logrus level name, defaults to info
+	Level string
+	// Format is json or pretty, defaults to json in production
+	Format      string
+	Environment string
+	ServiceName string
+}
+
+type entryKey struct{}
+
+// base carries the fields shared by every log line of this process
+var base = log.NewEntry(log.StandardLogger())
+
+// Setup Will configure the standard logger level and output format
+func Setup(config *Config) {
+	format := config.Format
+	if len(format) == 0 {
+		format = FormatPretty
+		if config.Environment == "production" {
+			format = FormatJSON
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		log.SetFormatter(&log.JSONFormatter{
+			FieldMap: log.FieldMap{
+				log.FieldKeyTime: "timestamp",
+				log.FieldKeyMsg:  "message",
+			},
+		})
+	case FormatPretty:
+		log.SetFormatter(&log.TextFormatter{
+			ForceColors:     true,
+			FullTimestamp:   true,
+			TimestampFormat: "15:04:05",
+		})
+	default:
+		log.Fatalf("Unknown log format %s", format)
+	}
+	log.SetOutput(os.Stdout)
+
+	level := log.InfoLevel
+	if len(config.Level) != 0 {
+		l, err := log.ParseLevel(config.Level)
+		if err != nil {
+			log.Fatal(err)
+		}
+		level = l
+	}
+	log.SetLevel(level)
+
+	if len(config.ServiceName) != 0 {
+		base = log.WithField("service", config.ServiceName)
+	}
+}
+
+// WithEntry returns a copy of the context carrying the logger entry
+func WithEntry(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// FromContext returns the request scoped logger, or the standard logger when there is none
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(entryKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return base
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// MiddlewareConfig Is the request logging config
+type MiddlewareConfig struct {
+	// AccessLog enables one log line per request
+	AccessLog bool
+	// SampleRate is the fraction (0, 1] of successful requests written to the access log,
+	// client and server errors are always written. Defaults to 1
+	SampleRate float64
+	// RequestIDKey is the fiber local set by the requestid middleware
+	RequestIDKey string
+}
+
+// SetUser Will attach the user to the request context as the actor and to the request scoped
+// logger, auth middlewares call it once the credentials of the user are verified
+func SetUser(ctx *fiber.Ctx, user string) {
+	c := utils.WithActor(utils.Context(ctx), user)
+	utils.SetContext(ctx, WithEntry(c, FromContext(c).WithField("user", user)))
+}
+
+// Middleware Will attach a request scoped logger to the context and write the access log
+func Middleware(config MiddlewareConfig) fiber.Handler {
+	if len(config.RequestIDKey) == 0 {
+		config.RequestIDKey = "requestid"
+	}
+	if config.SampleRate <= 0 {
+		config.SampleRate = 1
+	}
+
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+		c := utils.Context(ctx)
+
+		fields := log.Fields{
+			"method": ctx.Method(),
+			"path":   ctx.Path(),
+			"ip":     ctx.IP(),
+		}
+		if rid, ok := ctx.Locals(config.RequestIDKey).(string); ok {
+			fields["request_id"] = rid
+			c = utils.WithRequestID(c, rid)
+		}
+		if sc := trace.SpanContextFromContext(c); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+			fields["span_id"] = sc.SpanID().String()
+		}
+
+		entry := base.WithFields(fields)
+		utils.SetContext(ctx, WithEntry(c, entry))
+
+		err := ctx.Next()
+
+		if !config.AccessLog {
+			return err
+		}
+
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+		if status < fiber.StatusBadRequest && rand.Float64() >= config.SampleRate {
+			return err
+		}
+
+		access := entry.WithFields(log.Fields{
+			"route":      ctx.Route().Path,
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+		})
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			access.Error("request completed")
+		case status >= fiber.StatusBadRequest:
+			access.Warn("request completed")
+		default:
+			access.Info("request completed")
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,111 @@
+package logging_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+var span = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+	SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	TraceFlags: trace.FlagsSampled,
+})
+
+// newApp Mounts a handler logging through the request scoped logger behind a stand-in for the
+// tracing middleware and an auth middleware naming the user of the user header
+func newApp(config logging.MiddlewareConfig) *fiber.App {
+	app := fiber.New()
+	app.Use(func(ctx *fiber.Ctx) error {
+		utils.SetContext(ctx, trace.ContextWithSpanContext(utils.Context(ctx), span))
+		return ctx.Next()
+	})
+	app.Use(requestid.New())
+	app.Use(logging.Middleware(config))
+	app.Use(func(ctx *fiber.Ctx) error {
+		if user := ctx.Get("User"); len(user) != 0 {
+			logging.SetUser(ctx, user)
+		}
+		return ctx.Next()
+	})
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		c := utils.Context(ctx)
+		logging.FromContext(c).WithField("actor", utils.Actor(c)).Info("handled")
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+	app.Get("/fail", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusBadRequest)
+	})
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, path string, user string) *http.Response {
+	req, _ := http.NewRequest(fiber.MethodGet, path, nil)
+	req.Header.Set(fiber.HeaderXRequestID, "rid-1")
+	if len(user) != 0 {
+		req.Header.Set("User", user)
+	}
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	return res
+}
+
+/*
+	TESTS
+*/
+
+func TestMiddleware(t *testing.T) {
+	hook := test.NewGlobal()
+	app := newApp(logging.MiddlewareConfig{})
+
+	tests := []struct {
+		description string
+		user        string
+		actor       string
+	}{
+		{description: "Anonymous", actor: utils.AnonymousActor},
+		{description: "Authenticated", user: "admin", actor: "admin"},
+	}
+	for _, test := range tests {
+		hook.Reset()
+		send(t, app, "/", test.user)
+
+		entry := hook.LastEntry()
+		require.NotNil(t, entry, test.description)
+		assert.Equal(t, "handled", entry.Message, test.description)
+		assert.Equal(t, "rid-1", entry.Data["request_id"], test.description)
+		assert.Equal(t, span.TraceID().String(), entry.Data["trace_id"], test.description)
+		assert.Equal(t, span.SpanID().String(), entry.Data["span_id"], test.description)
+		assert.Equal(t, test.actor, entry.Data["actor"], test.description)
+		if len(test.user) == 0 {
+			assert.NotContains(t, entry.Data, "user", test.description)
+		} else {
+			assert.Equal(t, test.user, entry.Data["user"], test.description)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	hook := test.NewGlobal()
+	app := newApp(logging.MiddlewareConfig{AccessLog: true, SampleRate: 0.0001})
+
+	// Errors are always written, whatever the sample rate
+	send(t, app, "/fail", "")
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, "request completed", entry.Message)
+	assert.Equal(t, log.WarnLevel, entry.Level)
+	assert.Equal(t, fiber.StatusBadRequest, entry.Data["status"])
+	assert.Equal(t, "/fail", entry.Data["route"])
+	assert.Equal(t, "rid-1", entry.Data["request_id"])
+}
@@ -0,0 +1,246 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// MiddlewareConfig Is the spec validation config
+type MiddlewareConfig struct {
+	// Responses validates responses too. It is meant for development and tests, responses that do
+	// not match the spec are logged and replaced by an internal error
+	Responses bool
+}
+
+// route Is a path of the document split in segments, params are empty segments
+type route struct {
+	segments []string
+	static   int
+	item     map[string]*Endpoint
+}
+
+/*
+* PRIVATE
+ */
+
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+func isJSON(mt string) bool {
+	return mt == fiber.MIMEApplicationJSON || strings.HasSuffix(mt, "+json")
+}
+
+// segments splits a path, the root has none
+func segments(path string) []string {
+	path = strings.Trim(path, "/")
+	if len(path) == 0 {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// compile splits the paths of a document, the routes with the most static segments come first so
+// /v1/import is preferred over /v1/{id}
+func compile(doc *Document) []route {
+	routes := []route{}
+	for path, item := range doc.Paths {
+		r := route{item: item}
+		for _, s := range segments(path) {
+			if strings.HasPrefix(s, "{") {
+				s = ""
+			} else {
+				r.static++
+			}
+			r.segments = append(r.segments, s)
+		}
+		routes = append(routes, r)
+	}
+	// Insertion sort keeps it dependency free and the list is short
+	for i := 1; i < len(routes); i++ {
+		for j := i; j > 0 && routes[j].static > routes[j-1].static; j-- {
+			routes[j], routes[j-1] = routes[j-1], routes[j]
+		}
+	}
+	return routes
+}
+
+// match returns the endpoint of a request path relative to the base
+func match(routes []route, method string, path string) *Endpoint {
+	parts := segments(path)
+	for _, r := range routes {
+		if len(r.segments) != len(parts) {
+			continue
+		}
+		ok := true
+		for i, s := range r.segments {
+			ok = ok && (len(s) == 0 || strings.EqualFold(s, parts[i]))
+		}
+		if ok {
+			return r.item[strings.ToLower(method)]
+		}
+	}
+	return nil
+}
+
+// validateRequest checks the parameters and JSON body of a request
+func validateRequest(ctx *fiber.Ctx, e *Endpoint, components map[string]*Schema) error {
+	v := &validator{components: components}
+	for _, p := range e.Parameters {
+		var value string
+		switch p.In {
+		case "query":
+			value = ctx.Query(p.Name)
+		case "header":
+			value = ctx.Get(p.Name)
+		default:
+			continue
+		}
+		if len(value) == 0 {
+			if p.Required {
+				v.fail(p.Name, "required", "")
+			}
+			continue
+		}
+
+		var decoded interface{} = value
+		for _, t := range p.Schema.types() {
+			if t == "integer" || t == "number" {
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					v.fail(p.Name, "type", t)
+					decoded = nil
+					break
+				}
+				decoded = n
+			}
+		}
+		if decoded != nil {
+			v.validate(p.Name, p.Schema, decoded)
+		}
+	}
+
+	if e.RequestBody != nil {
+		mt := mediaType(ctx.Get(fiber.HeaderContentType))
+		media, ok := e.RequestBody.Content[fiber.MIMEApplicationJSON]
+		if ok && isJSON(mt) {
+			var body interface{}
+			if len(ctx.Body()) == 0 {
+				v.fail("body", "required", "")
+			} else if err := json.Unmarshal(ctx.Body(), &body); err != nil {
+				return apperrors.InvalidArgument(apperrors.CodeInvalidBody, "Body is not valid JSON")
+			} else {
+				v.validate("", media.Schema, body)
+			}
+		}
+	}
+
+	if len(v.errs) != 0 {
+		return apperrors.Validation("Request does not match the API specification", v.errs)
+	}
+	return nil
+}
+
+// validateResponse checks the status and JSON body of a response, bodies in other formats are
+// only checked to be documented
+func validateResponse(ctx *fiber.Ctx, e *Endpoint, components map[string]*Schema) error {
+	status := ctx.Response().StatusCode()
+	r, ok := e.Responses[strconv.Itoa(status)]
+	if !ok && status >= fiber.StatusBadRequest {
+		r, ok = e.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+
+	// Bodies of these statuses are never sent, fasthttp fills them with the status text
+	if status == fiber.StatusNoContent || status == fiber.StatusNotModified {
+		return nil
+	}
+	// Streamed bodies are left unread, reading them would buffer the whole stream
+	stream := ctx.Response().IsBodyStream()
+	if !stream && len(ctx.Response().Body()) == 0 {
+		return nil
+	}
+	mt := mediaType(string(ctx.Response().Header.ContentType()))
+	media, ok := r.Content[mt]
+	if !ok {
+		return fmt.Errorf("%s bodies of status %d are not documented", mt, status)
+	}
+	if stream || !isJSON(mt) {
+		return nil
+	}
+	body := ctx.Response().Body()
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return fmt.Errorf("body of status %d is not valid JSON: %w", status, err)
+	}
+	v := &validator{components: components}
+	v.validate("", media.Schema, decoded)
+	if len(v.errs) != 0 {
+		return apperrors.Validation(fmt.Sprintf("body of status %d does not match the schema", status), v.errs)
+	}
+	return nil
+}
+
+/*
+* PUBLIC
+ */
+
+// Middleware Will reject requests whose parameters or JSON body do not match the spec, routes
+// the spec does not know are left to the router
+func Middleware(s Spec, config MiddlewareConfig) fiber.Handler {
+	var once sync.Once
+	var routes []route
+	var base string
+
+	return func(ctx *fiber.Ctx) error {
+		doc := s.Document()
+		once.Do(func() {
+			routes = compile(doc)
+			base = doc.Servers[0].URL
+		})
+
+		e := match(routes, ctx.Method(), strings.TrimPrefix(ctx.Path(), base))
+		if e == nil || !e.documented {
+			return ctx.Next()
+		}
+		if err := validateRequest(ctx, e, doc.Components.Schemas); err != nil {
+			return err
+		}
+		if !config.Responses {
+			return ctx.Next()
+		}
+
+		// Errors are rendered here so their problem is validated too
+		if err := ctx.Next(); err != nil {
+			if err := ctx.App().Config().ErrorHandler(ctx, err); err != nil {
+				return err
+			}
+		}
+		if err := validateResponse(ctx, e, doc.Components.Schemas); err != nil {
+			entry := logging.FromContext(utils.Context(ctx)).WithFields(log.Fields{
+				"operation": e.OperationID,
+				"status":    ctx.Response().StatusCode(),
+			})
+			if domain, ok := apperrors.As(err); ok {
+				entry = entry.WithField("violations", domain.Fields)
+			}
+			entry.Error("Response does not match the API specification: ", err)
+			return apperrors.Internal(err)
+		}
+		return nil
+	}
+}
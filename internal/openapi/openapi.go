@@ -0,0 +1,432 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+)
+
+// Version is the OpenAPI version of generated documents
+const Version = "3.1.0"
+
+// BasicAuth is the security scheme of operations needing basic credentials
+const BasicAuth = "basicAuth"
+
+// codecs are the media types of bodies without ContentTypes, see render.Negotiate
+var codecs = []string{fiber.MIMEApplicationJSON, render.MIMEApplicationMsgPack, render.MIMEApplicationCBOR, fiber.MIMEApplicationXML}
+
+// Body Describes a request or response body from a Go value of its type
+type Body struct {
+	Description string
+	// Value is a value of the body type, nil for an empty body
+	Value interface{}
+	// Fields replace the schema of fields of Value, e.g. the data of an envelope
+	Fields map[string]interface{}
+	// ContentTypes default to the codecs of the render package
+	ContentTypes []string
+	// Headers are the names of the headers of a response
+	Headers []string
+}
+
+// Param Is a query or header parameter, path parameters are taken from the route
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	// Value is a value of the parameter type, defaults to a string
+	Value interface{}
+	Enum  []string
+}
+
+// Operation Describes the parameters, body and responses of a route
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	// Security are the schemes accepted, e.g. BasicAuth
+	Security []string
+	Params   []Param
+	Body     *Body
+	// Partial bodies may leave out required fields, e.g. in a PATCH
+	Partial bool
+	// Responses by status, errors are described by the default problem response
+	Responses map[int]Body
+}
+
+// Operations Describe routes by their method and OpenAPI path, e.g. GET /models/{id}
+type Operations map[string]Operation
+
+// Config Is the spec config
+type Config struct {
+	Title       string
+	Version     string
+	Description string
+	// Base is the path every described route is under, e.g. /api
+	Base       string
+	Operations Operations
+}
+
+// Document Is an OpenAPI 3.1 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Servers    []Server                        `json:"servers"`
+	Paths      map[string]map[string]*Endpoint `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// Endpoint Is an operation object of the document
+type Endpoint struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+
+	// documented is false for routes without an Operation, the middleware leaves them alone
+	documented bool
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Schema *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Spec Generates the document of the routes registered on an app
+type Spec interface {
+	// Document is generated on first use, once every route is registered
+	Document() *Document
+	// Undocumented returns the registered routes without an Operation
+	Undocumented() []string
+	// Unregistered returns the Operations without a registered route
+	Unregistered() []string
+}
+
+type spec struct {
+	app    *fiber.App
+	config Config
+
+	once         sync.Once
+	doc          *Document
+	undocumented []string
+	unregistered []string
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewSpec Will describe the routes of app under config.Base
+func NewSpec(app *fiber.App, config *Config) Spec {
+	return &spec{app: app, config: *config}
+}
+
+/*
+* PRIVATE
+ */
+
+// handlerKey identifies a route by its path and first handler
+func handlerKey(r *fiber.Route) string {
+	if len(r.Handlers) == 0 {
+		return r.Path
+	}
+	return fmt.Sprintf("%s %x", r.Path, reflect.ValueOf(r.Handlers[0]).Pointer())
+}
+
+// routePath converts a fiber route path to an OpenAPI path, e.g. /models/:id to /models/{id}
+func routePath(path string) string {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, s := range segments {
+		switch {
+		case strings.HasPrefix(s, ":"):
+			segments[i] = "{" + strings.TrimSuffix(s[1:], "?") + "}"
+		case s == "*":
+			segments[i] = "{*}"
+		}
+	}
+	if p := strings.Join(segments, "/"); len(p) != 0 {
+		return p
+	}
+	return "/"
+}
+
+// operationID derives a unique ID from the method and path, e.g. getV2ModelsById
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, "{") {
+			s = "by-" + strings.Trim(s, "{}*")
+		}
+		for _, word := range strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// inline returns a copy of a schema, referenced schemas are copied from components
+func inline(s *Schema, components map[string]*Schema) *Schema {
+	if len(s.Ref) != 0 {
+		s = components[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	c := *s
+	c.Properties = map[string]*Schema{}
+	for k, v := range s.Properties {
+		c.Properties[k] = v
+	}
+	return &c
+}
+
+// bodySchema returns the schema of a body value with its Fields replaced
+func bodySchema(b Body, components map[string]*Schema) *Schema {
+	if b.Value == nil {
+		return &Schema{}
+	}
+	s := schemaOf(reflect.TypeOf(b.Value), components)
+	if len(b.Fields) == 0 {
+		return s
+	}
+	s = inline(s, components)
+	for k, v := range b.Fields {
+		s.Properties[k] = schemaOf(reflect.TypeOf(v), components)
+	}
+	return s
+}
+
+// content maps each media type of a body to its schema
+func content(b Body, s *Schema) map[string]MediaType {
+	types := b.ContentTypes
+	if len(types) == 0 {
+		types = codecs
+	}
+	c := map[string]MediaType{}
+	for _, t := range types {
+		c[t] = MediaType{Schema: s}
+	}
+	return c
+}
+
+// endpoint builds the operation object of a described route
+func (s *spec) endpoint(method string, path string, params []string, op Operation, components map[string]*Schema) *Endpoint {
+	e := &Endpoint{
+		OperationID: operationID(method, path),
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Deprecated:  op.Deprecated,
+		Responses:   map[string]*Response{},
+	}
+	for _, scheme := range op.Security {
+		e.Security = append(e.Security, map[string][]string{scheme: {}})
+	}
+	for _, p := range params {
+		e.Parameters = append(e.Parameters, Parameter{Name: p, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, p := range op.Params {
+		var value interface{} = p.Value
+		if value == nil {
+			value = ""
+		}
+		schema := schemaOf(reflect.TypeOf(value), components)
+		for _, v := range p.Enum {
+			schema.Enum = append(schema.Enum, v)
+		}
+		e.Parameters = append(e.Parameters, Parameter{Name: p.Name, In: p.In, Description: p.Description, Required: p.Required, Schema: schema})
+	}
+
+	if op.Body != nil {
+		schema := bodySchema(*op.Body, components)
+		if op.Partial {
+			// Partial bodies are inlined without their required fields
+			schema = inline(schema, components)
+			schema.Required = nil
+		}
+		e.RequestBody = &RequestBody{Description: op.Body.Description, Required: true, Content: content(*op.Body, schema)}
+	}
+
+	for status, b := range op.Responses {
+		r := &Response{Description: b.Description}
+		if len(r.Description) == 0 {
+			r.Description = http.StatusText(status)
+		}
+		if b.Value != nil {
+			r.Content = content(b, bodySchema(b, components))
+		}
+		for _, h := range b.Headers {
+			if r.Headers == nil {
+				r.Headers = map[string]Header{}
+			}
+			r.Headers[h] = Header{Schema: &Schema{Type: "string"}}
+		}
+		e.Responses[strconv.Itoa(status)] = r
+	}
+	e.Responses["default"] = &Response{
+		Description: "Problem",
+		Content:     map[string]MediaType{problem.ContentType: {Schema: schemaOf(reflect.TypeOf(problem.Problem{}), components)}},
+	}
+	return e
+}
+
+// generate walks the routes of the app
+func (s *spec) generate() {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: s.config.Title, Version: s.config.Version, Description: s.config.Description},
+		Servers: []Server{{URL: s.config.Base}},
+		Paths:   map[string]map[string]*Endpoint{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{BasicAuth: {Type: "http", Scheme: "basic"}},
+		},
+	}
+
+	// Fiber copies middleware to the stack of every method, as no route serves CONNECT the
+	// handlers found there are middleware
+	middleware := map[string]bool{}
+	for _, methodRoutes := range s.app.Stack() {
+		for _, r := range methodRoutes {
+			if r.Method == fiber.MethodConnect {
+				middleware[handlerKey(r)] = true
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, methodRoutes := range s.app.Stack() {
+		for _, r := range methodRoutes {
+			if middleware[handlerKey(r)] || r.Method == fiber.MethodHead || r.Method == fiber.MethodOptions || !strings.HasPrefix(r.Path, s.config.Base) {
+				continue
+			}
+			path := routePath(strings.TrimPrefix(r.Path, s.config.Base))
+			key := r.Method + " " + path
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			op, ok := s.config.Operations[key]
+			if !ok {
+				s.undocumented = append(s.undocumented, key)
+			}
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = map[string]*Endpoint{}
+			}
+			e := s.endpoint(r.Method, path, r.Params, op, doc.Components.Schemas)
+			e.documented = ok
+			doc.Paths[path][strings.ToLower(r.Method)] = e
+		}
+	}
+
+	for key := range s.config.Operations {
+		if !seen[key] {
+			s.unregistered = append(s.unregistered, key)
+		}
+	}
+	sort.Strings(s.undocumented)
+	sort.Strings(s.unregistered)
+	s.doc = doc
+}
+
+/*
+* PUBLIC
+ */
+
+func (s *spec) Document() *Document {
+	s.once.Do(s.generate)
+	return s.doc
+}
+
+func (s *spec) Undocumented() []string {
+	s.once.Do(s.generate)
+	return s.undocumented
+}
+
+func (s *spec) Unregistered() []string {
+	s.once.Do(s.generate)
+	return s.unregistered
+}
+
+// Prefix Returns the operations with prefix prepended to their path
+func (o Operations) Prefix(prefix string) Operations {
+	out := Operations{}
+	for key, op := range o {
+		method, path, _ := strings.Cut(key, " ")
+		out[method+" "+routePath(prefix+path)] = op
+	}
+	return out
+}
+
+// Merge Adds the operations of others
+func (o Operations) Merge(others ...Operations) Operations {
+	for _, other := range others {
+		for key, op := range other {
+			o[key] = op
+		}
+	}
+	return o
+}
+
+// Handler Serves the document as JSON
+func Handler(s Spec) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		return ctx.JSON(s.Document())
+	}
+}
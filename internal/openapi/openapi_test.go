@@ -0,0 +1,166 @@
+package openapi_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+)
+
+type Thing struct {
+	ID        string    `json:"id,omitempty"`
+	Name      string    `json:"name" validate:"required" example:"lamp"`
+	Count     int       `json:"count" example:"2"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func operations() openapi.Operations {
+	thing := openapi.Body{Value: Thing{}}
+	return openapi.Operations{
+		"GET /things": {
+			Params:    []openapi.Param{{Name: "page", In: "query", Value: 0}, {Name: "sort", In: "query", Enum: []string{"asc", "desc"}}},
+			Responses: map[int]openapi.Body{fiber.StatusOK: {Value: []Thing{}}},
+		},
+		"POST /things": {
+			Body:      &thing,
+			Responses: map[int]openapi.Body{fiber.StatusCreated: thing},
+		},
+		"PATCH /things/{id}": {
+			Body:      &thing,
+			Partial:   true,
+			Responses: map[int]openapi.Body{fiber.StatusNoContent: {}},
+		},
+		"GET /things/{id}": {
+			Responses: map[int]openapi.Body{fiber.StatusOK: thing},
+		},
+		"DELETE /things/{id}": {},
+	}
+}
+
+// newApp Returns an app whose GET /things/:id drifts from the spec
+func newApp() (*fiber.App, openapi.Spec) {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	spec := openapi.NewSpec(app, &openapi.Config{Title: "things", Version: "1.0", Base: "/api", Operations: operations()})
+	app.Get("/openapi.json", openapi.Handler(spec))
+
+	api := app.Group("/api")
+	api.Use(openapi.Middleware(spec, openapi.MiddlewareConfig{Responses: true}))
+	api.Get("/things", func(ctx *fiber.Ctx) error {
+		return ctx.JSON([]Thing{{ID: "1", Name: "lamp", CreatedAt: time.Now()}})
+	})
+	api.Post("/things", func(ctx *fiber.Ctx) error {
+		return ctx.Status(fiber.StatusCreated).JSON(Thing{ID: "1", Name: "lamp"})
+	})
+	api.Patch("/things/:id", func(ctx *fiber.Ctx) error {
+		if ctx.Params("id") == "missing" {
+			return apperrors.NotFound(apperrors.CodeResourceNotFound, "Thing Not Found")
+		}
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+	api.Get("/things/:id", func(ctx *fiber.Ctx) error {
+		return ctx.JSON(fiber.Map{"id": 1, "name": "lamp", "createdAt": "yesterday"})
+	})
+	api.Delete("/things/:id", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+	api.Get("/undocumented", func(ctx *fiber.Ctx) error {
+		return ctx.SendString("ok")
+	})
+	return app, spec
+}
+
+/*
+	TESTS
+*/
+
+func TestSpec(t *testing.T) {
+	_, spec := newApp()
+	doc := spec.Document()
+
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	assert.Equal(t, []string{"GET /undocumented"}, spec.Undocumented())
+	assert.Empty(t, spec.Unregistered())
+
+	get := doc.Paths["/things/{id}"]["get"]
+	require.NotNil(t, get)
+	assert.Equal(t, "getThingsById", get.OperationID)
+	assert.Equal(t, "id", get.Parameters[0].Name)
+	assert.Equal(t, "path", get.Parameters[0].In)
+	assert.Contains(t, get.Responses["default"].Content, problem.ContentType)
+
+	thing := doc.Components.Schemas["openapi_test.Thing"]
+	require.NotNil(t, thing)
+	assert.Equal(t, []string{"name"}, thing.Required)
+	assert.Equal(t, "date-time", thing.Properties["createdAt"].Format)
+	assert.Equal(t, []interface{}{int64(2)}, thing.Properties["count"].Examples)
+
+	// Partial bodies are inlined without their required fields
+	patch := doc.Paths["/things/{id}"]["patch"].RequestBody.Content[fiber.MIMEApplicationJSON].Schema
+	assert.Empty(t, patch.Ref)
+	assert.Empty(t, patch.Required)
+}
+
+func TestMiddleware(t *testing.T) {
+	app, _ := newApp()
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{description: "Valid request", method: fiber.MethodPost, path: "/api/things", body: `{"name":"lamp","count":2}`, status: fiber.StatusCreated},
+		{description: "Missing field", method: fiber.MethodPost, path: "/api/things", body: `{"count":2}`, status: fiber.StatusBadRequest, code: apperrors.CodeValidationFailed, field: "name"},
+		{description: "Wrong type", method: fiber.MethodPost, path: "/api/things", body: `{"name":"lamp","count":"two"}`, status: fiber.StatusBadRequest, code: apperrors.CodeValidationFailed, field: "count"},
+		{description: "Nested type", method: fiber.MethodPost, path: "/api/things", body: `{"name":"lamp","tags":[1]}`, status: fiber.StatusBadRequest, code: apperrors.CodeValidationFailed, field: "tags[0]"},
+		{description: "Invalid JSON", method: fiber.MethodPost, path: "/api/things", body: `{"name"`, status: fiber.StatusBadRequest, code: apperrors.CodeInvalidBody},
+		{description: "Partial body", method: fiber.MethodPatch, path: "/api/things/1", body: `{"count":2}`, status: fiber.StatusNoContent},
+		{description: "Documented error", method: fiber.MethodPatch, path: "/api/things/missing", body: `{"count":2}`, status: fiber.StatusNotFound, code: apperrors.CodeResourceNotFound},
+		{description: "Valid query", method: fiber.MethodGet, path: "/api/things?page=2&sort=asc", status: fiber.StatusOK},
+		{description: "Query type", method: fiber.MethodGet, path: "/api/things?page=two", status: fiber.StatusBadRequest, code: apperrors.CodeValidationFailed, field: "page"},
+		{description: "Query enum", method: fiber.MethodGet, path: "/api/things?sort=up", status: fiber.StatusBadRequest, code: apperrors.CodeValidationFailed, field: "sort"},
+		{description: "Response drift", method: fiber.MethodGet, path: "/api/things/1", status: fiber.StatusInternalServerError, code: apperrors.CodeInternal},
+		{description: "Undocumented status", method: fiber.MethodDelete, path: "/api/things/1", status: fiber.StatusInternalServerError, code: apperrors.CodeInternal},
+		{description: "Undocumented route", method: fiber.MethodGet, path: "/api/undocumented", status: fiber.StatusOK},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		res, err := app.Test(req, -1)
+		require.Nil(t, err, test.description)
+		body, _ := io.ReadAll(res.Body)
+
+		assert.Equal(t, test.status, res.StatusCode, test.description)
+		if len(test.code) != 0 {
+			assert.Contains(t, string(body), `"code":"`+test.code+`"`, test.description)
+		}
+		if len(test.field) != 0 {
+			assert.Contains(t, string(body), `"field":"`+test.field+`"`, test.description)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	app, _ := newApp()
+	req, _ := http.NewRequest(fiber.MethodGet, "/openapi.json", nil)
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+
+	assert.Equal(t, fiber.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), `"openapi":"3.1.0"`)
+	assert.Contains(t, string(body), `"/things/{id}"`)
+}
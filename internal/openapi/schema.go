@@ -0,0 +1,274 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+)
+
+// Schema Is a JSON Schema 2020-12 object, the dialect of OpenAPI 3.1
+type Schema struct {
+	Ref         string `json:"$ref,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is a type name, or a list of them for nullable values
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Examples             []interface{}      `json:"examples,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	componentName     = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+/*
+* PRIVATE
+ */
+
+// types returns the type names a schema allows, none allows any value
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+// example converts an example tag to the kind of its field
+func example(value string, t reflect.Type) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// schemaOf builds the schema of a Go type from its json tags, structs are added to components
+// and referenced. Fields validated as required are required
+func schemaOf(t reflect.Type, components map[string]*Schema) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// Custom encodings such as json.RawMessage hold any value
+		return &Schema{}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		// Bytes are encoded in base64
+		return &Schema{Type: "string", Format: "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		// Nil slices are encoded as null
+		return &Schema{Type: []string{"array", "null"}, Items: schemaOf(t.Elem(), components)}
+	case reflect.Map:
+		return &Schema{Type: []string{"object", "null"}, AdditionalProperties: schemaOf(t.Elem(), components)}
+	case reflect.Struct:
+		name := componentName.ReplaceAllString(strings.ReplaceAll(t.String(), "*", ""), "_")
+		if _, ok := components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			components[name] = &Schema{}
+			components[name] = objectOf(t, components)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// Interfaces hold any value
+	return &Schema{}
+}
+
+// objectOf builds the schema of a struct, embedded structs are flattened like encoding/json does
+func objectOf(t reflect.Type, components map[string]*Schema) *Schema {
+	o := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && len(name) == 0 {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := objectOf(ft, components)
+				for k, v := range embedded.Properties {
+					o.Properties[k] = v
+				}
+				o.Required = append(o.Required, embedded.Required...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		prop := schemaOf(f.Type, components)
+		if strings.Contains(opts, "string") {
+			prop = &Schema{Type: "string"}
+		}
+		if v, ok := f.Tag.Lookup("example"); ok && len(prop.Ref) == 0 {
+			prop.Examples = []interface{}{example(v, f.Type)}
+		}
+		o.Properties[name] = prop
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				o.Required = append(o.Required, name)
+			}
+		}
+	}
+	sort.Strings(o.Required)
+	return o
+}
+
+// typeOf returns the JSON type name of a decoded JSON value
+func typeOf(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validator checks decoded JSON values against schemas of a document
+type validator struct {
+	components map[string]*Schema
+	errs       []apperrors.FieldError
+}
+
+func (v *validator) fail(path string, rule string, param string) {
+	v.errs = append(v.errs, apperrors.FieldError{Field: path, Rule: rule, Param: param})
+}
+
+// validate checks value against s, failures are recorded by the JSON path of the value
+func (v *validator) validate(path string, s *Schema, value interface{}) {
+	if s == nil {
+		return
+	}
+	if len(s.Ref) != 0 {
+		v.validate(path, v.components[strings.TrimPrefix(s.Ref, "#/components/schemas/")], value)
+		return
+	}
+
+	if types := s.types(); len(types) != 0 {
+		actual := typeOf(value)
+		ok := false
+		for _, t := range types {
+			// Integers are numbers too
+			ok = ok || t == actual || (t == "number" && actual == "integer")
+		}
+		if !ok {
+			v.fail(path, "type", strings.Join(types, "|"))
+			return
+		}
+	}
+	if len(s.Enum) != 0 {
+		found := false
+		values := make([]string, 0, len(s.Enum))
+		for _, e := range s.Enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(value)
+			values = append(values, fmt.Sprint(e))
+		}
+		if !found {
+			v.fail(path, "enum", strings.Join(values, " "))
+		}
+	}
+
+	switch val := value.(type) {
+	case string:
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, val); err != nil {
+				v.fail(path, "format", s.Format)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), s.Items, item)
+		}
+	case map[string]interface{}:
+		for _, r := range s.Required {
+			if _, ok := val[r]; !ok {
+				v.fail(join(path, r), "required", "")
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			item := val[k]
+			if prop, ok := s.Properties[k]; ok {
+				v.validate(join(path, k), prop, item)
+			} else if s.AdditionalProperties != nil {
+				v.validate(join(path, k), s.AdditionalProperties, item)
+			}
+		}
+	}
+}
+
+func join(path string, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
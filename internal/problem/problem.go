@@ -0,0 +1,121 @@
+package problem
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
+)
+
+// ContentType is the RFC 7807 media type
+const ContentType = "application/problem+json"
+
+// Problem Is an RFC 7807 problem details response
+type Problem struct {
+	Type      string                 `json:"type" example:"/problems/not-found"`
+	Title     string                 `json:"title" example:"Not Found"`
+	Status    int                    `json:"status" example:"404"`
+	Detail    string                 `json:"detail,omitempty" example:"Model Not Found"`
+	Instance  string                 `json:"instance,omitempty" example:"/api/v1/5ff3fc0e00acd4328da25d92"`
+	Code      string                 `json:"code" example:"MODEL_NOT_FOUND"`
+	RequestID string                 `json:"requestId,omitempty" example:"3c1a9b3e-9f0e-4a64-a3f1-0a3c2b5c1d8e"`
+	Errors    []apperrors.FieldError `json:"errors,omitempty"`
+}
+
+var statusByKind = map[apperrors.Kind]int{
+	apperrors.KindInvalidArgument: fiber.StatusBadRequest,
+	apperrors.KindValidation:      fiber.StatusBadRequest,
+	apperrors.KindUnauthorized:    fiber.StatusUnauthorized,
+	apperrors.KindForbidden:       fiber.StatusForbidden,
+	apperrors.KindNotFound:        fiber.StatusNotFound,
+	apperrors.KindConflict:        fiber.StatusConflict,
+	apperrors.KindUnavailable:     fiber.StatusServiceUnavailable,
+	apperrors.KindInternal:        fiber.StatusInternalServerError,
+}
+
+/*
+* PRIVATE
+ */
+
+// typeURI builds a relative problem type reference from the title, e.g. /problems/not-found
+func typeURI(status int) string {
+	return "/problems/" + strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "-")
+}
+
+// codeForStatus is the stable code for errors raised by fiber itself rather than the domain
+func codeForStatus(status int) string {
+	if status >= fiber.StatusInternalServerError {
+		return apperrors.CodeInternal
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+/*
+* PUBLIC
+ */
+
+// StatusOf Returns the HTTP status an error maps to
+func StatusOf(err error) int {
+	if e, ok := apperrors.As(err); ok {
+		return statusByKind[e.Kind]
+	}
+	if e, ok := err.(*fiber.Error); ok {
+		return e.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// FromError Maps any error to a problem, internal details are never exposed
+func FromError(err error) Problem {
+	status := StatusOf(err)
+	p := Problem{
+		Type:   typeURI(status),
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+
+	if e, ok := apperrors.As(err); ok {
+		p.Code = e.Code
+		p.Errors = e.Fields
+		if e.Kind != apperrors.KindInternal {
+			p.Detail = e.Message
+		}
+		return p
+	}
+
+	p.Code = codeForStatus(status)
+	if e, ok := err.(*fiber.Error); ok && status < fiber.StatusInternalServerError {
+		p.Detail = e.Message
+	}
+	return p
+}
+
+// ErrorHandler Is the fiber error handler rendering every error as application/problem+json
+func ErrorHandler(ctx *fiber.Ctx, err error) error {
+	rctx := utils.Context(ctx)
+	p := FromError(err)
+	p.Instance = ctx.OriginalURL()
+	p.RequestID = utils.RequestID(rctx)
+	if len(p.Errors) != 0 {
+		// Field messages follow the Accept-Language of the request
+		errs, tag := validation.Localize(p.Errors, ctx.Get(fiber.HeaderAcceptLanguage))
+		p.Errors = errs
+		ctx.Set(fiber.HeaderContentLanguage, tag.String())
+	}
+
+	if p.Status >= fiber.StatusInternalServerError {
+		logging.FromContext(rctx).Error(err)
+	}
+
+	err = ctx.Status(p.Status).JSON(p)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).SendString("Internal Server Error")
+	}
+	ctx.Set(fiber.HeaderContentType, ContentType)
+	return nil
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+)
+
+// Validators Identify a version of a representation for conditional requests
+type Validators struct {
+	// Version changes whenever the representation does, e.g. an ID and its update time.
+	// When empty the encoded body is hashed instead
+	Version string
+	// LastModified is sent when it is not zero
+	LastModified time.Time
+	// Weak marks representations that are only semantically equivalent, such as lists
+	Weak bool
+}
+
+// Versioned Is implemented by documents that know their own validators
+type Versioned interface {
+	Validators() Validators
+}
+
+/*
+* PRIVATE
+ */
+
+// etag Is unique per version and codec, since each format is a different representation
+func (v Validators) etag(contentType string) string {
+	sum := sha256.Sum256([]byte(v.Version + "\x00" + contentType))
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if v.Weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// notModified Evaluates If-None-Match, or If-Modified-Since when it is absent, see RFC 9110 13.2.2
+func notModified(ctx *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if inm := ctx.Get(fiber.HeaderIfNoneMatch); len(inm) != 0 {
+		// GET and HEAD use the weak comparison
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := ctx.Get(fiber.HeaderIfModifiedSince)
+	if len(ims) == 0 || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+/*
+* PUBLIC
+ */
+
+// Collection Combines the validators of every item into a weak validator of the list. Last-Modified
+// is left out since removing an item does not change it. It is false when an item is not Versioned
+func Collection(items interface{}) (Validators, bool) {
+	v := reflect.Indirect(reflect.ValueOf(items))
+	if v.Kind() != reflect.Slice {
+		return Validators{}, false
+	}
+
+	versions := make([]string, 0, v.Len()+1)
+	versions = append(versions, strconv.Itoa(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		item, ok := v.Index(i).Interface().(Versioned)
+		if !ok && v.Index(i).CanAddr() {
+			item, ok = v.Index(i).Addr().Interface().(Versioned)
+		}
+		if !ok {
+			return Validators{}, false
+		}
+		versions = append(versions, item.Validators().Version)
+	}
+	return Validators{Version: strings.Join(versions, ","), Weak: true}, true
+}
+
+// RespondConditional Encodes v like Respond, with ETag and Last-Modified headers taken from
+// validators. Requests whose copy is still fresh get 304 and v is never encoded
+func RespondConditional(ctx *fiber.Ctx, status int, validators Validators, v interface{}) error {
+	ctx.Vary(fiber.HeaderAccept)
+	c, err := Negotiate(ctx)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	if len(validators.Version) == 0 {
+		b, err = c.Marshal(v)
+		if err != nil {
+			return apperrors.Internal(err)
+		}
+		sum := sha256.Sum256(b)
+		validators.Version = hex.EncodeToString(sum[:])
+		validators.Weak = true
+	}
+
+	etag := validators.etag(c.ContentType())
+	ctx.Set(fiber.HeaderETag, etag)
+	if !validators.LastModified.IsZero() {
+		ctx.Set(fiber.HeaderLastModified, validators.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(ctx, etag, validators.LastModified) {
+		return ctx.SendStatus(fiber.StatusNotModified)
+	}
+
+	if b == nil {
+		b, err = c.Marshal(v)
+		if err != nil {
+			return apperrors.Internal(err)
+		}
+	}
+	ctx.Set(fiber.HeaderContentType, c.ContentType())
+	return ctx.Status(status).Send(b)
+}
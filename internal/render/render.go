@@ -0,0 +1,159 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+)
+
+const (
+	MIMEApplicationMsgPack  = "application/msgpack"
+	MIMEApplicationXMsgPack = "application/x-msgpack"
+	MIMEApplicationCBOR     = "application/cbor"
+)
+
+// Codec Is a wire format requests and responses can be encoded in
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return fiber.MIMEApplicationJSON }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string                        { return fiber.MIMEApplicationXML }
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string                        { return MIMEApplicationCBOR }
+func (cborCodec) Marshal(v interface{}) ([]byte, error)      { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
+
+// msgpackCodec reuses json tags so field names match across every format
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return MIMEApplicationMsgPack }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	enc.SetCustomStructTag("json")
+	enc.SetOmitEmpty(true)
+	err := enc.Encode(v)
+	return b.Bytes(), err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// codecs in order of preference, the first one is used when the client has no preference
+var codecs = []Codec{jsonCodec{}, msgpackCodec{}, cborCodec{}, xmlCodec{}}
+
+// aliases maps alternative media types to their codec
+var aliases = map[string]Codec{
+	MIMEApplicationXMsgPack: msgpackCodec{},
+	fiber.MIMETextXML:       xmlCodec{},
+}
+
+/*
+* PRIVATE
+ */
+
+func mediaType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+func lookup(mt string) (Codec, bool) {
+	for _, c := range codecs {
+		if c.ContentType() == mt {
+			return c, true
+		}
+	}
+	c, ok := aliases[mt]
+	return c, ok
+}
+
+/*
+* PUBLIC
+ */
+
+// Negotiate Picks the response codec from the Accept header
+func Negotiate(ctx *fiber.Ctx) (Codec, error) {
+	offers := make([]string, 0, len(codecs)+len(aliases))
+	for _, c := range codecs {
+		offers = append(offers, c.ContentType())
+	}
+	for mt := range aliases {
+		offers = append(offers, mt)
+	}
+
+	c, ok := lookup(ctx.Accepts(offers...))
+	if !ok {
+		return nil, fiber.ErrNotAcceptable
+	}
+	return c, nil
+}
+
+// Respond Encodes v in the negotiated format
+func Respond(ctx *fiber.Ctx, status int, v interface{}) error {
+	ctx.Vary(fiber.HeaderAccept)
+	c, err := Negotiate(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.Marshal(v)
+	if err != nil {
+		return apperrors.Internal(err)
+	}
+	ctx.Set(fiber.HeaderContentType, c.ContentType())
+	return ctx.Status(status).Send(b)
+}
+
+// Bind Decodes the request body according to its Content-Type, JSON is assumed when none is sent
+func Bind(ctx *fiber.Ctx, out interface{}) error {
+	mt := mediaType(string(ctx.Request().Header.ContentType()))
+	if len(mt) == 0 {
+		mt = fiber.MIMEApplicationJSON
+	}
+
+	// Forms are still handled by fiber
+	if mt == fiber.MIMEApplicationForm || mt == fiber.MIMEMultipartForm {
+		err := ctx.BodyParser(out)
+		if err != nil {
+			return apperrors.InvalidArgument(apperrors.CodeInvalidBody, err.Error())
+		}
+		return nil
+	}
+
+	c, ok := lookup(mt)
+	if !ok {
+		return fiber.ErrUnsupportedMediaType
+	}
+	err := c.Unmarshal(ctx.Body(), out)
+	if err != nil {
+		return apperrors.InvalidArgument(apperrors.CodeInvalidBody, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package resource
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+type controller[T any] struct {
+	def *Definition[T]
+	s   *service[T]
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func newController[T any](def *Definition[T], s *service[T]) *controller[T] {
+	return &controller[T]{def: def, s: s}
+}
+
+/*
+* PRIVATE
+ */
+
+func allow(ctx *fiber.Ctx, p Permission) error {
+	if p == nil {
+		return nil
+	}
+	return p(utils.Context(ctx))
+}
+
+func queryInt(ctx *fiber.Ctx, key string, def int) (int, error) {
+	v := ctx.Query(key)
+	if len(v) == 0 {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 1 {
+		return 0, apperrors.InvalidArgument(apperrors.CodeInvalidPagination, key+" must be a positive integer")
+	}
+	return i, nil
+}
+
+// validators Are taken from Versioned documents, others fall back to a weak hash of the body
+func validators(v interface{}) render.Validators {
+	if d, ok := v.(render.Versioned); ok {
+		return d.Validators()
+	}
+	if d, ok := render.Collection(v); ok {
+		return d
+	}
+	return render.Validators{}
+}
+
+/*
+* PUBLIC
+ */
+
+func (c *controller[T]) List(ctx *fiber.Ctx) error {
+	if err := allow(ctx, c.def.Permissions.List); err != nil {
+		return err
+	}
+	rctx := utils.Context(ctx)
+
+	page, err := queryInt(ctx, "page", 1)
+	if err != nil {
+		return err
+	}
+	limit, err := queryInt(ctx, "limit", 30)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.s.List(rctx, page, limit)
+	if err != nil {
+		logging.FromContext(rctx).Error(err)
+		return err
+	}
+	return render.RespondConditional(ctx, fiber.StatusOK, validators(res), models.Response{Data: res})
+}
+
+func (c *controller[T]) Get(ctx *fiber.Ctx) error {
+	if err := allow(ctx, c.def.Permissions.Get); err != nil {
+		return err
+	}
+	rctx := utils.Context(ctx)
+
+	res, err := c.s.Get(rctx, ctx.Params("id"))
+	if err != nil {
+		logging.FromContext(rctx).Error(err)
+		return err
+	}
+	return render.RespondConditional(ctx, fiber.StatusOK, validators(res), models.Response{Data: res})
+}
+
+func (c *controller[T]) Create(ctx *fiber.Ctx) error {
+	if err := allow(ctx, c.def.Permissions.Create); err != nil {
+		return err
+	}
+	rctx := utils.Context(ctx)
+
+	var data T
+	if err := render.Bind(ctx, &data); err != nil {
+		return err
+	}
+	if err := c.s.Validate(rctx, &data); err != nil {
+		return err
+	}
+
+	id, err := c.s.Create(rctx, &data)
+	if err != nil {
+		logging.FromContext(rctx).Error(err)
+		return err
+	}
+	ctx.Location(strings.TrimSuffix(ctx.Path(), "/") + "/" + id)
+	return render.Respond(ctx, fiber.StatusCreated, models.Response{
+		Data: models.CreateResponse{InsertedID: id},
+	})
+}
+
+func (c *controller[T]) Patch(ctx *fiber.Ctx) error {
+	if err := allow(ctx, c.def.Permissions.Update); err != nil {
+		return err
+	}
+	rctx := utils.Context(ctx)
+
+	var data T
+	if err := render.Bind(ctx, &data); err != nil {
+		return err
+	}
+	if err := c.s.ValidatePartial(rctx, &data); err != nil {
+		return err
+	}
+
+	err := c.s.Update(rctx, ctx.Params("id"), &data)
+	if err != nil {
+		logging.FromContext(rctx).Error(err)
+		return err
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (c *controller[T]) Replace(ctx *fiber.Ctx) error {
+	if err := allow(ctx, c.def.Permissions.Update); err != nil {
+		return err
+	}
+	rctx := utils.Context(ctx)
+
+	var data T
+	if err := render.Bind(ctx, &data); err != nil {
+		return err
+	}
+	if err := c.s.Validate(rctx, &data); err != nil {
+		return err
+	}
+
+	err := c.s.Update(rctx, ctx.Params("id"), &data)
+	if err != nil {
+		logging.FromContext(rctx).Error(err)
+		return err
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (c *controller[T]) Delete(ctx *fiber.Ctx) error {
+	if err := allow(ctx, c.def.Permissions.Delete); err != nil {
+		return err
+	}
+	rctx := utils.Context(ctx)
+
+	err := c.s.Delete(rctx, ctx.Params("id"))
+	if err != nil {
+		logging.FromContext(rctx).Error(err)
+		return err
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
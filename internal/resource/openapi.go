@@ -0,0 +1,71 @@
+package resource
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+/*
+* PUBLIC
+ */
+
+// Operations Will describe the CRUD routes of Mount for the OpenAPI spec, keyed by their path
+// under the router the resource is mounted on
+func (r *registration[T]) Operations() openapi.Operations {
+	var zero T
+	tags := []string{r.def.Name}
+	envelope := func(description string, data interface{}) openapi.Body {
+		return openapi.Body{Description: description, Value: models.Response{}, Fields: map[string]interface{}{"data": data}}
+	}
+	page := openapi.Param{Name: "page", In: "query", Description: "Page, defaults to 1", Value: 0}
+	limit := openapi.Param{Name: "limit", In: "query", Description: "Limit, defaults to 30", Value: 0}
+	ifNoneMatch := openapi.Param{Name: fiber.HeaderIfNoneMatch, In: "header", Description: "ETag of a previous response"}
+	ifModifiedSince := openapi.Param{Name: fiber.HeaderIfModifiedSince, In: "header", Description: "Last-Modified of a previous response"}
+	body := &openapi.Body{Description: r.def.Name + " entry", Value: zero}
+	created := envelope("Created", models.CreateResponse{})
+	created.Headers = []string{fiber.HeaderLocation}
+	noContent := map[int]openapi.Body{fiber.StatusNoContent: {}}
+	notModified := openapi.Body{Description: "Not Modified"}
+
+	base := "/" + r.def.Name
+	return openapi.Operations{
+		"GET " + base: {
+			Summary:   "Lists " + r.def.Name,
+			Tags:      tags,
+			Params:    []openapi.Param{page, limit, ifNoneMatch},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("OK", []T{}), fiber.StatusNotModified: notModified},
+		},
+		"POST " + base: {
+			Summary:   "Creates a " + r.def.Name + " entry",
+			Tags:      tags,
+			Body:      body,
+			Responses: map[int]openapi.Body{fiber.StatusCreated: created},
+		},
+		"GET " + base + "/{id}": {
+			Summary:   "Gets a " + r.def.Name + " entry",
+			Tags:      tags,
+			Params:    []openapi.Param{ifNoneMatch, ifModifiedSince},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("OK", zero), fiber.StatusNotModified: notModified},
+		},
+		"PATCH " + base + "/{id}": {
+			Summary:   "Partially updates a " + r.def.Name + " entry",
+			Tags:      tags,
+			Body:      body,
+			Partial:   true,
+			Responses: noContent,
+		},
+		"PUT " + base + "/{id}": {
+			Summary:   "Replaces a " + r.def.Name + " entry",
+			Tags:      tags,
+			Body:      body,
+			Responses: noContent,
+		},
+		"DELETE " + base + "/{id}": {
+			Summary:   "Deletes a " + r.def.Name + " entry",
+			Tags:      tags,
+			Responses: noContent,
+		},
+	}
+}
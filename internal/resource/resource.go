@@ -0,0 +1,165 @@
+package resource
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// Permission Decides if the caller may run an operation, a nil Permission allows everyone
+type Permission func(ctx context.Context) error
+
+// Permissions Are the per operation permissions of a resource
+type Permissions struct {
+	List   Permission
+	Get    Permission
+	Create Permission
+	Update Permission
+	Delete Permission
+}
+
+// Hooks Run around each operation, returning an error from a Before hook aborts the operation
+type Hooks[T any] struct {
+	BeforeCreate func(ctx context.Context, data *T) error
+	AfterCreate  func(ctx context.Context, id string, data *T) error
+	BeforeUpdate func(ctx context.Context, id string, data *T) error
+	AfterUpdate  func(ctx context.Context, id string, data *T) error
+	BeforeDelete func(ctx context.Context, id string) error
+	AfterDelete  func(ctx context.Context, id string) error
+}
+
+// Definition Declares a CRUD resource.
+// T must be a struct with an `ID string` field tagged `bson:"_id,omitempty"`, every other
+// field should be tagged omitempty in bson so PATCH only sets the fields that were sent.
+// Responses of a *T implementing render.Versioned carry its ETag and Last-Modified, others a weak
+// ETag hashed from the body
+type Definition[T any] struct {
+	// Name is the plural route segment, e.g. widgets
+	Name string
+	// Collection defaults to Name
+	Collection string
+	// Indexes are unique indexes created at startup
+	Indexes []string
+	// Validate runs after the `validate` struct tags, it may be nil
+	Validate    func(ctx context.Context, data *T) error
+	Permissions Permissions
+	Hooks       Hooks[T]
+	// Audit records every mutation in the audit log
+	Audit bool
+}
+
+// Dependencies Are shared by every mounted resource
+type Dependencies struct {
+	Repository datastore.Repository
+	Auditor    audit.Auditor
+	Utils      utils.Utils
+}
+
+// Registration Is a type erased resource the router can mount
+type Registration interface {
+	Name() string
+	Collection() string
+	Indexes() []string
+	Mount(r fiber.Router, deps Dependencies)
+	Describe() Description
+	Operations() openapi.Operations
+}
+
+type registration[T any] struct {
+	def Definition[T]
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// New Will turn a definition into a mountable resource
+func New[T any](def Definition[T]) Registration {
+	if len(def.Name) == 0 {
+		panic("resource: Name is required")
+	}
+	if reflect.TypeOf((*T)(nil)).Elem().Kind() != reflect.Struct {
+		panic("resource: " + def.Name + " must be a struct type")
+	}
+	if len(def.Collection) == 0 {
+		def.Collection = def.Name
+	}
+	return &registration[T]{def: def}
+}
+
+/*
+* PUBLIC
+ */
+
+func (r *registration[T]) Name() string {
+	return r.def.Name
+}
+
+func (r *registration[T]) Collection() string {
+	return r.def.Collection
+}
+
+func (r *registration[T]) Indexes() []string {
+	return r.def.Indexes
+}
+
+// Mount Will register the CRUD routes under /<Name>
+func (r *registration[T]) Mount(router fiber.Router, deps Dependencies) {
+	if deps.Utils == nil {
+		deps.Utils = utils.NewUtils()
+	}
+	s := newService(&r.def, deps)
+	c := newController(&r.def, s)
+
+	group := router.Group("/" + r.def.Name)
+	group.Get("/", c.List)
+	group.Post("/", c.Create)
+	group.Get("/:id", c.Get)
+	group.Patch("/:id", c.Patch)
+	group.Put("/:id", c.Replace)
+	group.Delete("/:id", c.Delete)
+}
+
+// EnsureIndexes Will create the unique indexes of every resource
+func EnsureIndexes(ds datastore.Repository, regs []Registration) {
+	for _, reg := range regs {
+		if len(reg.Indexes()) != 0 {
+			ds.EnsureIndexes(reg.Collection(), reg.Indexes())
+		}
+	}
+}
+
+// Authenticated Allows any caller with an actor attached to the request
+func Authenticated() Permission {
+	return func(ctx context.Context) error {
+		if utils.Actor(ctx) == utils.AnonymousActor {
+			return apperrors.Unauthorized("Authentication required")
+		}
+		return nil
+	}
+}
+
+// Actors Allows only the listed actors
+func Actors(actors ...string) Permission {
+	allowed := map[string]bool{}
+	for _, a := range actors {
+		allowed[a] = true
+	}
+	return func(ctx context.Context) error {
+		actor := utils.Actor(ctx)
+		if actor == utils.AnonymousActor {
+			return apperrors.Unauthorized("Authentication required")
+		}
+		if !allowed[actor] {
+			return apperrors.Forbidden("You are not allowed to perform this operation")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+package resource_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resource"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resource/resourcetest"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+type Widget struct {
+	ID    string `json:"id,omitempty" bson:"_id,omitempty"`
+	Label string `json:"label" bson:"label,omitempty" validate:"required"`
+	Size  int    `json:"size" bson:"size,omitempty" validate:"gte=0"`
+}
+
+/*
+	TESTS
+*/
+
+func TestResourceCRUD(t *testing.T) {
+	reg := resource.New(resource.Definition[Widget]{Name: "widgets"})
+	deps := resource.Dependencies{Repository: datastore.NewMemoryDatastore(), Utils: utils.NewUtils()}
+
+	resourcetest.Run(t, reg, deps, Widget{Label: "gear", Size: 3}, Widget{Size: -1})
+}
+
+func TestResourceDescribe(t *testing.T) {
+	reg := resource.New(resource.Definition[Widget]{Name: "widgets"})
+	d := reg.Describe()
+
+	if _, ok := d.Paths["/v2/widgets/{id}"]; !ok {
+		t.Fatal("missing item path")
+	}
+	def, ok := d.Definitions["resource_test.Widget"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing definition, got %v", d.Definitions)
+	}
+	if !reflect.DeepEqual(def["required"], []string{"label"}) {
+		t.Fatalf("unexpected required fields %v", def["required"])
+	}
+}
@@ -0,0 +1,95 @@
+package resourcetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resource"
+)
+
+// Run Will exercise every CRUD route of a resource through the HTTP stack.
+// valid must pass validation and invalid must fail it
+func Run[T any](t *testing.T, reg resource.Registration, deps resource.Dependencies, valid T, invalid T) {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	reg.Mount(app.Group("/api/v2"), deps)
+	base := "/api/v2/" + reg.Name()
+
+	do := func(method string, route string, payload interface{}) (*http.Response, []byte) {
+		var body bytes.Buffer
+		if payload != nil {
+			_ = json.NewEncoder(&body).Encode(payload)
+		}
+		req, _ := http.NewRequest(method, route, &body)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := app.Test(req, -1)
+		if !assert.Nil(t, err, method+" "+route) {
+			t.FailNow()
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		return res, b
+	}
+
+	// Create
+	res, _ := do("POST", base, invalid)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode, "[Create] Invalid")
+
+	res, body := do("POST", base, valid)
+	if !assert.Equal(t, fiber.StatusCreated, res.StatusCode, "[Create] Success: %s", body) {
+		t.FailNow()
+	}
+	location := res.Header.Get(fiber.HeaderLocation)
+	assert.NotEmpty(t, location, "[Create] Location")
+
+	// Read
+	res, _ = do("GET", location, nil)
+	assert.Equal(t, fiber.StatusOK, res.StatusCode, "[Get] Success")
+	etag := res.Header.Get(fiber.HeaderETag)
+	assert.NotEmpty(t, etag, "[Get] ETag")
+
+	req, _ := http.NewRequest("GET", location, nil)
+	req.Header.Set(fiber.HeaderIfNoneMatch, etag)
+	res, err := app.Test(req, -1)
+	if assert.Nil(t, err, "[Get] Conditional") {
+		b, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(t, fiber.StatusNotModified, res.StatusCode, "[Get] Not modified")
+		assert.Empty(t, b, "[Get] Not modified body")
+	}
+
+	res, body = do("GET", base+"?page=1&limit=10", nil)
+	assert.Equal(t, fiber.StatusOK, res.StatusCode, "[List] Success")
+	var list struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	_ = json.Unmarshal(body, &list)
+	assert.Len(t, list.Data, 1, "[List] Contains created entry")
+
+	res, _ = do("GET", base+"/nothex", nil)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode, "[Get] Invalid ID")
+
+	// Update
+	res, _ = do("PATCH", location, valid)
+	assert.Equal(t, fiber.StatusNoContent, res.StatusCode, "[Patch] Success")
+
+	res, _ = do("PUT", location, invalid)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode, "[Replace] Invalid")
+
+	res, _ = do("PUT", location, valid)
+	assert.Equal(t, fiber.StatusNoContent, res.StatusCode, "[Replace] Success")
+
+	// Delete
+	res, _ = do("DELETE", location, nil)
+	assert.Equal(t, fiber.StatusNoContent, res.StatusCode, "[Delete] Success")
+
+	res, _ = do("GET", location, nil)
+	assert.Equal(t, fiber.StatusNotFound, res.StatusCode, "[Get] Deleted")
+
+	res, _ = do("DELETE", location, nil)
+	assert.Equal(t, fiber.StatusNotFound, res.StatusCode, "[Delete] Deleted")
+}
@@ -0,0 +1,265 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
+)
+
+type service[T any] struct {
+	def  *Definition[T]
+	deps Dependencies
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func newService[T any](def *Definition[T], deps Dependencies) *service[T] {
+	return &service[T]{def: def, deps: deps}
+}
+
+/*
+* PRIVATE
+ */
+
+func (s *service[T]) parseID(id string) (datastore.ID, error) {
+	if !datastore.ValidID(id) {
+		return "", apperrors.InvalidArgument(apperrors.CodeInvalidID, "ID must be a 24 character hex string")
+	}
+	return datastore.ID(id), nil
+}
+
+// wrap maps datastore errors to domain errors naming this resource
+func (s *service[T]) wrap(err error) error {
+	err = s.deps.Utils.ErrorWrapper(err)
+	switch apperrors.KindOf(err) {
+	case apperrors.KindNotFound:
+		return s.notFound()
+	case apperrors.KindConflict:
+		return apperrors.Conflict(apperrors.CodeResourceAlreadyExists, fmt.Sprintf("%s already exists", s.def.Name))
+	}
+	return err
+}
+
+// named words validation errors after the resource rather than its Go type
+func (s *service[T]) named(err error) error {
+	if e, ok := apperrors.As(err); ok && e.Kind == apperrors.KindValidation {
+		return apperrors.Validation(fmt.Sprintf("%s failed validation", s.def.Name), e.Fields)
+	}
+	return err
+}
+
+func (s *service[T]) notFound() error {
+	return apperrors.NotFound(apperrors.CodeResourceNotFound, fmt.Sprintf("%s not found", s.def.Name))
+}
+
+func (s *service[T]) find(ctx context.Context, objectId datastore.ID) (*T, error) {
+	query := datastore.Query{
+		Where: datastore.M{"_id": objectId},
+		From:  s.def.Collection,
+	}
+
+	res := []T{}
+	err := s.deps.Repository.FindInto(ctx, query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return &res[0], nil
+}
+
+// clearID drops any client supplied _id so the datastore assigns it and updates never touch it
+func clearID(data interface{}) {
+	v := reflect.ValueOf(data).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("bson")
+		if tag == "_id" || strings.HasPrefix(tag, "_id,") {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+	}
+}
+
+func (s *service[T]) record(ctx context.Context, op string, id string, before interface{}, after interface{}) {
+	if !s.def.Audit || s.deps.Auditor == nil {
+		return
+	}
+	err := s.deps.Auditor.Record(ctx, op, s.def.Collection, id, before, after)
+	if err != nil {
+		logging.FromContext(ctx).WithField("operation", op).Error(err)
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+// Validate Runs the struct tags and the custom validator of the definition
+func (s *service[T]) Validate(ctx context.Context, data *T) error {
+	if err := s.named(validation.Default().Struct(ctx, data)); err != nil {
+		return err
+	}
+	if s.def.Validate != nil {
+		return s.def.Validate(ctx, data)
+	}
+	return nil
+}
+
+// ValidatePartial Runs the struct tags of the fields a patch sets, the custom validator of the
+// definition expects a whole resource so it is left to create and replace
+func (s *service[T]) ValidatePartial(ctx context.Context, data *T) error {
+	return s.named(validation.Default().Partial(ctx, data))
+}
+
+func (s *service[T]) List(ctx context.Context, page int, limit int) ([]T, error) {
+	query := datastore.Query{From: s.def.Collection}
+	pOpts := &datastore.Pagination{
+		Page:  page,
+		Limit: limit,
+		Sort:  []string{"_id"},
+	}
+
+	res := []T{}
+	err := s.deps.Repository.FindInto(ctx, query, pOpts, &res)
+	return res, err
+}
+
+func (s *service[T]) Get(ctx context.Context, id string) (*T, error) {
+	objectId, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.find(ctx, objectId)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, s.notFound()
+	}
+	return res, nil
+}
+
+func (s *service[T]) Create(ctx context.Context, data *T) (string, error) {
+	clearID(data)
+	if h := s.def.Hooks.BeforeCreate; h != nil {
+		if err := h(ctx, data); err != nil {
+			return "", err
+		}
+	}
+
+	res, err := s.deps.Repository.Insert(ctx, datastore.Query{From: s.def.Collection}, data)
+	if err != nil {
+		return "", s.wrap(err)
+	}
+
+	// The insert result is backend specific, its JSON form always carries the ID
+	var payload struct {
+		InsertedID string
+	}
+	b, err := json.Marshal(res)
+	if err == nil {
+		err = json.Unmarshal(b, &payload)
+	}
+	if err != nil {
+		return "", apperrors.Internal(err)
+	}
+	id := payload.InsertedID
+
+	s.record(ctx, audit.OperationCreate, id, nil, data)
+	if h := s.def.Hooks.AfterCreate; h != nil {
+		if err := h(ctx, id, data); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+func (s *service[T]) Update(ctx context.Context, id string, data *T) error {
+	objectId, err := s.parseID(id)
+	if err != nil {
+		return err
+	}
+
+	clearID(data)
+	if h := s.def.Hooks.BeforeUpdate; h != nil {
+		if err := h(ctx, id, data); err != nil {
+			return err
+		}
+	}
+
+	before, err := s.find(ctx, objectId)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return s.notFound()
+	}
+
+	query := datastore.Query{
+		Where: datastore.M{"_id": objectId},
+		From:  s.def.Collection,
+	}
+	_, err = s.deps.Repository.Update(ctx, query, datastore.M{"$set": data})
+	if err != nil {
+		return s.wrap(err)
+	}
+
+	after, err := s.find(ctx, objectId)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, audit.OperationUpdate, id, before, after)
+
+	if h := s.def.Hooks.AfterUpdate; h != nil {
+		return h(ctx, id, after)
+	}
+	return nil
+}
+
+func (s *service[T]) Delete(ctx context.Context, id string) error {
+	objectId, err := s.parseID(id)
+	if err != nil {
+		return err
+	}
+
+	if h := s.def.Hooks.BeforeDelete; h != nil {
+		if err := h(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	before, err := s.find(ctx, objectId)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return s.notFound()
+	}
+
+	query := datastore.Query{
+		Where: datastore.M{"_id": objectId},
+		From:  s.def.Collection,
+	}
+	_, err = s.deps.Repository.Delete(ctx, query)
+	if err != nil {
+		return s.wrap(err)
+	}
+	s.record(ctx, audit.OperationDelete, id, before, nil)
+
+	if h := s.def.Hooks.AfterDelete; h != nil {
+		return h(ctx, id)
+	}
+	return nil
+}
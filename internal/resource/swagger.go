@@ -0,0 +1,216 @@
+package resource
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/swaggo/swag"
+)
+
+// Description Is the swagger fragment of a resource, merged into the generated docs at runtime
+type Description struct {
+	Paths       map[string]interface{}
+	Definitions map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+/*
+* PRIVATE
+ */
+
+// schema Builds a swagger 2.0 schema from a Go type using its json tags
+func schema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schema(t.Elem(), defs)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schema(t.Elem(), defs)}
+	case t.Kind() == reflect.Struct:
+		name := definitionName(t)
+		if _, ok := defs[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			defs[name] = map[string]interface{}{}
+			defs[name] = object(t, defs)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	}
+	return map[string]interface{}{"type": "object"}
+}
+
+func object(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		prop := schema(f.Type, defs)
+		if example, ok := f.Tag.Lookup("example"); ok {
+			prop["example"] = example
+		}
+		props[name] = prop
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				required = append(required, name)
+			}
+		}
+	}
+
+	o := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) != 0 {
+		o["required"] = required
+	}
+	return o
+}
+
+func definitionName(t reflect.Type) string {
+	return strings.ReplaceAll(t.String(), "*", "")
+}
+
+func operation(tag string, summary string, params []interface{}, responses map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"tags":       []string{tag},
+		"summary":    summary,
+		"consumes":   []string{"application/json", "application/msgpack", "application/cbor", "application/xml"},
+		"produces":   []string{"application/json", "application/msgpack", "application/cbor", "application/xml"},
+		"parameters": params,
+		"responses":  responses,
+	}
+}
+
+func problemResponse(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"schema":      map[string]interface{}{"$ref": "#/definitions/problem.Problem"},
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+// Describe Will build the swagger paths and definitions of the resource
+func (r *registration[T]) Describe() Description {
+	defs := map[string]interface{}{}
+	ref := schema(reflect.TypeOf((*T)(nil)).Elem(), defs)
+	envelope := func(data map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"message": map[string]interface{}{"type": "string"},
+				"data":    data,
+			},
+		}
+	}
+
+	tag := r.def.Name
+	id := map[string]interface{}{"name": "id", "in": "path", "required": true, "type": "string"}
+	body := map[string]interface{}{"name": "body", "in": "body", "required": true, "schema": ref}
+	page := map[string]interface{}{"name": "page", "in": "query", "type": "integer"}
+	limit := map[string]interface{}{"name": "limit", "in": "query", "type": "integer"}
+	ifNoneMatch := map[string]interface{}{"name": "If-None-Match", "in": "header", "type": "string"}
+	ifModifiedSince := map[string]interface{}{"name": "If-Modified-Since", "in": "header", "type": "string"}
+	noContent := map[string]interface{}{"description": "No Content"}
+	notModified := map[string]interface{}{"description": "Not Modified"}
+
+	base := "/v2/" + r.def.Name
+	return Description{
+		Definitions: defs,
+		Paths: map[string]interface{}{
+			base: map[string]interface{}{
+				"get": operation(tag, "Lists "+r.def.Name, []interface{}{page, limit, ifNoneMatch}, map[string]interface{}{
+					"200": map[string]interface{}{"description": "OK", "schema": envelope(map[string]interface{}{"type": "array", "items": ref})},
+					"304": notModified,
+					"400": problemResponse("Bad Request"),
+				}),
+				"post": operation(tag, "Creates a "+r.def.Name+" entry", []interface{}{body}, map[string]interface{}{
+					"201": map[string]interface{}{"description": "Created", "schema": envelope(map[string]interface{}{"$ref": "#/definitions/models.CreateResponse"})},
+					"400": problemResponse("Bad Request"),
+					"409": problemResponse("Conflict"),
+				}),
+			},
+			base + "/{id}": map[string]interface{}{
+				"get": operation(tag, "Gets a "+r.def.Name+" entry", []interface{}{id, ifNoneMatch, ifModifiedSince}, map[string]interface{}{
+					"200": map[string]interface{}{"description": "OK", "schema": envelope(ref)},
+					"304": notModified,
+					"404": problemResponse("Not Found"),
+				}),
+				"patch": operation(tag, "Partially updates a "+r.def.Name+" entry", []interface{}{id, body}, map[string]interface{}{
+					"204": noContent,
+					"404": problemResponse("Not Found"),
+				}),
+				"put": operation(tag, "Replaces a "+r.def.Name+" entry", []interface{}{id, body}, map[string]interface{}{
+					"204": noContent,
+					"400": problemResponse("Bad Request"),
+					"404": problemResponse("Not Found"),
+				}),
+				"delete": operation(tag, "Deletes a "+r.def.Name+" entry", []interface{}{id}, map[string]interface{}{
+					"204": noContent,
+					"404": problemResponse("Not Found"),
+				}),
+			},
+		},
+	}
+}
+
+// SwaggerHandler Serves the generated swagger docs merged with every registered resource
+func SwaggerHandler(regs []Registration) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		raw, err := swag.ReadDoc()
+		if err != nil {
+			return err
+		}
+
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+			return err
+		}
+		paths, _ := doc["paths"].(map[string]interface{})
+		if paths == nil {
+			paths = map[string]interface{}{}
+		}
+		defs, _ := doc["definitions"].(map[string]interface{})
+		if defs == nil {
+			defs = map[string]interface{}{}
+		}
+
+		for _, reg := range regs {
+			d := reg.Describe()
+			for k, v := range d.Paths {
+				paths[k] = v
+			}
+			for k, v := range d.Definitions {
+				defs[k] = v
+			}
+		}
+		doc["paths"] = paths
+		doc["definitions"] = defs
+
+		return ctx.JSON(doc)
+	}
+}
@@ -0,0 +1,28 @@
+package resources
+
+import (
+	"github.com/sizzlorox/go-service-boilerplate/internal/resource"
+)
+
+// All Are the declarative CRUD resources mounted under /api/v2/<name>.
+// Add a resource by declaring its type and definition, e.g.
+//
+//	type Widget struct {
+//		ID    string `json:"id,omitempty" bson:"_id,omitempty"`
+//		Label string `json:"label" bson:"label,omitempty" validate:"required"`
+//	}
+//
+//	var All = []resource.Registration{
+//		resource.New(resource.Definition[Widget]{
+//			Name:    "widgets",
+//			Indexes: []string{"label"},
+//			Audit:   true,
+//			Permissions: resource.Permissions{
+//				Create: resource.Authenticated(),
+//				Delete: resource.Actors("admin"),
+//			},
+//		}),
+//	}
+//
+// Indexes, routes and swagger docs are wired from this list at startup.
+var All = []resource.Registration{}
@@ -0,0 +1,197 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/gql"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resource"
+	"github.com/sizzlorox/go-service-boilerplate/internal/resources"
+	"github.com/sizzlorox/go-service-boilerplate/internal/scheduler"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	v1router "github.com/sizzlorox/go-service-boilerplate/internal/v1/router"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	v2router "github.com/sizzlorox/go-service-boilerplate/internal/v2/router"
+	// scaffold:imports
+)
+
+// Version Is an API version mounted under /api/<Name>
+type Version struct {
+	Name string
+	// Deprecated versions answer with Deprecation, Sunset and Link headers, a zero DeprecatedAt
+	// or Sunset leaves its header out
+	Deprecated   bool
+	DeprecatedAt time.Time
+	Sunset       time.Time
+	Successor    string
+	// Exempt are the paths under the version that its deprecation does not cover, such as the
+	// admin API mounted beside it
+	Exempt []string
+	Load   func(r fiber.Router, s services.Service)
+	// Operations describe the routes of Load for the OpenAPI spec
+	Operations func() openapi.Operations
+}
+
+// Config Is the router config
+type Config struct {
+	// V1DeprecatedAt is when v1 was deprecated and V1Sunset when it stops being served, zero
+	// leaves them unannounced
+	V1DeprecatedAt time.Time
+	V1Sunset       time.Time
+	Models         services.Config
+	GraphQL        gql.Config
+}
+
+// Versions Returns every API version in the order they are mounted
+func Versions(config *Config) []Version {
+	return []Version{
+		{
+			Name:         "v1",
+			Deprecated:   true,
+			DeprecatedAt: config.V1DeprecatedAt,
+			Sunset:       config.V1Sunset,
+			Successor:    "v2",
+			Exempt:       []string{"/admin"},
+			Load:         v1router.LoadRoutes,
+			Operations:   v1router.Operations,
+		},
+		{
+			Name:       "v2",
+			Load:       v2router.LoadRoutes,
+			Operations: v2router.Operations,
+		},
+	}
+}
+
+/*
+* PRIVATE
+ */
+
+// deprecation announces a deprecated version, see RFC 9745 and RFC 8594
+func deprecation(v Version) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		// The route of a middleware is the prefix it was mounted on
+		for _, path := range v.Exempt {
+			if strings.HasPrefix(ctx.Path(), ctx.Route().Path+path) {
+				return ctx.Next()
+			}
+		}
+
+		if !v.DeprecatedAt.IsZero() {
+			ctx.Set("Deprecation", "@"+strconv.FormatInt(v.DeprecatedAt.Unix(), 10))
+		}
+		if !v.Sunset.IsZero() {
+			ctx.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if len(v.Successor) != 0 {
+			ctx.Append(fiber.HeaderLink, fmt.Sprintf("</api/%s>; rel=\"successor-version\"", v.Successor))
+		}
+		return ctx.Next()
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+// LoadRoutes Will mount every API version, all versions share the same services. Large model
+// imports are enqueued on q and run by pool. The models Service is returned for other transports
+func LoadRoutes(api fiber.Router, ds datastore.Repository, q jobs.Queue, pool jobs.Pool, config *Config) services.Service {
+	// Initialize Utils
+	u := utils.NewUtils()
+	a := audit.NewAuditor(ds)
+
+	// Initialize Service
+	s := services.NewTracedService(services.NewService(ds, u, a, q, &config.Models))
+	services.HandleImports(pool, s)
+
+	for _, v := range Versions(config) {
+		group := api.Group("/" + v.Name)
+		if v.Deprecated {
+			group.Use(deprecation(v))
+		}
+		v.Load(group, s)
+	}
+
+	// GraphQL is unversioned, its schema evolves by adding fields
+	graphql := gql.Handler(s, &config.GraphQL)
+	api.Get("/graphql", graphql)
+	api.Post("/graphql", graphql)
+
+	// Declarative resources live beside the models routes in v2
+	deps := resource.Dependencies{Repository: ds, Auditor: a, Utils: u}
+	v2 := api.Group("/v2")
+	for _, reg := range resources.All {
+		reg.Mount(v2, deps)
+	}
+
+	// Resources generated by cmd/scaffold are registered here
+	// scaffold:routes
+
+	return s
+}
+
+// LoadAdminRoutes registers the admin API, admin must already be guarded by authentication
+func LoadAdminRoutes(admin fiber.Router, ds datastore.Repository, q jobs.Queue, s scheduler.Scheduler) {
+	v1router.LoadAdminRoutes(admin, audit.NewAuditor(ds), ds, q, s)
+}
+
+// Operations Describes the routes of LoadRoutes for the OpenAPI spec, keyed by their path under
+// the API
+func Operations(config *Config) openapi.Operations {
+	ops := openapi.Operations{}
+	for _, v := range Versions(config) {
+		ops.Merge(v.Operations().Prefix("/" + v.Name))
+	}
+
+	// GraphQL answers its own errors in a GraphQL response rather than a problem
+	result := func(description string) openapi.Body {
+		return openapi.Body{Description: description, Value: gql.Response{}, ContentTypes: []string{fiber.MIMEApplicationJSON}}
+	}
+	tags := []string{"GraphQL"}
+	ops.Merge(openapi.Operations{
+		"GET /graphql": {
+			Summary: "Runs a GraphQL query",
+			Tags:    tags,
+			Params: []openapi.Param{
+				{Name: "query", In: "query", Description: "GraphQL query, it is required"},
+				{Name: "operationName", In: "query"},
+				{Name: "variables", In: "query", Description: "JSON object"},
+			},
+			Responses: map[int]openapi.Body{
+				fiber.StatusOK:               result("Result"),
+				fiber.StatusBadRequest:       result("Invalid or too complex query"),
+				fiber.StatusMethodNotAllowed: result("Mutations must be sent with POST"),
+			},
+		},
+		"POST /graphql": {
+			Summary: "Runs a GraphQL query or mutation",
+			Tags:    tags,
+			Body:    &openapi.Body{Description: "Request", Value: gql.Request{}, ContentTypes: []string{fiber.MIMEApplicationJSON}},
+			Responses: map[int]openapi.Body{
+				fiber.StatusOK:         result("Result"),
+				fiber.StatusBadRequest: result("Invalid or too complex query"),
+			},
+		},
+	})
+
+	for _, reg := range resources.All {
+		ops.Merge(reg.Operations().Prefix("/v2"))
+	}
+	return ops
+}
+
+// AdminOperations Describes the routes of LoadAdminRoutes for the OpenAPI spec, keyed by their path
+// under the API
+func AdminOperations() openapi.Operations {
+	return v1router.AdminOperations().Prefix("/v1/admin")
+}
@@ -0,0 +1,379 @@
+package router_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/router"
+	"github.com/sizzlorox/go-service-boilerplate/internal/scheduler"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+)
+
+// newApp Mounts every route like cmd/api does, behind the spec validation of requests and responses
+func newApp() (*fiber.App, openapi.Spec) {
+	r := datastore.NewMemoryDatastore()
+	r.EnsureIndexes("models", []string{"email"})
+	jobsConfig := &jobs.Config{Workers: 1, PollInterval: time.Second, Lease: time.Second, MaxAttempts: 1}
+	q := jobs.NewQueue(r, jobsConfig)
+	config := &router.Config{Models: services.Config{ImportBatchSize: 2, ImportSyncRows: 100}}
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	spec := openapi.NewSpec(app, &openapi.Config{
+		Title:      "test",
+		Version:    "1.0",
+		Base:       "/api",
+		Operations: router.Operations(config).Merge(router.AdminOperations()),
+	})
+	api := app.Group("/api")
+	api.Use(openapi.Middleware(spec, openapi.MiddlewareConfig{Responses: true}))
+	router.LoadRoutes(api, r, q, jobs.NewPool(r, jobsConfig), config)
+	router.LoadAdminRoutes(api.Group("/v1/admin"), r, q, scheduler.NewScheduler(r, &scheduler.Config{}))
+	return app, spec
+}
+
+func send(t *testing.T, app *fiber.App, method string, path string, contentType string, body string) (int, string) {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if len(contentType) != 0 {
+		req.Header.Set(fiber.HeaderContentType, contentType)
+	}
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+/*
+	TESTS
+*/
+
+func TestSpecCoversRoutes(t *testing.T) {
+	_, spec := newApp()
+	assert.Empty(t, spec.Undocumented(), "routes without an operation in router.Operations")
+	assert.Empty(t, spec.Unregistered(), "operations without a registered route")
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	app, _ := newApp()
+
+	status, body := send(t, app, fiber.MethodPost, "/api/v2/models", fiber.MIMEApplicationJSON, `{"name":"Bob","email":"bob@bob.com"}`)
+	require.Equal(t, fiber.StatusCreated, status, body)
+	var created struct {
+		Data struct {
+			InsertedID string `json:"insertedId"`
+		} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(body), &created))
+	id := created.Data.InsertedID
+	missing := "5ff3fc0e00acd4328da25d92"
+	graphql := url.Values{"query": {"{ models(limit: 10) { id name } }"}}.Encode()
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"v2 list", fiber.MethodGet, "/api/v2/models?page=1&limit=10", "", "", fiber.StatusOK},
+		{"v2 get", fiber.MethodGet, "/api/v2/models/" + id, "", "", fiber.StatusOK},
+		{"v2 get missing", fiber.MethodGet, "/api/v2/models/" + missing, "", "", fiber.StatusNotFound},
+		{"v2 create invalid", fiber.MethodPost, "/api/v2/models", fiber.MIMEApplicationJSON, `{"name":"Bob"}`, fiber.StatusBadRequest},
+		{"v2 create taken email", fiber.MethodPost, "/api/v2/models", fiber.MIMEApplicationJSON, `{"name":"Bobby","email":"bob@bob.com"}`, fiber.StatusConflict},
+		{"v2 patch invalid", fiber.MethodPatch, "/api/v2/models/" + id, fiber.MIMEApplicationJSON, `{"email":"bob"}`, fiber.StatusBadRequest},
+		{"v2 patch", fiber.MethodPatch, "/api/v2/models/" + id, fiber.MIMEApplicationJSON, `{"name":"Robert"}`, fiber.StatusOK},
+		{"v2 replace", fiber.MethodPut, "/api/v2/models/" + id, fiber.MIMEApplicationJSON, `{"name":"Rob","email":"bob@bob.com"}`, fiber.StatusOK},
+		{"v2 history", fiber.MethodGet, "/api/v2/models/" + id + "/history", "", "", fiber.StatusOK},
+		{"v1 list", fiber.MethodGet, "/api/v1/?page=1", "", "", fiber.StatusOK},
+		{"v1 list without page", fiber.MethodGet, "/api/v1/", "", "", fiber.StatusBadRequest},
+		{"v1 get", fiber.MethodGet, "/api/v1/" + id, "", "", fiber.StatusOK},
+		{"v1 create", fiber.MethodPut, "/api/v1/create", fiber.MIMEApplicationJSON, `{"name":"Alice","email":"alice@alice.com"}`, fiber.StatusCreated},
+		{"v1 update", fiber.MethodPost, "/api/v1/" + id + "/update", fiber.MIMEApplicationJSON, `{"name":"Bobby"}`, fiber.StatusOK},
+		{"v1 history", fiber.MethodGet, "/api/v1/" + id + "/history", "", "", fiber.StatusOK},
+		{"v1 export", fiber.MethodGet, "/api/v1/export?format=csv", "", "", fiber.StatusOK},
+		{"v1 export format", fiber.MethodGet, "/api/v1/export?format=xlsx", "", "", fiber.StatusBadRequest},
+		{"v1 import", fiber.MethodPost, "/api/v1/import", "text/csv", "name,email\nCarol,carol@carol.com\n", fiber.StatusOK},
+		{"v1 import missing", fiber.MethodGet, "/api/v1/import/" + missing, "", "", fiber.StatusNotFound},
+		{"graphql get", fiber.MethodGet, "/api/graphql?" + graphql, "", "", fiber.StatusOK},
+		{"graphql post", fiber.MethodPost, "/api/graphql", fiber.MIMEApplicationJSON, `{"query":"{ models(limit: 10) { id } }"}`, fiber.StatusOK},
+		{"admin audit", fiber.MethodGet, "/api/v1/admin/audit", "", "", fiber.StatusOK},
+		{"admin jobs", fiber.MethodGet, "/api/v1/admin/jobs?status=dead", "", "", fiber.StatusOK},
+		{"admin job missing", fiber.MethodGet, "/api/v1/admin/jobs/" + missing, "", "", fiber.StatusNotFound},
+		{"admin task runs", fiber.MethodGet, "/api/v1/admin/tasks/models.purge/runs", "", "", fiber.StatusNotFound},
+		{"v1 delete", fiber.MethodDelete, "/api/v1/" + id + "/delete", "", "", fiber.StatusOK},
+		{"v2 delete missing", fiber.MethodDelete, "/api/v2/models/" + id, "", "", fiber.StatusNotFound},
+	}
+	for _, test := range tests {
+		status, body := send(t, app, test.method, test.path, test.contentType, test.body)
+		assert.Equal(t, test.status, status, test.description+": "+body)
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	app, _ := newApp()
+	req, _ := http.NewRequest(fiber.MethodPost, "/api/v2/models", strings.NewReader(`{"name":"Bob","email":"bob"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAcceptLanguage, "fr-FR,fr;q=0.9")
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "fr", res.Header.Get(fiber.HeaderContentLanguage))
+	assert.Contains(t, string(body), `"field":"email","rule":"email","message":"email doit être une adresse e-mail valide"`)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	r := datastore.NewTenantRepository(datastore.NewMemoryDatastore(), &datastore.TenancyConfig{})
+	r.EnsureIndexes("models", []string{"email"})
+	jobsConfig := &jobs.Config{Workers: 1, PollInterval: time.Second, Lease: time.Second, MaxAttempts: 1}
+	config := &router.Config{Models: services.Config{ImportBatchSize: 2, ImportSyncRows: 100}}
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	api := app.Group("/api")
+	api.Use(tenancy.Middleware(tenancy.NewResolver(&tenancy.Config{Sources: []string{tenancy.SourceHeader}})))
+	router.LoadRoutes(api, r, jobs.NewQueue(r, jobsConfig), jobs.NewPool(r, jobsConfig), config)
+
+	as := func(tenant string, method string, path string, body string) (int, string) {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if len(tenant) != 0 {
+			req.Header.Set(tenancy.DefaultHeader, tenant)
+		}
+		res, err := app.Test(req, -1)
+		require.Nil(t, err)
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	status, body := as("acme", fiber.MethodPost, "/api/v2/models", `{"name":"Bob","email":"bob@bob.com"}`)
+	require.Equal(t, fiber.StatusCreated, status, body)
+	var created struct {
+		Data struct {
+			InsertedID string `json:"insertedId"`
+		} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(body), &created))
+	model := "/api/v2/models/" + created.Data.InsertedID
+
+	status, _ = as("acme", fiber.MethodGet, model, "")
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = as("globex", fiber.MethodGet, model, "")
+	assert.Equal(t, fiber.StatusNotFound, status, "another tenant cannot read the model")
+	_, body = as("globex", fiber.MethodGet, "/api/v2/models?page=1&limit=10", "")
+	assert.NotContains(t, body, "bob@bob.com")
+	status, _ = as("globex", fiber.MethodPatch, model, `{"name":"Eve"}`)
+	assert.Equal(t, fiber.StatusNotFound, status, "another tenant cannot update the model")
+	status, _ = as("globex", fiber.MethodDelete, model, "")
+	assert.Equal(t, fiber.StatusNotFound, status, "another tenant cannot delete the model")
+	status, body = as("globex", fiber.MethodPost, "/api/v2/models", `{"name":"Bob","email":"bob@bob.com"}`)
+	assert.Equal(t, fiber.StatusCreated, status, "emails are unique per tenant: "+body)
+	status, _ = as("", fiber.MethodGet, model, "")
+	assert.Equal(t, fiber.StatusBadRequest, status, "requests need a tenant")
+}
+
+func TestV2ReplaceAndPatch(t *testing.T) {
+	app, _ := newApp()
+	list := "/api/v2/models?page=1&limit=10"
+
+	status, body := send(t, app, fiber.MethodPost, "/api/v2/models", fiber.MIMEApplicationJSON, `{"name":"Bob","email":"bob@bob.com"}`)
+	require.Equal(t, fiber.StatusCreated, status, body)
+	var created struct {
+		Data struct {
+			InsertedID string `json:"insertedId"`
+		} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(body), &created))
+	model := "/api/v2/models/" + created.Data.InsertedID
+	_, body = send(t, app, fiber.MethodGet, list, "", "")
+	var before struct {
+		Data []struct {
+			CreatedAt string `json:"createdAt"`
+		} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(body), &before))
+	require.Len(t, before.Data, 1)
+
+	// PATCH changes the fields it is given, PUT needs the whole model
+	status, body = send(t, app, fiber.MethodPatch, model, fiber.MIMEApplicationJSON, `{"name":"Robert"}`)
+	require.Equal(t, fiber.StatusOK, status, body)
+	_, body = send(t, app, fiber.MethodGet, list, "", "")
+	assert.Contains(t, body, `"name":"Robert","email":"bob@bob.com"`)
+	status, _ = send(t, app, fiber.MethodPut, model, fiber.MIMEApplicationJSON, `{"name":"Rob"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status, "a replacement must be a complete model")
+
+	status, body = send(t, app, fiber.MethodPut, model, fiber.MIMEApplicationJSON, `{"id":"5ff3fc0e00acd4328da25d92","name":"Rob","email":"rob@bob.com","createdAt":"2000-01-01T00:00:00Z"}`)
+	require.Equal(t, fiber.StatusOK, status, body)
+	_, body = send(t, app, fiber.MethodGet, list, "", "")
+	assert.Contains(t, body, `"id":"`+created.Data.InsertedID+`","name":"Rob","email":"rob@bob.com","createdAt":"`+before.Data[0].CreatedAt+`"`, "the ID and creation time are kept")
+}
+
+func TestAdminJobsTenantIsolation(t *testing.T) {
+	// Jobs are stored unscoped like cmd/api does, so workers claim them for every tenant
+	r := datastore.NewMemoryDatastore()
+	jobsConfig := &jobs.Config{Workers: 1, PollInterval: time.Second, Lease: time.Second, MaxAttempts: 1}
+	q := jobs.NewQueue(r, jobsConfig)
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	api := app.Group("/api")
+	api.Use(tenancy.Middleware(tenancy.NewResolver(&tenancy.Config{Sources: []string{tenancy.SourceHeader}})))
+	router.LoadAdminRoutes(api.Group("/v1/admin"), datastore.NewTenantRepository(r, &datastore.TenancyConfig{}), q, scheduler.NewScheduler(r, &scheduler.Config{}))
+
+	as := func(tenant string, method string, path string) (int, string) {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set(tenancy.DefaultHeader, tenant)
+		res, err := app.Test(req, -1)
+		require.Nil(t, err)
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+
+	job, err := q.Enqueue(tenancy.WithTenant(context.Background(), "acme"), "export", nil, &jobs.Options{Delay: time.Hour})
+	require.Nil(t, err)
+	require.Equal(t, "acme", job.Tenant)
+	path := "/api/v1/admin/jobs/" + job.ID
+
+	status, body := as("acme", fiber.MethodGet, "/api/v1/admin/jobs")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Contains(t, body, job.ID)
+	_, body = as("globex", fiber.MethodGet, "/api/v1/admin/jobs")
+	assert.NotContains(t, body, job.ID, "another tenant cannot list the job")
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+	}{
+		{description: "read", method: fiber.MethodGet, path: path},
+		{description: "cancel", method: fiber.MethodPost, path: path + "/cancel"},
+		{description: "retry", method: fiber.MethodPost, path: path + "/retry"},
+	}
+	for _, test := range tests {
+		status, _ = as("globex", test.method, test.path)
+		assert.Equal(t, fiber.StatusNotFound, status, "another tenant cannot %s the job", test.description)
+	}
+
+	status, _ = as("acme", fiber.MethodPost, path+"/cancel")
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = as("acme", fiber.MethodPost, path+"/retry")
+	assert.Equal(t, fiber.StatusOK, status)
+}
+
+func TestDeprecation(t *testing.T) {
+	r := datastore.NewMemoryDatastore()
+	jobsConfig := &jobs.Config{Workers: 1, PollInterval: time.Second, Lease: time.Second, MaxAttempts: 1}
+	q := jobs.NewQueue(r, jobsConfig)
+	deprecatedAt := time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC)
+	config := &router.Config{V1DeprecatedAt: deprecatedAt, V1Sunset: sunset}
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	api := app.Group("/api")
+	router.LoadRoutes(api, r, q, jobs.NewPool(r, jobsConfig), config)
+	router.LoadAdminRoutes(api.Group("/v1/admin"), r, q, scheduler.NewScheduler(r, &scheduler.Config{}))
+
+	tests := []struct {
+		description string
+		path        string
+		deprecated  bool
+	}{
+		{description: "v1", path: "/api/v1/?page=1", deprecated: true},
+		{description: "v2", path: "/api/v2/models?page=1&limit=10"},
+		{description: "Admin API mounted under v1", path: "/api/v1/admin/audit"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(fiber.MethodGet, test.path, nil)
+		res, err := app.Test(req, -1)
+		require.Nil(t, err)
+		assert.Equal(t, fiber.StatusOK, res.StatusCode, test.description)
+		if !test.deprecated {
+			assert.Empty(t, res.Header.Get("Deprecation"), test.description)
+			assert.Empty(t, res.Header.Get("Sunset"), test.description)
+			continue
+		}
+		assert.Equal(t, "@1735776000", res.Header.Get("Deprecation"), test.description)
+		assert.Equal(t, "Fri, 02 Jan 2026 00:00:00 GMT", res.Header.Get("Sunset"), test.description)
+		assert.Equal(t, `</api/v2>; rel="successor-version"`, res.Header.Get(fiber.HeaderLink), test.description)
+	}
+}
+
+func TestV2ConditionalRequests(t *testing.T) {
+	app, _ := newApp()
+	get := func(path string, headers map[string]string) *http.Response {
+		req, _ := http.NewRequest(fiber.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := app.Test(req, -1)
+		require.Nil(t, err)
+		return res
+	}
+
+	status, body := send(t, app, fiber.MethodPost, "/api/v2/models", fiber.MIMEApplicationJSON, `{"name":"Bob","email":"bob@bob.com"}`)
+	require.Equal(t, fiber.StatusCreated, status, body)
+	var created struct {
+		Data struct {
+			InsertedID string `json:"insertedId"`
+		} `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(body), &created))
+	model := "/api/v2/models/" + created.Data.InsertedID
+	list := "/api/v2/models?page=1&limit=10"
+
+	res := get(model, nil)
+	require.Equal(t, fiber.StatusOK, res.StatusCode)
+	etag := res.Header.Get(fiber.HeaderETag)
+	require.NotEmpty(t, etag)
+	assert.False(t, strings.HasPrefix(etag, "W/"), "Models have strong ETags")
+	lastModified := res.Header.Get(fiber.HeaderLastModified)
+	require.NotEmpty(t, lastModified)
+
+	res = get(list, nil)
+	require.Equal(t, fiber.StatusOK, res.StatusCode)
+	listETag := res.Header.Get(fiber.HeaderETag)
+	assert.True(t, strings.HasPrefix(listETag, "W/"), "Lists have weak ETags")
+
+	tests := []struct {
+		description string
+		path        string
+		headers     map[string]string
+		status      int
+	}{
+		{description: "Get matching ETag", path: model, headers: map[string]string{fiber.HeaderIfNoneMatch: etag}, status: fiber.StatusNotModified},
+		{description: "Get stale ETag", path: model, headers: map[string]string{fiber.HeaderIfNoneMatch: `"stale"`}, status: fiber.StatusOK},
+		{description: "Get not modified since", path: model, headers: map[string]string{fiber.HeaderIfModifiedSince: lastModified}, status: fiber.StatusNotModified},
+		{description: "List matching ETag", path: list, headers: map[string]string{fiber.HeaderIfNoneMatch: listETag}, status: fiber.StatusNotModified},
+		{description: "List stale ETag", path: list, headers: map[string]string{fiber.HeaderIfNoneMatch: `W/"stale"`}, status: fiber.StatusOK},
+	}
+	for _, test := range tests {
+		res := get(test.path, test.headers)
+		assert.Equal(t, test.status, res.StatusCode, test.description)
+		if test.status == fiber.StatusNotModified {
+			b, _ := io.ReadAll(res.Body)
+			assert.Empty(t, b, test.description)
+		}
+	}
+
+	// Updating the model changes both validators, once past the millisecond precision of stored times
+	time.Sleep(2 * time.Millisecond)
+	status, body = send(t, app, fiber.MethodPatch, model, fiber.MIMEApplicationJSON, `{"name":"Robert"}`)
+	require.Equal(t, fiber.StatusOK, status, body)
+	res = get(model, map[string]string{fiber.HeaderIfNoneMatch: etag})
+	assert.Equal(t, fiber.StatusOK, res.StatusCode, "Get after update")
+	assert.NotEqual(t, etag, res.Header.Get(fiber.HeaderETag))
+	res = get(list, map[string]string{fiber.HeaderIfNoneMatch: listETag})
+	assert.Equal(t, fiber.StatusOK, res.StatusCode, "List after update")
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail carrying the stable error code
+const ErrorDomain = "github.com/sizzlorox/go-service-boilerplate"
+
+var codeByKind = map[apperrors.Kind]codes.Code{
+	apperrors.KindInvalidArgument: codes.InvalidArgument,
+	apperrors.KindValidation:      codes.InvalidArgument,
+	apperrors.KindUnauthorized:    codes.Unauthenticated,
+	apperrors.KindForbidden:       codes.PermissionDenied,
+	apperrors.KindNotFound:        codes.NotFound,
+	apperrors.KindConflict:        codes.AlreadyExists,
+	apperrors.KindUnavailable:     codes.Unavailable,
+	apperrors.KindInternal:        codes.Internal,
+}
+
+/*
+* PRIVATE
+ */
+
+// isServerError reports the codes logged like 5xx problems
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+/*
+* PUBLIC
+ */
+
+// Status Maps any error to a gRPC status the way problem.FromError maps it to a problem, the
+// stable code is sent as an ErrorInfo reason and failed fields as a BadRequest. Internal details
+// are never exposed
+func Status(err error) *status.Status {
+	if e, ok := apperrors.As(err); ok {
+		code := codeByKind[e.Kind]
+		message := e.Message
+		if e.Kind == apperrors.KindInternal {
+			message = "Internal Server Error"
+		}
+
+		details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: e.Code, Domain: ErrorDomain}}
+		if len(e.Fields) != 0 {
+			violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(e.Fields))
+			// gRPC has no Accept-Language, violations are described in English
+			fields, _ := validation.Localize(e.Fields, "")
+			for _, f := range fields {
+				violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message})
+			}
+			details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+		}
+
+		st := status.New(code, message)
+		if withDetails, err := st.WithDetails(details...); err == nil {
+			st = withDetails
+		}
+		return st
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, err.Error())
+	}
+	return status.New(codes.Internal, "Internal Server Error")
+}
@@ -0,0 +1,176 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// RequestIDKey is the metadata key of the request ID, the same header the HTTP API uses
+const RequestIDKey = "x-request-id"
+
+/*
+* PRIVATE
+ */
+
+// first returns the first value of a metadata key
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// contextInterceptor attaches the request ID and a request scoped logger to the context and
+// writes the access log, like logging.Middleware does for HTTP
+func contextInterceptor(config *Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		rid := first(md, RequestIDKey)
+		if len(rid) == 0 {
+			rid = uuid.NewString()
+		}
+		ctx = utils.WithRequestID(ctx, rid)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, rid))
+
+		fields := log.Fields{
+			"method":     info.FullMethod,
+			"request_id": rid,
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			fields["ip"] = p.Addr.String()
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			fields["trace_id"] = sc.TraceID().String()
+			fields["span_id"] = sc.SpanID().String()
+		}
+		entry := logging.FromContext(context.Background()).WithFields(fields)
+
+		res, err := handler(logging.WithEntry(ctx, entry), req)
+
+		if !config.AccessLog {
+			return res, err
+		}
+
+		code := status.Code(err)
+		if err == nil && rand.Float64() >= config.SampleRate {
+			return res, err
+		}
+
+		access := entry.WithFields(log.Fields{
+			"code":       code.String(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+		})
+		switch {
+		case isServerError(code):
+			access.Error("call completed")
+		case err != nil:
+			access.Warn("call completed")
+		default:
+			access.Info("call completed")
+		}
+		return res, err
+	}
+}
+
+// errorInterceptor maps the errors of every call to a gRPC status, see Status
+func errorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	res, err := handler(ctx, req)
+	if err == nil {
+		return res, nil
+	}
+
+	st := Status(err)
+	if isServerError(st.Code()) {
+		logging.FromContext(ctx).Error(err)
+	}
+	return res, st.Err()
+}
+
+// recoverInterceptor turns a panicking call into an internal error
+func recoverInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.FromContext(ctx).WithField("stack", string(debug.Stack())).Error(r)
+			err = apperrors.Internal(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// tenantInterceptor resolves the tenant of the call from its metadata like tenancy.Middleware
+// does for HTTP, health checks are not scoped to a tenant
+func tenantInterceptor(config *Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if config.Tenancy == nil || strings.HasPrefix(info.FullMethod, "/grpc.health.v1.") {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := func(key string) string {
+			return first(md, strings.ToLower(key))
+		}
+		tenant, err := config.Tenancy.Resolve(header, first(md, ":authority"))
+		if err != nil {
+			return nil, err
+		}
+
+		ctx = tenancy.WithTenant(ctx, tenant)
+		ctx = logging.WithEntry(ctx, logging.FromContext(ctx).WithField("tenant", tenant))
+		return handler(ctx, req)
+	}
+}
+
+// authInterceptor checks the basic credentials of the authorization metadata and attaches the
+// user as the actor. Calls without credentials stay anonymous, as on the HTTP models API
+func authInterceptor(config *Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth := first(md, "authorization")
+		if len(auth) == 0 || len(config.Users) == 0 {
+			return handler(ctx, req)
+		}
+
+		scheme, credentials, _ := strings.Cut(auth, " ")
+		if strings.EqualFold(scheme, "bearer") && config.Tenancy != nil {
+			// Bearer tokens name the tenant and were verified by tenantInterceptor
+			return handler(ctx, req)
+		}
+		if !strings.EqualFold(scheme, "basic") {
+			return nil, apperrors.Unauthorized("Basic credentials required")
+		}
+		raw, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return nil, apperrors.Unauthorized("Malformed credentials")
+		}
+		user, pwd, _ := strings.Cut(string(raw), ":")
+		expected, ok := config.Users[user]
+		if !ok || subtle.ConstantTimeCompare([]byte(pwd), []byte(expected)) != 1 {
+			return nil, apperrors.Unauthorized("Invalid credentials")
+		}
+
+		ctx = utils.WithActor(ctx, user)
+		ctx = logging.WithEntry(ctx, logging.FromContext(ctx).WithField("user", user))
+		return handler(ctx, req)
+	}
+}
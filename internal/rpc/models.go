@@ -0,0 +1,124 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	modelsv1 "github.com/sizzlorox/go-service-boilerplate/pkg/pb/models/v1"
+)
+
+// modelServer implements models.v1.ModelService over the same Service as the HTTP controllers,
+// requests are validated the same way
+type modelServer struct {
+	modelsv1.UnimplementedModelServiceServer
+	s services.Service
+}
+
+/*
+* PRIVATE
+ */
+
+// timestamp converts a time, zero times are left unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func toProto(m models.Model) *modelsv1.Model {
+	return &modelsv1.Model{
+		Id:         m.ID,
+		Name:       m.Name,
+		Email:      m.Email,
+		CreateTime: timestamp(m.CreatedAt),
+		UpdateTime: timestamp(m.UpdatedAt),
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+func (m *modelServer) ListModels(ctx context.Context, req *modelsv1.ListModelsRequest) (*modelsv1.ListModelsResponse, error) {
+	// Unset fields are zero in proto3, they take the defaults
+	page := "1"
+	if req.Page != 0 {
+		page = strconv.Itoa(int(req.Page))
+	}
+	limit := ""
+	if req.PageSize != 0 {
+		limit = strconv.Itoa(int(req.PageSize))
+	}
+
+	res, err := m.s.Get(ctx, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &modelsv1.ListModelsResponse{}
+	if list, ok := res.Data.(*[]models.Model); ok {
+		for _, model := range *list {
+			out.Models = append(out.Models, toProto(model))
+		}
+	}
+	return out, nil
+}
+
+func (m *modelServer) GetModel(ctx context.Context, req *modelsv1.GetModelRequest) (*modelsv1.GetModelResponse, error) {
+	res, err := m.s.GetById(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	model, ok := res.Data.(models.Model)
+	if !ok {
+		return nil, apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
+	}
+	return &modelsv1.GetModelResponse{Model: toProto(model)}, nil
+}
+
+func (m *modelServer) CreateModel(ctx context.Context, req *modelsv1.CreateModelRequest) (*modelsv1.CreateModelResponse, error) {
+	model := models.Model{Name: req.Name, Email: req.Email}
+	if err := model.Validate(); err != nil {
+		return nil, err
+	}
+
+	res, err := m.s.Create(ctx, &model)
+	if err != nil {
+		return nil, err
+	}
+	if payload, ok := res.Data.(models.CreateResponse); ok {
+		model.ID = payload.InsertedID
+	}
+	return &modelsv1.CreateModelResponse{Model: toProto(model)}, nil
+}
+
+func (m *modelServer) UpdateModel(ctx context.Context, req *modelsv1.UpdateModelRequest) (*modelsv1.UpdateModelResponse, error) {
+	model := models.Model{Name: req.Name, Email: req.Email}
+	if model.IsNil() {
+		return nil, apperrors.InvalidArgument(apperrors.CodeNoFieldsToUpdate, "You require at least one field to update")
+	}
+	if err := model.ValidatePartial(); err != nil {
+		return nil, err
+	}
+
+	_, err := m.s.Update(ctx, req.Id, &model)
+	if err != nil {
+		return nil, err
+	}
+	return &modelsv1.UpdateModelResponse{}, nil
+}
+
+func (m *modelServer) DeleteModel(ctx context.Context, req *modelsv1.DeleteModelRequest) (*modelsv1.DeleteModelResponse, error) {
+	_, err := m.s.Delete(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &modelsv1.DeleteModelResponse{}, nil
+}
@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	modelsv1 "github.com/sizzlorox/go-service-boilerplate/pkg/pb/models/v1"
+)
+
+// Server Is the gRPC API, it serves the models Service beside the HTTP API
+type Server interface {
+	// Serve Accepts connections on lis until the Server is stopped, then it returns nil
+	Serve(lis net.Listener) error
+	// Stop Waits for in-flight calls, which are cancelled once ctx is done
+	Stop(ctx context.Context) error
+}
+
+// Config Is the Server config
+type Config struct {
+	// Users are the basic credentials accepted in the authorization metadata. Calls without
+	// credentials are anonymous like on the HTTP models API, wrong credentials are rejected
+	Users map[string]string
+	// Checkers back the grpc.health.v1 service, which is serving unless one of them is down
+	Checkers map[string]health.Checker
+	// AccessLog and SampleRate are the same as logging.MiddlewareConfig
+	AccessLog  bool
+	SampleRate float64
+	// Tenancy resolves the tenant of every call from its metadata, nil runs without tenants
+	Tenancy tenancy.Resolver
+}
+
+type server struct {
+	grpc *grpc.Server
+}
+
+// healthServer reports the same readiness as the /health endpoint
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	checkers map[string]health.Checker
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewServer Will create the gRPC API over s, with reflection for tools such as grpcurl
+func NewServer(s services.Service, config *Config) Server {
+	c := *config
+	if c.SampleRate <= 0 {
+		c.SampleRate = 1
+	}
+
+	g := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			contextInterceptor(&c),
+			errorInterceptor,
+			recoverInterceptor,
+			tenantInterceptor(&c),
+			authInterceptor(&c),
+		),
+	)
+	modelsv1.RegisterModelServiceServer(g, &modelServer{s: s})
+	grpc_health_v1.RegisterHealthServer(g, &healthServer{checkers: c.Checkers})
+	reflection.Register(g)
+	return &server{grpc: g}
+}
+
+/*
+* PRIVATE
+ */
+
+func (h *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if len(req.Service) != 0 && req.Service != modelsv1.ModelService_ServiceDesc.ServiceName {
+		return nil, status.Errorf(codes.NotFound, "Unknown service %s", req.Service)
+	}
+
+	res := &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}
+	if health.Run(ctx, h.checkers).Status == health.StatusDown {
+		res.Status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	return res, nil
+}
+
+/*
+* PUBLIC
+ */
+
+func (s *server) Serve(lis net.Listener) error {
+	err := s.grpc.Serve(lis)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+func (s *server) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,310 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/rpc"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	modelsv1 "github.com/sizzlorox/go-service-boilerplate/pkg/pb/models/v1"
+)
+
+type checker string
+
+func (c checker) Health(ctx context.Context) health.Check {
+	return health.Check{Status: string(c)}
+}
+
+// newClient Serves the models of r over an in-memory connection
+func newClient(t *testing.T, r datastore.Repository, checkers map[string]health.Checker) *grpc.ClientConn {
+	return serve(t, r, &rpc.Config{
+		Users:    map[string]string{"admin": "secret"},
+		Checkers: checkers,
+	})
+}
+
+// serve Serves the models of r with config over an in-memory connection
+func serve(t *testing.T, r datastore.Repository, config *rpc.Config) *grpc.ClientConn {
+	s := services.NewService(r, utils.NewUtils(), audit.NewAuditor(r), jobs.NewQueue(r, &jobs.Config{}), &services.Config{})
+	srv := rpc.NewServer(s, config)
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Stop(context.Background())
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
+// basic Returns ctx carrying basic credentials
+func basic(ctx context.Context, user string, pwd string) context.Context {
+	credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + pwd))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Basic "+credentials)
+}
+
+// reason Returns the stable code carried by a status
+func reason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+/*
+	TESTS
+*/
+
+func TestModelService(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	r.EnsureIndexes("models", []string{"email"})
+	client := modelsv1.NewModelServiceClient(newClient(t, r, nil))
+
+	var header metadata.MD
+	created, err := client.CreateModel(ctx, &modelsv1.CreateModelRequest{Name: "Bob", Email: "bob@bob.com"}, grpc.Header(&header))
+	require.Nil(t, err)
+	id := created.Model.Id
+	assert.True(t, datastore.ValidID(id))
+	assert.NotNil(t, created.Model.CreateTime)
+	assert.NotEmpty(t, header.Get(rpc.RequestIDKey), "Calls are given a request ID")
+
+	tests := []struct {
+		description string
+		call        func() error
+		code        codes.Code
+		reason      string
+	}{
+		{
+			description: "Get",
+			call: func() error {
+				res, err := client.GetModel(ctx, &modelsv1.GetModelRequest{Id: id})
+				if err == nil {
+					assert.Equal(t, "Bob", res.Model.Name)
+				}
+				return err
+			},
+		},
+		{
+			description: "List",
+			call: func() error {
+				res, err := client.ListModels(ctx, &modelsv1.ListModelsRequest{})
+				if err == nil {
+					assert.Len(t, res.Models, 1)
+				}
+				return err
+			},
+		},
+		{
+			description: "Invalid page",
+			call: func() error {
+				_, err := client.ListModels(ctx, &modelsv1.ListModelsRequest{Page: -1})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			reason: apperrors.CodeInvalidPagination,
+		},
+		{
+			description: "Invalid ID",
+			call: func() error {
+				_, err := client.GetModel(ctx, &modelsv1.GetModelRequest{Id: "1"})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			reason: apperrors.CodeInvalidID,
+		},
+		{
+			description: "Not found",
+			call: func() error {
+				_, err := client.DeleteModel(ctx, &modelsv1.DeleteModelRequest{Id: string(datastore.NewID())})
+				return err
+			},
+			code:   codes.NotFound,
+			reason: apperrors.CodeModelNotFound,
+		},
+		{
+			description: "Duplicate email",
+			call: func() error {
+				_, err := client.CreateModel(ctx, &modelsv1.CreateModelRequest{Name: "Robert", Email: "bob@bob.com"})
+				return err
+			},
+			code:   codes.AlreadyExists,
+			reason: apperrors.CodeModelAlreadyExists,
+		},
+		{
+			description: "No fields to update",
+			call: func() error {
+				_, err := client.UpdateModel(ctx, &modelsv1.UpdateModelRequest{Id: id})
+				return err
+			},
+			code:   codes.InvalidArgument,
+			reason: apperrors.CodeNoFieldsToUpdate,
+		},
+		{
+			description: "Update",
+			call: func() error {
+				_, err := client.UpdateModel(ctx, &modelsv1.UpdateModelRequest{Id: id, Name: "Robert"})
+				return err
+			},
+		},
+		{
+			description: "Delete",
+			call: func() error {
+				_, err := client.DeleteModel(ctx, &modelsv1.DeleteModelRequest{Id: id})
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		err := test.call()
+		assert.Equal(t, test.code, status.Code(err), "%s: %v", test.description, err)
+		assert.Equal(t, test.reason, reason(err), test.description)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	client := modelsv1.NewModelServiceClient(newClient(t, datastore.NewMemoryDatastore(), nil))
+
+	_, err := client.CreateModel(context.Background(), &modelsv1.CreateModelRequest{Name: "Bob", Email: "bob"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, apperrors.CodeValidationFailed, reason(err))
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			violations = br.FieldViolations
+		}
+	}
+	require.Len(t, violations, 1)
+	assert.Equal(t, "email", violations[0].Field)
+	assert.Equal(t, "email must be a valid email address", violations[0].Description)
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	client := modelsv1.NewModelServiceClient(newClient(t, r, nil))
+
+	tests := []struct {
+		description string
+		ctx         context.Context
+		code        codes.Code
+		actor       string
+	}{
+		{description: "Anonymous", ctx: ctx, actor: utils.AnonymousActor},
+		{description: "Credentials", ctx: basic(ctx, "admin", "secret"), actor: "admin"},
+		{description: "Wrong password", ctx: basic(ctx, "admin", "guess"), code: codes.Unauthenticated},
+		{description: "Other scheme", ctx: metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token"), code: codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		res, err := client.CreateModel(test.ctx, &modelsv1.CreateModelRequest{Name: "Bob", Email: test.description + "@bob.com"})
+		assert.Equal(t, test.code, status.Code(err), "%s: %v", test.description, err)
+		if err != nil {
+			continue
+		}
+
+		// The actor is recorded in the audit history, auth.Middleware does the same for HTTP requests
+		entries, err := audit.NewAuditor(r).History(ctx, res.Model.Id, datastore.Pagination{Page: 1, Limit: 1})
+		require.Nil(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, test.actor, entries[0].Actor, test.description)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		description string
+		status      string
+		service     string
+		expected    grpc_health_v1.HealthCheckResponse_ServingStatus
+		code        codes.Code
+	}{
+		{description: "Up", status: health.StatusUp, expected: grpc_health_v1.HealthCheckResponse_SERVING},
+		{description: "Degraded", status: health.StatusDegraded, expected: grpc_health_v1.HealthCheckResponse_SERVING},
+		{description: "Down", status: health.StatusDown, expected: grpc_health_v1.HealthCheckResponse_NOT_SERVING},
+		{description: "By service", status: health.StatusUp, service: "models.v1.ModelService", expected: grpc_health_v1.HealthCheckResponse_SERVING},
+		{description: "Unknown service", status: health.StatusUp, service: "models.v2.ModelService", code: codes.NotFound},
+	}
+	for _, test := range tests {
+		conn := newClient(t, datastore.NewMemoryDatastore(), map[string]health.Checker{"lifecycle": checker(test.status)})
+		res, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: test.service})
+		assert.Equal(t, test.code, status.Code(err), test.description)
+		if err == nil {
+			assert.Equal(t, test.expected, res.Status, test.description)
+		}
+	}
+}
+
+func TestTenancy(t *testing.T) {
+	r := datastore.NewTenantRepository(datastore.NewMemoryDatastore(), &datastore.TenancyConfig{})
+	conn := serve(t, r, &rpc.Config{
+		Users:   map[string]string{"admin": "secret"},
+		Tenancy: tenancy.NewResolver(&tenancy.Config{Sources: []string{tenancy.SourceHeader}}),
+	})
+	client := modelsv1.NewModelServiceClient(conn)
+	acme := metadata.AppendToOutgoingContext(context.Background(), tenancy.DefaultHeader, "acme")
+	globex := metadata.AppendToOutgoingContext(context.Background(), tenancy.DefaultHeader, "globex")
+
+	created, err := client.CreateModel(acme, &modelsv1.CreateModelRequest{Name: "Bob", Email: "bob@bob.com"})
+	require.Nil(t, err)
+	_, err = client.GetModel(acme, &modelsv1.GetModelRequest{Id: created.Model.Id})
+	assert.Nil(t, err)
+	_, err = client.GetModel(globex, &modelsv1.GetModelRequest{Id: created.Model.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err), "another tenant cannot read the model")
+	_, err = client.GetModel(context.Background(), &modelsv1.GetModelRequest{Id: created.Model.Id})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "calls need a tenant")
+
+	// Health checks are not scoped to a tenant
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Nil(t, err)
+}
+
+func TestStop(t *testing.T) {
+	r := datastore.NewMemoryDatastore()
+	s := services.NewService(r, utils.NewUtils(), audit.NewAuditor(r), jobs.NewQueue(r, &jobs.Config{}), &services.Config{})
+	srv := rpc.NewServer(s, &rpc.Config{})
+	lis := bufconn.Listen(1 << 20)
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(lis)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.Nil(t, srv.Stop(ctx))
+	assert.Nil(t, <-served, "Serve returns once stopped")
+}
@@ -0,0 +1,432 @@
+// Package scheduler runs registered tasks on cron schedules. The next run of every task is stored
+// in the datastore and a process takes it under a lease lock, so each run happens once however
+// many processes or prefork children share the datastore, and runs of a task never overlap.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// Collections the scheduler stores its state in
+const (
+	TasksCollection = "scheduler_tasks"
+	RunsCollection  = "scheduler_runs"
+)
+
+// Statuses of a Run
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// minLease leaves room to extend a lock a few times before it expires
+const minLease = time.Second
+
+// Task Is a periodic piece of work
+type Task struct {
+	Name string
+	// Schedule is a five field cron expression or a descriptor such as @hourly or @every 10m
+	Schedule string
+	Run      func(ctx context.Context) error
+	// Timeout bounds a run, zero lets it run until the scheduler stops
+	Timeout time.Duration
+}
+
+// State Is the shared state of a task, every process reads its next run from here
+type State struct {
+	ID       string    `json:"-" bson:"_id,omitempty"`
+	Name     string    `json:"name" bson:"name"`
+	Schedule string    `json:"schedule" bson:"schedule"`
+	NextRun  time.Time `json:"nextRun" bson:"next_run"`
+	// Lock is unique to each run, it is held until LockedUntil and extended while the run lasts
+	Lock        string    `json:"-" bson:"lock,omitempty"`
+	LockedUntil time.Time `json:"lockedUntil,omitempty" bson:"locked_until,omitempty"`
+	Owner       string    `json:"owner,omitempty" bson:"owner,omitempty"`
+	LastRun     time.Time `json:"lastRun,omitempty" bson:"last_run,omitempty"`
+	LastStatus  string    `json:"lastStatus,omitempty" bson:"last_status,omitempty"`
+	LastError   string    `json:"lastError,omitempty" bson:"last_error,omitempty"`
+	// Failures counts the runs that failed in a row
+	Failures int `json:"failures" bson:"failures"`
+}
+
+// Run Is the record of one run of a task
+type Run struct {
+	ID          string    `json:"id" xml:"id" bson:"_id,omitempty" example:"5ff3fc0e00acd4328da25d92"`
+	Task        string    `json:"task" xml:"task" bson:"task" example:"models.purge"`
+	Owner       string    `json:"owner" xml:"owner" bson:"owner" example:"api-1234"`
+	ScheduledAt time.Time `json:"scheduledAt" xml:"scheduledAt" bson:"scheduled_at"`
+	StartedAt   time.Time `json:"startedAt" xml:"startedAt" bson:"started_at"`
+	FinishedAt  time.Time `json:"finishedAt" xml:"finishedAt" bson:"finished_at"`
+	Status      string    `json:"status" xml:"status" bson:"status" example:"failed"`
+	Error       string    `json:"error,omitempty" xml:"error,omitempty" bson:"error,omitempty" example:"context deadline exceeded"`
+}
+
+// Config Is the Scheduler config
+type Config struct {
+	// PollInterval is how often due runs are looked for, runs start up to this late
+	PollInterval time.Duration
+	// Lease is how long a run holds its lock, it is extended while the run lasts
+	Lease time.Duration
+}
+
+type Scheduler interface {
+	// Register Will run t on its schedule, tasks must be registered before Start
+	Register(t Task) error
+	Start(ctx context.Context) error
+	// Stop Stops starting runs and waits for the running ones, which are cancelled once ctx is done
+	Stop(ctx context.Context) error
+	// Runs Returns the run history of a task, newest first
+	Runs(ctx context.Context, task string, page datastore.Pagination) ([]Run, error)
+	// Health Reports every task, the scheduler is degraded while the last run of a task failed
+	Health(ctx context.Context) health.Check
+}
+
+type task struct {
+	Task
+	schedule cron.Schedule
+}
+
+type scheduler struct {
+	r      datastore.Repository
+	u      utils.Utils
+	config Config
+	owner  string
+	tasks  map[string]*task
+
+	stopping chan struct{}
+	// ctx is cancelled to abandon the running tasks
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewScheduler Will create a Scheduler storing its state in r, which must implement
+// datastore.FindOneAndUpdater
+func NewScheduler(r datastore.Repository, config *Config) Scheduler {
+	if _, ok := r.(datastore.FindOneAndUpdater); !ok {
+		log.Fatal("The scheduler needs a datastore that can find and update atomically")
+	}
+	host, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &scheduler{
+		r:        r,
+		u:        utils.NewUtils(),
+		config:   *config,
+		owner:    fmt.Sprintf("%s-%d", host, os.Getpid()),
+		tasks:    map[string]*task{},
+		stopping: make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+/*
+* PRIVATE
+ */
+
+func (s *scheduler) names() []string {
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	return names
+}
+
+// save Stores the state of a new task, or its new schedule when the expression changed
+func (s *scheduler) save(ctx context.Context, t *task) error {
+	next := t.schedule.Next(time.Now().UTC())
+	_, err := s.r.Insert(ctx, datastore.Query{From: TasksCollection}, State{Name: t.Name, Schedule: t.Schedule, NextRun: next})
+	if apperrors.KindOf(s.u.ErrorWrapper(err)) != apperrors.KindConflict {
+		return err
+	}
+
+	query := datastore.Query{Where: datastore.M{"name": t.Name, "schedule": datastore.M{"$ne": t.Schedule}}, From: TasksCollection}
+	_, err = s.r.Update(ctx, query, datastore.M{"$set": datastore.M{"schedule": t.Schedule, "next_run": next}})
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// states Reads the state of every registered task
+func (s *scheduler) states(ctx context.Context) ([]State, error) {
+	res := []State{}
+	query := datastore.Query{Where: datastore.M{"name": datastore.M{"$in": s.names()}}, From: TasksCollection}
+	err := s.r.FindInto(ctx, query, &datastore.Pagination{Sort: []string{"name"}}, &res)
+	return res, err
+}
+
+// claim Takes the due run of a task, moving its next run forward so no other process takes it.
+// A run still holding the lock delays the due run until it finishes
+func (s *scheduler) claim(ctx context.Context, t *task) (*State, error) {
+	now := time.Now().UTC()
+	query := datastore.Query{
+		Where: datastore.M{
+			"name":     t.Name,
+			"next_run": datastore.M{"$lte": now},
+			"$or": []datastore.M{
+				{"locked_until": datastore.M{"$exists": false}},
+				{"locked_until": datastore.M{"$lt": now}},
+			},
+		},
+		From: TasksCollection,
+	}
+	update := datastore.M{"$set": datastore.M{
+		// Runs missed while no process was up are run once, not caught up on
+		"next_run":     t.schedule.Next(now),
+		"lock":         datastore.NewID(),
+		"locked_until": now.Add(s.config.Lease),
+		"owner":        s.owner,
+	}}
+
+	var claimed State
+	err := datastore.FindOneAndUpdate(ctx, s.r, query, nil, update, &claimed)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &claimed, nil
+}
+
+// locked Updates the task only while the run still holds its lock, it reports whether it did
+func (s *scheduler) locked(state *State, update datastore.M) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := datastore.Query{Where: datastore.M{"name": state.Name, "lock": state.Lock}, From: TasksCollection}
+	_, err := s.r.Update(ctx, query, update)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// heartbeat Extends the lock until done is closed
+func (s *scheduler) heartbeat(logger *log.Entry, state *State, done <-chan struct{}) {
+	ticker := time.NewTicker(s.config.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ok, err := s.locked(state, datastore.M{"$set": datastore.M{"locked_until": time.Now().UTC().Add(s.config.Lease)}})
+		if err != nil {
+			logger.Warnf("Could not extend the lock: %v", err)
+		} else if !ok {
+			logger.Warn("Lost the lock, the next run may overlap this one")
+			return
+		}
+	}
+}
+
+// call Runs the task, a panic fails the run
+func call(ctx context.Context, t *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return t.Run(ctx)
+}
+
+// run Runs a claimed task and records the run, then releases the lock
+func (s *scheduler) run(t *task, state *State, scheduledAt time.Time) {
+	defer s.wg.Done()
+	logger := log.WithFields(log.Fields{"component": "scheduler", "task": t.Name})
+	ctx := logging.WithEntry(s.ctx, logger)
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan struct{})
+	go s.heartbeat(logger, state, done)
+	started := time.Now().UTC()
+	err := call(ctx, t)
+	close(done)
+
+	run := Run{Task: t.Name, Owner: s.owner, ScheduledAt: scheduledAt, StartedAt: started, FinishedAt: time.Now().UTC(), Status: StatusSucceeded}
+	update := datastore.M{
+		"$set":   datastore.M{"last_run": started, "last_status": StatusSucceeded, "failures": 0},
+		"$unset": datastore.M{"lock": "", "locked_until": "", "owner": "", "last_error": ""},
+	}
+	if err != nil {
+		logger.Errorf("Task failed: %v", err)
+		run.Status, run.Error = StatusFailed, err.Error()
+		update = datastore.M{
+			"$set":   datastore.M{"last_run": started, "last_status": StatusFailed, "last_error": err.Error()},
+			"$inc":   datastore.M{"failures": 1},
+			"$unset": datastore.M{"lock": "", "locked_until": "", "owner": ""},
+		}
+	} else {
+		logger.Infof("Task succeeded in %s", run.FinishedAt.Sub(started))
+	}
+
+	rctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.r.Insert(rctx, datastore.Query{From: RunsCollection}, run); err != nil {
+		logger.Errorf("Could not record the run: %v", err)
+	}
+	if ok, err := s.locked(state, update); err != nil || !ok {
+		logger.Warnf("Could not release the lock, it expires on its own: %v", err)
+	}
+}
+
+// poll Starts every due run this process can claim
+func (s *scheduler) poll() {
+	states, err := s.states(s.ctx)
+	if err != nil {
+		log.WithField("component", "scheduler").Warnf("Could not read the tasks: %v", err)
+		return
+	}
+	now := time.Now().UTC()
+	for _, state := range states {
+		t, ok := s.tasks[state.Name]
+		if !ok || state.NextRun.After(now) {
+			continue
+		}
+		claimed, err := s.claim(s.ctx, t)
+		if err != nil {
+			log.WithFields(log.Fields{"component": "scheduler", "task": t.Name}).Warnf("Could not claim the run: %v", err)
+			continue
+		}
+		if claimed != nil {
+			s.wg.Add(1)
+			go s.run(t, claimed, state.NextRun)
+		}
+	}
+}
+
+func (s *scheduler) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		s.poll()
+		select {
+		case <-s.stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+* PUBLIC
+ */
+
+func (s *scheduler) Register(t Task) error {
+	schedule, err := cron.ParseStandard(t.Schedule)
+	if err != nil {
+		return fmt.Errorf("task %s: %w", t.Name, err)
+	}
+	if _, ok := s.tasks[t.Name]; ok {
+		return fmt.Errorf("task %s is already registered", t.Name)
+	}
+	s.tasks[t.Name] = &task{Task: t, schedule: schedule}
+	return nil
+}
+
+func (s *scheduler) Start(ctx context.Context) error {
+	if len(s.tasks) == 0 {
+		log.Info("No scheduled tasks")
+		return nil
+	}
+	if s.config.Lease < minLease {
+		return fmt.Errorf("the scheduler lease must be at least %s", minLease)
+	}
+	if s.config.PollInterval <= 0 {
+		return errors.New("the scheduler poll interval must be positive")
+	}
+	s.r.EnsureIndexes(TasksCollection, []string{"name"})
+	for _, t := range s.tasks {
+		if err := s.save(ctx, t); err != nil {
+			return fmt.Errorf("task %s: %w", t.Name, err)
+		}
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return nil
+}
+
+func (s *scheduler) Stop(ctx context.Context) error {
+	close(s.stopping)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	s.cancel()
+	<-done
+	return fmt.Errorf("cancelled the running tasks: %w", ctx.Err())
+}
+
+func (s *scheduler) Runs(ctx context.Context, task string, page datastore.Pagination) ([]Run, error) {
+	if _, ok := s.tasks[task]; !ok {
+		return nil, apperrors.NotFound(apperrors.CodeTaskNotFound, "Task not found")
+	}
+	page.Sort = []string{"-started_at"}
+
+	res := []Run{}
+	err := s.r.FindInto(ctx, datastore.Query{Where: datastore.M{"task": task}, From: RunsCollection}, &page, &res)
+	return res, err
+}
+
+func (s *scheduler) Health(ctx context.Context) health.Check {
+	check := health.Check{Status: health.StatusUp, Details: map[string]interface{}{}}
+	if len(s.tasks) == 0 {
+		return check
+	}
+	states, err := s.states(ctx)
+	if err != nil {
+		check.Status = health.StatusDegraded
+		check.Details["error"] = err.Error()
+		return check
+	}
+
+	now := time.Now()
+	for _, state := range states {
+		check.Details[state.Name] = map[string]interface{}{
+			"schedule":   state.Schedule,
+			"nextRun":    state.NextRun,
+			"running":    state.LockedUntil.After(now),
+			"lastRun":    state.LastRun,
+			"lastStatus": state.LastStatus,
+			"lastError":  state.LastError,
+			"failures":   state.Failures,
+		}
+		if state.Failures > 0 {
+			check.Status = health.StatusDegraded
+		}
+	}
+	return check
+}
@@ -0,0 +1,164 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/health"
+	"github.com/sizzlorox/go-service-boilerplate/internal/scheduler"
+)
+
+func newConfig() *scheduler.Config {
+	return &scheduler.Config{PollInterval: 5 * time.Millisecond, Lease: time.Second}
+}
+
+// runs Returns the runs of task once there are n of them
+func runs(t *testing.T, s scheduler.Scheduler, task string, n int) []scheduler.Run {
+	var res []scheduler.Run
+	require.Eventually(t, func() bool {
+		var err error
+		res, err = s.Runs(context.Background(), task, datastore.Pagination{})
+		require.Nil(t, err)
+		return len(res) >= n
+	}, 3*time.Second, 5*time.Millisecond, "Task %s never ran %d times", task, n)
+	return res
+}
+
+/*
+	TESTS
+*/
+
+func TestRegister(t *testing.T) {
+	s := scheduler.NewScheduler(datastore.NewMemoryDatastore(), newConfig())
+	noop := func(ctx context.Context) error { return nil }
+
+	tests := []struct {
+		description string
+		task        scheduler.Task
+		valid       bool
+	}{
+		{description: "Cron expression", task: scheduler.Task{Name: "a", Schedule: "*/5 * * * *", Run: noop}, valid: true},
+		{description: "Descriptor", task: scheduler.Task{Name: "b", Schedule: "@every 1s", Run: noop}, valid: true},
+		{description: "Already registered", task: scheduler.Task{Name: "a", Schedule: "@hourly", Run: noop}},
+		{description: "Invalid expression", task: scheduler.Task{Name: "c", Schedule: "every minute", Run: noop}},
+	}
+	for _, test := range tests {
+		err := s.Register(test.task)
+		assert.Equal(t, test.valid, err == nil, "%s: %v", test.description, err)
+	}
+
+	_, err := s.Runs(context.Background(), "c", datastore.Pagination{})
+	assert.Equal(t, apperrors.KindNotFound, apperrors.KindOf(err))
+}
+
+func TestSchedulerRunsOnce(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+
+	// Processes sharing a datastore run each due run once between them
+	var calls int32
+	schedulers := []scheduler.Scheduler{}
+	for i := 0; i < 3; i++ {
+		s := scheduler.NewScheduler(r, newConfig())
+		require.Nil(t, s.Register(scheduler.Task{
+			Name:     "purge",
+			Schedule: "@every 1s",
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			},
+		}))
+		require.Nil(t, s.Start(ctx))
+		schedulers = append(schedulers, s)
+	}
+
+	res := runs(t, schedulers[0], "purge", 2)
+	for _, s := range schedulers {
+		require.Nil(t, s.Stop(ctx))
+	}
+
+	assert.Equal(t, int32(len(res)), atomic.LoadInt32(&calls), "Every run is recorded")
+	assert.Equal(t, scheduler.StatusSucceeded, res[0].Status)
+	assert.True(t, res[0].ScheduledAt.Sub(res[1].ScheduledAt) >= time.Second, "Runs are a schedule apart")
+	check := schedulers[1].Health(ctx)
+	assert.Equal(t, health.StatusUp, check.Status)
+}
+
+func TestSchedulerFailures(t *testing.T) {
+	ctx := context.Background()
+	s := scheduler.NewScheduler(datastore.NewMemoryDatastore(), newConfig())
+	require.Nil(t, s.Register(scheduler.Task{
+		Name:     "export",
+		Schedule: "@every 1s",
+		Run: func(ctx context.Context) error {
+			return errors.New("bucket unreachable")
+		},
+	}))
+	require.Nil(t, s.Register(scheduler.Task{
+		Name:     "report",
+		Schedule: "@every 1s",
+		Run: func(ctx context.Context) error {
+			panic("nil map")
+		},
+	}))
+	require.Nil(t, s.Start(ctx))
+
+	export := runs(t, s, "export", 1)
+	report := runs(t, s, "report", 1)
+	require.Nil(t, s.Stop(ctx))
+
+	assert.Equal(t, scheduler.StatusFailed, export[0].Status)
+	assert.Equal(t, "bucket unreachable", export[0].Error)
+	assert.Equal(t, "panic: nil map", report[0].Error, "Panics fail the run")
+
+	check := s.Health(ctx)
+	assert.Equal(t, health.StatusDegraded, check.Status)
+	details := check.Details["export"].(map[string]interface{})
+	assert.Equal(t, "bucket unreachable", details["lastError"])
+	assert.GreaterOrEqual(t, details["failures"], 1)
+}
+
+func TestSchedulerStop(t *testing.T) {
+	ctx := context.Background()
+	s := scheduler.NewScheduler(datastore.NewMemoryDatastore(), newConfig())
+	started := make(chan struct{})
+	require.Nil(t, s.Register(scheduler.Task{
+		Name:     "reindex",
+		Schedule: "@every 1s",
+		Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	require.Nil(t, s.Start(ctx))
+	<-started
+
+	stopCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	err := s.Stop(stopCtx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+
+	// The cancelled run is recorded and its lock released
+	res := runs(t, s, "reindex", 1)
+	assert.Equal(t, scheduler.StatusFailed, res[0].Status)
+	assert.Equal(t, false, s.Health(ctx).Details["reindex"].(map[string]interface{})["running"])
+}
+
+func TestSchedulerLease(t *testing.T) {
+	for _, lease := range []time.Duration{0, time.Nanosecond, 999 * time.Millisecond} {
+		config := newConfig()
+		config.Lease = lease
+		s := scheduler.NewScheduler(datastore.NewMemoryDatastore(), config)
+		require.Nil(t, s.Register(scheduler.Task{Name: "reindex", Schedule: "@hourly", Run: func(ctx context.Context) error { return nil }}))
+		assert.NotNil(t, s.Start(context.Background()), "Rejects a lease of %s", lease)
+	}
+}
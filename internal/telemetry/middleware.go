@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// InstrumentationName is the tracer name used by this service's instrumentation
+const InstrumentationName = "github.com/sizzlorox/go-service-boilerplate"
+
+// Middleware Will start a server span per request, continuing any incoming W3C traceparent
+func Middleware() fiber.Handler {
+	tracer := otel.Tracer(InstrumentationName)
+	return func(ctx *fiber.Ctx) error {
+		propagator := otel.GetTextMapPropagator()
+
+		// Extract incoming trace headers
+		carrier := propagation.HeaderCarrier{}
+		ctx.Request().Header.VisitAll(func(k, v []byte) {
+			carrier.Set(string(k), string(v))
+		})
+		c := propagator.Extract(context.Background(), carrier)
+
+		c, span := tracer.Start(c, fmt.Sprintf("%s %s", ctx.Method(), ctx.Path()),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Method()),
+				semconv.URLPath(ctx.Path()),
+				semconv.ClientAddress(ctx.IP()),
+				semconv.UserAgentOriginal(ctx.Get(fiber.HeaderUserAgent)),
+			),
+		)
+		defer span.End()
+		utils.SetContext(ctx, c)
+
+		// Expose the trace to the caller
+		out := propagation.HeaderCarrier{}
+		propagator.Inject(c, out)
+		for _, k := range out.Keys() {
+			ctx.Set(k, out.Get(k))
+		}
+
+		err := ctx.Next()
+
+		// Name the span after the matched route to keep cardinality low
+		route := ctx.Route().Path
+		span.SetName(fmt.Sprintf("%s %s", ctx.Method(), route))
+		span.SetAttributes(semconv.HTTPRoute(route))
+
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+
+		return err
+	}
+}
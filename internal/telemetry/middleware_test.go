@@ -0,0 +1,119 @@
+package telemetry_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/router"
+	"github.com/sizzlorox/go-service-boilerplate/internal/telemetry"
+)
+
+// newExporter Records the spans of the global tracer provider until the test ends
+func newExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		tp.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func find(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func attr(span *tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+/*
+	TESTS
+*/
+
+func TestMiddleware(t *testing.T) {
+	exporter := newExporter(t)
+
+	r := datastore.NewTracedRepository(datastore.NewMemoryDatastore())
+	jobsConfig := &jobs.Config{Workers: 1, PollInterval: time.Second, Lease: time.Second, MaxAttempts: 1}
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(telemetry.Middleware())
+	router.LoadRoutes(app.Group("/api"), r, jobs.NewQueue(r, jobsConfig), jobs.NewPool(r, jobsConfig), &router.Config{})
+
+	req, _ := http.NewRequest(fiber.MethodPost, "/api/v2/models", strings.NewReader(`{"name":"Bob","email":"bob@bob.com"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	assert.Equal(t, fiber.StatusCreated, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("traceparent"), "the trace is exposed to the caller")
+
+	spans := exporter.GetSpans()
+	server := find(spans, "POST /api/v2/models")
+	service := find(spans, "services.Create")
+	insert := find(spans, "datastore.insert")
+	require.NotNil(t, server, "server span")
+	require.NotNil(t, service, "service span")
+	require.NotNil(t, insert, "datastore span")
+
+	// One trace, the service under the request and the datastore under the service
+	trace := server.SpanContext.TraceID()
+	for _, span := range spans {
+		assert.Equal(t, trace, span.SpanContext.TraceID(), span.Name)
+	}
+	assert.Equal(t, server.SpanContext.SpanID(), service.Parent.SpanID())
+	assert.Equal(t, service.SpanContext.SpanID(), insert.Parent.SpanID())
+
+	assert.Equal(t, "/api/v2/models", attr(server, semconv.HTTPRouteKey))
+	assert.Equal(t, "201", attr(server, semconv.HTTPResponseStatusCodeKey))
+	assert.Equal(t, "models", attr(insert, semconv.DBCollectionNameKey))
+	assert.Equal(t, "insert", attr(insert, semconv.DBOperationNameKey))
+}
+
+func TestMiddlewareContinuesIncomingTraces(t *testing.T) {
+	exporter := newExporter(t)
+	app := fiber.New()
+	app.Use(telemetry.Middleware())
+	app.Get("/ping", func(ctx *fiber.Ctx) error {
+		return ctx.SendString("pong")
+	})
+
+	req, _ := http.NewRequest(fiber.MethodGet, "/ping", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, err := app.Test(req, -1)
+	require.Nil(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.Equal(t, "/ping", attr(&spans[0], semconv.HTTPRouteKey))
+}
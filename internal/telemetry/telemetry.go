@@ -0,0 +1,90 @@
+package telemetry
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Telemetry interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Config Is the Telemetry config
+type Config struct {
+	ServiceName string
+	Environment string
+	// Exporter is one of none, stdout or otlp
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector address, e.g. localhost:4318
+	Endpoint string
+}
+
+type telemetry struct {
+	tp *sdktrace.TracerProvider
+}
+
+// NewTelemetry Will register the global tracer provider and W3C propagators
+func NewTelemetry(config *Config) Telemetry {
+	// Always propagate traceparent, even when spans are not exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithInsecure()}
+		if len(config.Endpoint) != 0 {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case ExporterNone, "":
+		log.Info("Tracing exporter disabled")
+		return &telemetry{}
+	default:
+		log.Fatalf("Unknown tracing exporter %s", config.Exporter)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+		semconv.DeploymentEnvironment(config.Environment),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	log.Infof("Exporting traces to %s", config.Exporter)
+	return &telemetry{tp: tp}
+}
+
+// Shutdown Will flush pending spans and stop the exporter
+func (t *telemetry) Shutdown(ctx context.Context) error {
+	if t.tp == nil {
+		return nil
+	}
+	return t.tp.Shutdown(ctx)
+}
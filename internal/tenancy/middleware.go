@@ -0,0 +1,26 @@
+package tenancy
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+// Middleware Will resolve the tenant of every request and attach it to the request context,
+// requests without a tenant are rejected
+func Middleware(r Resolver) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		header := func(key string) string {
+			return ctx.Get(key)
+		}
+		tenant, err := r.Resolve(header, ctx.Hostname())
+		if err != nil {
+			return err
+		}
+
+		c := WithTenant(utils.Context(ctx), tenant)
+		utils.SetContext(ctx, logging.WithEntry(c, logging.FromContext(c).WithField("tenant", tenant)))
+		return ctx.Next()
+	}
+}
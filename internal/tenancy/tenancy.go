@@ -0,0 +1,192 @@
+// Package tenancy resolves the tenant of a request and carries it in the context, the datastore
+// reads it back to keep the data of each tenant apart. A tenant is named by a header, the
+// subdomain of the request or a claim of its bearer token, whichever sources are enabled must
+// agree so a caller cannot pick another tenant than the one its token was issued for.
+package tenancy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+)
+
+// Sources selectable with Config.Sources
+const (
+	SourceHeader    = "header"
+	SourceSubdomain = "subdomain"
+	SourceClaim     = "claim"
+)
+
+// Defaults of Config
+const (
+	DefaultHeader = "X-Tenant-ID"
+	DefaultClaim  = "tenant_id"
+)
+
+// Config Is the tenant resolution config
+type Config struct {
+	// Sources are where tenants are read from, any of header, subdomain and claim
+	Sources []string
+	// Header defaults to X-Tenant-ID
+	Header string
+	// Domain is the parent domain of tenant subdomains, e.g. example.com for acme.example.com
+	Domain string
+	// Claim defaults to tenant_id, it is read from bearer tokens signed with Secret using HS256
+	Claim  string
+	Secret []byte
+	// Tenants restricts tenants to a known set, empty accepts any well formed ID
+	Tenants []string
+}
+
+// Resolver Finds the tenant of a request, it is shared by the HTTP and gRPC APIs
+type Resolver interface {
+	// Resolve Returns the tenant named by the headers and host of a request, header is called
+	// with canonical header names
+	Resolve(header func(key string) string, host string) (string, error)
+}
+
+type resolver struct {
+	config  Config
+	tenants map[string]bool
+}
+
+type tenantKey struct{}
+
+// validID keeps tenant IDs usable in database names and cache keys
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewResolver Will create a Resolver reading the tenant from config.Sources
+func NewResolver(config *Config) Resolver {
+	c := *config
+	if len(c.Header) == 0 {
+		c.Header = DefaultHeader
+	}
+	if len(c.Claim) == 0 {
+		c.Claim = DefaultClaim
+	}
+	c.Domain = strings.ToLower(strings.Trim(c.Domain, "."))
+
+	for _, source := range c.Sources {
+		switch source {
+		case SourceHeader, SourceSubdomain:
+		case SourceClaim:
+			if len(c.Secret) == 0 {
+				log.Fatal("Reading the tenant from a token claim needs the secret tokens are signed with")
+			}
+		default:
+			log.Fatalf("Unknown tenant source %q", source)
+		}
+	}
+	if len(c.Sources) == 0 {
+		log.Fatal("Tenancy needs at least one tenant source")
+	}
+
+	tenants := map[string]bool{}
+	for _, t := range c.Tenants {
+		tenants[t] = true
+	}
+	return &resolver{config: c, tenants: tenants}
+}
+
+/*
+* PRIVATE
+ */
+
+// subdomain returns the first label of host under the domain, acme for acme.example.com
+func (r *resolver) subdomain(host string) string {
+	host = strings.ToLower(host)
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	rest, ok := strings.CutSuffix(host, "."+r.config.Domain)
+	if !ok || len(r.config.Domain) == 0 {
+		return ""
+	}
+	labels := strings.Split(rest, ".")
+	return labels[len(labels)-1]
+}
+
+// claim returns the tenant claim of a bearer token, requests without one have none. Tokens that
+// do not verify are rejected rather than ignored
+func (r *resolver) claim(authorization string) (string, error) {
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "bearer") || len(token) == 0 {
+		return "", nil
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimSpace(token), claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Header["alg"])
+		}
+		return r.config.Secret, nil
+	})
+	if err != nil {
+		return "", apperrors.Unauthorized("Invalid bearer token")
+	}
+	tenant, _ := claims[r.config.Claim].(string)
+	return tenant, nil
+}
+
+/*
+* PUBLIC
+ */
+
+func (r *resolver) Resolve(header func(key string) string, host string) (string, error) {
+	tenant := ""
+	for _, source := range r.config.Sources {
+		var found string
+		switch source {
+		case SourceHeader:
+			found = header(r.config.Header)
+		case SourceSubdomain:
+			found = r.subdomain(host)
+		case SourceClaim:
+			var err error
+			found, err = r.claim(header("Authorization"))
+			if err != nil {
+				return "", err
+			}
+		}
+		found = strings.TrimSpace(found)
+		if len(found) == 0 {
+			continue
+		}
+		if len(tenant) != 0 && found != tenant {
+			return "", apperrors.Forbidden(fmt.Sprintf("The %s names another tenant", source))
+		}
+		tenant = found
+	}
+
+	if len(tenant) == 0 {
+		return "", apperrors.InvalidArgument(apperrors.CodeTenantRequired, "A tenant is required")
+	}
+	if !validID.MatchString(tenant) {
+		return "", apperrors.InvalidArgument(apperrors.CodeInvalidTenant, "Tenant IDs are lowercase letters, digits, - and _")
+	}
+	if len(r.tenants) != 0 && !r.tenants[tenant] {
+		return "", apperrors.NotFound(apperrors.CodeTenantNotFound, "Tenant not found")
+	}
+	return tenant, nil
+}
+
+// WithTenant Returns a copy of the context carrying the tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext Returns the tenant carried by the context, or an empty string
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
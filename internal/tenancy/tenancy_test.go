@@ -0,0 +1,101 @@
+package tenancy_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/tenancy"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+)
+
+var secret = []byte("secret")
+
+func token(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.Nil(t, err)
+	return "Bearer " + s
+}
+
+/*
+	TESTS
+*/
+
+func TestResolve(t *testing.T) {
+	r := tenancy.NewResolver(&tenancy.Config{
+		Sources: []string{tenancy.SourceHeader, tenancy.SourceSubdomain, tenancy.SourceClaim},
+		Domain:  "example.com",
+		Secret:  secret,
+	})
+	acme := token(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"tenant_id": "acme"})
+
+	tests := []struct {
+		description string
+		headers     map[string]string
+		host        string
+		tenant      string
+		kind        apperrors.Kind
+		code        string
+	}{
+		{description: "Header", headers: map[string]string{"X-Tenant-ID": "acme"}, host: "localhost", tenant: "acme"},
+		{description: "Subdomain", host: "acme.example.com:8080", tenant: "acme"},
+		{description: "Nested subdomain", host: "api.acme.example.com", tenant: "acme"},
+		{description: "Claim", headers: map[string]string{"Authorization": acme}, host: "localhost", tenant: "acme"},
+		{description: "Sources agree", headers: map[string]string{"X-Tenant-ID": "acme", "Authorization": acme}, host: "acme.example.com", tenant: "acme"},
+		{description: "Header names another tenant than the token", headers: map[string]string{"X-Tenant-ID": "globex", "Authorization": acme}, host: "localhost", kind: apperrors.KindForbidden},
+		{description: "Subdomain names another tenant than the header", headers: map[string]string{"X-Tenant-ID": "acme"}, host: "globex.example.com", kind: apperrors.KindForbidden},
+		{description: "Token signed with another secret", headers: map[string]string{"Authorization": token(t, jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"tenant_id": "acme"})}, host: "localhost", kind: apperrors.KindUnauthorized},
+		{description: "Unsigned token", headers: map[string]string{"Authorization": token(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"tenant_id": "acme"})}, host: "localhost", kind: apperrors.KindUnauthorized},
+		{description: "Other domain", host: "acme.other.com", kind: apperrors.KindInvalidArgument, code: apperrors.CodeTenantRequired},
+		{description: "No tenant", host: "localhost", kind: apperrors.KindInvalidArgument, code: apperrors.CodeTenantRequired},
+		{description: "Malformed", headers: map[string]string{"X-Tenant-ID": "../acme"}, host: "localhost", kind: apperrors.KindInvalidArgument, code: apperrors.CodeInvalidTenant},
+	}
+	for _, test := range tests {
+		header := func(key string) string {
+			return test.headers[key]
+		}
+		tenant, err := r.Resolve(header, test.host)
+		if len(test.kind) == 0 {
+			assert.Nil(t, err, test.description)
+			assert.Equal(t, test.tenant, tenant, test.description)
+			continue
+		}
+		assert.Equal(t, test.kind, apperrors.KindOf(err), test.description)
+		if len(test.code) != 0 {
+			assert.Equal(t, test.code, err.(*apperrors.Error).Code, test.description)
+		}
+	}
+
+	// Only known tenants are served when they are listed
+	r = tenancy.NewResolver(&tenancy.Config{Sources: []string{tenancy.SourceHeader}, Header: "Tenant", Tenants: []string{"acme"}})
+	_, err := r.Resolve(func(key string) string { return map[string]string{"Tenant": "globex"}[key] }, "")
+	assert.Equal(t, apperrors.KindNotFound, apperrors.KindOf(err))
+}
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(tenancy.Middleware(tenancy.NewResolver(&tenancy.Config{Sources: []string{tenancy.SourceHeader}})))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendString(tenancy.FromContext(utils.Context(ctx)))
+	})
+
+	req, _ := http.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(tenancy.DefaultHeader, "acme")
+	res, err := app.Test(req, -1)
+	require.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, fiber.StatusOK, res.StatusCode)
+	assert.Equal(t, "acme", string(body))
+
+	req, _ = http.NewRequest(fiber.MethodGet, "/", nil)
+	res, err = app.Test(req, -1)
+	require.Nil(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// contextKey is the fiber local used to carry the request scoped context
+const contextKey = "requestContext"
+
+// Context returns the request scoped context stored on the fiber context, or a background context
+func Context(ctx *fiber.Ctx) context.Context {
+	if c, ok := ctx.Locals(contextKey).(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// SetContext stores the request scoped context on the fiber context so handlers can pass it down
+func SetContext(ctx *fiber.Ctx, c context.Context) {
+	ctx.Locals(contextKey, c)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context carrying the request ID
+func WithRequestID(c context.Context, id string) context.Context {
+	return context.WithValue(c, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by the context, if any
+func RequestID(c context.Context) string {
+	id, _ := c.Value(requestIDKey{}).(string)
+	return id
+}
+
+type actorKey struct{}
+
+// AnonymousActor is reported when no authenticated user is attached to the request
+const AnonymousActor = "anonymous"
+
+// WithActor returns a copy of the context carrying the acting user
+func WithActor(c context.Context, actor string) context.Context {
+	return context.WithValue(c, actorKey{}, actor)
+}
+
+// Actor returns the acting user carried by the context, or AnonymousActor
+func Actor(c context.Context) string {
+	if actor, ok := c.Value(actorKey{}).(string); ok && len(actor) != 0 {
+		return actor
+	}
+	return AnonymousActor
+}
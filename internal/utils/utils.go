@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"errors"
 	"strings"
 
-	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
 )
 
 type Utils interface {
@@ -17,17 +19,37 @@ func NewUtils() Utils {
 	return &utils{}
 }
 
-// ErrorWrapper will wrap the error with a fiber error when it's an unhandled error object
+// duplicateKey and notFound are implemented by the errors of datastores other than mongo
+type duplicateKey interface {
+	DuplicateKey() bool
+}
+
+type notFound interface {
+	NotFound() bool
+}
+
+// ErrorWrapper will wrap datastore errors with the matching domain error
 func (u *utils) ErrorWrapper(err error) error {
+	var dk duplicateKey
+	if errors.As(err, &dk) && dk.DuplicateKey() {
+		return apperrors.Conflict(apperrors.CodeModelAlreadyExists, "Model Already Exists")
+	}
+	var nf notFound
+	if errors.As(err, &nf) && nf.NotFound() {
+		return apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
+	}
 	if we, ok := err.(mongo.WriteException); ok {
 		for _, wce := range we.WriteErrors {
 			if wce.Code == 11000 || wce.Code == 11001 || wce.Code == 12582 || wce.Code == 16460 && strings.Contains(wce.Message, " E11000 ") {
-				return fiber.NewError(fiber.StatusConflict, "Model Already Exists")
+				return apperrors.Conflict(apperrors.CodeModelAlreadyExists, "Model Already Exists")
 			}
 		}
 	}
-	if err.Error() == "mongo: no documents in result" {
-		return fiber.NewError(fiber.StatusOK, "No Operation Executed")
+	if ce, ok := err.(mongo.CommandError); ok && ce.Code == 11000 {
+		return apperrors.Conflict(apperrors.CodeModelAlreadyExists, "Model Already Exists")
+	}
+	if err == mongo.ErrNoDocuments {
+		return apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
 	}
 	return err
 }
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+type AuditController interface {
+	Query(ctx *fiber.Ctx) error
+}
+
+type auditController struct {
+	a audit.Auditor
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func NewAuditController(a audit.Auditor) AuditController {
+	return &auditController{a}
+}
+
+/*
+* PRIVATE
+ */
+
+func parseTime(ctx *fiber.Ctx, key string) (time.Time, error) {
+	v := ctx.Query(key)
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, apperrors.InvalidArgument(apperrors.CodeInvalidArgument, key+" must be an RFC3339 timestamp")
+	}
+	return t, nil
+}
+
+func parseInt(ctx *fiber.Ctx, key string, def int) (int, error) {
+	v := ctx.Query(key)
+	if len(v) == 0 {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 1 {
+		return 0, apperrors.InvalidArgument(apperrors.CodeInvalidPagination, key+" must be a positive integer")
+	}
+	return i, nil
+}
+
+/*
+* PUBLIC
+ */
+
+// Query godoc
+// @Summary Queries the audit log
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Param actor query string false "Acting user"
+// @Param operation query string false "create, update or delete"
+// @Param collection query string false "Collection name"
+// @Param targetId query string false "Target entity ID"
+// @Param from query string false "RFC3339 lower bound"
+// @Param to query string false "RFC3339 upper bound"
+// @Param page query int false "Page, defaults to 1"
+// @Param limit query int false "Limit, defaults to 30"
+// @Success 200 {object} models.Response{data=[]audit.Entry}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /v1/admin/audit [get]
+func (c *auditController) Query(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	from, err := parseTime(ctx, "from")
+	if err != nil {
+		return err
+	}
+	to, err := parseTime(ctx, "to")
+	if err != nil {
+		return err
+	}
+	page, err := parseInt(ctx, "page", 1)
+	if err != nil {
+		return err
+	}
+	limit, err := parseInt(ctx, "limit", 30)
+	if err != nil {
+		return err
+	}
+
+	filter := audit.Filter{
+		Actor:      ctx.Query("actor"),
+		Operation:  ctx.Query("operation"),
+		Collection: ctx.Query("collection"),
+		TargetID:   ctx.Query("targetId"),
+		From:       from,
+		To:         to,
+	}
+	res, err := c.a.Query(rctx, filter, datastore.Pagination{Page: page, Limit: limit})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Get Audit Entries Successful",
+		Data:    res,
+	})
+}
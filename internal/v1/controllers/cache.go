@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+type CacheController interface {
+	Stats(ctx *fiber.Ctx) error
+}
+
+type cacheController struct {
+	ds datastore.Repository
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func NewCacheController(ds datastore.Repository) CacheController {
+	return &cacheController{ds}
+}
+
+/*
+* PUBLIC
+ */
+
+// Stats godoc
+// @Summary Gets the datastore cache hit and miss counters
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Success 200 {object} models.Response{data=datastore.CacheStats}
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v1/admin/cache [get]
+func (c *cacheController) Stats(ctx *fiber.Ctx) error {
+	r, ok := c.ds.(datastore.CacheStatsReporter)
+	if !ok {
+		return apperrors.NotFound(apperrors.CodeResourceNotFound, "Caching is disabled")
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Get Cache Stats Successful",
+		Data:    r.CacheStats(),
+	})
+}
@@ -1,9 +1,18 @@
 package controllers
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
-	log "github.com/sirupsen/logrus"
 
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
 )
@@ -14,6 +23,10 @@ type Controller interface {
 	Create(ctx *fiber.Ctx) error
 	Update(ctx *fiber.Ctx) error
 	Delete(ctx *fiber.Ctx) error
+	History(ctx *fiber.Ctx) error
+	Export(ctx *fiber.Ctx) error
+	Import(ctx *fiber.Ctx) error
+	GetImport(ctx *fiber.Ctx) error
 }
 
 type controller struct {
@@ -28,114 +41,376 @@ func NewController(s services.Service) Controller {
 	return &controller{s}
 }
 
+/*
+* PRIVATE
+ */
+
+// respond renders a service result in the response envelope
+func respond(ctx *fiber.Ctx, status int, res services.ServiceResponse) error {
+	return render.Respond(ctx, status, models.Response{
+		Message: res.Message,
+		Data:    res.Data,
+	})
+}
+
+// respondConditional renders a service result whose data carries validators, clients holding a
+// fresh copy get 304 instead
+func respondConditional(ctx *fiber.Ctx, status int, res services.ServiceResponse, v render.Validators) error {
+	return render.RespondConditional(ctx, status, v, models.Response{
+		Message: res.Message,
+		Data:    res.Data,
+	})
+}
+
+// exportTypes maps export formats to their Content-Type
+var exportTypes = map[string]string{
+	services.FormatCSV:    "text/csv; charset=utf-8",
+	services.FormatNDJSON: "application/x-ndjson",
+}
+
+// uploadFormats maps the media types and file extensions of uploads to their format
+var uploadFormats = map[string]string{
+	"text/csv":             services.FormatCSV,
+	"application/x-ndjson": services.FormatNDJSON,
+	"application/ndjson":   services.FormatNDJSON,
+	".csv":                 services.FormatCSV,
+	".ndjson":              services.FormatNDJSON,
+	".jsonl":               services.FormatNDJSON,
+}
+
+func mediaType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// readUpload Returns the upload and its format, which the format query overrides. Uploads are
+// the body, or the file field of a multipart form
+func readUpload(ctx *fiber.Ctx) (string, []byte, error) {
+	format := ctx.Query("format")
+	mt := mediaType(ctx.Get(fiber.HeaderContentType))
+	if mt != fiber.MIMEMultipartForm {
+		if len(format) == 0 {
+			format = uploadFormats[mt]
+		}
+		if len(format) == 0 {
+			return "", nil, fiber.ErrUnsupportedMediaType
+		}
+		return format, ctx.Body(), nil
+	}
+
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		return "", nil, apperrors.InvalidArgument(apperrors.CodeInvalidBody, "The upload must be the file field of the form")
+	}
+	if len(format) == 0 {
+		format = uploadFormats[mediaType(fh.Header.Get(fiber.HeaderContentType))]
+	}
+	if len(format) == 0 {
+		format = uploadFormats[strings.ToLower(filepath.Ext(fh.Filename))]
+	}
+	if len(format) == 0 {
+		return "", nil, fiber.ErrUnsupportedMediaType
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return "", nil, apperrors.Internal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", nil, apperrors.Internal(err)
+	}
+	return format, data, nil
+}
+
 /*
 * PUBLIC
  */
 
 // Get godoc
 // @Summary Gets a model
-// @Tags Model
-// @Produce json
+// @Tags Model v1
+// @Deprecated
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param page query int true "Page"
+// @Param limit query int false "Limit, defaults to 30"
+// @Param If-None-Match header string false "Weak ETag of a previous response"
 // @Success 200 {object} models.Response
-// @Router / [get]
+// @Success 304 "Not Modified"
+// @Failure 400 {object} problem.Problem
+// @Router /v1/ [get]
 func (c *controller) Get(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
 	p := ctx.Query("page")
 	l := ctx.Query("limit")
 	if len(p) == 0 {
-		return fiber.NewError(409, "Page is required")
+		return apperrors.InvalidArgument(apperrors.CodeInvalidPagination, "Page is required")
 	}
 
-	res, err := c.s.Get(p, l)
+	res, err := c.s.Get(rctx, p, l)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
+		return err
+	}
+	if v, ok := render.Collection(res.Data); ok {
+		return respondConditional(ctx, fiber.StatusOK, res, v)
 	}
-	return ctx.Status(res.Status).JSON(res)
+	return respond(ctx, fiber.StatusOK, res)
 }
 
 // GetById godoc
 // @Summary Gets a model by ID
-// @Tags Model
-// @Produce json
+// @Tags Model v1
+// @Deprecated
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Param If-Modified-Since header string false "Last-Modified of a previous response"
 // @Success 200 {object} models.Response
-// @Router /{id} [get]
+// @Success 304 "Not Modified"
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v1/{id} [get]
 func (c *controller) GetById(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
 	id := ctx.Params("id")
-	res, err := c.s.GetById(id)
+	res, err := c.s.GetById(rctx, id)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return err
 	}
-	return ctx.Status(res.Status).JSON(res)
+	if m, ok := res.Data.(render.Versioned); ok {
+		return respondConditional(ctx, fiber.StatusOK, *res, m.Validators())
+	}
+	return respond(ctx, fiber.StatusOK, *res)
 }
 
 // Create godoc
 // @Summary Creates a model
-// @Tags Model
-// @Produce json
+// @Tags Model v1
+// @Deprecated
+// @Accept json,application/msgpack,application/cbor,xml
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param model body models.Model true "Model"
 // @Success 201 {object} models.Response{data=models.CreateResponse}
-// @Failure 409 {object} models.ValidationError
-// @Router /create [post]
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v1/create [put]
 func (c *controller) Create(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
 	var m models.Model
-	if err := ctx.BodyParser(&m); err != nil {
-		log.Error(err)
+	if err := render.Bind(ctx, &m); err != nil {
+		logger.Error(err)
 		return err
 	}
 
-	errors := m.ValidateStruct()
-	if errors != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(errors)
+	if err := m.Validate(); err != nil {
+		return err
 	}
 
-	res, err := c.s.Create(&m)
+	res, err := c.s.Create(rctx, &m)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return err
 	}
-	return ctx.Status(res.Status).JSON(res)
+	return respond(ctx, fiber.StatusCreated, res)
 }
 
 // Update godoc
 // @Summary Updates a model
-// @Tags Model
-// @Produce json
+// @Tags Model v1
+// @Deprecated
+// @Accept json,application/msgpack,application/cbor,xml
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
+// @Param model body models.Model true "Model"
 // @Success 200 {object} models.Response
-// @Router /{id}/update [put]
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v1/{id}/update [post]
 func (c *controller) Update(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
 	id := ctx.Params("id")
 	var m models.Model
-	if err := ctx.BodyParser(&m); err != nil {
-		log.Error(err)
+	if err := render.Bind(ctx, &m); err != nil {
+		logger.Error(err)
 		return err
 	}
 
 	if m.IsNil() {
-		err := fiber.NewError(fiber.StatusBadRequest, "You require at least one field to update")
-		log.Error(err)
+		err := apperrors.InvalidArgument(apperrors.CodeNoFieldsToUpdate, "You require at least one field to update")
+		logger.Error(err)
+		return err
+	}
+	if err := m.ValidatePartial(); err != nil {
 		return err
 	}
 
-	res, err := c.s.Update(id, &m)
+	res, err := c.s.Update(rctx, id, &m)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return err
 	}
-	return ctx.Status(res.Status).JSON(res)
+	return respond(ctx, fiber.StatusOK, res)
 }
 
 // Delete godoc
 // @Summary Deletes a model
-// @Tags Model
-// @Produce json
+// @Tags Model v1
+// @Deprecated
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
 // @Success 200 {object} models.Response
-// @Router /{id} [delete]
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v1/{id}/delete [delete]
 func (c *controller) Delete(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	id := ctx.Params("id")
+
+	res, err := c.s.Delete(rctx, id)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return respond(ctx, fiber.StatusOK, *res)
+}
+
+// History godoc
+// @Summary Gets the audit history of a model
+// @Tags Model v1
+// @Deprecated
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param page query int false "Page, defaults to 1"
+// @Param limit query int false "Limit, defaults to 30"
+// @Param id path string true "Model ID"
+// @Success 200 {object} models.Response{data=[]audit.Entry}
+// @Failure 400 {object} problem.Problem
+// @Router /v1/{id}/history [get]
+func (c *controller) History(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
 	id := ctx.Params("id")
+	res, err := c.s.History(rctx, id, ctx.Query("page"), ctx.Query("limit"))
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return respond(ctx, fiber.StatusOK, res)
+}
+
+// Export godoc
+// @Summary Streams the models as CSV or NDJSON, oldest first
+// @Tags Model v1
+// @Deprecated
+// @Produce text/csv,application/x-ndjson
+// @Param format query string true "csv or ndjson"
+// @Param name query string false "Name"
+// @Param email query string false "Email"
+// @Param since query string false "Created at or after, RFC 3339"
+// @Param until query string false "Created before, RFC 3339"
+// @Success 200 {string} string
+// @Failure 400 {object} problem.Problem
+// @Router /v1/export [get]
+func (c *controller) Export(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	format := ctx.Query("format")
+	contentType, ok := exportTypes[format]
+	if !ok {
+		return apperrors.InvalidArgument(apperrors.CodeInvalidArgument, "format must be csv or ndjson")
+	}
+	since, err := parseTime(ctx, "since")
+	if err != nil {
+		return err
+	}
+	until, err := parseTime(ctx, "until")
+	if err != nil {
+		return err
+	}
+	filter := services.Filter{Name: ctx.Query("name"), Email: ctx.Query("email"), Since: since, Until: until}
+
+	ctx.Set(fiber.HeaderContentType, contentType)
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="models.%s"`, format))
+	// The body is written once the handler returns, as the datastore cursor is read
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := c.s.Export(rctx, format, filter, w); err != nil {
+			// The status is already sent, the client gets a truncated body
+			logger.Error(err)
+		}
+	})
+	return nil
+}
+
+// Import godoc
+// @Summary Imports models from CSV or NDJSON, matching stored models by email
+// @Description The upload is the body or the file field of a multipart form. CSV uploads need a
+// @Description header with name and email columns. Small uploads are imported during the request,
+// @Description larger ones answer 202 and are imported in the background, poll the Location for progress
+// @Tags Model v1
+// @Deprecated
+// @Accept text/csv,application/x-ndjson,multipart/form-data
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param format query string false "csv or ndjson, defaults to the type of the upload"
+// @Success 200 {object} models.Response{data=models.Import}
+// @Success 202 {object} models.Response{data=models.Import}
+// @Failure 400 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Router /v1/import [post]
+func (c *controller) Import(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	format, data, err := readUpload(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.s.Import(rctx, format, data)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if imp, ok := res.Data.(*models.Import); ok && imp.Status == models.ImportPending {
+		ctx.Location(ctx.Path() + "/" + imp.ID)
+		return respond(ctx, fiber.StatusAccepted, res)
+	}
+	return respond(ctx, fiber.StatusOK, res)
+}
+
+// GetImport godoc
+// @Summary Gets the progress and report of an import
+// @Tags Model v1
+// @Deprecated
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Import ID"
+// @Success 200 {object} models.Response{data=models.Import}
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v1/import/{id} [get]
+func (c *controller) GetImport(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
 
-	res, err := c.s.Delete(id)
+	res, err := c.s.GetImport(rctx, ctx.Params("id"))
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return err
 	}
-	return ctx.Status(res.Status).JSON(res)
+	return respond(ctx, fiber.StatusOK, *res)
 }
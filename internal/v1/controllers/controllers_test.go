@@ -2,16 +2,22 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -30,6 +36,8 @@ type TestCase struct {
 	// Test input
 	method         string
 	route          string
+	accept         string
+	headers        map[string]string
 	payload        models.Model
 	mockedResponse services.ServiceResponse
 	mockedError    error
@@ -48,6 +56,12 @@ func (tc TestCase) CaseRunner(app *fiber.App) (*http.Response, []byte, error) {
 	// Setup Request
 	req, _ := http.NewRequest(tc.method, tc.route, contentBuffer)
 	req.Header.Set("Content-Type", "application/json")
+	if len(tc.accept) != 0 {
+		req.Header.Set("Accept", tc.accept)
+	}
+	for k, v := range tc.headers {
+		req.Header.Set(k, v)
+	}
 
 	res, err := app.Test(req, -1)
 
@@ -60,12 +74,22 @@ func (tc TestCase) CaseRunner(app *fiber.App) (*http.Response, []byte, error) {
 	MOCKS
 */
 // TODO: Maybe move somewhere else or smthing?
-func (m *MockService) Create(model *models.Model) (services.ServiceResponse, error) {
+func (m *MockService) Create(ctx context.Context, model *models.Model) (services.ServiceResponse, error) {
 	args := m.Called(model)
 	return args.Get(0).(services.ServiceResponse), args.Error(1)
 }
 
-func (m *MockService) Update(id string, model *models.Model) (services.ServiceResponse, error) {
+func (m *MockService) Get(ctx context.Context, page string, limit string) (services.ServiceResponse, error) {
+	args := m.Called(page, limit)
+	return args.Get(0).(services.ServiceResponse), args.Error(1)
+}
+
+func (m *MockService) GetById(ctx context.Context, id string) (*services.ServiceResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(*services.ServiceResponse), args.Error(1)
+}
+
+func (m *MockService) Update(ctx context.Context, id string, model *models.Model) (services.ServiceResponse, error) {
 	args := m.Called(id, model)
 	return args.Get(0).(services.ServiceResponse), args.Error(1)
 }
@@ -89,13 +113,12 @@ func (suite *ControllerSuite) TestCreate() {
 				Email: "test@test.com",
 			},
 			mockedResponse: services.ServiceResponse{
-				Status:  fiber.StatusCreated,
 				Message: "Created Model Successfully",
 			},
 			mockedError:   nil,
 			expectedError: false,
 			expectedCode:  fiber.StatusCreated,
-			expectedBody:  "{\"Status\":201,\"message\":\"Created Model Successfully\"}",
+			expectedBody:  "{\"message\":\"Created Model Successfully\"}",
 		},
 		{
 			description: "[Create] Missing Required Field Email",
@@ -105,13 +128,12 @@ func (suite *ControllerSuite) TestCreate() {
 				Name: "test",
 			},
 			mockedResponse: services.ServiceResponse{
-				Status:  fiber.StatusCreated,
 				Message: "Created Model Successfully",
 			},
 			mockedError:   nil,
 			expectedError: true,
 			expectedCode:  fiber.StatusBadRequest,
-			expectedBody:  "[{\"failedField\":\"Model.Email\",\"tag\":\"required\",\"value\":\"\"}]",
+			expectedBody:  "{\"type\":\"/problems/bad-request\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Model failed validation\",\"instance\":\"/api/v1/create\",\"code\":\"VALIDATION_FAILED\",\"errors\":[{\"field\":\"email\",\"rule\":\"required\",\"message\":\"email is required\"}]}",
 		},
 		{
 			description: "[Create] Missing Required Field Name",
@@ -121,13 +143,60 @@ func (suite *ControllerSuite) TestCreate() {
 				Email: "test@test.com",
 			},
 			mockedResponse: services.ServiceResponse{
-				Status:  fiber.StatusCreated,
 				Message: "Created Model Successfully",
 			},
 			mockedError:   nil,
 			expectedError: true,
 			expectedCode:  fiber.StatusBadRequest,
-			expectedBody:  "[{\"failedField\":\"Model.Name\",\"tag\":\"required\",\"value\":\"\"}]",
+			expectedBody:  "{\"type\":\"/problems/bad-request\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"Model failed validation\",\"instance\":\"/api/v1/create\",\"code\":\"VALIDATION_FAILED\",\"errors\":[{\"field\":\"name\",\"rule\":\"required\",\"message\":\"name is required\"}]}",
+		},
+		{
+			description: "[Create] Already Exists",
+			method:      "PUT",
+			route:       "/api/v1/create",
+			payload: models.Model{
+				Name:  "test",
+				Email: "exists@test.com",
+			},
+			mockedResponse: services.ServiceResponse{},
+			mockedError:    apperrors.Conflict(apperrors.CodeModelAlreadyExists, "Model Already Exists"),
+			expectedError:  true,
+			expectedCode:   fiber.StatusConflict,
+			expectedBody:   "{\"type\":\"/problems/conflict\",\"title\":\"Conflict\",\"status\":409,\"detail\":\"Model Already Exists\",\"instance\":\"/api/v1/create\",\"code\":\"MODEL_ALREADY_EXISTS\"}",
+		},
+		{
+			description: "[Create] Negotiates XML",
+			method:      "PUT",
+			route:       "/api/v1/create",
+			accept:      "application/xml",
+			payload: models.Model{
+				Name:  "test",
+				Email: "xml@test.com",
+			},
+			mockedResponse: services.ServiceResponse{
+				Message: "Created Model Successfully",
+			},
+			mockedError:   nil,
+			expectedError: false,
+			expectedCode:  fiber.StatusCreated,
+			expectedBody:  "<response><message>Created Model Successfully</message></response>",
+		},
+		{
+			description: "[Create] Not Acceptable",
+			method:      "PUT",
+			route:       "/api/v1/create",
+			accept:      "text/csv",
+			payload: models.Model{
+				Name:  "test",
+				Email: "csv@test.com",
+			},
+			mockedResponse: services.ServiceResponse{
+				Message: "Created Model Successfully",
+			},
+			mockedError:   nil,
+			expectedError: true,
+			expectedCode:  fiber.StatusNotAcceptable,
+			expectedBody:  "{\"type\":\"/problems/not-acceptable\",\"title\":\"Not Acceptable\",\"status\":406,\"detail\":\"Not Acceptable\",\"instance\":\"/api/v1/create\",\"code\":\"NOT_ACCEPTABLE\"}",
 		},
 	}
 
@@ -137,15 +206,15 @@ func (suite *ControllerSuite) TestCreate() {
 	// Initialize stuff
 	controller := NewController(mockService)
 
-	// TODO: Move errorhandler somewhere else and use it here to validate mockedError
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
 	v1.Put("/create", controller.Create)
 
 	for _, test := range tests {
-		// Mock Service call
-		mockService.On("Create", &test.payload).Return(test.mockedResponse, test.mockedError)
+		// Mock Service call, copy the payload so each expectation keeps its own pointer
+		payload := test.payload
+		mockService.On("Create", &payload).Return(test.mockedResponse, test.mockedError)
 		res, body, err := test.CaseRunner(app)
 
 		// Asserts
@@ -171,13 +240,12 @@ func (suite *ControllerSuite) TestUpdate() {
 				Email: "test@test.com",
 			},
 			mockedResponse: services.ServiceResponse{
-				Status:  fiber.StatusOK,
 				Message: "Update Successful",
 			},
 			mockedError:   nil,
 			expectedError: false,
 			expectedCode:  fiber.StatusOK,
-			expectedBody:  "{\"Status\":200,\"message\":\"Update Successful\"}",
+			expectedBody:  "{\"message\":\"Update Successful\"}",
 		},
 		{
 			description:    "[Update] Empty Payload",
@@ -187,7 +255,7 @@ func (suite *ControllerSuite) TestUpdate() {
 			mockedResponse: services.ServiceResponse{}, // We wont reach this point in this test case
 			expectedError:  true,
 			expectedCode:   fiber.StatusBadRequest,
-			expectedBody:   "You require at least one field to update",
+			expectedBody:   "{\"type\":\"/problems/bad-request\",\"title\":\"Bad Request\",\"status\":400,\"detail\":\"You require at least one field to update\",\"instance\":\"/api/v1/mockid/update\",\"code\":\"NO_FIELDS_TO_UPDATE\"}",
 		},
 	}
 
@@ -197,7 +265,7 @@ func (suite *ControllerSuite) TestUpdate() {
 	// Initialize stuff
 	controller := NewController(mockService)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
 	api := app.Group("/api")
 	v1 := api.Group("/v1")
 	v1.Post("/:id/update", controller.Update)
@@ -217,6 +285,131 @@ func (suite *ControllerSuite) TestUpdate() {
 	}
 }
 
+func (suite *ControllerSuite) TestGetById() {
+	t := suite.T()
+
+	modified := time.Date(2021, 1, 5, 10, 30, 15, 500, time.UTC)
+	model := models.Model{ID: "5ff3fc0e00acd4328da25d92", Name: "test", UpdatedAt: modified}
+	route := "/api/v1/" + model.ID
+	body := "{\"message\":\"Get Model by ID Successful\",\"data\":{\"id\":\"5ff3fc0e00acd4328da25d92\",\"name\":\"test\",\"email\":\"\",\"createdAt\":\"0001-01-01T00:00:00Z\",\"updatedAt\":\"2021-01-05T10:30:15.0000005Z\"}}"
+
+	mockService := new(MockService)
+	mockService.On("GetById", model.ID).Return(&services.ServiceResponse{
+		Message: "Get Model by ID Successful",
+		Data:    model,
+	}, nil)
+
+	controller := NewController(mockService)
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	api := app.Group("/api")
+	v1 := api.Group("/v1")
+	v1.Get("/:id", controller.GetById)
+
+	// The first response hands out the validators the cases send back
+	res, _, err := TestCase{method: "GET", route: route}.CaseRunner(app)
+	require.Nil(t, err)
+	etag := res.Header.Get(fiber.HeaderETag)
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "Tue, 05 Jan 2021 10:30:15 GMT", res.Header.Get(fiber.HeaderLastModified))
+
+	tests := []TestCase{
+		{
+			description:  "[GetById] Matching ETag",
+			headers:      map[string]string{fiber.HeaderIfNoneMatch: etag},
+			expectedCode: fiber.StatusNotModified,
+		},
+		{
+			description:  "[GetById] Matching weak ETag in a list",
+			headers:      map[string]string{fiber.HeaderIfNoneMatch: "\"stale\", W/" + etag},
+			expectedCode: fiber.StatusNotModified,
+		},
+		{
+			description:  "[GetById] Stale ETag",
+			headers:      map[string]string{fiber.HeaderIfNoneMatch: "\"stale\""},
+			expectedCode: fiber.StatusOK,
+			expectedBody: body,
+		},
+		{
+			description:  "[GetById] ETag of another format",
+			accept:       "application/xml",
+			headers:      map[string]string{fiber.HeaderIfNoneMatch: etag},
+			expectedCode: fiber.StatusOK,
+			expectedBody: "<response><message>Get Model by ID Successful</message><data><id>5ff3fc0e00acd4328da25d92</id><name>test</name><email></email><createdAt>0001-01-01T00:00:00Z</createdAt><updatedAt>2021-01-05T10:30:15.0000005Z</updatedAt></data></response>",
+		},
+		{
+			description:  "[GetById] Not modified since",
+			headers:      map[string]string{fiber.HeaderIfModifiedSince: "Tue, 05 Jan 2021 10:30:15 GMT"},
+			expectedCode: fiber.StatusNotModified,
+		},
+		{
+			description:  "[GetById] Modified since",
+			headers:      map[string]string{fiber.HeaderIfModifiedSince: "Tue, 05 Jan 2021 10:30:14 GMT"},
+			expectedCode: fiber.StatusOK,
+			expectedBody: body,
+		},
+		{
+			description:  "[GetById] If-None-Match takes precedence",
+			headers:      map[string]string{fiber.HeaderIfNoneMatch: "\"stale\"", fiber.HeaderIfModifiedSince: "Tue, 05 Jan 2021 10:30:15 GMT"},
+			expectedCode: fiber.StatusOK,
+			expectedBody: body,
+		},
+	}
+
+	for _, test := range tests {
+		test.method = "GET"
+		test.route = route
+		res, body, err := test.CaseRunner(app)
+
+		// Asserts
+		assert.Equal(t, test.expectedCode, res.StatusCode, test.description)
+		assert.Nilf(t, err, test.description)
+		assert.Equalf(t, test.expectedBody, string(body), test.description)
+		assert.NotEmptyf(t, res.Header.Get(fiber.HeaderETag), test.description)
+	}
+}
+
+func (suite *ControllerSuite) TestGet() {
+	t := suite.T()
+
+	page := []models.Model{{ID: "5ff3fc0e00acd4328da25d92", Name: "test"}}
+	mockService := new(MockService)
+	mockService.On("Get", "1", "").Return(services.ServiceResponse{Message: "Get Models Successful", Data: &page}, nil)
+
+	controller := NewController(mockService)
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	api := app.Group("/api")
+	v1 := api.Group("/v1")
+	v1.Get("/", controller.Get)
+
+	res, _, err := TestCase{method: "GET", route: "/api/v1/?page=1"}.CaseRunner(app)
+	require.Nil(t, err)
+	etag := res.Header.Get(fiber.HeaderETag)
+	assert.True(t, strings.HasPrefix(etag, "W/"), "[Get] Weak ETag")
+	assert.Empty(t, res.Header.Get(fiber.HeaderLastModified), "[Get] No Last-Modified")
+
+	res, body, err := TestCase{
+		method:  "GET",
+		route:   "/api/v1/?page=1",
+		headers: map[string]string{fiber.HeaderIfNoneMatch: etag},
+	}.CaseRunner(app)
+	assert.Nil(t, err)
+	assert.Equal(t, fiber.StatusNotModified, res.StatusCode, "[Get] Not modified")
+	assert.Empty(t, body, "[Get] Not modified body")
+
+	// Any change to an item changes the list
+	page[0].UpdatedAt = time.Now()
+	res, _, err = TestCase{
+		method:  "GET",
+		route:   "/api/v1/?page=1",
+		headers: map[string]string{fiber.HeaderIfNoneMatch: etag},
+	}.CaseRunner(app)
+	assert.Nil(t, err)
+	assert.Equal(t, fiber.StatusOK, res.StatusCode, "[Get] Modified")
+	assert.NotEqual(t, etag, res.Header.Get(fiber.HeaderETag), "[Get] New ETag")
+}
+
 func TestRunControllerSuite(t *testing.T) {
 	suite.Run(t, new(ControllerSuite))
 }
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+type JobController interface {
+	List(ctx *fiber.Ctx) error
+	Get(ctx *fiber.Ctx) error
+	Retry(ctx *fiber.Ctx) error
+	Cancel(ctx *fiber.Ctx) error
+}
+
+type jobController struct {
+	q jobs.Queue
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func NewJobController(q jobs.Queue) JobController {
+	return &jobController{q}
+}
+
+/*
+* PRIVATE
+ */
+
+func parseStatus(ctx *fiber.Ctx) (string, error) {
+	status := ctx.Query("status")
+	switch status {
+	case "", jobs.StatusPending, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusDead, jobs.StatusCancelled:
+		return status, nil
+	}
+	return "", apperrors.InvalidArgument(apperrors.CodeInvalidArgument, "status must be pending, running, succeeded, dead or cancelled")
+}
+
+/*
+* PUBLIC
+ */
+
+// List godoc
+// @Summary Lists background jobs, the next to run first
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Param status query string false "pending, running, succeeded, dead or cancelled"
+// @Param type query string false "Job type"
+// @Param page query int false "Page, defaults to 1"
+// @Param limit query int false "Limit, defaults to 30"
+// @Success 200 {object} models.Response{data=[]jobs.Job}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /v1/admin/jobs [get]
+func (c *jobController) List(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	status, err := parseStatus(ctx)
+	if err != nil {
+		return err
+	}
+	page, err := parseInt(ctx, "page", 1)
+	if err != nil {
+		return err
+	}
+	limit, err := parseInt(ctx, "limit", 30)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.q.List(rctx, jobs.Filter{Status: status, Type: ctx.Query("type")}, datastore.Pagination{Page: page, Limit: limit})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Get Jobs Successful",
+		Data:    res,
+	})
+}
+
+// Get godoc
+// @Summary Gets a background job
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.Response{data=jobs.Job}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v1/admin/jobs/{id} [get]
+func (c *jobController) Get(ctx *fiber.Ctx) error {
+	res, err := c.q.Get(utils.Context(ctx), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Get Job Successful",
+		Data:    res,
+	})
+}
+
+// Retry godoc
+// @Summary Runs a dead or cancelled job again with a fresh set of attempts
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.Response{data=jobs.Job}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v1/admin/jobs/{id}/retry [post]
+func (c *jobController) Retry(ctx *fiber.Ctx) error {
+	res, err := c.q.Retry(utils.Context(ctx), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Retry Job Successful",
+		Data:    res,
+	})
+}
+
+// Cancel godoc
+// @Summary Cancels a pending or running job
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.Response{data=jobs.Job}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v1/admin/jobs/{id}/cancel [post]
+func (c *jobController) Cancel(ctx *fiber.Ctx) error {
+	res, err := c.q.Cancel(utils.Context(ctx), ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Cancel Job Successful",
+		Data:    res,
+	})
+}
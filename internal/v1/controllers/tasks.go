@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/scheduler"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+type TaskController interface {
+	Runs(ctx *fiber.Ctx) error
+}
+
+type taskController struct {
+	s scheduler.Scheduler
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func NewTaskController(s scheduler.Scheduler) TaskController {
+	return &taskController{s}
+}
+
+/*
+* PUBLIC
+ */
+
+// Runs godoc
+// @Summary Lists the runs of a scheduled task, newest first
+// @Tags Admin
+// @Produce json,application/msgpack,application/cbor,xml
+// @Security BasicAuth
+// @Param name path string true "Task name"
+// @Param page query int false "Page, defaults to 1"
+// @Param limit query int false "Limit, defaults to 30"
+// @Success 200 {object} models.Response{data=[]scheduler.Run}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v1/admin/tasks/{name}/runs [get]
+func (c *taskController) Runs(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	page, err := parseInt(ctx, "page", 1)
+	if err != nil {
+		return err
+	}
+	limit, err := parseInt(ctx, "limit", 30)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.s.Runs(rctx, ctx.Params("name"), datastore.Pagination{Page: page, Limit: limit})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return render.Respond(ctx, fiber.StatusOK, models.Response{
+		Message: "Get Task Runs Successful",
+		Data:    res,
+	})
+}
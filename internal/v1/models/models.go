@@ -1,51 +1,93 @@
 package models
 
 import (
+	"context"
+	"encoding/xml"
 	"reflect"
+	"strconv"
 	"time"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
 )
 
+// Response Is the envelope every successful response is rendered in
 type Response struct {
-	Message string      `json:"message,omitempty" example:"Response Message"`
-	Data    interface{} `json:"data,omitempty"`
+	XMLName xml.Name    `json:"-" xml:"response"`
+	Message string      `json:"message,omitempty" xml:"message,omitempty" example:"Response Message"`
+	Data    interface{} `json:"data,omitempty" xml:"data,omitempty"`
 }
 
 type CreateResponse struct {
-	InsertedID string `json:"insertedId" example:"5ff3fc0e00acd4328da25d92"`
+	InsertedID string `json:"insertedId" xml:"insertedId" example:"5ff3fc0e00acd4328da25d92"`
 }
 
-type ValidationError struct {
-	FailedField string `json:"failedField" example:"email"`
-	Tag         string `json:"tag" example:"required"`
-	Value       string `json:"value" example:""`
+type Model struct {
+	ID        string    `json:"id,omitempty" xml:"id,omitempty" bson:"_id,omitempty" example:"5ff3fc0e00acd4328da25d92"`
+	Name      string    `json:"name" xml:"name" bson:"name,omitempty" validate:"required" example:"Bob"`
+	Email     string    `json:"email" xml:"email" bson:"email,omitempty" validate:"required,email" example:"bob@bob.com"`
+	CreatedAt time.Time `json:"createdAt" xml:"createdAt" bson:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" xml:"updatedAt" bson:"updated_at"`
 }
 
-type Model struct {
-	ID        string    `json:"id,omitempty" bson:"_id,omitempty" example:"5ff3fc0e00acd4328da25d92"`
-	Name      string    `json:"name" bson:"name,omitempty" validate:"required" example:"Bob"`
-	Email     string    `json:"email" bson:"email,omitempty" validate:"required,email" example:"bob@bob.com"`
-	CreatedAt time.Time `json:"createdAt" bson:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" bson:"updated_at"`
-}
-
-// https://pkg.go.dev/github.com/go-playground/validator
-// ValidateStruct Validates if Struct is valid
-func (m Model) ValidateStruct() []*ValidationError {
-	var errors []*ValidationError
-	validate := validator.New()
-	err := validate.Struct(m)
-	if err != nil {
-		for _, err := range err.(validator.ValidationErrors) {
-			var element ValidationError
-			element.FailedField = err.StructNamespace()
-			element.Tag = err.Tag()
-			element.Value = err.Param()
-			errors = append(errors, &element)
-		}
+// Statuses of an Import
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportSucceeded = "succeeded"
+	// ImportFailed imports stopped on a datastore error, their job retries them from the start
+	ImportFailed = "failed"
+)
+
+// Import Is the progress of a models import and the report of its rejected rows
+type Import struct {
+	ID        string        `json:"id,omitempty" xml:"id,omitempty" bson:"_id,omitempty" example:"5ff3fc0e00acd4328da25d92"`
+	Format    string        `json:"format" xml:"format" bson:"format" example:"csv"`
+	Status    string        `json:"status" xml:"status" bson:"status" example:"running"`
+	Total     int           `json:"total" xml:"total" bson:"total" example:"2000"`
+	Processed int           `json:"processed" xml:"processed" bson:"processed" example:"500"`
+	Created   int           `json:"created" xml:"created" bson:"created" example:"480"`
+	Updated   int           `json:"updated" xml:"updated" bson:"updated" example:"18"`
+	Failed    int           `json:"failed" xml:"failed" bson:"failed" example:"2"`
+	Errors    []ImportError `json:"errors,omitempty" xml:"errors>error,omitempty" bson:"errors,omitempty"`
+	Error     string        `json:"error,omitempty" xml:"error,omitempty" bson:"error,omitempty" example:""`
+	// Data is the upload of an import run as a job, it is dropped once the import succeeds
+	Data       string    `json:"-" xml:"-" bson:"data,omitempty"`
+	CreatedAt  time.Time `json:"createdAt" xml:"createdAt" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" xml:"updatedAt" bson:"updated_at"`
+	FinishedAt time.Time `json:"finishedAt,omitempty" xml:"finishedAt,omitempty" bson:"finished_at,omitempty"`
+}
+
+// ImportError Is a rejected row of an import
+type ImportError struct {
+	// Line is where the row starts in the upload, the CSV header is line 1
+	Line    int                    `json:"line" xml:"line" bson:"line" example:"3"`
+	Message string                 `json:"message" xml:"message" bson:"message" example:"Model failed validation"`
+	Fields  []apperrors.FieldError `json:"fields,omitempty" xml:"fields>field,omitempty" bson:"fields,omitempty"`
+}
+
+// Validate Returns a domain validation error when the struct is invalid, fields are named by
+// their JSON name
+func (m Model) Validate() error {
+	return validation.Default().Struct(context.Background(), m)
+}
+
+// ValidatePartial Is Validate for updates, only the fields that are set are checked
+func (m Model) ValidatePartial() error {
+	return validation.Default().Partial(context.Background(), m)
+}
+
+// Validators Derives the ETag and Last-Modified of a model from its ID and latest timestamp
+func (m Model) Validators() render.Validators {
+	modified := m.CreatedAt
+	if m.UpdatedAt.After(modified) {
+		modified = m.UpdatedAt
+	}
+	return render.Validators{
+		Version:      m.ID + ":" + strconv.FormatInt(modified.UnixNano(), 36),
+		LastModified: modified,
 	}
-	return errors
 }
 
 func (m Model) IsNil() bool {
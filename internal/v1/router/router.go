@@ -1,26 +1,209 @@
 package router
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
 	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
-	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/scheduler"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/controllers"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
 )
 
-func LoadRoutes(api fiber.Router, ds datastore.Repository) {
-	// Initialize Utils
-	u := utils.NewUtils()
-
-	// Initialize Service and Controller
-	s := services.NewService(ds, u)
+func LoadRoutes(v1 fiber.Router, s services.Service) {
+	// Initialize Controller
 	c := controllers.NewController(s)
 
-	// Register Routes and Handlers
-	v1 := api.Group("/v1")
+	// Register Routes and Handlers, static paths before /:id
 	v1.Get("/", c.Get)
+	v1.Get("/export", c.Export)
+	v1.Post("/import", c.Import)
+	v1.Get("/import/:id", c.GetImport)
 	v1.Get("/:id", c.GetById)
+	v1.Get("/:id/history", c.History)
 	v1.Put("/create", c.Create)
 	v1.Post("/:id/update", c.Update)
 	v1.Delete("/:id/delete", c.Delete)
 }
+
+// LoadAdminRoutes registers the admin API, admin must already be guarded by authentication
+func LoadAdminRoutes(admin fiber.Router, a audit.Auditor, ds datastore.Repository, q jobs.Queue, s scheduler.Scheduler) {
+	c := controllers.NewAuditController(a)
+	cc := controllers.NewCacheController(ds)
+	jc := controllers.NewJobController(q)
+	tc := controllers.NewTaskController(s)
+
+	admin.Get("/audit", c.Query)
+	admin.Get("/cache", cc.Stats)
+	admin.Get("/jobs", jc.List)
+	admin.Get("/jobs/:id", jc.Get)
+	admin.Post("/jobs/:id/retry", jc.Retry)
+	admin.Post("/jobs/:id/cancel", jc.Cancel)
+	admin.Get("/tasks/:name/runs", tc.Runs)
+}
+
+// envelope describes a models.Response carrying data
+func envelope(description string, data interface{}) openapi.Body {
+	return openapi.Body{Description: description, Value: models.Response{}, Fields: map[string]interface{}{"data": data}}
+}
+
+// Operations Describes the routes of LoadRoutes, keyed by their path under the version
+func Operations() openapi.Operations {
+	tags := []string{"Model v1"}
+	page := openapi.Param{Name: "page", In: "query", Description: "Page, defaults to 1", Value: 0}
+	limit := openapi.Param{Name: "limit", In: "query", Description: "Limit, defaults to 30", Value: 0}
+	ifNoneMatch := openapi.Param{Name: fiber.HeaderIfNoneMatch, In: "header", Description: "ETag of a previous response"}
+	ifModifiedSince := openapi.Param{Name: fiber.HeaderIfModifiedSince, In: "header", Description: "Last-Modified of a previous response"}
+	model := &openapi.Body{Description: "Model", Value: models.Model{}}
+	message := openapi.Body{Description: "OK", Value: models.Response{}}
+	notModified := openapi.Body{Description: "Not Modified"}
+	formats := []string{services.FormatCSV, services.FormatNDJSON}
+	pending := envelope("Import pending, poll the Location for progress", models.Import{})
+	pending.Headers = []string{fiber.HeaderLocation}
+
+	return openapi.Operations{
+		"GET /": {
+			Summary:    "Gets a page of models",
+			Tags:       tags,
+			Deprecated: true,
+			Params:     []openapi.Param{{Name: "page", In: "query", Description: "Page", Required: true, Value: 0}, limit, ifNoneMatch},
+			Responses:  map[int]openapi.Body{fiber.StatusOK: envelope("Models", []models.Model{}), fiber.StatusNotModified: notModified},
+		},
+		"GET /{id}": {
+			Summary:    "Gets a model by ID",
+			Tags:       tags,
+			Deprecated: true,
+			Params:     []openapi.Param{ifNoneMatch, ifModifiedSince},
+			Responses:  map[int]openapi.Body{fiber.StatusOK: envelope("Model", models.Model{}), fiber.StatusNotModified: notModified},
+		},
+		"PUT /create": {
+			Summary:    "Creates a model",
+			Tags:       tags,
+			Deprecated: true,
+			Body:       model,
+			Responses:  map[int]openapi.Body{fiber.StatusCreated: envelope("Created", models.CreateResponse{})},
+		},
+		"POST /{id}/update": {
+			Summary:    "Updates the fields of a model that are set",
+			Tags:       tags,
+			Deprecated: true,
+			Body:       model,
+			Partial:    true,
+			Responses:  map[int]openapi.Body{fiber.StatusOK: message},
+		},
+		"DELETE /{id}/delete": {
+			Summary:    "Deletes a model",
+			Tags:       tags,
+			Deprecated: true,
+			Responses:  map[int]openapi.Body{fiber.StatusOK: message},
+		},
+		"GET /{id}/history": {
+			Summary:    "Gets the audit history of a model",
+			Tags:       tags,
+			Deprecated: true,
+			Params:     []openapi.Param{page, limit},
+			Responses:  map[int]openapi.Body{fiber.StatusOK: envelope("Audit entries", []audit.Entry{})},
+		},
+		"GET /export": {
+			Summary:    "Streams the models as CSV or NDJSON, oldest first",
+			Tags:       tags,
+			Deprecated: true,
+			Params: []openapi.Param{
+				{Name: "format", In: "query", Required: true, Enum: formats},
+				{Name: "name", In: "query"},
+				{Name: "email", In: "query"},
+				{Name: "since", In: "query", Description: "Created at or after", Value: time.Time{}},
+				{Name: "until", In: "query", Description: "Created before", Value: time.Time{}},
+			},
+			Responses: map[int]openapi.Body{fiber.StatusOK: {Description: "Models", Value: "", ContentTypes: []string{"text/csv", "application/x-ndjson"}}},
+		},
+		"POST /import": {
+			Summary:     "Imports models from CSV or NDJSON, matching stored models by email",
+			Description: "The upload is the body or the file field of a multipart form. Small uploads are imported during the request, larger ones answer 202 and are imported in the background, poll the Location for progress",
+			Tags:        tags,
+			Deprecated:  true,
+			Params:      []openapi.Param{{Name: "format", In: "query", Description: "Defaults to the type of the upload", Enum: formats}},
+			Body:        &openapi.Body{Description: "Upload", Value: "", ContentTypes: []string{"text/csv", "application/x-ndjson", fiber.MIMEMultipartForm}},
+			Responses: map[int]openapi.Body{
+				fiber.StatusOK:       envelope("Imported", models.Import{}),
+				fiber.StatusAccepted: pending,
+			},
+		},
+		"GET /import/{id}": {
+			Summary:    "Gets the progress and report of an import",
+			Tags:       tags,
+			Deprecated: true,
+			Responses:  map[int]openapi.Body{fiber.StatusOK: envelope("Import", models.Import{})},
+		},
+	}
+}
+
+// AdminOperations Describes the routes of LoadAdminRoutes, keyed by their path under the admin API
+func AdminOperations() openapi.Operations {
+	tags := []string{"Admin"}
+	security := []string{openapi.BasicAuth}
+	page := openapi.Param{Name: "page", In: "query", Description: "Page, defaults to 1", Value: 0}
+	limit := openapi.Param{Name: "limit", In: "query", Description: "Limit, defaults to 30", Value: 0}
+	statuses := []string{jobs.StatusPending, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusDead, jobs.StatusCancelled}
+
+	return openapi.Operations{
+		"GET /audit": {
+			Summary:  "Queries the audit log",
+			Tags:     tags,
+			Security: security,
+			Params: []openapi.Param{
+				{Name: "actor", In: "query"},
+				{Name: "operation", In: "query", Enum: []string{audit.OperationCreate, audit.OperationUpdate, audit.OperationDelete}},
+				{Name: "collection", In: "query"},
+				{Name: "targetId", In: "query"},
+				{Name: "from", In: "query", Value: time.Time{}},
+				{Name: "to", In: "query", Value: time.Time{}},
+				page,
+				limit,
+			},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Audit entries", []audit.Entry{})},
+		},
+		"GET /cache": {
+			Summary:   "Gets the datastore cache hit and miss counters",
+			Tags:      tags,
+			Security:  security,
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Statistics", datastore.CacheStats{})},
+		},
+		"GET /jobs": {
+			Summary:   "Lists background jobs, the next to run first",
+			Tags:      tags,
+			Security:  security,
+			Params:    []openapi.Param{{Name: "status", In: "query", Enum: statuses}, {Name: "type", In: "query"}, page, limit},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Jobs", []jobs.Job{})},
+		},
+		"GET /jobs/{id}": {
+			Summary:   "Gets a background job",
+			Tags:      tags,
+			Security:  security,
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Job", jobs.Job{})},
+		},
+		"POST /jobs/{id}/retry": {
+			Summary:   "Runs a dead or cancelled job again with a fresh set of attempts",
+			Tags:      tags,
+			Security:  security,
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Job", jobs.Job{})},
+		},
+		"POST /jobs/{id}/cancel": {
+			Summary:   "Cancels a pending or running job",
+			Tags:      tags,
+			Security:  security,
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Job", jobs.Job{})},
+		},
+		"GET /tasks/{name}/runs": {
+			Summary:   "Lists the runs of a scheduled task, newest first",
+			Tags:      tags,
+			Security:  security,
+			Params:    []openapi.Param{page, limit},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Runs", []scheduler.Run{})},
+		},
+	}
+}
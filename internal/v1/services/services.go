@@ -1,150 +1,289 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"strconv"
 	"time"
 
-	"github.com/gofiber/fiber/v2"
-	log "github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
 	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
 	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
 	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
 )
 
 type Service interface {
-	Get(page string, limit string) (resp ServiceResponse, err error)
-	GetById(id string) (*ServiceResponse, error)
-	Create(data *models.Model) (resp ServiceResponse, err error)
-	Update(id string, data *models.Model) (resp ServiceResponse, err error)
-	Delete(id string) (*ServiceResponse, error)
+	Get(ctx context.Context, page string, limit string) (resp ServiceResponse, err error)
+	// Find Returns a page of the models matching filter, oldest first
+	Find(ctx context.Context, filter Filter, page string, limit string) (resp ServiceResponse, err error)
+	GetById(ctx context.Context, id string) (*ServiceResponse, error)
+	// GetByIds Returns the models of ids in a single datastore read, missing models are left out
+	GetByIds(ctx context.Context, ids []string) (resp ServiceResponse, err error)
+	Create(ctx context.Context, data *models.Model) (resp ServiceResponse, err error)
+	Update(ctx context.Context, id string, data *models.Model) (resp ServiceResponse, err error)
+	// Replace Stores data in place of the model, only its ID and creation time are kept
+	Replace(ctx context.Context, id string, data *models.Model) (resp ServiceResponse, err error)
+	Delete(ctx context.Context, id string) (*ServiceResponse, error)
+	History(ctx context.Context, id string, page string, limit string) (resp ServiceResponse, err error)
+	// Export Writes the models matching filter to w, oldest first, without holding them all
+	Export(ctx context.Context, format string, filter Filter, w io.Writer) error
+	// Import Upserts the rows of a CSV or NDJSON upload by email and reports the rejected rows.
+	// Uploads of more than Config.ImportSyncRows rows are stored and imported by a job instead
+	Import(ctx context.Context, format string, data []byte) (resp ServiceResponse, err error)
+	GetImport(ctx context.Context, id string) (*ServiceResponse, error)
+	// RunImport Imports a stored upload, it is the handler of the jobs enqueued by Import
+	RunImport(ctx context.Context, id string) error
+}
+
+// Config Is the Service config
+type Config struct {
+	// ImportBatchSize is how many rows of an import are upserted per datastore read
+	ImportBatchSize int
+	// ImportSyncRows is the most rows imported during the request
+	ImportSyncRows int
 }
 
 type service struct {
-	r datastore.Repository
-	u utils.Utils
+	r      datastore.Repository
+	u      utils.Utils
+	a      audit.Auditor
+	q      jobs.Queue
+	config Config
 }
 
+// ServiceResponse Is the transport agnostic result of a service call
 type ServiceResponse struct {
-	Status  int
-	Message string      `json:"message" example:"Some Message"`
-	Data    interface{} `json:"data,omitempty"`
+	Message string
+	Data    interface{}
 }
 
 /*
 * CONSTRUCTOR
  */
 
-func NewService(ds datastore.Repository, u utils.Utils) Service {
-	return &service{r: ds, u: u}
+// NewService Will create the models Service, large imports are enqueued on q
+func NewService(ds datastore.Repository, u utils.Utils, a audit.Auditor, q jobs.Queue, config *Config) Service {
+	return &service{r: ds, u: u, a: a, q: q, config: *config}
 }
 
 /*
 * PRIVATE
  */
 
-func (s *service) mapPayload(res interface{}, response interface{}) error {
+func (s *service) mapPayload(ctx context.Context, res interface{}, response interface{}) error {
+	logger := logging.FromContext(ctx)
+
 	// Mapping Response
 	bRes, err := json.Marshal(res)
 	if err != nil {
-		log.Error(err)
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		logger.Error(err)
+		return apperrors.Internal(err)
 	}
 	err = json.Unmarshal(bRes, &response)
 	if err != nil {
-		log.Error(err)
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		logger.Error(err)
+		return apperrors.Internal(err)
 	}
 	return nil
 }
 
+// parseID validates a hex ID
+func (s *service) parseID(id string) (datastore.ID, error) {
+	if !datastore.ValidID(id) {
+		return "", apperrors.InvalidArgument(apperrors.CodeInvalidID, "ID must be a 24 character hex string")
+	}
+	return datastore.ID(id), nil
+}
+
+// parsePagination converts page and limit params, an empty limit defaults to 30
+func (s *service) parsePagination(page string, limit string) (int, int, error) {
+	p, err := strconv.Atoi(page)
+	if err != nil || p < 1 {
+		return 0, 0, apperrors.InvalidArgument(apperrors.CodeInvalidPagination, "Page must be a positive integer")
+	}
+
+	l := 30
+	if len(limit) != 0 {
+		l, err = strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return 0, 0, apperrors.InvalidArgument(apperrors.CodeInvalidPagination, "Limit must be a positive integer")
+		}
+	}
+	return p, l, nil
+}
+
+// findOne returns the full stored model, or nil when it does not exist
+func (s *service) findOne(ctx context.Context, objectId datastore.ID) (*models.Model, error) {
+	query := datastore.Query{
+		Where: datastore.M{"_id": objectId},
+		From:  "models",
+	}
+
+	res, err := s.r.Find(ctx, query)
+	if err != nil || len(*res) == 0 {
+		return nil, err
+	}
+	return &(*res)[0], nil
+}
+
+// checks returns the rules of data needing the datastore, id is the model being updated or empty
+// on create. The unique index stays the guard against concurrent writes
+func (s *service) checks(data *models.Model, id datastore.ID) []validation.Check {
+	if len(data.Email) == 0 {
+		return nil
+	}
+	return []validation.Check{
+		validation.Unique("email", apperrors.CodeModelAlreadyExists, "Model Already Exists", func(ctx context.Context) (bool, error) {
+			where := datastore.M{"email": data.Email}
+			if len(id) != 0 {
+				where["_id"] = datastore.M{"$ne": id}
+			}
+			res, err := s.r.Find(ctx, datastore.Query{Where: where, From: "models"})
+			if err != nil {
+				return false, s.u.ErrorWrapper(err)
+			}
+			return len(*res) != 0, nil
+		}),
+	}
+}
+
+// changes Returns the $set of an update, only the mutable fields that are set so the ID and
+// created_at are never overwritten
+func changes(data *models.Model) datastore.M {
+	set := datastore.M{"updated_at": data.UpdatedAt}
+	if len(data.Name) != 0 {
+		set["name"] = data.Name
+	}
+	if len(data.Email) != 0 {
+		set["email"] = data.Email
+	}
+	return set
+}
+
+// record appends an audit entry, failures are logged since the mutation already happened
+func (s *service) record(ctx context.Context, op string, id string, before interface{}, after interface{}) {
+	err := s.a.Record(ctx, op, "models", id, before, after)
+	if err != nil {
+		logging.FromContext(ctx).WithField("operation", op).Error(err)
+	}
+}
+
 /*
 * PUBLIC
  */
 
-func (s *service) Get(page string, limit string) (resp ServiceResponse, err error) {
+func (s *service) Get(ctx context.Context, page string, limit string) (resp ServiceResponse, err error) {
+	return s.Find(ctx, Filter{}, page, limit)
+}
+
+func (s *service) Find(ctx context.Context, filter Filter, page string, limit string) (resp ServiceResponse, err error) {
 	// Build Query
-	q := datastore.Query{From: "models"}
+	q := datastore.Query{Where: filter.where(), From: "models"}
 
 	// Convert params
-	p, err := strconv.Atoi(page)
+	p, l, err := s.parsePagination(page, limit)
 	if err != nil {
 		return resp, err
 	}
 
-	// Validate Optional & Default params
-	l := 30
-	if len(limit) != 0 {
-		l, err = strconv.Atoi(limit)
-		if err != nil {
-			return resp, err
-		}
-	}
-
 	// Build Pagination Options
 	pOpts := datastore.Pagination{
 		Page:  p,
 		Limit: l,
-		Sort:  bson.M{"createdAt": 1},
+		Sort:  []string{"created_at"},
 	}
 
 	// Datastore operation
-	res, err := s.r.Paginate(q, pOpts)
+	res, err := s.r.Paginate(ctx, q, pOpts)
 	if err != nil {
 		return resp, err
 	}
 
 	resp = ServiceResponse{
-		Status:  fiber.StatusOK,
 		Message: "Get Models Successful",
 		Data:    res,
 	}
 	return resp, err
 }
 
-func (s *service) GetById(id string) (*ServiceResponse, error) {
-	objectId, err := primitive.ObjectIDFromHex(id)
+func (s *service) GetById(ctx context.Context, id string) (*ServiceResponse, error) {
+	objectId, err := s.parseID(id)
 	if err != nil {
 		return nil, err
 	}
 
 	// Build Query
 	query := datastore.Query{
-		Select: bson.M{"name": 1},
-		Where:  bson.M{"_id": objectId},
+		// Timestamps are selected for the ETag and Last-Modified of the response
+		Select: datastore.M{"name": 1, "created_at": 1, "updated_at": 1},
+		Where:  datastore.M{"_id": objectId},
 		From:   "models",
 	}
 
 	// Datastore operation
-	res, err := s.r.Find(query)
+	res, err := s.r.Find(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	if len((*res)) == 0 {
-		return nil, fiber.NewError(fiber.StatusNotFound, "Model Not Found")
+		return nil, apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
 	}
 
 	return &ServiceResponse{
-		Status:  fiber.StatusOK,
 		Message: "Get Model by ID Successful",
 		Data:    (*res)[0],
 	}, err
 }
 
-func (s *service) Create(data *models.Model) (resp ServiceResponse, err error) {
+func (s *service) GetByIds(ctx context.Context, ids []string) (resp ServiceResponse, err error) {
+	objectIds := make([]datastore.ID, 0, len(ids))
+	for _, id := range ids {
+		objectId, err := s.parseID(id)
+		if err != nil {
+			return resp, err
+		}
+		objectIds = append(objectIds, objectId)
+	}
+
+	// Build Query
+	query := datastore.Query{
+		Where: datastore.M{"_id": datastore.M{"$in": objectIds}},
+		From:  "models",
+	}
+
+	// Datastore operation
+	res, err := s.r.Find(ctx, query)
+	if err != nil {
+		return resp, err
+	}
+
+	resp = ServiceResponse{
+		Message: "Get Models by ID Successful",
+		Data:    *res,
+	}
+	return resp, err
+}
+
+func (s *service) Create(ctx context.Context, data *models.Model) (resp ServiceResponse, err error) {
 	// Build Query
 	query := datastore.Query{
 		From: "models",
 	}
 
+	if err := validation.Run(ctx, "Model failed validation", s.checks(data, "")...); err != nil {
+		return resp, err
+	}
+
 	// Update Timestamp
 	data.CreatedAt = time.Now().UTC()
 
 	// Datastore operation
-	res, err := s.r.Insert(query, data)
+	res, err := s.r.Insert(ctx, query, data)
 	if err != nil {
 		err = s.u.ErrorWrapper(err)
 		return resp, err
@@ -152,69 +291,163 @@ func (s *service) Create(data *models.Model) (resp ServiceResponse, err error) {
 
 	// Mapping Payload
 	var payload models.CreateResponse
-	err = s.mapPayload(res, &payload)
+	err = s.mapPayload(ctx, res, &payload)
 	if err != nil {
-		return resp, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		return resp, err
 	}
 
+	s.record(ctx, audit.OperationCreate, payload.InsertedID, nil, data)
+
 	resp = ServiceResponse{
-		Status:  fiber.StatusCreated,
 		Message: "Created Model Successfully",
 		Data:    payload,
 	}
 	return resp, err
 }
 
-func (s *service) Update(id string, data *models.Model) (resp ServiceResponse, err error) {
-	objectId, err := primitive.ObjectIDFromHex(id)
+func (s *service) Update(ctx context.Context, id string, data *models.Model) (resp ServiceResponse, err error) {
+	objectId, err := s.parseID(id)
 	if err != nil {
 		return resp, err
 	}
 
 	// Build Query
 	query := datastore.Query{
-		Where: bson.M{"_id": objectId},
+		Where: datastore.M{"_id": objectId},
 		From:  "models",
 	}
 
 	// Update Timestamp
 	data.UpdatedAt = time.Now().UTC()
 
+	before, err := s.findOne(ctx, objectId)
+	if err != nil {
+		return resp, err
+	}
+	if before == nil {
+		return resp, apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
+	}
+	if err := validation.Run(ctx, "Model failed validation", s.checks(data, objectId)...); err != nil {
+		return resp, err
+	}
+
 	// Datastore operation
-	_, err = s.r.Update(query, bson.M{"$set": data})
+	_, err = s.r.Update(ctx, query, datastore.M{"$set": changes(data)})
 	if err != nil {
 		err = s.u.ErrorWrapper(err)
 		return resp, err
 	}
 
+	after, err := s.findOne(ctx, objectId)
+	if err != nil {
+		return resp, err
+	}
+	s.record(ctx, audit.OperationUpdate, id, before, after)
+
 	resp = ServiceResponse{
-		Status:  fiber.StatusOK,
 		Message: "Update Successful",
 	}
 	return resp, err
 }
 
-func (s *service) Delete(id string) (*ServiceResponse, error) {
-	objectId, err := primitive.ObjectIDFromHex(id)
+func (s *service) Replace(ctx context.Context, id string, data *models.Model) (resp ServiceResponse, err error) {
+	objectId, err := s.parseID(id)
+	if err != nil {
+		return resp, err
+	}
+
+	// Build Query
+	query := datastore.Query{
+		Where: datastore.M{"_id": objectId},
+		From:  "models",
+	}
+
+	before, err := s.findOne(ctx, objectId)
+	if err != nil {
+		return resp, err
+	}
+	if before == nil {
+		return resp, apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
+	}
+	if err := validation.Run(ctx, "Model failed validation", s.checks(data, objectId)...); err != nil {
+		return resp, err
+	}
+
+	// Datastore operation, a replacement document drops every field it leaves out
+	_, err = s.r.Update(ctx, query, datastore.M{
+		"name":       data.Name,
+		"email":      data.Email,
+		"created_at": before.CreatedAt,
+		"updated_at": time.Now().UTC(),
+	})
+	if err != nil {
+		err = s.u.ErrorWrapper(err)
+		return resp, err
+	}
+
+	after, err := s.findOne(ctx, objectId)
+	if err != nil {
+		return resp, err
+	}
+	s.record(ctx, audit.OperationUpdate, id, before, after)
+
+	resp = ServiceResponse{
+		Message: "Replace Successful",
+	}
+	return resp, err
+}
+
+func (s *service) Delete(ctx context.Context, id string) (*ServiceResponse, error) {
+	objectId, err := s.parseID(id)
 	if err != nil {
 		return nil, err
 	}
 
 	// Build Query
 	query := datastore.Query{
-		Where: bson.M{"_id": objectId},
+		Where: datastore.M{"_id": objectId},
 		From:  "models",
 	}
 
+	before, err := s.findOne(ctx, objectId)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, apperrors.NotFound(apperrors.CodeModelNotFound, "Model Not Found")
+	}
+
 	// Datastore operation
-	_, err = s.r.Delete(query)
+	_, err = s.r.Delete(ctx, query)
 	if err != nil {
 		err = s.u.ErrorWrapper(err)
 		return nil, err
 	}
+	s.record(ctx, audit.OperationDelete, id, before, nil)
 
 	return &ServiceResponse{
-		Status:  fiber.StatusOK,
 		Message: "Delete Successful",
 	}, err
 }
+
+func (s *service) History(ctx context.Context, id string, page string, limit string) (resp ServiceResponse, err error) {
+	// Convert params, history defaults to the first page
+	if len(page) == 0 {
+		page = "1"
+	}
+	p, l, err := s.parsePagination(page, limit)
+	if err != nil {
+		return resp, err
+	}
+
+	res, err := s.a.History(ctx, id, datastore.Pagination{Page: p, Limit: l})
+	if err != nil {
+		return resp, err
+	}
+
+	resp = ServiceResponse{
+		Message: "Get Model History Successful",
+		Data:    res,
+	}
+	return resp, err
+}
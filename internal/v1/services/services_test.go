@@ -0,0 +1,154 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+func codeOf(err error) string {
+	if e, ok := apperrors.As(err); ok {
+		return e.Code
+	}
+	return ""
+}
+
+/*
+	TESTS
+*/
+
+func TestByID(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	r.EnsureIndexes("models", []string{"email"})
+	s, _ := newService(r, 100)
+
+	res, err := s.Create(ctx, &models.Model{Name: "Bob", Email: "bob@bob.com"})
+	require.Nil(t, err)
+	id := res.Data.(models.CreateResponse).InsertedID
+	require.Len(t, id, 24)
+	require.True(t, datastore.ValidID(id), "IDs are 24 character hex strings")
+
+	got, err := s.GetById(ctx, id)
+	require.Nil(t, err)
+	assert.Equal(t, "Bob", got.Data.(models.Model).Name)
+
+	_, err = s.Update(ctx, id, &models.Model{Name: "Robert", Email: "bob@bob.com"})
+	require.Nil(t, err)
+	got, err = s.GetById(ctx, id)
+	require.Nil(t, err)
+	assert.Equal(t, "Robert", got.Data.(models.Model).Name)
+
+	_, err = s.Delete(ctx, id)
+	require.Nil(t, err)
+
+	// A well formed ID of no model is not found, a malformed one is invalid
+	missing := string(datastore.NewID())
+	tests := []struct {
+		description string
+		id          string
+		code        string
+	}{
+		{description: "Deleted", id: id, code: apperrors.CodeModelNotFound},
+		{description: "Missing", id: missing, code: apperrors.CodeModelNotFound},
+		{description: "Malformed", id: "not-an-id", code: apperrors.CodeInvalidID},
+	}
+	for _, test := range tests {
+		_, err = s.GetById(ctx, test.id)
+		assert.Equal(t, test.code, codeOf(err), "get: "+test.description)
+		_, err = s.Update(ctx, test.id, &models.Model{Name: "Eve", Email: "eve@eve.com"})
+		assert.Equal(t, test.code, codeOf(err), "update: "+test.description)
+		_, err = s.Delete(ctx, test.id)
+		assert.Equal(t, test.code, codeOf(err), "delete: "+test.description)
+	}
+}
+
+func TestUpdateKeepsCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	s, _ := newService(r, 100)
+
+	res, err := s.Create(ctx, &models.Model{Name: "Bob", Email: "bob@bob.com"})
+	require.Nil(t, err)
+	id := res.Data.(models.CreateResponse).InsertedID
+	// Read the stored model, GetById leaves the email out
+	stored := func() models.Model {
+		res, err := r.Find(ctx, datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: "models"})
+		require.Nil(t, err)
+		require.Len(t, *res, 1)
+		return (*res)[0]
+	}
+	created := stored().CreatedAt
+	require.False(t, created.IsZero())
+
+	_, err = s.Update(ctx, id, &models.Model{ID: datastore.NewID(), Name: "Robert"})
+	require.Nil(t, err)
+	m := stored()
+	assert.Equal(t, id, m.ID, "the ID is never overwritten")
+	assert.True(t, created.Equal(m.CreatedAt), "created at %v, then %v", created, m.CreatedAt)
+	assert.Equal(t, "bob@bob.com", m.Email, "unset fields are kept")
+	assert.Equal(t, "Robert", m.Name)
+
+	entries, err := audit.NewAuditor(r).History(ctx, id, datastore.Pagination{Page: 1, Limit: 10})
+	require.Nil(t, err)
+	for _, e := range entries {
+		if e.Operation != audit.OperationUpdate {
+			continue
+		}
+		for _, c := range e.Changes {
+			assert.NotEqual(t, "createdAt", c.Field)
+			assert.NotEqual(t, "created_at", c.Field)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	s, _ := newService(r, 100)
+
+	// A field the model does not know, such as one written by another version of the service
+	created := time.Date(2021, time.January, 5, 0, 0, 0, 0, time.UTC)
+	id := datastore.NewID()
+	_, err := r.Insert(ctx, datastore.Query{From: "models"}, datastore.M{
+		"_id": id, "name": "Bob", "email": "bob@bob.com", "nickname": "bobby", "created_at": created,
+	})
+	require.Nil(t, err)
+	byID := datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: "models"}
+	stored := func() datastore.M {
+		res := []datastore.M{}
+		require.Nil(t, r.FindInto(ctx, byID, nil, &res))
+		require.Len(t, res, 1)
+		return res[0]
+	}
+
+	_, err = s.Update(ctx, id, &models.Model{Name: "Robert"})
+	require.Nil(t, err)
+	assert.Equal(t, "bobby", stored()["nickname"], "updates keep the fields they leave out")
+
+	_, err = s.Replace(ctx, id, &models.Model{ID: datastore.NewID(), Name: "Rob", Email: "rob@bob.com"})
+	require.Nil(t, err)
+	doc := stored()
+	assert.NotContains(t, doc, "nickname", "replacements drop the fields they leave out")
+	assert.Equal(t, "Rob", doc["name"])
+	assert.Equal(t, "rob@bob.com", doc["email"])
+
+	res, err := r.Find(ctx, byID)
+	require.Nil(t, err)
+	require.Len(t, *res, 1)
+	m := (*res)[0]
+	assert.Equal(t, id, m.ID, "the ID is kept")
+	assert.True(t, created.Equal(m.CreatedAt), "the creation time is kept, got %v", m.CreatedAt)
+	assert.True(t, m.UpdatedAt.After(created))
+
+	_, err = s.Replace(ctx, string(datastore.NewID()), &models.Model{Name: "Eve", Email: "eve@eve.com"})
+	assert.Equal(t, apperrors.CodeModelNotFound, codeOf(err))
+}
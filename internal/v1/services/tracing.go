@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+const tracerName = "github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+
+type tracedService struct {
+	s      Service
+	tracer trace.Tracer
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewTracedService Will wrap a Service so every call is recorded as a child span
+func NewTracedService(s Service) Service {
+	return &tracedService{s: s, tracer: otel.Tracer(tracerName)}
+}
+
+/*
+* PRIVATE
+ */
+
+func (t *tracedService) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "services."+op, trace.WithAttributes(attrs...))
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+/*
+* PUBLIC
+ */
+
+func (t *tracedService) Get(ctx context.Context, page string, limit string) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Get", attribute.String("page", page), attribute.String("limit", limit))
+	defer func() { end(span, err) }()
+	return t.s.Get(ctx, page, limit)
+}
+
+func (t *tracedService) Find(ctx context.Context, filter Filter, page string, limit string) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Find", attribute.String("page", page), attribute.String("limit", limit))
+	defer func() { end(span, err) }()
+	return t.s.Find(ctx, filter, page, limit)
+}
+
+func (t *tracedService) GetById(ctx context.Context, id string) (resp *ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "GetById", attribute.String("model.id", id))
+	defer func() { end(span, err) }()
+	return t.s.GetById(ctx, id)
+}
+
+func (t *tracedService) GetByIds(ctx context.Context, ids []string) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "GetByIds", attribute.StringSlice("model.ids", ids))
+	defer func() { end(span, err) }()
+	return t.s.GetByIds(ctx, ids)
+}
+
+func (t *tracedService) Create(ctx context.Context, data *models.Model) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Create")
+	defer func() { end(span, err) }()
+	return t.s.Create(ctx, data)
+}
+
+func (t *tracedService) Update(ctx context.Context, id string, data *models.Model) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Update", attribute.String("model.id", id))
+	defer func() { end(span, err) }()
+	return t.s.Update(ctx, id, data)
+}
+
+func (t *tracedService) Replace(ctx context.Context, id string, data *models.Model) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Replace", attribute.String("model.id", id))
+	defer func() { end(span, err) }()
+	return t.s.Replace(ctx, id, data)
+}
+
+func (t *tracedService) Delete(ctx context.Context, id string) (resp *ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Delete", attribute.String("model.id", id))
+	defer func() { end(span, err) }()
+	return t.s.Delete(ctx, id)
+}
+
+func (t *tracedService) History(ctx context.Context, id string, page string, limit string) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "History", attribute.String("model.id", id))
+	defer func() { end(span, err) }()
+	return t.s.History(ctx, id, page, limit)
+}
+
+func (t *tracedService) Export(ctx context.Context, format string, filter Filter, w io.Writer) (err error) {
+	ctx, span := t.start(ctx, "Export", attribute.String("format", format))
+	defer func() { end(span, err) }()
+	return t.s.Export(ctx, format, filter, w)
+}
+
+func (t *tracedService) Import(ctx context.Context, format string, data []byte) (resp ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "Import", attribute.String("format", format), attribute.Int("bytes", len(data)))
+	defer func() { end(span, err) }()
+	return t.s.Import(ctx, format, data)
+}
+
+func (t *tracedService) GetImport(ctx context.Context, id string) (resp *ServiceResponse, err error) {
+	ctx, span := t.start(ctx, "GetImport", attribute.String("import.id", id))
+	defer func() { end(span, err) }()
+	return t.s.GetImport(ctx, id)
+}
+
+func (t *tracedService) RunImport(ctx context.Context, id string) (err error) {
+	ctx, span := t.start(ctx, "RunImport", attribute.String("import.id", id))
+	defer func() { end(span, err) }()
+	return t.s.RunImport(ctx, id)
+}
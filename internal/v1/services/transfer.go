@@ -0,0 +1,510 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+)
+
+// Formats of imports and exports
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// importsCollection holds the progress of imports run as jobs
+const importsCollection = "imports"
+
+// maxImportErrors bounds the rejected rows kept in a report, the rest are only counted
+const maxImportErrors = 1000
+
+// exportFlushRows is how many rows are buffered before they are sent to the client
+const exportFlushRows = 100
+
+// csvHeader Is the header of exports, imports only read the name and email columns
+var csvHeader = []string{"id", "name", "email", "createdAt", "updatedAt"}
+
+// Filter Narrows a listing or an export of models, empty fields are ignored
+type Filter struct {
+	Name  string
+	Email string
+	// Since and Until bound the creation time, Until is exclusive
+	Since time.Time
+	Until time.Time
+}
+
+type importPayload struct {
+	ID string `json:"id"`
+}
+
+// importJob Runs the imports too large to run during the request
+var importJob = jobs.Type[importPayload]{Name: "models.import"}
+
+// row Is a row of an upload, err is set when it could not be parsed
+type row struct {
+	line  int
+	model models.Model
+	err   error
+}
+
+/*
+* PRIVATE
+ */
+
+// where builds the datastore condition of a filter
+func (f Filter) where() datastore.M {
+	where := datastore.M{}
+	if len(f.Name) != 0 {
+		where["name"] = f.Name
+	}
+	if len(f.Email) != 0 {
+		where["email"] = f.Email
+	}
+	created := datastore.M{}
+	if !f.Since.IsZero() {
+		created["$gte"] = f.Since.UTC()
+	}
+	if !f.Until.IsZero() {
+		created["$lt"] = f.Until.UTC()
+	}
+	if len(created) != 0 {
+		where["created_at"] = created
+	}
+	return where
+}
+
+func invalidFormat() error {
+	return apperrors.InvalidArgument(apperrors.CodeInvalidArgument, "format must be csv or ndjson")
+}
+
+// parseRows Reads every row of an upload, only a CSV without a usable header fails as a whole
+func parseRows(format string, data []byte) ([]row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data)
+	case FormatNDJSON:
+		return parseNDJSON(data)
+	}
+	return nil, invalidFormat()
+}
+
+func parseCSV(data []byte) ([]row, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	// Short rows fail validation instead
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperrors.InvalidArgument(apperrors.CodeInvalidBody, "CSV header: "+err.Error())
+	}
+	columns := map[string]int{}
+	for i, h := range header {
+		// Spreadsheets may start the file with a byte order mark
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	name, hasName := columns["name"]
+	email, hasEmail := columns["email"]
+	if !hasName || !hasEmail {
+		return nil, apperrors.InvalidArgument(apperrors.CodeInvalidBody, "CSV header must have name and email columns")
+	}
+
+	field := func(record []string, i int) string {
+		if i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	var rows []row
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return nil, err
+			}
+			rows = append(rows, row{line: pe.StartLine, err: err})
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		rows = append(rows, row{line: line, model: models.Model{Name: field(record, name), Email: field(record, email)}})
+	}
+}
+
+func parseNDJSON(data []byte) ([]row, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// A line may be as long as the whole upload
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	var rows []row
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var m models.Model
+		err := json.Unmarshal(b, &m)
+		rows = append(rows, row{line: line, model: models.Model{Name: m.Name, Email: m.Email}, err: err})
+	}
+	return rows, scanner.Err()
+}
+
+// reject Records a rejected row in the report
+func reject(report *models.Import, line int, err error) {
+	report.Failed++
+	if len(report.Errors) >= maxImportErrors {
+		return
+	}
+	e := models.ImportError{Line: line, Message: err.Error()}
+	if ae, ok := apperrors.As(err); ok {
+		e.Message = ae.Message
+		e.Fields = ae.Fields
+	}
+	report.Errors = append(report.Errors, e)
+}
+
+// rowError Reports whether err only concerns the row, any other error stops the import
+func rowError(err error) bool {
+	kind := apperrors.KindOf(err)
+	return kind == apperrors.KindConflict || kind == apperrors.KindNotFound
+}
+
+// upsert Imports a batch with a single read, rows are matched to stored models by email
+func (s *service) upsert(ctx context.Context, batch []row, report *models.Import) error {
+	valid := make([]row, 0, len(batch))
+	emails := make([]string, 0, len(batch))
+	for _, r := range batch {
+		if r.err != nil {
+			reject(report, r.line, r.err)
+			continue
+		}
+		if err := r.model.Validate(); err != nil {
+			reject(report, r.line, err)
+			continue
+		}
+		valid = append(valid, r)
+		emails = append(emails, r.model.Email)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	stored := []models.Model{}
+	query := datastore.Query{Where: datastore.M{"email": datastore.M{"$in": emails}}, From: "models"}
+	if err := s.r.FindInto(ctx, query, nil, &stored); err != nil {
+		return err
+	}
+	existing := map[string]models.Model{}
+	for _, m := range stored {
+		existing[m.Email] = m
+	}
+
+	now := time.Now().UTC()
+	for _, r := range valid {
+		if before, ok := existing[r.model.Email]; ok {
+			after := before
+			after.Name = r.model.Name
+			after.UpdatedAt = now
+			query := datastore.Query{Where: datastore.M{"_id": datastore.ID(before.ID)}, From: "models"}
+			_, err := s.r.Update(ctx, query, datastore.M{"$set": datastore.M{"name": after.Name, "updated_at": now}})
+			if err != nil {
+				err = s.u.ErrorWrapper(err)
+				if !rowError(err) {
+					return err
+				}
+				reject(report, r.line, err)
+				continue
+			}
+			s.record(ctx, audit.OperationUpdate, before.ID, before, after)
+			existing[after.Email] = after
+			report.Updated++
+			continue
+		}
+
+		m := r.model
+		m.CreatedAt = now
+		res, err := s.r.Insert(ctx, datastore.Query{From: "models"}, m)
+		if err != nil {
+			err = s.u.ErrorWrapper(err)
+			if !rowError(err) {
+				return err
+			}
+			reject(report, r.line, err)
+			continue
+		}
+		var payload models.CreateResponse
+		if err := s.mapPayload(ctx, res, &payload); err != nil {
+			return err
+		}
+		m.ID = payload.InsertedID
+		s.record(ctx, audit.OperationCreate, m.ID, nil, m)
+		existing[m.Email] = m
+		report.Created++
+	}
+	return nil
+}
+
+// importRows Upserts the rows in batches, progress is called after each batch
+func (s *service) importRows(ctx context.Context, rows []row, report *models.Import, progress func() error) error {
+	size := s.config.ImportBatchSize
+	if size < 1 {
+		size = 1
+	}
+	for start := 0; start < len(rows); start += size {
+		end := min(start+size, len(rows))
+		if err := s.upsert(ctx, rows[start:end], report); err != nil {
+			return err
+		}
+		report.Processed = end
+		if progress != nil {
+			if err := progress(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findImport Returns the stored import, or nil when it does not exist
+func (s *service) findImport(ctx context.Context, id string) (*models.Import, error) {
+	objectId, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []models.Import{}
+	err = s.r.FindInto(ctx, datastore.Query{Where: datastore.M{"_id": objectId}, From: importsCollection}, nil, &res)
+	if err != nil || len(res) == 0 {
+		return nil, err
+	}
+	return &res[0], nil
+}
+
+// updateImport Stores the progress of an import
+func (s *service) updateImport(ctx context.Context, id string, update datastore.M) error {
+	query := datastore.Query{Where: datastore.M{"_id": datastore.ID(id)}, From: importsCollection}
+	_, err := s.r.Update(ctx, query, update)
+	return err
+}
+
+func progressOf(report *models.Import) datastore.M {
+	return datastore.M{
+		"processed":  report.Processed,
+		"created":    report.Created,
+		"updated":    report.Updated,
+		"failed":     report.Failed,
+		"errors":     report.Errors,
+		"updated_at": time.Now().UTC(),
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+/*
+* PUBLIC
+ */
+
+// HandleImports Will run the imports of s that are too large for a request on p
+func HandleImports(p jobs.Pool, s Service) {
+	importJob.Handle(p, func(ctx context.Context, job *jobs.Job, payload importPayload) error {
+		return s.RunImport(ctx, payload.ID)
+	})
+}
+
+func (s *service) Export(ctx context.Context, format string, filter Filter, w io.Writer) error {
+	where := filter.where()
+
+	var write func(m models.Model) error
+	var flush func() error
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		write = func(m models.Model) error {
+			return cw.Write([]string{m.ID, m.Name, m.Email, formatTime(m.CreatedAt), formatTime(m.UpdatedAt)})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		write = func(m models.Model) error {
+			return enc.Encode(m)
+		}
+		flush = func() error {
+			return nil
+		}
+	default:
+		return invalidFormat()
+	}
+	// Buffered writers, such as the one of a streamed response, are flushed along the way
+	if f, ok := w.(interface{ Flush() error }); ok {
+		encoder := flush
+		flush = func() error {
+			if err := encoder(); err != nil {
+				return err
+			}
+			return f.Flush()
+		}
+	}
+
+	logger := logging.FromContext(ctx)
+	rows := 0
+	err := datastore.Stream(ctx, s.r, datastore.Query{Where: where, From: "models"}, []string{"created_at"}, func(decode func(out interface{}) error) error {
+		var m models.Model
+		if err := decode(&m); err != nil {
+			logger.WithField("collection", "models").Warn(err)
+			return nil
+		}
+		if err := write(m); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+func (s *service) Import(ctx context.Context, format string, data []byte) (resp ServiceResponse, err error) {
+	rows, err := parseRows(format, data)
+	if err != nil {
+		return resp, err
+	}
+
+	now := time.Now().UTC()
+	report := &models.Import{
+		Format:    format,
+		Status:    models.ImportRunning,
+		Total:     len(rows),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if len(rows) <= s.config.ImportSyncRows {
+		if err := s.importRows(ctx, rows, report, nil); err != nil {
+			return resp, err
+		}
+		report.Status = models.ImportSucceeded
+		report.FinishedAt = time.Now().UTC()
+		report.UpdatedAt = report.FinishedAt
+		return ServiceResponse{
+			Message: "Import Successful",
+			Data:    report,
+		}, nil
+	}
+
+	// Too large for the request, a job imports the stored upload
+	report.Status = models.ImportPending
+	report.Data = string(data)
+	res, err := s.r.Insert(ctx, datastore.Query{From: importsCollection}, report)
+	if err != nil {
+		return resp, err
+	}
+	var payload models.CreateResponse
+	if err := s.mapPayload(ctx, res, &payload); err != nil {
+		return resp, err
+	}
+	report.ID = payload.InsertedID
+
+	if _, err := importJob.Enqueue(ctx, s.q, importPayload{ID: report.ID}, nil); err != nil {
+		update := datastore.M{"$set": datastore.M{"status": models.ImportFailed, "error": err.Error(), "updated_at": time.Now().UTC()}}
+		if err := s.updateImport(ctx, report.ID, update); err != nil {
+			logging.FromContext(ctx).Error(err)
+		}
+		return resp, err
+	}
+
+	return ServiceResponse{
+		Message: "Import Accepted",
+		Data:    report,
+	}, nil
+}
+
+func (s *service) GetImport(ctx context.Context, id string) (*ServiceResponse, error) {
+	imp, err := s.findImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if imp == nil {
+		return nil, apperrors.NotFound(apperrors.CodeImportNotFound, "Import Not Found")
+	}
+
+	return &ServiceResponse{
+		Message: "Get Import Successful",
+		Data:    imp,
+	}, nil
+}
+
+func (s *service) RunImport(ctx context.Context, id string) error {
+	imp, err := s.findImport(ctx, id)
+	if err != nil {
+		return err
+	}
+	if imp == nil {
+		return jobs.Permanent(apperrors.NotFound(apperrors.CodeImportNotFound, "Import Not Found"))
+	}
+	if imp.Status == models.ImportSucceeded {
+		return nil
+	}
+	rows, err := parseRows(imp.Format, []byte(imp.Data))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	// A retried import starts over, rows imported before are matched by email again
+	report := &models.Import{Total: len(rows)}
+	running := progressOf(report)
+	running["status"] = models.ImportRunning
+	if err := s.updateImport(ctx, id, datastore.M{"$set": running, "$unset": datastore.M{"error": ""}}); err != nil {
+		return err
+	}
+
+	err = s.importRows(ctx, rows, report, func() error {
+		return s.updateImport(ctx, id, datastore.M{"$set": progressOf(report)})
+	})
+	if err != nil {
+		failed := progressOf(report)
+		failed["status"] = models.ImportFailed
+		failed["error"] = err.Error()
+		if err := s.updateImport(ctx, id, datastore.M{"$set": failed}); err != nil {
+			logging.FromContext(ctx).Error(err)
+		}
+		return err
+	}
+
+	succeeded := progressOf(report)
+	succeeded["status"] = models.ImportSucceeded
+	succeeded["finished_at"] = time.Now().UTC()
+	return s.updateImport(ctx, id, datastore.M{"$set": succeeded, "$unset": datastore.M{"data": ""}})
+}
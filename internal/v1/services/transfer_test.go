@@ -0,0 +1,193 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+)
+
+func newService(r datastore.Repository, syncRows int) (services.Service, jobs.Pool) {
+	config := &jobs.Config{Workers: 1, PollInterval: 5 * time.Millisecond, Lease: time.Second, MaxAttempts: 1}
+	s := services.NewService(r, utils.NewUtils(), audit.NewAuditor(r), jobs.NewQueue(r, config), &services.Config{
+		ImportBatchSize: 2,
+		ImportSyncRows:  syncRows,
+	})
+	p := jobs.NewPool(r, config)
+	services.HandleImports(p, s)
+	return s, p
+}
+
+/*
+	TESTS
+*/
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	r.EnsureIndexes("models", []string{"email"})
+	s, _ := newService(r, 100)
+	_, err := s.Create(ctx, &models.Model{Name: "Bob", Email: "bob@bob.com"})
+	require.Nil(t, err)
+
+	tests := []struct {
+		description string
+		format      string
+		data        string
+		created     int
+		updated     int
+		lines       []int
+		kind        apperrors.Kind
+	}{
+		{
+			description: "CSV",
+			format:      services.FormatCSV,
+			data:        "\ufeffEmail,Name\nann@ann.com,Ann\nbob@bob.com,Robert\nnot an email,Cid\n\ndan@dan.com\n",
+			created:     1,
+			updated:     1,
+			lines:       []int{4, 6},
+		},
+		{
+			description: "NDJSON",
+			format:      services.FormatNDJSON,
+			data:        "{\"name\":\"Eve\",\"email\":\"eve@eve.com\"}\n{\"name\":\n\n{\"name\":\"Ann B\",\"email\":\"ann@ann.com\"}\n",
+			created:     1,
+			updated:     1,
+			lines:       []int{2},
+		},
+		{description: "Missing columns", format: services.FormatCSV, data: "name,mail\nAnn,ann@ann.com\n", kind: apperrors.KindInvalidArgument},
+		{description: "Unknown format", format: "xlsx", data: "", kind: apperrors.KindInvalidArgument},
+	}
+	for _, test := range tests {
+		res, err := s.Import(ctx, test.format, []byte(test.data))
+		if len(test.kind) != 0 {
+			assert.Equal(t, test.kind, apperrors.KindOf(err), test.description)
+			continue
+		}
+		require.Nil(t, err, test.description)
+		report := res.Data.(*models.Import)
+		assert.Equal(t, models.ImportSucceeded, report.Status, test.description)
+		assert.Equal(t, test.created, report.Created, test.description)
+		assert.Equal(t, test.updated, report.Updated, test.description)
+		assert.Equal(t, report.Total, report.Processed, test.description)
+		lines := []int{}
+		for _, e := range report.Errors {
+			lines = append(lines, e.Line)
+		}
+		assert.Equal(t, test.lines, lines, test.description)
+	}
+
+	var buf bytes.Buffer
+	require.Nil(t, s.Export(ctx, services.FormatCSV, services.Filter{}, &buf))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(t, err)
+	require.Len(t, records, 4, "Header and three models")
+	assert.Equal(t, []string{"id", "name", "email", "createdAt", "updatedAt"}, records[0])
+	assert.Equal(t, []string{"Robert", "bob@bob.com"}, records[1][1:3], "Oldest first, updated by email")
+	assert.Equal(t, []string{"Ann B", "ann@ann.com"}, records[2][1:3])
+	assert.NotEmpty(t, records[2][4], "Updates are timestamped")
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	s, _ := newService(r, 100)
+	for _, m := range []models.Model{{Name: "Ann", Email: "ann@ann.com"}, {Name: "Bob", Email: "bob@bob.com"}} {
+		m := m
+		_, err := s.Create(ctx, &m)
+		require.Nil(t, err)
+	}
+
+	tests := []struct {
+		description string
+		filter      services.Filter
+		lines       int
+	}{
+		{description: "Everything", lines: 2},
+		{description: "By email", filter: services.Filter{Email: "bob@bob.com"}, lines: 1},
+		{description: "Created since", filter: services.Filter{Since: time.Now().Add(-time.Minute)}, lines: 2},
+		{description: "Created until", filter: services.Filter{Until: time.Now().Add(-time.Minute)}, lines: 0},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		require.Nil(t, s.Export(ctx, services.FormatNDJSON, test.filter, &buf), test.description)
+		assert.Equal(t, test.lines, strings.Count(buf.String(), "\n"), test.description)
+	}
+
+	err := s.Export(ctx, "xlsx", services.Filter{}, &bytes.Buffer{})
+	assert.Equal(t, apperrors.KindInvalidArgument, apperrors.KindOf(err))
+}
+
+func TestExportUpdated(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	s, _ := newService(r, 100)
+	since := time.Now().Add(-time.Minute)
+	for _, m := range []models.Model{{Name: "Ann", Email: "ann@ann.com"}, {Name: "Bob", Email: "bob@bob.com"}} {
+		m := m
+		_, err := s.Create(ctx, &m)
+		require.Nil(t, err)
+	}
+	res, err := r.Find(ctx, datastore.Query{Where: datastore.M{"name": "Ann"}, From: "models"})
+	require.Nil(t, err)
+	require.Len(t, *res, 1)
+	_, err = s.Update(ctx, (*res)[0].ID, &models.Model{Name: "Ann B"})
+	require.Nil(t, err)
+
+	// Updated models keep their creation time, so they stay in the window and in creation order
+	var buf bytes.Buffer
+	require.Nil(t, s.Export(ctx, services.FormatCSV, services.Filter{Since: since}, &buf))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"Ann B", "Bob"}, []string{records[1][1], records[2][1]})
+	for _, record := range records[1:] {
+		created, err := time.Parse(time.RFC3339Nano, record[3])
+		require.Nil(t, err, record[3])
+		assert.True(t, created.After(since), "%s was created at %s", record[1], record[3])
+	}
+}
+
+func TestImportJob(t *testing.T) {
+	ctx := context.Background()
+	r := datastore.NewMemoryDatastore()
+	s, p := newService(r, 2)
+	require.Nil(t, p.Start(ctx))
+	defer p.Stop(ctx)
+
+	res, err := s.Import(ctx, services.FormatCSV, []byte("name,email\nAnn,ann@ann.com\nBob,bob@bob.com\nCid,cid\n"))
+	require.Nil(t, err)
+	pending := res.Data.(*models.Import)
+	assert.Equal(t, models.ImportPending, pending.Status, "Larger than the sync rows")
+	assert.Equal(t, 3, pending.Total)
+
+	var report *models.Import
+	require.Eventually(t, func() bool {
+		res, err := s.GetImport(ctx, pending.ID)
+		require.Nil(t, err)
+		report = res.Data.(*models.Import)
+		return report.Status == models.ImportSucceeded
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 3, report.Processed)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 1, report.Failed)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, 4, report.Errors[0].Line)
+	assert.Equal(t, "email", report.Errors[0].Fields[0].Field)
+
+	_, err = s.GetImport(ctx, datastore.NewID())
+	assert.Equal(t, apperrors.KindNotFound, apperrors.KindOf(err))
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/logging"
+	"github.com/sizzlorox/go-service-boilerplate/internal/render"
+	"github.com/sizzlorox/go-service-boilerplate/internal/utils"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+)
+
+type Controller interface {
+	List(ctx *fiber.Ctx) error
+	Get(ctx *fiber.Ctx) error
+	Create(ctx *fiber.Ctx) error
+	Patch(ctx *fiber.Ctx) error
+	Replace(ctx *fiber.Ctx) error
+	Delete(ctx *fiber.Ctx) error
+	History(ctx *fiber.Ctx) error
+}
+
+type controller struct {
+	s services.Service
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+func NewController(s services.Service) Controller {
+	return &controller{s}
+}
+
+/*
+* PRIVATE
+ */
+
+// respond renders a service result in the response envelope
+func respond(ctx *fiber.Ctx, status int, res services.ServiceResponse) error {
+	return render.Respond(ctx, status, models.Response{
+		Message: res.Message,
+		Data:    res.Data,
+	})
+}
+
+// respondConditional renders a service result whose data carries validators, clients holding a
+// fresh copy get 304 instead
+func respondConditional(ctx *fiber.Ctx, status int, res services.ServiceResponse, v render.Validators) error {
+	return render.RespondConditional(ctx, status, v, models.Response{
+		Message: res.Message,
+		Data:    res.Data,
+	})
+}
+
+/*
+* PUBLIC
+ */
+
+// List godoc
+// @Summary Lists models
+// @Tags Model v2
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param page query int false "Page, defaults to 1"
+// @Param limit query int false "Limit, defaults to 30"
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Success 200 {object} models.Response{data=[]models.Model}
+// @Success 304 "Not Modified"
+// @Failure 400 {object} problem.Problem
+// @Router /v2/models [get]
+func (c *controller) List(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	res, err := c.s.Get(rctx, ctx.Query("page", "1"), ctx.Query("limit"))
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if v, ok := render.Collection(res.Data); ok {
+		return respondConditional(ctx, fiber.StatusOK, res, v)
+	}
+	return respond(ctx, fiber.StatusOK, res)
+}
+
+// Get godoc
+// @Summary Gets a model
+// @Tags Model v2
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Param If-Modified-Since header string false "Last-Modified of a previous response"
+// @Success 200 {object} models.Response{data=models.Model}
+// @Success 304 "Not Modified"
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v2/models/{id} [get]
+func (c *controller) Get(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	res, err := c.s.GetById(rctx, ctx.Params("id"))
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if m, ok := res.Data.(render.Versioned); ok {
+		return respondConditional(ctx, fiber.StatusOK, *res, m.Validators())
+	}
+	return respond(ctx, fiber.StatusOK, *res)
+}
+
+// Create godoc
+// @Summary Creates a model
+// @Tags Model v2
+// @Accept json,application/msgpack,application/cbor,xml
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param model body models.Model true "Model"
+// @Success 201 {object} models.Response{data=models.CreateResponse}
+// @Header 201 {string} Location "URL of the created model"
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v2/models [post]
+func (c *controller) Create(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	var m models.Model
+	if err := render.Bind(ctx, &m); err != nil {
+		logger.Error(err)
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	res, err := c.s.Create(rctx, &m)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	if created, ok := res.Data.(models.CreateResponse); ok {
+		ctx.Location(strings.TrimSuffix(ctx.Path(), "/") + "/" + created.InsertedID)
+	}
+	return respond(ctx, fiber.StatusCreated, res)
+}
+
+// Patch godoc
+// @Summary Partially updates a model
+// @Tags Model v2
+// @Accept json,application/msgpack,application/cbor,xml
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
+// @Param model body models.Model true "Fields to update"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v2/models/{id} [patch]
+func (c *controller) Patch(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	var m models.Model
+	if err := render.Bind(ctx, &m); err != nil {
+		logger.Error(err)
+		return err
+	}
+	if m.IsNil() {
+		return apperrors.InvalidArgument(apperrors.CodeNoFieldsToUpdate, "You require at least one field to update")
+	}
+	if err := m.ValidatePartial(); err != nil {
+		return err
+	}
+
+	res, err := c.s.Update(rctx, ctx.Params("id"), &m)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return respond(ctx, fiber.StatusOK, res)
+}
+
+// Replace godoc
+// @Summary Replaces a model
+// @Tags Model v2
+// @Accept json,application/msgpack,application/cbor,xml
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
+// @Param model body models.Model true "Model"
+// @Success 200 {object} models.Response
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /v2/models/{id} [put]
+func (c *controller) Replace(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	var m models.Model
+	if err := render.Bind(ctx, &m); err != nil {
+		logger.Error(err)
+		return err
+	}
+	// A replacement must be a complete, valid model
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	res, err := c.s.Replace(rctx, ctx.Params("id"), &m)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return respond(ctx, fiber.StatusOK, res)
+}
+
+// Delete godoc
+// @Summary Deletes a model
+// @Tags Model v2
+// @Param id path string true "Model ID"
+// @Success 204
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /v2/models/{id} [delete]
+func (c *controller) Delete(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	_, err := c.s.Delete(rctx, ctx.Params("id"))
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// History godoc
+// @Summary Gets the audit history of a model
+// @Tags Model v2
+// @Produce json,application/msgpack,application/cbor,xml
+// @Param id path string true "Model ID"
+// @Param page query int false "Page, defaults to 1"
+// @Param limit query int false "Limit, defaults to 30"
+// @Success 200 {object} models.Response{data=[]audit.Entry}
+// @Failure 400 {object} problem.Problem
+// @Router /v2/models/{id}/history [get]
+func (c *controller) History(ctx *fiber.Ctx) error {
+	rctx := utils.Context(ctx)
+	logger := logging.FromContext(rctx)
+
+	res, err := c.s.History(rctx, ctx.Params("id"), ctx.Query("page"), ctx.Query("limit"))
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	return respond(ctx, fiber.StatusOK, res)
+}
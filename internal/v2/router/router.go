@@ -0,0 +1,88 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sizzlorox/go-service-boilerplate/internal/audit"
+	"github.com/sizzlorox/go-service-boilerplate/internal/openapi"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/models"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v2/controllers"
+)
+
+func LoadRoutes(v2 fiber.Router, s services.Service) {
+	// Initialize Controller
+	c := controllers.NewController(s)
+
+	// Register Routes and Handlers
+	models := v2.Group("/models")
+	models.Get("/", c.List)
+	models.Post("/", c.Create)
+	models.Get("/:id", c.Get)
+	models.Patch("/:id", c.Patch)
+	models.Put("/:id", c.Replace)
+	models.Delete("/:id", c.Delete)
+	models.Get("/:id/history", c.History)
+}
+
+// envelope describes a models.Response carrying data
+func envelope(description string, data interface{}) openapi.Body {
+	return openapi.Body{Description: description, Value: models.Response{}, Fields: map[string]interface{}{"data": data}}
+}
+
+// Operations Describes the routes of LoadRoutes, keyed by their path under the version
+func Operations() openapi.Operations {
+	tags := []string{"Model v2"}
+	page := openapi.Param{Name: "page", In: "query", Description: "Page, defaults to 1", Value: 0}
+	limit := openapi.Param{Name: "limit", In: "query", Description: "Limit, defaults to 30", Value: 0}
+	ifNoneMatch := openapi.Param{Name: fiber.HeaderIfNoneMatch, In: "header", Description: "ETag of a previous response"}
+	ifModifiedSince := openapi.Param{Name: fiber.HeaderIfModifiedSince, In: "header", Description: "Last-Modified of a previous response"}
+	notModified := openapi.Body{Description: "Not Modified"}
+	message := openapi.Body{Description: "OK", Value: models.Response{}}
+	created := envelope("Created", models.CreateResponse{})
+	created.Headers = []string{fiber.HeaderLocation}
+
+	return openapi.Operations{
+		"GET /models": {
+			Summary:   "Lists models",
+			Tags:      tags,
+			Params:    []openapi.Param{page, limit, ifNoneMatch},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Models", []models.Model{}), fiber.StatusNotModified: notModified},
+		},
+		"POST /models": {
+			Summary:   "Creates a model",
+			Tags:      tags,
+			Body:      &openapi.Body{Description: "Model", Value: models.Model{}},
+			Responses: map[int]openapi.Body{fiber.StatusCreated: created},
+		},
+		"GET /models/{id}": {
+			Summary:   "Gets a model",
+			Tags:      tags,
+			Params:    []openapi.Param{ifNoneMatch, ifModifiedSince},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Model", models.Model{}), fiber.StatusNotModified: notModified},
+		},
+		"PATCH /models/{id}": {
+			Summary:   "Partially updates a model",
+			Tags:      tags,
+			Body:      &openapi.Body{Description: "Fields to update", Value: models.Model{}},
+			Partial:   true,
+			Responses: map[int]openapi.Body{fiber.StatusOK: message},
+		},
+		"PUT /models/{id}": {
+			Summary:   "Replaces a model",
+			Tags:      tags,
+			Body:      &openapi.Body{Description: "Model", Value: models.Model{}},
+			Responses: map[int]openapi.Body{fiber.StatusOK: message},
+		},
+		"DELETE /models/{id}": {
+			Summary:   "Deletes a model",
+			Tags:      tags,
+			Responses: map[int]openapi.Body{fiber.StatusNoContent: {}},
+		},
+		"GET /models/{id}/history": {
+			Summary:   "Gets the audit history of a model",
+			Tags:      tags,
+			Params:    []openapi.Param{page, limit},
+			Responses: map[int]openapi.Body{fiber.StatusOK: envelope("Audit entries", []audit.Entry{})},
+		},
+	}
+}
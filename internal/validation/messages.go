@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+)
+
+// fallback Is the template of rules without a message of their own
+const fallback = "fallback"
+
+// languages Are the languages messages are translated to, the first is the default
+var languages = []language.Tag{language.English, language.French, language.Spanish, language.German}
+
+var matcher = language.NewMatcher(languages)
+
+// messages Are the templates of each language by rule, {field} and {param} are replaced
+var messages = map[language.Tag]map[string]string{
+	language.English: {
+		"required": "{field} is required",
+		"notblank": "{field} must not be blank",
+		"email":    "{field} must be a valid email address",
+		"url":      "{field} must be a valid URL",
+		"uuid":     "{field} must be a valid UUID",
+		"min":      "{field} must be at least {param}",
+		"max":      "{field} must be at most {param}",
+		"len":      "{field} must have a length of {param}",
+		"oneof":    "{field} must be one of {param}",
+		"enum":     "{field} must be one of {param}",
+		"gt":       "{field} must be greater than {param}",
+		"gte":      "{field} must be greater than or equal to {param}",
+		"lt":       "{field} must be less than {param}",
+		"lte":      "{field} must be less than or equal to {param}",
+		"eqfield":  "{field} must be equal to {param}",
+		"nefield":  "{field} must be different from {param}",
+		"gtfield":  "{field} must be greater than {param}",
+		"ltfield":  "{field} must be less than {param}",
+		"unique":   "{field} is already taken",
+		"type":     "{field} must be of type {param}",
+		"format":   "{field} must be formatted as {param}",
+		fallback:   "{field} is invalid",
+	},
+	language.French: {
+		"required": "{field} est obligatoire",
+		"notblank": "{field} ne doit pas être vide",
+		"email":    "{field} doit être une adresse e-mail valide",
+		"url":      "{field} doit être une URL valide",
+		"uuid":     "{field} doit être un UUID valide",
+		"min":      "{field} doit être au moins {param}",
+		"max":      "{field} doit être au plus {param}",
+		"len":      "{field} doit avoir une longueur de {param}",
+		"oneof":    "{field} doit être l'une des valeurs {param}",
+		"enum":     "{field} doit être l'une des valeurs {param}",
+		"gt":       "{field} doit être supérieur à {param}",
+		"gte":      "{field} doit être supérieur ou égal à {param}",
+		"lt":       "{field} doit être inférieur à {param}",
+		"lte":      "{field} doit être inférieur ou égal à {param}",
+		"eqfield":  "{field} doit être égal à {param}",
+		"nefield":  "{field} doit être différent de {param}",
+		"gtfield":  "{field} doit être supérieur à {param}",
+		"ltfield":  "{field} doit être inférieur à {param}",
+		"unique":   "{field} est déjà utilisé",
+		"type":     "{field} doit être de type {param}",
+		"format":   "{field} doit être au format {param}",
+		fallback:   "{field} est invalide",
+	},
+	language.Spanish: {
+		"required": "{field} es obligatorio",
+		"notblank": "{field} no debe estar en blanco",
+		"email":    "{field} debe ser una dirección de correo válida",
+		"url":      "{field} debe ser una URL válida",
+		"uuid":     "{field} debe ser un UUID válido",
+		"min":      "{field} debe ser al menos {param}",
+		"max":      "{field} debe ser como máximo {param}",
+		"len":      "{field} debe tener una longitud de {param}",
+		"oneof":    "{field} debe ser uno de {param}",
+		"enum":     "{field} debe ser uno de {param}",
+		"gt":       "{field} debe ser mayor que {param}",
+		"gte":      "{field} debe ser mayor o igual que {param}",
+		"lt":       "{field} debe ser menor que {param}",
+		"lte":      "{field} debe ser menor o igual que {param}",
+		"eqfield":  "{field} debe ser igual a {param}",
+		"nefield":  "{field} debe ser distinto de {param}",
+		"gtfield":  "{field} debe ser mayor que {param}",
+		"ltfield":  "{field} debe ser menor que {param}",
+		"unique":   "{field} ya está en uso",
+		"type":     "{field} debe ser de tipo {param}",
+		"format":   "{field} debe tener el formato {param}",
+		fallback:   "{field} no es válido",
+	},
+	language.German: {
+		"required": "{field} ist erforderlich",
+		"notblank": "{field} darf nicht leer sein",
+		"email":    "{field} muss eine gültige E-Mail-Adresse sein",
+		"url":      "{field} muss eine gültige URL sein",
+		"uuid":     "{field} muss eine gültige UUID sein",
+		"min":      "{field} muss mindestens {param} sein",
+		"max":      "{field} darf höchstens {param} sein",
+		"len":      "{field} muss die Länge {param} haben",
+		"oneof":    "{field} muss einer der Werte {param} sein",
+		"enum":     "{field} muss einer der Werte {param} sein",
+		"gt":       "{field} muss größer als {param} sein",
+		"gte":      "{field} muss größer oder gleich {param} sein",
+		"lt":       "{field} muss kleiner als {param} sein",
+		"lte":      "{field} muss kleiner oder gleich {param} sein",
+		"eqfield":  "{field} muss gleich {param} sein",
+		"nefield":  "{field} muss sich von {param} unterscheiden",
+		"gtfield":  "{field} muss größer als {param} sein",
+		"ltfield":  "{field} muss kleiner als {param} sein",
+		"unique":   "{field} ist bereits vergeben",
+		"type":     "{field} muss vom Typ {param} sein",
+		"format":   "{field} muss das Format {param} haben",
+		fallback:   "{field} ist ungültig",
+	},
+}
+
+/*
+* PUBLIC
+ */
+
+// Language Returns the supported language best matching an Accept-Language header, English when
+// none does
+func Language(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return languages[0]
+	}
+	_, i, _ := matcher.Match(tags...)
+	return languages[i]
+}
+
+// Localize Returns a copy of fields whose missing messages are written in the language best
+// matching acceptLanguage, messages already set are kept
+func Localize(fields []apperrors.FieldError, acceptLanguage string) ([]apperrors.FieldError, language.Tag) {
+	tag := Language(acceptLanguage)
+	if len(fields) == 0 {
+		return fields, tag
+	}
+
+	templates := messages[tag]
+	localized := make([]apperrors.FieldError, len(fields))
+	for i, f := range fields {
+		localized[i] = f
+		if len(f.Message) != 0 {
+			continue
+		}
+		template, ok := templates[f.Rule]
+		if !ok {
+			template = templates[fallback]
+		}
+		localized[i].Message = strings.NewReplacer("{field}", f.Field, "{param}", f.Param).Replace(template)
+	}
+	return localized, tag
+}
@@ -0,0 +1,244 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+)
+
+// Check Is a rule beyond the struct tags, such as a datastore lookup. It returns the fields it
+// failed, or an error such as a conflict which is returned as is
+type Check func(ctx context.Context) ([]apperrors.FieldError, error)
+
+// StructRule Is a rule comparing fields of the given types, failures are reported with
+// validator.StructLevel.ReportError using the JSON name of the field
+type StructRule struct {
+	Func  validator.StructLevelFunc
+	Types []interface{}
+}
+
+// Config Is the validator config
+type Config struct {
+	// Rules are custom tags, their func may compare fields through validator.FieldLevel.Parent
+	Rules       map[string]validator.Func
+	StructRules []StructRule
+}
+
+// Validator Checks payloads against their `validate` struct tags, failed fields are named by
+// their JSON path, e.g. address.city or tags[0]
+type Validator interface {
+	// Struct checks every field of s, then runs the checks concurrently once the tags pass
+	Struct(ctx context.Context, s interface{}, checks ...Check) error
+	// Partial is Struct for updates, only the fields of s that are set are checked
+	Partial(ctx context.Context, s interface{}, checks ...Check) error
+}
+
+type validate struct {
+	v *validator.Validate
+}
+
+// shared Is the validator of Default, built on first use
+var (
+	sharedOnce sync.Once
+	shared     Validator
+)
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewValidator Will build a validator, it caches the metadata of every struct type it checks so
+// it is meant to be shared
+func NewValidator(config *Config) Validator {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonName)
+	if err := v.RegisterValidation("notblank", notBlank); err != nil {
+		panic(err)
+	}
+	for tag, fn := range config.Rules {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			panic(fmt.Sprintf("validation: rule %s: %v", tag, err))
+		}
+	}
+	for _, rule := range config.StructRules {
+		v.RegisterStructValidation(rule.Func, rule.Types...)
+	}
+	return &validate{v: v}
+}
+
+/*
+* PRIVATE
+ */
+
+// jsonName names fields by their json tag, fields left out of JSON are skipped
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// notBlank fails strings made only of whitespace, unlike required which accepts them
+func notBlank(fl validator.FieldLevel) bool {
+	if fl.Field().Kind() != reflect.String {
+		return true
+	}
+	return len(strings.TrimSpace(fl.Field().String())) != 0
+}
+
+// path drops the struct name the namespace starts with, e.g. Model.address.city is address.city
+func path(namespace string) string {
+	if _, rest, ok := strings.Cut(namespace, "."); ok {
+		return rest
+	}
+	return namespace
+}
+
+// unset returns the top level fields of s holding their zero value
+func unset(s interface{}) map[string]bool {
+	v := reflect.Indirect(reflect.ValueOf(s))
+	fields := map[string]bool{}
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			fields[v.Type().Field(i).Name] = true
+		}
+	}
+	return fields
+}
+
+// run checks s, filter skips the fields whose struct namespace it returns true for
+func (v *validate) run(ctx context.Context, s interface{}, filter validator.FilterFunc, checks []Check) error {
+	var err error
+	if filter == nil {
+		err = v.v.StructCtx(ctx, s)
+	} else {
+		err = v.v.StructFilteredCtx(ctx, s, filter)
+	}
+	if err != nil {
+		verrs, ok := err.(validator.ValidationErrors)
+		if !ok {
+			return apperrors.Internal(err)
+		}
+		fields := make([]apperrors.FieldError, 0, len(verrs))
+		for _, e := range verrs {
+			fields = append(fields, apperrors.FieldError{
+				Field: path(e.Namespace()),
+				Rule:  e.Tag(),
+				Param: e.Param(),
+			})
+		}
+		return failed(s, fields)
+	}
+
+	fields, err := runChecks(ctx, checks)
+	if err != nil {
+		return err
+	}
+	if len(fields) != 0 {
+		return failed(s, fields)
+	}
+	return nil
+}
+
+// failed names the validation error after the type of s, e.g. Model failed validation
+func failed(s interface{}, fields []apperrors.FieldError) error {
+	t := reflect.TypeOf(s)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return apperrors.Validation(t.Name()+" failed validation", fields)
+}
+
+// runChecks runs checks concurrently, failed fields keep the order of the checks. The first
+// error cancels the others
+func runChecks(ctx context.Context, checks []Check) ([]apperrors.FieldError, error) {
+	results := make([][]apperrors.FieldError, len(checks))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, check := range checks {
+		i, check := i, check
+		g.Go(func() error {
+			fields, err := check(gctx)
+			results[i] = fields
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	fields := []apperrors.FieldError{}
+	for _, r := range results {
+		fields = append(fields, r...)
+	}
+	return fields, nil
+}
+
+/*
+* PUBLIC
+ */
+
+func (v *validate) Struct(ctx context.Context, s interface{}, checks ...Check) error {
+	return v.run(ctx, s, nil, checks)
+}
+
+func (v *validate) Partial(ctx context.Context, s interface{}, checks ...Check) error {
+	zero := unset(s)
+	return v.run(ctx, s, func(ns []byte) bool {
+		// The namespace is Type.Field or Type.Field.Nested, nested fields follow their parent
+		field, _, _ := strings.Cut(path(string(ns)), ".")
+		field, _, _ = strings.Cut(field, "[")
+		return zero[field]
+	}, checks)
+}
+
+// Run Will run checks concurrently outside of a struct validation, failed fields are returned
+// as a validation error with message
+func Run(ctx context.Context, message string, checks ...Check) error {
+	fields, err := runChecks(ctx, checks)
+	if err != nil {
+		return err
+	}
+	if len(fields) != 0 {
+		return apperrors.Validation(message, fields)
+	}
+	return nil
+}
+
+// Unique Returns a check failing field with a conflict when exists finds the value taken. Only
+// a unique index makes this safe from concurrent writes, the check reports the field early
+func Unique(field string, code string, message string, exists func(ctx context.Context) (bool, error)) Check {
+	return func(ctx context.Context) ([]apperrors.FieldError, error) {
+		taken, err := exists(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			e := apperrors.Conflict(code, message)
+			e.Fields = []apperrors.FieldError{{Field: field, Rule: "unique"}}
+			return nil, e
+		}
+		return nil, nil
+	}
+}
+
+// Default Returns the shared validator without custom rules
+func Default() Validator {
+	sharedOnce.Do(func() {
+		shared = NewValidator(&Config{})
+	})
+	return shared
+}
@@ -0,0 +1,190 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/apperrors"
+	"github.com/sizzlorox/go-service-boilerplate/internal/validation"
+)
+
+type Address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type Booking struct {
+	Name    string    `json:"name" validate:"required,notblank"`
+	Email   string    `json:"email,omitempty" validate:"omitempty,email"`
+	Seats   int       `json:"seats" validate:"gte=0"`
+	Tags    []string  `json:"tags" validate:"dive,min=2"`
+	Address *Address  `json:"address" validate:"omitempty"`
+	From    time.Time `json:"from"`
+	Until   time.Time `json:"until" validate:"omitempty,after=From"`
+	Secret  string    `json:"-" validate:"required"`
+}
+
+// newValidator Returns a validator with an after rule comparing dates and a struct rule
+// limiting group bookings to 10 seats
+func newValidator() validation.Validator {
+	return validation.NewValidator(&validation.Config{
+		Rules: map[string]validator.Func{
+			"after": func(fl validator.FieldLevel) bool {
+				other := fl.Parent().FieldByName(fl.Param())
+				return fl.Field().Interface().(time.Time).After(other.Interface().(time.Time))
+			},
+		},
+		StructRules: []validation.StructRule{{
+			Func: func(sl validator.StructLevel) {
+				b := sl.Current().Interface().(Booking)
+				if len(b.Tags) != 0 && b.Seats > 10 {
+					sl.ReportError(b.Seats, "seats", "Seats", "lte", "10")
+				}
+			},
+			Types: []interface{}{Booking{}},
+		}},
+	})
+}
+
+func fieldsOf(t *testing.T, err error) []apperrors.FieldError {
+	e, ok := apperrors.As(err)
+	require.True(t, ok, "expected a domain error, got %v", err)
+	return e.Fields
+}
+
+/*
+	TESTS
+*/
+
+func TestStruct(t *testing.T) {
+	v := newValidator()
+	now := time.Now()
+
+	tests := []struct {
+		description string
+		booking     Booking
+		fields      []apperrors.FieldError
+	}{
+		{description: "Valid", booking: Booking{Name: "Bob", Secret: "s"}},
+		{description: "Required", booking: Booking{Secret: "s"}, fields: []apperrors.FieldError{{Field: "name", Rule: "required"}}},
+		{description: "Blank", booking: Booking{Name: "  ", Secret: "s"}, fields: []apperrors.FieldError{{Field: "name", Rule: "notblank"}}},
+		{description: "Param", booking: Booking{Name: "Bob", Seats: -1, Secret: "s"}, fields: []apperrors.FieldError{{Field: "seats", Rule: "gte", Param: "0"}}},
+		{description: "Slice", booking: Booking{Name: "Bob", Tags: []string{"ok", "x"}, Secret: "s"}, fields: []apperrors.FieldError{{Field: "tags[1]", Rule: "min", Param: "2"}}},
+		{description: "Nested", booking: Booking{Name: "Bob", Address: &Address{}, Secret: "s"}, fields: []apperrors.FieldError{{Field: "address.city", Rule: "required"}}},
+		{description: "Cross field", booking: Booking{Name: "Bob", From: now, Until: now.Add(-time.Hour), Secret: "s"}, fields: []apperrors.FieldError{{Field: "until", Rule: "after", Param: "From"}}},
+		{description: "Struct rule", booking: Booking{Name: "Bob", Seats: 11, Tags: []string{"group"}, Secret: "s"}, fields: []apperrors.FieldError{{Field: "seats", Rule: "lte", Param: "10"}}},
+		{description: "Field left out of JSON", booking: Booking{Name: "Bob"}, fields: []apperrors.FieldError{{Field: "Secret", Rule: "required"}}},
+	}
+	for _, test := range tests {
+		err := v.Struct(context.Background(), test.booking)
+		if test.fields == nil {
+			assert.Nil(t, err, test.description)
+			continue
+		}
+		assert.Equal(t, apperrors.KindValidation, apperrors.KindOf(err), test.description)
+		assert.Equal(t, "Booking failed validation", err.(*apperrors.Error).Message, test.description)
+		assert.Equal(t, test.fields, fieldsOf(t, err), test.description)
+	}
+}
+
+func TestPartial(t *testing.T) {
+	v := newValidator()
+
+	// Fields left out of a patch are not required
+	assert.Nil(t, v.Partial(context.Background(), Booking{Seats: 2}))
+	assert.Nil(t, v.Partial(context.Background(), &Booking{Email: "bob@bob.com"}))
+
+	// Fields that are set are still checked, nested ones included
+	err := v.Partial(context.Background(), Booking{Email: "bob"})
+	assert.Equal(t, []apperrors.FieldError{{Field: "email", Rule: "email"}}, fieldsOf(t, err))
+	err = v.Partial(context.Background(), Booking{Address: &Address{}, Tags: []string{"x"}})
+	assert.ElementsMatch(t, []apperrors.FieldError{
+		{Field: "tags[0]", Rule: "min", Param: "2"},
+		{Field: "address.city", Rule: "required"},
+	}, fieldsOf(t, err))
+}
+
+func TestChecks(t *testing.T) {
+	v := newValidator()
+	booking := Booking{Name: "Bob", Email: "bob@bob.com", Secret: "s"}
+
+	// Checks run concurrently and report their fields in order
+	var running int32
+	started := make(chan struct{})
+	wait := func(field string) validation.Check {
+		return func(ctx context.Context) ([]apperrors.FieldError, error) {
+			if atomic.AddInt32(&running, 1) == 2 {
+				close(started)
+			}
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				return nil, errors.New("checks ran one after the other")
+			}
+			return []apperrors.FieldError{{Field: field, Rule: "available"}}, nil
+		}
+	}
+	err := v.Struct(context.Background(), booking, wait("name"), wait("seats"))
+	assert.Equal(t, []apperrors.FieldError{{Field: "name", Rule: "available"}, {Field: "seats", Rule: "available"}}, fieldsOf(t, err))
+
+	// Checks only run once the tags pass
+	ran := false
+	check := func(ctx context.Context) ([]apperrors.FieldError, error) {
+		ran = true
+		return nil, nil
+	}
+	assert.NotNil(t, v.Struct(context.Background(), Booking{}, check))
+	assert.False(t, ran)
+
+	// A taken value is a conflict naming the field
+	taken := validation.Unique("email", apperrors.CodeModelAlreadyExists, "Booking Already Exists", func(ctx context.Context) (bool, error) {
+		return true, nil
+	})
+	err = v.Struct(context.Background(), booking, taken)
+	assert.Equal(t, apperrors.KindConflict, apperrors.KindOf(err))
+	assert.Equal(t, []apperrors.FieldError{{Field: "email", Rule: "unique"}}, fieldsOf(t, err))
+
+	free := validation.Unique("email", apperrors.CodeModelAlreadyExists, "Booking Already Exists", func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	assert.Nil(t, validation.Run(context.Background(), "Booking failed validation", free))
+}
+
+func TestLocalize(t *testing.T) {
+	fields := []apperrors.FieldError{
+		{Field: "name", Rule: "required"},
+		{Field: "seats", Rule: "gte", Param: "0"},
+		{Field: "until", Rule: "after", Param: "From"},
+		{Field: "email", Rule: "email", Message: "kept as is"},
+	}
+
+	tests := []struct {
+		description    string
+		acceptLanguage string
+		tag            language.Tag
+		messages       []string
+	}{
+		{"No header", "", language.English, []string{"name is required", "seats must be greater than or equal to 0", "until is invalid", "kept as is"}},
+		{"French", "fr-CA,fr;q=0.9,en;q=0.8", language.French, []string{"name est obligatoire", "seats doit être supérieur ou égal à 0", "until est invalide", "kept as is"}},
+		{"Preferred supported language", "ja,de;q=0.5", language.German, []string{"name ist erforderlich", "seats muss größer oder gleich 0 sein", "until ist ungültig", "kept as is"}},
+		{"Unsupported", "ja", language.English, []string{"name is required", "seats must be greater than or equal to 0", "until is invalid", "kept as is"}},
+		{"Malformed", ";;q=x", language.English, []string{"name is required", "seats must be greater than or equal to 0", "until is invalid", "kept as is"}},
+	}
+	for _, test := range tests {
+		localized, tag := validation.Localize(fields, test.acceptLanguage)
+		assert.Equal(t, test.tag, tag, test.description)
+		messages := []string{}
+		for _, f := range localized {
+			messages = append(messages, f.Message)
+		}
+		assert.Equal(t, test.messages, messages, test.description)
+	}
+	assert.Empty(t, fields[0].Message, "fields are copied")
+}
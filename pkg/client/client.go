@@ -0,0 +1,252 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Doer Sends HTTP requests, *http.Client is one
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Config Is the client config
+type Config struct {
+	// BaseURL is where the service is served, e.g. http://localhost:8080
+	BaseURL string
+	// HTTPClient defaults to an *http.Client with a 30s timeout
+	HTTPClient Doer
+	// Token returns the bearer token sent with each attempt, so it may be refreshed between them
+	Token func(ctx context.Context) (string, error)
+	// Username and Password are sent as basic credentials when there is no Token
+	Username string
+	Password string
+	// Retries is how many times a request failing with a network error, 429 or 5xx is retried,
+	// defaults to 3 and negative disables retries
+	Retries int
+	// Backoff is the delay before the first retry which doubles on each retry, defaults to 200ms.
+	// A longer Retry-After from the server is honoured
+	Backoff time.Duration
+	// PollInterval is how often Bulk polls a background import, defaults to 1s
+	PollInterval time.Duration
+	// UserAgent defaults to go-service-boilerplate-client
+	UserAgent string
+}
+
+// Client Is a typed client of the models API. Writes are sent with an Idempotency-Key reused by
+// their retries, so the service applies each of them once
+type Client interface {
+	// List returns a page of models, oldest first. Zero page and limit use the service defaults
+	List(ctx context.Context, page int, limit int) ([]Model, error)
+	// Iterate returns an iterator over every model, fetched limit at a time
+	Iterate(ctx context.Context, limit int) *Iterator
+	Get(ctx context.Context, id string) (Model, error)
+	// Create returns the ID of the created model
+	Create(ctx context.Context, m ModelInput) (string, error)
+	// Update sets the non empty fields of m
+	Update(ctx context.Context, id string, m ModelInput) error
+	// Replace sets every field of m, which must be a valid model
+	Replace(ctx context.Context, id string, m ModelInput) error
+	Delete(ctx context.Context, id string) error
+	// Bulk creates models or updates the ones with the same email in one import, waiting for it
+	// to finish when the service runs it in the background. Rejected models are in the report
+	Bulk(ctx context.Context, ms []ModelInput) (Import, error)
+	GetImport(ctx context.Context, id string) (Import, error)
+}
+
+type client struct {
+	base   string
+	config Config
+}
+
+// request Is an API call, body is sent as is on every attempt
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	contentType string
+	body        []byte
+}
+
+// response Is a response with its body read
+type response struct {
+	*http.Response
+	body []byte
+}
+
+// envelope Is the body of successful responses
+type envelope struct {
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+/*
+* CONSTRUCTOR
+ */
+
+// NewClient Will initialize a client of the service at config.BaseURL
+func NewClient(config *Config) Client {
+	c := *config
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.Retries == 0 {
+		c.Retries = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = 200 * time.Millisecond
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if len(c.UserAgent) == 0 {
+		c.UserAgent = "go-service-boilerplate-client"
+	}
+	return &client{base: strings.TrimSuffix(c.BaseURL, "/"), config: c}
+}
+
+/*
+* PRIVATE
+ */
+
+// newKey returns a random Idempotency-Key
+func newKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// retryable reports whether an attempt may succeed when sent again
+func retryable(res *response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if e := decodeError(res); e.Code == CodeIdempotencyKeyInUse {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay asked for by a Retry-After in seconds
+func retryAfter(res *response) time.Duration {
+	if res == nil {
+		return 0
+	}
+	s, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || s < 0 {
+		return 0
+	}
+	return time.Duration(s) * time.Second
+}
+
+// attempt sends r once
+func (c *client) attempt(ctx context.Context, r request, key string) (*response, error) {
+	u := c.base + r.path
+	if len(r.query) != 0 {
+		u += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u, bytes.NewReader(r.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	if len(r.contentType) != 0 {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if len(key) != 0 {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	switch {
+	case c.config.Token != nil:
+		token, err := c.config.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case len(c.config.Username) != 0:
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	res, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{Response: res, body: body}, nil
+}
+
+// do sends r until it succeeds, fails with an error that is not retryable or runs out of
+// retries. Writes reuse one Idempotency-Key across their attempts
+func (c *client) do(ctx context.Context, r request) (*response, error) {
+	key := ""
+	if r.method != http.MethodGet {
+		key = newKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.attempt(ctx, r, key)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil && res.StatusCode < http.StatusBadRequest {
+			return res, nil
+		}
+		if attempt >= c.config.Retries || !retryable(res, err) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, decodeError(res)
+		}
+
+		delay := max(c.config.Backoff<<attempt, retryAfter(res))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// call sends r and decodes the data of its response into out, when out is not nil
+func (c *client) call(ctx context.Context, r request, out interface{}) error {
+	res, err := c.do(ctx, r)
+	if err != nil || out == nil || res.StatusCode == http.StatusNoContent {
+		return err
+	}
+	var env envelope
+	if err := json.Unmarshal(res.body, &env); err != nil {
+		return err
+	}
+	if len(env.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(env.Data, out)
+}
+
+// jsonRequest encodes v as the body of a request
+func jsonRequest(method string, path string, v interface{}) (request, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, contentType: "application/json", body: body}, nil
+}
@@ -0,0 +1,381 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sizzlorox/go-service-boilerplate/internal/cache"
+	"github.com/sizzlorox/go-service-boilerplate/internal/datastore"
+	"github.com/sizzlorox/go-service-boilerplate/internal/idempotency"
+	"github.com/sizzlorox/go-service-boilerplate/internal/jobs"
+	"github.com/sizzlorox/go-service-boilerplate/internal/problem"
+	"github.com/sizzlorox/go-service-boilerplate/internal/router"
+	"github.com/sizzlorox/go-service-boilerplate/internal/v1/services"
+	"github.com/sizzlorox/go-service-boilerplate/pkg/client"
+)
+
+// server Is the real app behind a proxy recording requests and failing the ones it is told to
+type server struct {
+	app *fiber.App
+	mu  sync.Mutex
+	// fail answers the next requests with these statuses, before they reach the app
+	fail []int
+	// lose answers the next requests with a 502 after the app handled them
+	lose     int
+	requests []*http.Request
+}
+
+func (s *server) Do(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+	return s.app.Test(req, -1)
+}
+
+func (s *server) proxy(ctx *fiber.Ctx) error {
+	s.mu.Lock()
+	var status int
+	if len(s.fail) != 0 {
+		status, s.fail = s.fail[0], s.fail[1:]
+	}
+	lose := s.lose > 0
+	if lose {
+		s.lose--
+	}
+	s.mu.Unlock()
+
+	if status != 0 {
+		ctx.Set("Retry-After", "0")
+		return fiber.NewError(status)
+	}
+	err := ctx.Next()
+	if lose {
+		return fiber.NewError(fiber.StatusBadGateway)
+	}
+	return err
+}
+
+// keys Returns the Idempotency-Key of every recorded request
+func (s *server) keys() []string {
+	keys := []string{}
+	for _, req := range s.requests {
+		keys = append(keys, req.Header.Get(client.IdempotencyKeyHeader))
+	}
+	return keys
+}
+
+func newServer(t *testing.T, syncRows int) *server {
+	r := datastore.NewMemoryDatastore()
+	r.EnsureIndexes("models", []string{"email"})
+	config := &jobs.Config{Workers: 1, PollInterval: 5 * time.Millisecond, Lease: time.Second, MaxAttempts: 1}
+	pool := jobs.NewPool(r, config)
+
+	s := &server{app: fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})}
+	s.app.Use(s.proxy)
+	api := s.app.Group("/api")
+	api.Use(idempotency.Middleware(cache.NewLRU(100), idempotency.Config{}))
+	router.LoadRoutes(api, r, jobs.NewQueue(r, config), pool, &router.Config{
+		Models: services.Config{ImportBatchSize: 2, ImportSyncRows: syncRows},
+	})
+
+	require.Nil(t, pool.Start(context.Background()))
+	t.Cleanup(func() {
+		pool.Stop(context.Background())
+	})
+	return s
+}
+
+func newClient(s *server) client.Client {
+	return client.NewClient(&client.Config{
+		BaseURL:      "http://service.test",
+		HTTPClient:   s,
+		Backoff:      time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	})
+}
+
+/*
+	TESTS
+*/
+
+func TestModels(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(newServer(t, 100))
+
+	id, err := c.Create(ctx, client.ModelInput{Name: "Bob", Email: "bob@bob.com"})
+	require.Nil(t, err)
+	m, err := c.Get(ctx, id)
+	require.Nil(t, err)
+	assert.Equal(t, "Bob", m.Name)
+	assert.False(t, m.CreatedAt.IsZero())
+
+	require.Nil(t, c.Update(ctx, id, client.ModelInput{Name: "Robert"}))
+	ms, err := c.List(ctx, 1, 10)
+	require.Nil(t, err)
+	require.Len(t, ms, 1)
+	assert.Equal(t, []string{id, "Robert", "bob@bob.com"}, []string{ms[0].ID, ms[0].Name, ms[0].Email})
+	require.Nil(t, c.Replace(ctx, id, client.ModelInput{Name: "Rob", Email: "rob@rob.com"}))
+	ms, _ = c.List(ctx, 1, 10)
+	assert.Equal(t, "rob@rob.com", ms[0].Email)
+
+	tests := []struct {
+		description string
+		call        func() error
+		sentinel    error
+		code        string
+	}{
+		{
+			description: "Invalid model",
+			call: func() error {
+				_, err := c.Create(ctx, client.ModelInput{Name: "Cid", Email: "cid"})
+				return err
+			},
+			sentinel: client.ErrInvalid,
+			code:     client.CodeValidationFailed,
+		},
+		{
+			description: "Duplicate email",
+			call: func() error {
+				_, err := c.Create(ctx, client.ModelInput{Name: "Robby", Email: "rob@rob.com"})
+				return err
+			},
+			sentinel: client.ErrConflict,
+			code:     client.CodeModelAlreadyExists,
+		},
+		{
+			description: "No fields",
+			call:        func() error { return c.Update(ctx, id, client.ModelInput{}) },
+			sentinel:    client.ErrInvalid,
+			code:        client.CodeNoFieldsToUpdate,
+		},
+		{
+			description: "Invalid ID",
+			call: func() error {
+				_, err := c.Get(ctx, "1")
+				return err
+			},
+			sentinel: client.ErrInvalid,
+			code:     client.CodeInvalidID,
+		},
+		{
+			description: "Default page",
+			call: func() error {
+				_, err := c.List(ctx, 0, 0)
+				return err
+			},
+		},
+		{description: "Delete", call: func() error { return c.Delete(ctx, id) }},
+		{
+			description: "Deleted",
+			call: func() error {
+				_, err := c.Get(ctx, id)
+				return err
+			},
+			sentinel: client.ErrNotFound,
+			code:     client.CodeModelNotFound,
+		},
+	}
+	for _, test := range tests {
+		err := test.call()
+		if test.sentinel == nil {
+			assert.Nil(t, err, test.description)
+			continue
+		}
+		assert.ErrorIs(t, err, test.sentinel, test.description)
+		assert.Equal(t, test.code, client.CodeOf(err), test.description)
+	}
+
+	_, err = c.Create(ctx, client.ModelInput{Name: "Cid", Email: "cid"})
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusBadRequest, e.Status)
+	assert.Equal(t, "Model failed validation", e.Detail)
+	assert.Equal(t, "email", e.Fields[0].Field)
+}
+
+func TestIterate(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, 100)
+	c := newClient(s)
+	names := []string{"Ann", "Bob", "Cid", "Dan", "Eve"}
+	for _, name := range names {
+		_, err := c.Create(ctx, client.ModelInput{Name: name, Email: name + "@models.com"})
+		require.Nil(t, err)
+	}
+
+	tests := []struct {
+		description string
+		limit       int
+		pages       int
+	}{
+		{description: "Short last page", limit: 2, pages: 3},
+		{description: "Full last page", limit: 5, pages: 2},
+		{description: "Default limit", limit: 0, pages: 1},
+	}
+	for _, test := range tests {
+		s.requests = nil
+		read := []string{}
+		it := c.Iterate(ctx, test.limit)
+		for it.Next() {
+			read = append(read, it.Model().Name)
+		}
+		require.Nil(t, it.Err(), test.description)
+		assert.Equal(t, names, read, test.description)
+		assert.Len(t, s.requests, test.pages, test.description)
+		assert.False(t, it.Next(), "Iterators stay done")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, 100)
+	c := newClient(s)
+
+	// Transient failures are retried
+	s.fail = []int{fiber.StatusServiceUnavailable, fiber.StatusTooManyRequests}
+	_, err := c.List(ctx, 1, 10)
+	assert.Nil(t, err)
+	assert.Len(t, s.requests, 3)
+
+	// A write whose response was lost is replayed, not applied twice
+	s.requests = nil
+	s.lose = 1
+	id, err := c.Create(ctx, client.ModelInput{Name: "Bob", Email: "bob@bob.com"})
+	require.Nil(t, err)
+	ms, _ := c.List(ctx, 1, 10)
+	require.Len(t, ms, 1)
+	assert.Equal(t, id, ms[0].ID)
+	keys := s.keys()
+	require.Len(t, keys, 3)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1], "Retries reuse the key")
+	assert.Empty(t, keys[2], "Reads have no key")
+
+	s.requests = nil
+	s.lose = 1
+	require.Nil(t, c.Delete(ctx, id))
+	assert.Len(t, s.requests, 2)
+
+	// Each write has its own key
+	s.requests = nil
+	_, err = c.Create(ctx, client.ModelInput{Name: "Ann", Email: "ann@ann.com"})
+	require.Nil(t, err)
+	_, err = c.Create(ctx, client.ModelInput{Name: "Ann", Email: "ann@ann.com"})
+	assert.ErrorIs(t, err, client.ErrConflict)
+	keys = s.keys()
+	assert.NotEqual(t, keys[0], keys[1])
+
+	// Client errors are not retried and retries run out
+	tests := []struct {
+		description string
+		fail        []int
+		requests    int
+		sentinel    error
+	}{
+		{description: "Client error", fail: []int{fiber.StatusForbidden}, requests: 1, sentinel: client.ErrForbidden},
+		{description: "Not implemented", fail: []int{fiber.StatusNotImplemented}, requests: 1},
+		{
+			description: "Out of retries",
+			fail:        []int{fiber.StatusServiceUnavailable, fiber.StatusServiceUnavailable, fiber.StatusServiceUnavailable, fiber.StatusServiceUnavailable},
+			requests:    4,
+			sentinel:    client.ErrUnavailable,
+		},
+	}
+	for _, test := range tests {
+		s.requests = nil
+		s.fail = test.fail
+		_, err := c.List(ctx, 1, 10)
+		require.NotNil(t, err, test.description)
+		if test.sentinel != nil {
+			assert.ErrorIs(t, err, test.sentinel, test.description)
+		}
+		assert.Len(t, s.requests, test.requests, test.description)
+	}
+
+	// Cancelled contexts stop retrying
+	s.requests = nil
+	s.fail = []int{fiber.StatusServiceUnavailable}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.List(cancelled, 1, 10)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, 100)
+	tokens := 0
+	c := client.NewClient(&client.Config{
+		BaseURL:    "http://service.test",
+		HTTPClient: s,
+		Backoff:    time.Millisecond,
+		Token: func(ctx context.Context) (string, error) {
+			tokens++
+			return "token", nil
+		},
+	})
+
+	s.fail = []int{fiber.StatusServiceUnavailable}
+	_, err := c.List(ctx, 1, 10)
+	require.Nil(t, err)
+	assert.Equal(t, 2, tokens, "Every attempt gets a token")
+	assert.Equal(t, "Bearer token", s.requests[1].Header.Get("Authorization"))
+
+	s.requests = nil
+	c = client.NewClient(&client.Config{BaseURL: "http://service.test", HTTPClient: s, Username: "a", Password: "b"})
+	_, err = c.List(ctx, 1, 10)
+	require.Nil(t, err)
+	user, pwd, ok := s.requests[0].BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b"}, []string{user, pwd})
+
+	c = client.NewClient(&client.Config{
+		BaseURL:    "http://service.test",
+		HTTPClient: s,
+		Retries:    -1,
+		Token: func(ctx context.Context) (string, error) {
+			return "", errors.New("token expired")
+		},
+	})
+	_, err = c.List(ctx, 1, 10)
+	assert.EqualError(t, err, "token expired")
+}
+
+func TestBulk(t *testing.T) {
+	ctx := context.Background()
+	input := []client.ModelInput{
+		{Name: "Ann", Email: "ann@ann.com"},
+		{Name: "Bob", Email: "bob@bob.com"},
+		{Name: "Cid", Email: "cid"},
+		{Name: "Annie", Email: "ann@ann.com"},
+	}
+
+	tests := []struct {
+		description string
+		syncRows    int
+	}{
+		{description: "During the request", syncRows: 100},
+		{description: "In the background", syncRows: 1},
+	}
+	for _, test := range tests {
+		c := newClient(newServer(t, test.syncRows))
+		imp, err := c.Bulk(ctx, input)
+		require.Nil(t, err, test.description)
+		assert.Equal(t, client.ImportSucceeded, imp.Status, test.description)
+		assert.Equal(t, []int{4, 2, 1, 1}, []int{imp.Total, imp.Created, imp.Updated, imp.Failed}, test.description)
+		require.Len(t, imp.Errors, 1, test.description)
+		assert.Equal(t, 3, imp.Errors[0].Line, test.description)
+
+		ms, err := c.List(ctx, 1, 10)
+		require.Nil(t, err)
+		assert.Len(t, ms, 2, test.description)
+	}
+}
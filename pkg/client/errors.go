@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IdempotencyKeyHeader is the header writes send their Idempotency-Key in
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Stable codes of the errors the service returns, see Error.Code
+const (
+	CodeInvalidArgument     = "INVALID_ARGUMENT"
+	CodeInvalidID           = "INVALID_ID"
+	CodeInvalidPagination   = "INVALID_PAGINATION"
+	CodeInvalidBody         = "INVALID_BODY"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeNoFieldsToUpdate    = "NO_FIELDS_TO_UPDATE"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeModelNotFound       = "MODEL_NOT_FOUND"
+	CodeModelAlreadyExists  = "MODEL_ALREADY_EXISTS"
+	CodeImportNotFound      = "IMPORT_NOT_FOUND"
+	CodeIdempotencyKeyInUse = "IDEMPOTENCY_KEY_IN_USE"
+	CodeUnavailable         = "SERVICE_UNAVAILABLE"
+	CodeInternal            = "INTERNAL_ERROR"
+)
+
+// Sentinels matching any Error of their status with errors.Is
+var (
+	ErrInvalid      = &Error{Status: http.StatusBadRequest}
+	ErrUnauthorized = &Error{Status: http.StatusUnauthorized}
+	ErrForbidden    = &Error{Status: http.StatusForbidden}
+	ErrNotFound     = &Error{Status: http.StatusNotFound}
+	ErrConflict     = &Error{Status: http.StatusConflict}
+	ErrUnavailable  = &Error{Status: http.StatusServiceUnavailable}
+)
+
+// FieldError Is a field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Error Is an error response of the service, decoded from its RFC 7807 problem details
+type Error struct {
+	Status    int          `json:"status"`
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Detail    string       `json:"detail"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId"`
+	Fields    []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Title
+	if len(e.Detail) != 0 {
+		msg = e.Detail
+	}
+	if len(e.Code) != 0 {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Code, msg)
+	}
+	return fmt.Sprintf("%d: %s", e.Status, msg)
+}
+
+// Is Reports whether target is the sentinel of the status of e
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && len(t.Code) == 0 && t.Status == e.Status
+}
+
+/*
+* PRIVATE
+ */
+
+// decodeError maps an error response, bodies that are not problems keep their status and text
+func decodeError(res *response) *Error {
+	e := &Error{}
+	if err := json.Unmarshal(res.body, e); err != nil || e.Status == 0 {
+		e = &Error{Detail: strings.TrimSpace(string(res.body))}
+	}
+	e.Status = res.StatusCode
+	if len(e.Title) == 0 {
+		e.Title = http.StatusText(res.StatusCode)
+	}
+	return e
+}
+
+/*
+* PUBLIC
+ */
+
+// CodeOf Returns the stable code of an Error, or an empty string
+func CodeOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
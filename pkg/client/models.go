@@ -0,0 +1,205 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	modelsPath = "/api/v2/models"
+	importPath = "/api/v1/import"
+	// DefaultLimit is the page size of the service when none is given
+	DefaultLimit = 30
+)
+
+// Statuses of an Import
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportSucceeded = "succeeded"
+	// ImportFailed imports stopped on a service error, the service retries them from the start
+	ImportFailed = "failed"
+)
+
+// Model Is a stored model
+type Model struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ModelInput Is the fields of a model clients set, empty fields are left out
+type ModelInput struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Import Is the progress of a Bulk import and the report of its rejected models
+type Import struct {
+	ID         string        `json:"id"`
+	Format     string        `json:"format"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Created    int           `json:"created"`
+	Updated    int           `json:"updated"`
+	Failed     int           `json:"failed"`
+	Errors     []ImportError `json:"errors"`
+	Error      string        `json:"error"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+}
+
+// ImportError Is a rejected model of an import
+type ImportError struct {
+	// Line is the position of the model in the Bulk input, starting at 1
+	Line    int          `json:"line"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields"`
+}
+
+// Iterator Walks every model a page at a time, see Client.Iterate
+type Iterator struct {
+	ctx   context.Context
+	c     *client
+	limit int
+	page  int
+	items []Model
+	done  bool
+	err   error
+}
+
+/*
+* PUBLIC
+ */
+
+// Next Advances to the next model, fetching the next page when needed. It returns false once
+// every model was read or a page failed, see Err
+func (it *Iterator) Next() bool {
+	if len(it.items) > 1 {
+		it.items = it.items[1:]
+		return true
+	}
+	if it.done || it.err != nil {
+		it.items = nil
+		return false
+	}
+
+	it.page++
+	it.items, it.err = it.c.List(it.ctx, it.page, it.limit)
+	// A short page is the last one
+	it.done = len(it.items) < it.limit
+	return it.err == nil && len(it.items) != 0
+}
+
+// Model Returns the current model
+func (it *Iterator) Model() Model {
+	if len(it.items) == 0 {
+		return Model{}
+	}
+	return it.items[0]
+}
+
+// Err Returns the error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (c *client) List(ctx context.Context, page int, limit int) ([]Model, error) {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	ms := []Model{}
+	err := c.call(ctx, request{method: http.MethodGet, path: modelsPath, query: query}, &ms)
+	return ms, err
+}
+
+func (c *client) Iterate(ctx context.Context, limit int) *Iterator {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Iterator{ctx: ctx, c: c, limit: limit}
+}
+
+func (c *client) Get(ctx context.Context, id string) (Model, error) {
+	var m Model
+	err := c.call(ctx, request{method: http.MethodGet, path: modelsPath + "/" + url.PathEscape(id)}, &m)
+	return m, err
+}
+
+func (c *client) Create(ctx context.Context, m ModelInput) (string, error) {
+	r, err := jsonRequest(http.MethodPost, modelsPath, m)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		InsertedID string `json:"insertedId"`
+	}
+	err = c.call(ctx, r, &created)
+	return created.InsertedID, err
+}
+
+func (c *client) Update(ctx context.Context, id string, m ModelInput) error {
+	r, err := jsonRequest(http.MethodPatch, modelsPath+"/"+url.PathEscape(id), m)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, r, nil)
+}
+
+func (c *client) Replace(ctx context.Context, id string, m ModelInput) error {
+	r, err := jsonRequest(http.MethodPut, modelsPath+"/"+url.PathEscape(id), m)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, r, nil)
+}
+
+func (c *client) Delete(ctx context.Context, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: modelsPath + "/" + url.PathEscape(id)}, nil)
+}
+
+func (c *client) Bulk(ctx context.Context, ms []ModelInput) (Import, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, m := range ms {
+		if err := enc.Encode(m); err != nil {
+			return Import{}, err
+		}
+	}
+
+	var imp Import
+	err := c.call(ctx, request{
+		method:      http.MethodPost,
+		path:        importPath,
+		contentType: "application/x-ndjson",
+		body:        body.Bytes(),
+	}, &imp)
+	for err == nil && (imp.Status == ImportPending || imp.Status == ImportRunning) {
+		select {
+		case <-ctx.Done():
+			return imp, ctx.Err()
+		case <-time.After(c.config.PollInterval):
+		}
+		imp, err = c.GetImport(ctx, imp.ID)
+	}
+	return imp, err
+}
+
+func (c *client) GetImport(ctx context.Context, id string) (Import, error) {
+	var imp Import
+	err := c.call(ctx, request{method: http.MethodGet, path: importPath + "/" + url.PathEscape(id)}, &imp)
+	return imp, err
+}